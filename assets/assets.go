@@ -0,0 +1,9 @@
+package assets
+
+import "embed"
+
+// Fonts holds the DejaVu Sans font files used for generated documents. They cover Cyrillic,
+// which the core PDF fonts do not.
+//
+//go:embed fonts/*.ttf
+var Fonts embed.FS
@@ -8,3 +8,78 @@ const (
 	PharmacyMod   ModeratorType = "pharmacy"
 	MedicamentMod ModeratorType = "medicament"
 )
+
+type HospitalType string
+
+const (
+	Hospital HospitalType = "hospital"
+	Practice HospitalType = "practice"
+)
+
+type AffiliationRole string
+
+const (
+	AttendingPhysician  AffiliationRole = "attending"
+	ConsultantPhysician AffiliationRole = "consultant"
+	ResidentPhysician   AffiliationRole = "resident"
+	HeadOfDepartment    AffiliationRole = "head_of_department"
+	GeneralPractitioner AffiliationRole = "general_practitioner"
+)
+
+type DoseUnit string
+
+const (
+	Tablet      DoseUnit = "tablet"
+	Capsule     DoseUnit = "capsule"
+	Millilitre  DoseUnit = "ml"
+	Milligram   DoseUnit = "mg"
+	Drop        DoseUnit = "drop"
+	Puff        DoseUnit = "puff"
+	Sachet      DoseUnit = "sachet"
+	Application DoseUnit = "application"
+	DosageUnit  DoseUnit = "unit"
+)
+
+type AdministrationRoute string
+
+const (
+	OralRoute          AdministrationRoute = "oral"
+	SublingualRoute    AdministrationRoute = "sublingual"
+	TopicalRoute       AdministrationRoute = "topical"
+	InhalationRoute    AdministrationRoute = "inhalation"
+	NasalRoute         AdministrationRoute = "nasal"
+	OphthalmicRoute    AdministrationRoute = "ophthalmic"
+	OticRoute          AdministrationRoute = "otic"
+	RectalRoute        AdministrationRoute = "rectal"
+	VaginalRoute       AdministrationRoute = "vaginal"
+	SubcutaneousRoute  AdministrationRoute = "subcutaneous"
+	IntramuscularRoute AdministrationRoute = "intramuscular"
+	IntravenousRoute   AdministrationRoute = "intravenous"
+)
+
+type TimeOfDay string
+
+const (
+	Morning TimeOfDay = "morning"
+	Noon    TimeOfDay = "noon"
+	Evening TimeOfDay = "evening"
+	Bedtime TimeOfDay = "bedtime"
+)
+
+type RegistrationDecision string
+
+const (
+	ApproveRegistration        RegistrationDecision = "approve"
+	RejectRegistration         RegistrationDecision = "reject"
+	RequestRegistrationChanges RegistrationDecision = "request_changes"
+)
+
+type StockMovementType string
+
+const (
+	StockReceipt    StockMovementType = "receipt"
+	StockDispense   StockMovementType = "dispense"
+	StockAdjustment StockMovementType = "adjustment"
+	StockTransfer   StockMovementType = "transfer"
+	StockWriteOff   StockMovementType = "write_off"
+)
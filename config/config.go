@@ -1,6 +1,8 @@
 package config
 
 import (
+	"encoding/base64"
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
 	"time"
@@ -14,9 +16,13 @@ const (
 )
 
 const (
-	databaseConfigPath    = "./config/database.config.yml"
-	csrfStorageConfigPath = "./config/csrf.config.yml"
-	authSessionConfigPath = "./config/authSession.config.yml"
+	databaseConfigPath     = "./config/database.config.yml"
+	csrfStorageConfigPath  = "./config/csrf.config.yml"
+	authSessionConfigPath  = "./config/authSession.config.yml"
+	registryConfigPath     = "./config/registry.config.yml"
+	prescriptionConfigPath = "./config/prescription.config.yml"
+	mailConfigPath         = "./config/mail.config.yml"
+	stockConfigPath        = "./config/stock.config.yml"
 )
 
 type DatabaseConfig struct {
@@ -53,14 +59,64 @@ type AuthSessionConfig struct {
 	Expiration time.Duration `yaml:"expiration"`
 }
 
-func loadConfig(configPath string, out interface{}) {
+type RegistryConfig struct {
+	RecheckInterval time.Duration `yaml:"recheck_interval"`
+}
+
+// PrescriptionConfig holds the secrets prescriptions are verified and signed with. They are
+// best left out of the config file and given through the environment, which takes precedence.
+type PrescriptionConfig struct {
+	// VerificationSecret signs the QR payloads, MEDICO_VERIFICATION_SECRET overrides it
+	VerificationSecret string `yaml:"verification_secret"`
+	QrSize             int    `yaml:"qr_size"`
+	// SigningMasterKey is a base64 encoded 32 byte key sealing the doctors' private signing
+	// keys. It is only ever read from MEDICO_SIGNING_MASTER_KEY, never from the config file.
+	SigningMasterKey string `yaml:"-"`
+}
+
+// AuditConfig holds the key the audit log entries are hashed with. It is only ever read from
+// MEDICO_AUDIT_KEY, whoever can rewrite the database must not be able to rehash the log.
+type AuditConfig struct {
+	HashKey []byte
+}
+
+// MailConfig is the SMTP server notifications are sent through. Without a host the
+// notifications are only logged.
+type MailConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// StockConfig tunes how the stock of pharmacy branches is shown to citizens and owners
+type StockConfig struct {
+	// LowStockThreshold is the quantity at or below which a medicament counts as running low
+	LowStockThreshold uint `yaml:"low_stock_threshold"`
+	// ReservationHold is how long a reservation holds the stock before it expires
+	ReservationHold time.Duration `yaml:"reservation_hold"`
+	// ReservationSweepInterval is how often expired reservations release their stock
+	ReservationSweepInterval time.Duration `yaml:"reservation_sweep_interval"`
+	// ExpiryWarningDays is how many days ahead owners are shown the stock about to expire
+	ExpiryWarningDays uint `yaml:"expiry_warning_days"`
+	// ReorderVelocityDays is how many past days of dispensing the reorder suggestions are based on
+	ReorderVelocityDays uint `yaml:"reorder_velocity_days"`
+	// ReorderCoverDays is how many days of dispensing a reorder should cover at least
+	ReorderCoverDays uint `yaml:"reorder_cover_days"`
+}
+
+func readConfig(configPath string, out interface{}) error {
 	configFile, err := os.ReadFile(configPath)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	err = yaml.Unmarshal(configFile, out)
-	if err != nil {
+	return yaml.Unmarshal(configFile, out)
+}
+
+func loadConfig(configPath string, out interface{}) {
+	if err := readConfig(configPath, out); err != nil {
 		panic(err)
 	}
 }
@@ -88,3 +144,110 @@ func LoadAuthSessionConfig() *AuthSessionConfig {
 	loadConfig(authSessionConfigPath, &authSessionConfig)
 	return authSessionConfig
 }
+
+func LoadRegistryConfig() *RegistryConfig {
+	registryConfig := &RegistryConfig{}
+	loadConfig(registryConfigPath, registryConfig)
+	return registryConfig
+}
+
+// LoadPrescriptionConfig loads the prescription config, which CheckPrescriptionConfig has
+// validated at startup
+func LoadPrescriptionConfig() *PrescriptionConfig {
+	prescriptionConfig := &PrescriptionConfig{}
+	if err := readPrescriptionConfig(prescriptionConfig); err != nil {
+		panic(err)
+	}
+	return prescriptionConfig
+}
+
+// CheckPrescriptionConfig reports a missing or unusable prescription config, so that the
+// server refuses to start instead of failing when the services are built
+func CheckPrescriptionConfig() error {
+	prescriptionConfig := &PrescriptionConfig{}
+	if err := readPrescriptionConfig(prescriptionConfig); err != nil {
+		return fmt.Errorf("prescription config: %w", err)
+	}
+	return prescriptionConfig.validate()
+}
+
+const (
+	verificationSecretEnv       = "MEDICO_VERIFICATION_SECRET"
+	minVerificationSecretLength = 32
+	signingMasterKeyEnv         = "MEDICO_SIGNING_MASTER_KEY"
+	signingMasterKeyLength      = 32
+)
+
+func readPrescriptionConfig(prescriptionConfig *PrescriptionConfig) error {
+	if err := readConfig(prescriptionConfigPath, prescriptionConfig); err != nil {
+		return err
+	}
+
+	if secret, ok := os.LookupEnv(verificationSecretEnv); ok {
+		prescriptionConfig.VerificationSecret = secret
+	}
+	prescriptionConfig.SigningMasterKey = os.Getenv(signingMasterKeyEnv)
+
+	return nil
+}
+
+func (c *PrescriptionConfig) validate() error {
+	if len(c.VerificationSecret) < minVerificationSecretLength {
+		return fmt.Errorf("prescription config: verification secret must be a random value of at least %d characters, e.g. set through %s",
+			minVerificationSecretLength, verificationSecretEnv)
+	}
+
+	if c.QrSize <= 0 {
+		return fmt.Errorf("prescription config: qr_size must be a positive number of pixels, got %d", c.QrSize)
+	}
+
+	masterKey, err := base64.StdEncoding.DecodeString(c.SigningMasterKey)
+	if err != nil || len(masterKey) != signingMasterKeyLength {
+		return fmt.Errorf("prescription config: %s must be set to %d random bytes encoded as base64, e.g. `openssl rand -base64 32`",
+			signingMasterKeyEnv, signingMasterKeyLength)
+	}
+
+	return nil
+}
+
+const (
+	auditKeyEnv    = "MEDICO_AUDIT_KEY"
+	auditKeyLength = 32
+)
+
+// LoadAuditConfig loads the audit config, which CheckAuditConfig has validated at startup
+func LoadAuditConfig() *AuditConfig {
+	auditConfig := &AuditConfig{}
+	if err := readAuditConfig(auditConfig); err != nil {
+		panic(err)
+	}
+	return auditConfig
+}
+
+// CheckAuditConfig reports a missing or unusable audit key
+func CheckAuditConfig() error {
+	return readAuditConfig(&AuditConfig{})
+}
+
+func readAuditConfig(auditConfig *AuditConfig) error {
+	key, err := base64.StdEncoding.DecodeString(os.Getenv(auditKeyEnv))
+	if err != nil || len(key) != auditKeyLength {
+		return fmt.Errorf("audit config: %s must be set to %d random bytes encoded as base64, e.g. `openssl rand -base64 32`",
+			auditKeyEnv, auditKeyLength)
+	}
+
+	auditConfig.HashKey = key
+	return nil
+}
+
+func LoadMailConfig() *MailConfig {
+	mailConfig := &MailConfig{}
+	loadConfig(mailConfigPath, mailConfig)
+	return mailConfig
+}
+
+func LoadStockConfig() *StockConfig {
+	stockConfig := &StockConfig{}
+	loadConfig(stockConfigPath, stockConfig)
+	return stockConfig
+}
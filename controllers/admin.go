@@ -6,6 +6,7 @@ import (
 	"github.com/google/uuid"
 	"medico/dto"
 	"medico/models"
+	"medico/repo"
 	"medico/service"
 	"time"
 )
@@ -17,14 +18,30 @@ type AdminController interface {
 	GetModerators(ctx *fiber.Ctx) error
 	AddModerator(ctx *fiber.Ctx) error
 	DeleteModerator(ctx *fiber.Ctx) error
+	RestoreModerator(ctx *fiber.Ctx) error
+	UpdateModerator(ctx *fiber.Ctx) error
+	GetModeratorHistory(ctx *fiber.Ctx) error
+
+	PurgeDoctor(ctx *fiber.Ctx) error
+	PurgeCitizen(ctx *fiber.Ctx) error
+	PurgePharmacy(ctx *fiber.Ctx) error
+	PurgeMedicament(ctx *fiber.Ctx) error
+	PurgeModerator(ctx *fiber.Ctx) error
+
+	GetAuditEntries(ctx *fiber.Ctx) error
+	VerifyAudit(ctx *fiber.Ctx) error
 }
 
 type adminController struct {
-	service service.AdminService
+	service      service.AdminService
+	auditService service.AuditService
 }
 
 func NewAdminController() AdminController {
-	return &adminController{service: service.NewAdminService()}
+	return &adminController{
+		service:      service.NewAdminService(),
+		auditService: service.NewAuditService(),
+	}
 }
 
 func (c *adminController) Login(ctx *fiber.Ctx) error {
@@ -101,12 +118,22 @@ func (c *adminController) VerifySession(ctx *fiber.Ctx) error {
 }
 
 func (c *adminController) GetModerators(ctx *fiber.Ctx) error {
-	dtoModerators := new([]dto.ResponseAdminGetModerator)
+	query := new(dto.QueryAdminGetModerators)
 
-	if err := c.service.GetModerators(dtoModerators); err != nil {
+	if err := ctx.QueryParser(query); err != nil {
 		return err
 	}
 
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	dtoModerators := new(dto.ResponseList[dto.ResponseAdminGetModerator])
+
+	if err := c.service.GetModerators(query, dtoModerators); err != nil {
+		return listError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(dtoModerators)
 }
 
@@ -117,7 +144,7 @@ func (c *adminController) AddModerator(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	err := c.service.CreateModerator(newModerator)
+	err := c.service.CreateModerator(actor(ctx, "adminId", service.ActorAdmin), newModerator)
 	if err != nil {
 		return err
 	}
@@ -132,9 +159,133 @@ func (c *adminController) DeleteModerator(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	if err := c.service.DeleteModerator(moderatorId.ModeratorId); err != nil {
+	if err := c.service.DeleteModerator(actor(ctx, "adminId", service.ActorAdmin), moderatorId.ModeratorId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *adminController) RestoreModerator(ctx *fiber.Ctx) error {
+	moderatorId := new(dto.QueryAdminRestoreModerator)
+
+	if err := ctx.QueryParser(moderatorId); err != nil {
+		return err
+	}
+
+	if err := c.service.RestoreModerator(actor(ctx, "adminId", service.ActorAdmin), moderatorId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *adminController) UpdateModerator(ctx *fiber.Ctx) error {
+	updateModerator := new(dto.RequestAdminUpdateModerator)
+
+	if err := ctx.BodyParser(updateModerator); err != nil {
+		return err
+	}
+
+	if err := updateModerator.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	updated := new(dto.ResponseUpdated)
+
+	if err := c.service.UpdateModerator(actor(ctx, "adminId", service.ActorAdmin), updateModerator, updated); err != nil {
+		return updateError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(updated)
+}
+
+func (c *adminController) GetModeratorHistory(ctx *fiber.Ctx) error {
+	moderatorId := new(dto.QueryChangeHistory)
+
+	if err := ctx.QueryParser(moderatorId); err != nil {
+		return err
+	}
+
+	changes := new([]dto.ResponseChange)
+
+	if err := c.service.GetModeratorChanges(moderatorId, changes); err != nil {
 		return err
 	}
 
+	return ctx.Status(fiber.StatusOK).JSON(changes)
+}
+
+func (c *adminController) PurgeDoctor(ctx *fiber.Ctx) error {
+	return purge(ctx, c.service.PurgeDoctor)
+}
+
+func (c *adminController) PurgeCitizen(ctx *fiber.Ctx) error {
+	return purge(ctx, c.service.PurgeCitizen)
+}
+
+func (c *adminController) PurgePharmacy(ctx *fiber.Ctx) error {
+	return purge(ctx, c.service.PurgePharmacy)
+}
+
+func (c *adminController) PurgeMedicament(ctx *fiber.Ctx) error {
+	return purge(ctx, c.service.PurgeMedicament)
+}
+
+func (c *adminController) PurgeModerator(ctx *fiber.Ctx) error {
+	return purge(ctx, c.service.PurgeModerator)
+}
+
+// purge removes the soft-deleted record named in the query for good, unless other records
+// still reference it
+func purge(ctx *fiber.Ctx, purgeRecord func(*service.Actor, *dto.QueryAdminPurge, *[]dto.ResponseAdminReference) error) error {
+	recordId := new(dto.QueryAdminPurge)
+
+	if err := ctx.QueryParser(recordId); err != nil {
+		return err
+	}
+
+	references := new([]dto.ResponseAdminReference)
+
+	if err := purgeRecord(actor(ctx, "adminId", service.ActorAdmin), recordId, references); err != nil {
+		if errors.Is(err, repo.ErrRecordReferenced) {
+			return ctx.Status(fiber.StatusConflict).JSON(dto.ResponseAdminPurgeBlocked{
+				Message:    err.Error(),
+				References: *references,
+			})
+		}
+		return deleteError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(nil)
 }
+
+func (c *adminController) GetAuditEntries(ctx *fiber.Ctx) error {
+	query := new(dto.QueryAdminGetAuditEntries)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	dtoEntries := new(dto.ResponseList[dto.ResponseAdminAuditEntry])
+
+	if err := c.auditService.FindEntries(query, dtoEntries); err != nil {
+		return listError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(dtoEntries)
+}
+
+func (c *adminController) VerifyAudit(ctx *fiber.Ctx) error {
+	result := new(dto.ResponseAdminAuditVerification)
+
+	if err := c.auditService.VerifyChain(result); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(result)
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"medico/service"
+)
+
+// actor is the signed in admin or moderator the request acts for. idKey is the local the
+// session middleware stored their id under.
+func actor(ctx *fiber.Ctx, idKey string, role string) *service.Actor {
+	requestId, _ := ctx.Locals("requestid").(string)
+
+	return &service.Actor{
+		ID:        ctx.Locals(idKey).(uuid.UUID),
+		Role:      role,
+		IP:        ctx.IP(),
+		RequestID: requestId,
+	}
+}
@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"medico/repo"
+)
+
+// updateError answers an update that lost the race against another one or targets a record
+// that does not exist
+func updateError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repo.ErrVersionConflict):
+		return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+	}
+
+	return err
+}
@@ -17,7 +17,17 @@ type CitizenController interface {
 	GetMedicalInfo(ctx *fiber.Ctx) error
 	GetPersonalDoctor(ctx *fiber.Ctx) error
 	Prescription(ctx *fiber.Ctx) error
+	PrescriptionHistory(ctx *fiber.Ctx) error
+	PrescriptionVerification(ctx *fiber.Ctx) error
+	PrescriptionQr(ctx *fiber.Ctx) error
+	PrescriptionPdf(ctx *fiber.Ctx) error
 	AvailablePharmacies(ctx *fiber.Ctx) error
+	MedicamentAvailability(ctx *fiber.Ctx) error
+	NewReservation(ctx *fiber.Ctx) error
+	Reservations(ctx *fiber.Ctx) error
+	CancelReservation(ctx *fiber.Ctx) error
+	Hospitals(ctx *fiber.Ctx) error
+	DoctorsByHospital(ctx *fiber.Ctx) error
 }
 
 type citizenController struct {
@@ -142,20 +152,194 @@ func (c *citizenController) Prescription(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(prescriptionDto)
 }
 
-func (c *citizenController) AvailablePharmacies(ctx *fiber.Ctx) error {
-	prescriptionId := new(dto.QueryCitizenAvailablePharmacyGet)
+func (c *citizenController) PrescriptionHistory(ctx *fiber.Ctx) error {
+	query := new(dto.QueryCitizenGetPrescriptionHistory)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
 
-	err := ctx.QueryParser(prescriptionId)
+	historyDto := new([]dto.ResponsePrescriptionVersion)
+
+	if err := c.service.GetPrescriptionHistory(ctx.Locals("citizenId").(uuid.UUID), query, historyDto); err != nil {
+		if errors.Is(err, service.ErrPrescriptionNotOwned) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(historyDto)
+}
+
+func (c *citizenController) PrescriptionVerification(ctx *fiber.Ctx) error {
+	query := new(dto.QueryCitizenPrescriptionVerification)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	verificationDto := new(dto.ResponseCitizenPrescriptionVerification)
+
+	if err := c.service.GetPrescriptionVerification(ctx.Locals("citizenId").(uuid.UUID), query, verificationDto); err != nil {
+		if errors.Is(err, service.ErrPrescriptionNotOwned) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(verificationDto)
+}
+
+func (c *citizenController) PrescriptionQr(ctx *fiber.Ctx) error {
+	query := new(dto.QueryCitizenPrescriptionVerification)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	png, err := c.service.GetPrescriptionQr(ctx.Locals("citizenId").(uuid.UUID), query)
 	if err != nil {
+		if errors.Is(err, service.ErrPrescriptionNotOwned) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
 		return err
 	}
 
-	pharmaciesDto := new([]dto.ResponseCitizenAvailablePharmacy)
+	ctx.Type("png")
+	return ctx.Status(fiber.StatusOK).Send(png)
+}
+
+func (c *citizenController) PrescriptionPdf(ctx *fiber.Ctx) error {
+	prescriptionId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
 
-	err = c.service.FindAllAvailablePharmacies(prescriptionId, pharmaciesDto)
+	pdf, err := c.service.GetPrescriptionPdf(ctx.Locals("citizenId").(uuid.UUID), prescriptionId)
 	if err != nil {
+		if errors.Is(err, service.ErrPrescriptionNotOwned) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
+		return err
+	}
+
+	return sendPrescriptionPdf(ctx, prescriptionId, pdf)
+}
+
+func (c *citizenController) AvailablePharmacies(ctx *fiber.Ctx) error {
+	query := new(dto.QueryCitizenAvailablePharmacyGet)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	pharmaciesDto := new([]dto.ResponseCitizenAvailablePharmacy)
+
+	if err := c.service.FindAllAvailablePharmacies(ctx.Locals("citizenId").(uuid.UUID), query, pharmaciesDto); err != nil {
+		if errors.Is(err, service.ErrPrescriptionNotOwned) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
 		return err
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(pharmaciesDto)
 }
+
+func (c *citizenController) MedicamentAvailability(ctx *fiber.Ctx) error {
+	query := new(dto.QueryCitizenMedicamentAvailability)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	availability := new([]dto.ResponseCitizenMedicamentAvailability)
+
+	if err := c.service.FindMedicamentAvailability(query, availability); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(availability)
+}
+
+func (c *citizenController) NewReservation(ctx *fiber.Ctx) error {
+	request := new(dto.RequestCitizenNewReservation)
+
+	if err := ctx.BodyParser(request); err != nil {
+		return err
+	}
+
+	reservation := new(dto.ResponseReservation)
+
+	if err := c.service.ReserveStock(ctx.Locals("citizenId").(uuid.UUID), request, reservation); err != nil {
+		if errors.Is(err, service.ErrPrescriptionNotOwned) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
+		return reservationError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(reservation)
+}
+
+func (c *citizenController) Reservations(ctx *fiber.Ctx) error {
+	reservations := new([]dto.ResponseReservation)
+
+	if err := c.service.ListReservations(ctx.Locals("citizenId").(uuid.UUID), reservations); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(reservations)
+}
+
+func (c *citizenController) CancelReservation(ctx *fiber.Ctx) error {
+	request := new(dto.RequestCitizenCancelReservation)
+
+	if err := ctx.BodyParser(request); err != nil {
+		return err
+	}
+
+	if err := c.service.CancelReservation(ctx.Locals("citizenId").(uuid.UUID), request); err != nil {
+		return reservationError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *citizenController) Hospitals(ctx *fiber.Ctx) error {
+	query := new(dto.QueryCitizenGetHospitals)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	hospitalsDto := new([]dto.ResponseHospital)
+
+	if err := c.service.FindHospitals(query, hospitalsDto); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(hospitalsDto)
+}
+
+func (c *citizenController) DoctorsByHospital(ctx *fiber.Ctx) error {
+	query := new(dto.QueryCitizenGetDoctorsByHospital)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	doctorsDto := new([]dto.ResponseCitizenHospitalDoctor)
+
+	if err := c.service.FindDoctorsByHospital(query, doctorsDto); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(doctorsDto)
+}
@@ -0,0 +1,20 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"medico/repo"
+)
+
+// deleteError answers a delete or restore of a record that is not there to change
+func deleteError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repo.ErrRecordNotDeleted):
+		return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+	}
+
+	return err
+}
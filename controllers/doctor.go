@@ -2,10 +2,12 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 	"medico/dto"
 	"medico/models"
+	"medico/repo"
 	"medico/service"
 	"time"
 )
@@ -20,6 +22,12 @@ type DoctorController interface {
 	GetListOfCitizensViaCommonUCN(ctx *fiber.Ctx) error
 	GetCitizenPrescriptions(ctx *fiber.Ctx) error
 	CreateCitizenPrescription(ctx *fiber.Ctx) error
+	CancelPrescriptionRefills(ctx *fiber.Ctx) error
+	RevokeCitizenPrescription(ctx *fiber.Ctx) error
+	AmendCitizenPrescription(ctx *fiber.Ctx) error
+	GetPrescriptionHistory(ctx *fiber.Ctx) error
+	GetPrescriptionPdf(ctx *fiber.Ctx) error
+	GetAffiliations(ctx *fiber.Ctx) error
 }
 
 type doctorController struct {
@@ -161,13 +169,138 @@ func (d *doctorController) CreateCitizenPrescription(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	if err := d.service.CreatePrescription(ctx.Locals("doctorId").(uuid.UUID), citizenPrescriptionDto); err != nil {
+	if err := citizenPrescriptionDto.Validate(); err != nil {
 		return err
 	}
 
+	blockedDto := new([]dto.ResponseDoctorBlockedMedicament)
+	createdDto := new(dto.ResponseDoctorCreatedPrescription)
+
+	if err := d.service.CreatePrescription(ctx.Locals("doctorId").(uuid.UUID), citizenPrescriptionDto, blockedDto, createdDto); err != nil {
+		if errors.Is(err, service.ErrMedicamentRestricted) {
+			return ctx.Status(fiber.StatusForbidden).JSON(dto.ResponseDoctorPrescriptionBlocked{
+				Message:     err.Error(),
+				Medicaments: *blockedDto,
+			})
+		}
+		if errors.Is(err, service.ErrMedicamentDuplicated) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+		}
+		if errors.Is(err, service.ErrSigningKeyMissing) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
+		return err
+	}
+
+	return ctx.Status(200).JSON(createdDto)
+}
+
+func (d *doctorController) CancelPrescriptionRefills(ctx *fiber.Ctx) error {
+	cancelDto := new(dto.RequestDoctorCancelRefills)
+
+	if err := ctx.BodyParser(cancelDto); err != nil {
+		return err
+	}
+
+	if err := d.service.CancelRefills(ctx.Locals("doctorId").(uuid.UUID), cancelDto); err != nil {
+		return prescriptionChangeError(ctx, err)
+	}
+
 	return ctx.Status(200).JSON(nil)
 }
 
+func (d *doctorController) RevokeCitizenPrescription(ctx *fiber.Ctx) error {
+	revokeDto := new(dto.RequestDoctorRevokePrescription)
+
+	if err := ctx.BodyParser(revokeDto); err != nil {
+		return err
+	}
+
+	if err := revokeDto.Validate(); err != nil {
+		return err
+	}
+
+	if err := d.service.RevokePrescription(ctx.Locals("doctorId").(uuid.UUID), revokeDto); err != nil {
+		return prescriptionChangeError(ctx, err)
+	}
+
+	return ctx.Status(200).JSON(nil)
+}
+
+func (d *doctorController) AmendCitizenPrescription(ctx *fiber.Ctx) error {
+	amendDto := new(dto.RequestDoctorAmendPrescription)
+
+	if err := ctx.BodyParser(amendDto); err != nil {
+		return err
+	}
+
+	if err := amendDto.Validate(); err != nil {
+		return err
+	}
+
+	blockedDto := new([]dto.ResponseDoctorBlockedMedicament)
+
+	if err := d.service.AmendPrescription(ctx.Locals("doctorId").(uuid.UUID), amendDto, blockedDto); err != nil {
+		if errors.Is(err, service.ErrMedicamentRestricted) {
+			return ctx.Status(fiber.StatusForbidden).JSON(dto.ResponseDoctorPrescriptionBlocked{
+				Message:     err.Error(),
+				Medicaments: *blockedDto,
+			})
+		}
+		if errors.Is(err, service.ErrMedicamentDuplicated) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+		}
+		return prescriptionChangeError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(nil)
+}
+
+func (d *doctorController) GetPrescriptionHistory(ctx *fiber.Ctx) error {
+	query := new(dto.QueryDoctorGetPrescriptionHistory)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	historyDto := new([]dto.ResponsePrescriptionVersion)
+
+	if err := d.service.GetPrescriptionHistory(query, historyDto); err != nil {
+		return err
+	}
+
+	return ctx.Status(200).JSON(historyDto)
+}
+
+func (d *doctorController) GetPrescriptionPdf(ctx *fiber.Ctx) error {
+	prescriptionId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	pdf, err := d.service.GetPrescriptionPdf(ctx.Locals("doctorId").(uuid.UUID), prescriptionId)
+	if err != nil {
+		if errors.Is(err, service.ErrNotIssuingDoctor) {
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		}
+		return err
+	}
+
+	return sendPrescriptionPdf(ctx, prescriptionId, pdf)
+}
+
+// prescriptionChangeError maps the errors of revoking or amending a prescription to responses
+func prescriptionChangeError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrNotIssuingDoctor), errors.Is(err, service.ErrSigningKeyMissing):
+		return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+	case errors.Is(err, repo.ErrPrescriptionNotActive), errors.Is(err, repo.ErrPrescriptionDispensed):
+		return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+	}
+
+	return err
+}
+
 func (d *doctorController) GetMedicamentByCommonName(ctx *fiber.Ctx) error {
 	commonName := new(dto.QueryDoctorGetMedicamentByCommonName)
 
@@ -184,3 +317,19 @@ func (d *doctorController) GetMedicamentByCommonName(ctx *fiber.Ctx) error {
 
 	return ctx.Status(200).JSON(medicamentsDto)
 }
+
+func (d *doctorController) GetAffiliations(ctx *fiber.Ctx) error {
+	affiliationsDto := new([]dto.ResponseDoctorAffiliation)
+
+	if err := d.service.GetAffiliations(ctx.Locals("doctorId").(uuid.UUID), affiliationsDto); err != nil {
+		return err
+	}
+
+	return ctx.Status(200).JSON(affiliationsDto)
+}
+
+func sendPrescriptionPdf(ctx *fiber.Ctx, prescriptionId uuid.UUID, pdf []byte) error {
+	ctx.Type("pdf")
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf("inline; filename=\"prescription-%s.pdf\"", prescriptionId))
+	return ctx.Status(fiber.StatusOK).Send(pdf)
+}
@@ -0,0 +1,373 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"medico/dto"
+	"medico/service"
+	"net/url"
+	"strconv"
+)
+
+// FhirController serves the FHIR R4 facade. One is mounted under each role that may read it
+// and the role decides which records its searches can see. Doctors may also submit prescriptions.
+type FhirController interface {
+	SearchPatients(ctx *fiber.Ctx) error
+	ReadPatient(ctx *fiber.Ctx) error
+	SearchPractitioners(ctx *fiber.Ctx) error
+	ReadPractitioner(ctx *fiber.Ctx) error
+	SearchMedications(ctx *fiber.Ctx) error
+	ReadMedication(ctx *fiber.Ctx) error
+	SearchMedicationRequests(ctx *fiber.Ctx) error
+	ReadMedicationRequest(ctx *fiber.Ctx) error
+	SearchMedicationDispenses(ctx *fiber.Ctx) error
+	ReadMedicationDispense(ctx *fiber.Ctx) error
+	CreateMedicationRequests(ctx *fiber.Ctx) error
+}
+
+type fhirController struct {
+	role    service.FhirRole
+	service service.FhirService
+}
+
+func NewFhirController(role service.FhirRole) FhirController {
+	return &fhirController{
+		role:    role,
+		service: service.NewFhirService(),
+	}
+}
+
+type fhirSearch func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error
+
+func (f *fhirController) SearchPatients(ctx *fiber.Ctx) error {
+	query := new(dto.QueryFhirPatientSearch)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return fhirError(ctx, fiber.StatusBadRequest, "invalid", err.Error())
+	}
+
+	return f.search(ctx, &query.QueryFhirPaging, func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchPatients(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) ReadPatient(ctx *fiber.Ctx) error {
+	query := &dto.QueryFhirPatientSearch{Id: ctx.Params("id")}
+
+	return f.read(ctx, "Patient", func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchPatients(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) SearchPractitioners(ctx *fiber.Ctx) error {
+	query := new(dto.QueryFhirPractitionerSearch)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return fhirError(ctx, fiber.StatusBadRequest, "invalid", err.Error())
+	}
+
+	return f.search(ctx, &query.QueryFhirPaging, func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchPractitioners(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) ReadPractitioner(ctx *fiber.Ctx) error {
+	query := &dto.QueryFhirPractitionerSearch{Id: ctx.Params("id")}
+
+	return f.read(ctx, "Practitioner", func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchPractitioners(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) SearchMedications(ctx *fiber.Ctx) error {
+	query := new(dto.QueryFhirMedicationSearch)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return fhirError(ctx, fiber.StatusBadRequest, "invalid", err.Error())
+	}
+
+	return f.search(ctx, &query.QueryFhirPaging, func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchMedications(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) ReadMedication(ctx *fiber.Ctx) error {
+	query := &dto.QueryFhirMedicationSearch{Id: ctx.Params("id")}
+
+	return f.read(ctx, "Medication", func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchMedications(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) SearchMedicationRequests(ctx *fiber.Ctx) error {
+	query := new(dto.QueryFhirMedicationRequestSearch)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return fhirError(ctx, fiber.StatusBadRequest, "invalid", err.Error())
+	}
+
+	return f.search(ctx, &query.QueryFhirPaging, func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchMedicationRequests(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) ReadMedicationRequest(ctx *fiber.Ctx) error {
+	query := &dto.QueryFhirMedicationRequestSearch{Id: ctx.Params("id")}
+
+	return f.read(ctx, "MedicationRequest", func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchMedicationRequests(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) SearchMedicationDispenses(ctx *fiber.Ctx) error {
+	query := new(dto.QueryFhirMedicationDispenseSearch)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return fhirError(ctx, fiber.StatusBadRequest, "invalid", err.Error())
+	}
+
+	return f.search(ctx, &query.QueryFhirPaging, func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchMedicationDispenses(access, query, resources, total)
+	})
+}
+
+func (f *fhirController) ReadMedicationDispense(ctx *fiber.Ctx) error {
+	query := &dto.QueryFhirMedicationDispenseSearch{Id: ctx.Params("id")}
+
+	return f.read(ctx, "MedicationDispense", func(access service.FhirAccess, resources *[]dto.FhirResource, total *int64) error {
+		return f.service.SearchMedicationDispenses(access, query, resources, total)
+	})
+}
+
+// CreateMedicationRequests accepts a MedicationRequest or a transaction Bundle of them and
+// creates one prescription. A single request is answered with the stored resource, a bundle
+// with a transaction-response. A submission named by the Bundle identifier or an
+// If-None-Exist header that was created before is answered with what it created.
+func (f *fhirController) CreateMedicationRequests(ctx *fiber.Ctx) error {
+	submission := dto.RequestFhirSubmission{}
+
+	if err := dto.ParseFhirMedicationRequests(ctx.Body(), &submission); err != nil {
+		return fhirServiceError(ctx, err)
+	}
+
+	if ifNoneExist := ctx.Get("If-None-Exist"); ifNoneExist != "" {
+		identifier, err := dto.ParseFhirIfNoneExist(ifNoneExist)
+		if err != nil {
+			return fhirServiceError(ctx, err)
+		}
+		submission.Identifier = identifier
+	}
+
+	var created []dto.FhirResource
+	var existing bool
+
+	if err := f.service.CreateMedicationRequests(f.access(ctx), &submission, &created, &existing); err != nil {
+		return fhirServiceError(ctx, err)
+	}
+
+	status, entryStatus := fiber.StatusCreated, "201 Created"
+	if existing {
+		status, entryStatus = fiber.StatusOK, "200 OK"
+	}
+
+	if submission.Requests[0].Path == "MedicationRequest" {
+		ctx.Location(f.resourceUrl(ctx, created[0]))
+		return fhirJSON(ctx, status, created[0])
+	}
+
+	bundle := dto.FhirBundle{
+		ResourceType: "Bundle",
+		Type:         "transaction-response",
+		Entry:        make([]dto.FhirBundleEntry, len(created)),
+	}
+
+	for i, resource := range created {
+		bundle.Entry[i] = dto.FhirBundleEntry{
+			FullUrl:  f.resourceUrl(ctx, resource),
+			Resource: resource,
+			Response: &dto.FhirBundleEntryResponse{
+				Status:   entryStatus,
+				Location: resource.FhirResourceType() + "/" + resource.FhirId(),
+			},
+		}
+	}
+
+	return fhirJSON(ctx, fiber.StatusOK, bundle)
+}
+
+func (f *fhirController) access(ctx *fiber.Ctx) service.FhirAccess {
+	return service.FhirAccess{
+		Role: f.role,
+		ID:   ctx.Locals(string(f.role) + "Id").(uuid.UUID),
+	}
+}
+
+// search runs a search and answers with a searchset bundle. The paging is normalized by the
+// service, so the links are built after it ran.
+func (f *fhirController) search(ctx *fiber.Ctx, paging *dto.QueryFhirPaging, run fhirSearch) error {
+	var resources []dto.FhirResource
+	var total int64
+
+	if err := run(f.access(ctx), &resources, &total); err != nil {
+		return fhirServiceError(ctx, err)
+	}
+
+	bundle := dto.FhirBundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Total:        &total,
+		Entry:        make([]dto.FhirBundleEntry, len(resources)),
+	}
+
+	for i, resource := range resources {
+		// matches the service had to withhold are reported by an OperationOutcome in their place
+		if _, ok := resource.(*dto.FhirOperationOutcome); ok {
+			bundle.Entry[i] = dto.FhirBundleEntry{
+				Resource: resource,
+				Search:   &dto.FhirBundleEntrySearch{Mode: "outcome"},
+			}
+			continue
+		}
+
+		bundle.Entry[i] = dto.FhirBundleEntry{
+			FullUrl:  f.resourceUrl(ctx, resource),
+			Resource: resource,
+			Search:   &dto.FhirBundleEntrySearch{Mode: "match"},
+		}
+	}
+
+	bundle.Link = append(bundle.Link, dto.FhirBundleLink{Relation: "self", Url: pageUrl(ctx, paging.Offset)})
+	if paging.Offset > 0 {
+		bundle.Link = append(bundle.Link, dto.FhirBundleLink{Relation: "previous", Url: pageUrl(ctx, max(paging.Offset-paging.Count, 0))})
+	}
+	if int64(paging.Offset+paging.Count) < total {
+		bundle.Link = append(bundle.Link, dto.FhirBundleLink{Relation: "next", Url: pageUrl(ctx, paging.Offset+paging.Count)})
+	}
+
+	return fhirJSON(ctx, fiber.StatusOK, bundle)
+}
+
+func (f *fhirController) read(ctx *fiber.Ctx, resourceType string, run fhirSearch) error {
+	var resources []dto.FhirResource
+	var total int64
+
+	if err := run(f.access(ctx), &resources, &total); err != nil {
+		return fhirServiceError(ctx, err)
+	}
+
+	if len(resources) == 0 {
+		return fhirError(ctx, fiber.StatusNotFound, "not-found", resourceType+"/"+ctx.Params("id")+" is not known")
+	}
+
+	if outcome, ok := resources[0].(*dto.FhirOperationOutcome); ok {
+		return fhirJSON(ctx, fiber.StatusUnprocessableEntity, outcome)
+	}
+
+	return fhirJSON(ctx, fiber.StatusOK, resources[0])
+}
+
+func (f *fhirController) resourceUrl(ctx *fiber.Ctx, resource dto.FhirResource) string {
+	return ctx.BaseURL() + "/api/" + f.base() + "/fhir/" + resource.FhirResourceType() + "/" + resource.FhirId()
+}
+
+func (f *fhirController) base() string {
+	if f.role == service.FhirPharmacist {
+		return "pharmacy/pharmacist"
+	}
+
+	return string(f.role)
+}
+
+// pageUrl is the url of the current search with its offset moved to another page
+func pageUrl(ctx *fiber.Ctx, offset int) string {
+	query := url.Values{}
+	ctx.Request().URI().QueryArgs().VisitAll(func(key, value []byte) {
+		query.Add(string(key), string(value))
+	})
+	query.Set("_offset", strconv.Itoa(offset))
+
+	return ctx.BaseURL() + ctx.Path() + "?" + query.Encode()
+}
+
+// fhirServiceError answers with an OperationOutcome holding an issue for every error joined in
+// err. The first issue decides the status.
+func fhirServiceError(ctx *fiber.Ctx, err error) error {
+	outcome := dto.FhirOperationOutcome{ResourceType: "OperationOutcome"}
+	status := 0
+
+	for _, issueErr := range fhirIssueErrors("", err) {
+		issueStatus, code := fhirIssueCode(issueErr)
+		if status == 0 {
+			status = issueStatus
+		}
+
+		issue := dto.FhirOperationOutcomeIssue{
+			Severity:    "error",
+			Code:        code,
+			Diagnostics: issueErr.Err.Error(),
+		}
+		if issueErr.Expression != "" {
+			issue.Expression = []string{issueErr.Expression}
+		}
+
+		outcome.Issue = append(outcome.Issue, issue)
+	}
+
+	return fhirJSON(ctx, status, outcome)
+}
+
+func fhirIssueErrors(expression string, err error) []dto.FhirIssueError {
+	if issueErr, ok := err.(*dto.FhirIssueError); ok {
+		return fhirIssueErrors(issueErr.Expression, issueErr.Err)
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var issues []dto.FhirIssueError
+		for _, e := range joined.Unwrap() {
+			issues = append(issues, fhirIssueErrors(expression, e)...)
+		}
+		return issues
+	}
+
+	return []dto.FhirIssueError{{Expression: expression, Err: err}}
+}
+
+func fhirIssueCode(issueErr dto.FhirIssueError) (int, string) {
+	switch err := issueErr.Err; {
+	case errors.Is(err, service.ErrFhirInvalidParameter), errors.Is(err, dto.ErrFhirResourceInvalid):
+		return fiber.StatusBadRequest, "invalid"
+	case errors.Is(err, service.ErrFhirAccessDenied), errors.Is(err, service.ErrPrescribingBlocked), errors.Is(err, service.ErrSigningKeyMissing):
+		return fiber.StatusForbidden, "forbidden"
+	case errors.Is(err, service.ErrMedicamentRestricted):
+		return fiber.StatusUnprocessableEntity, "business-rule"
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fiber.StatusNotFound, "not-found"
+	case issueErr.Expression != "":
+		// the remaining errors about an element come from validating the prescription
+		return fiber.StatusUnprocessableEntity, "invalid"
+	}
+
+	return fiber.StatusInternalServerError, "exception"
+}
+
+func fhirError(ctx *fiber.Ctx, status int, code, diagnostics string) error {
+	return fhirJSON(ctx, status, dto.FhirOperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue: []dto.FhirOperationOutcomeIssue{{
+			Severity:    "error",
+			Code:        code,
+			Diagnostics: diagnostics,
+		}},
+	})
+}
+
+func fhirJSON(ctx *fiber.Ctx, status int, body any) error {
+	if err := ctx.Status(status).JSON(body); err != nil {
+		return err
+	}
+
+	ctx.Set(fiber.HeaderContentType, dto.FhirContentType)
+	return nil
+}
@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"medico/repo"
+)
+
+// stockError answers a stock movement or stock query the branch cannot take
+func stockError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repo.ErrInsufficientStock),
+		errors.Is(err, repo.ErrBranchDecommissioned),
+		errors.Is(err, repo.ErrBatchExpiryMismatch):
+		return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+	case errors.Is(err, repo.ErrTransferBranchInvalid),
+		errors.Is(err, repo.ErrBatchRequired),
+		errors.Is(err, repo.ErrBatchExpiryRequired),
+		errors.Is(err, repo.ErrSortFieldUnknown):
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+	}
+
+	return err
+}
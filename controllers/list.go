@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"medico/repo"
+)
+
+// listError answers a list request that asked for an order the list does not support
+func listError(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, repo.ErrSortFieldUnknown) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	return err
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"medico/dto"
 	"medico/service"
 	"time"
@@ -76,6 +77,32 @@ type DoctorModeratorController interface {
 	GetDoctors(ctx *fiber.Ctx) error
 	AddDoctor(ctx *fiber.Ctx) error
 	DeleteDoctor(ctx *fiber.Ctx) error
+	RestoreDoctor(ctx *fiber.Ctx) error
+	UpdateDoctor(ctx *fiber.Ctx) error
+	GetDoctorHistory(ctx *fiber.Ctx) error
+
+	ImportRegistry(ctx *fiber.Ctx) error
+	RecheckLicences(ctx *fiber.Ctx) error
+
+	GetHospitals(ctx *fiber.Ctx) error
+	AddHospital(ctx *fiber.Ctx) error
+	UpdateHospital(ctx *fiber.Ctx) error
+	DeleteHospital(ctx *fiber.Ctx) error
+
+	GetAffiliations(ctx *fiber.Ctx) error
+	AddAffiliation(ctx *fiber.Ctx) error
+	EndAffiliation(ctx *fiber.Ctx) error
+	DeleteAffiliation(ctx *fiber.Ctx) error
+
+	GetSpecialties(ctx *fiber.Ctx) error
+	AddSpecialty(ctx *fiber.Ctx) error
+	DeleteSpecialty(ctx *fiber.Ctx) error
+	AssignSpecialty(ctx *fiber.Ctx) error
+	UnassignSpecialty(ctx *fiber.Ctx) error
+
+	GetSigningKeys(ctx *fiber.Ctx) error
+	RotateSigningKey(ctx *fiber.Ctx) error
+	RevokeSigningKey(ctx *fiber.Ctx) error
 }
 
 type doctorModeratorController struct {
@@ -113,12 +140,22 @@ func (m *doctorModeratorController) VerifySession(ctx *fiber.Ctx) error {
 }
 
 func (m *doctorModeratorController) GetDoctors(ctx *fiber.Ctx) error {
-	doctors := new([]dto.ResponseModeratorGetDoctors)
+	query := new(dto.QueryModeratorGetDoctors)
 
-	if err := m.service.FindAllDoctors(doctors); err != nil {
+	if err := ctx.QueryParser(query); err != nil {
 		return err
 	}
 
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	doctors := new(dto.ResponseList[dto.ResponseModeratorGetDoctors])
+
+	if err := m.service.FindAllDoctors(query, doctors); err != nil {
+		return listError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(doctors)
 }
 func (m *doctorModeratorController) AddDoctor(ctx *fiber.Ctx) error {
@@ -128,7 +165,7 @@ func (m *doctorModeratorController) AddDoctor(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	err := m.service.CreateDoctor(newDoctor)
+	err := m.service.CreateDoctor(actor(ctx, "moderatorId", service.ActorDoctorModerator), newDoctor)
 	if err != nil {
 		return err
 	}
@@ -142,7 +179,359 @@ func (m *doctorModeratorController) DeleteDoctor(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	if err := m.service.DeleteDoctor(doctorId); err != nil {
+	if err := m.service.DeleteDoctor(actor(ctx, "moderatorId", service.ActorDoctorModerator), doctorId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) RestoreDoctor(ctx *fiber.Ctx) error {
+	doctorId := new(dto.QueryModeratorRestoreDoctor)
+
+	if err := ctx.QueryParser(doctorId); err != nil {
+		return err
+	}
+
+	if err := m.service.RestoreDoctor(actor(ctx, "moderatorId", service.ActorDoctorModerator), doctorId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) UpdateDoctor(ctx *fiber.Ctx) error {
+	updateDoctor := new(dto.RequestModeratorUpdateDoctor)
+
+	if err := ctx.BodyParser(updateDoctor); err != nil {
+		return err
+	}
+
+	if err := updateDoctor.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	updated := new(dto.ResponseUpdated)
+
+	if err := m.service.UpdateDoctor(actor(ctx, "moderatorId", service.ActorDoctorModerator), updateDoctor, updated); err != nil {
+		if errors.Is(err, service.ErrUinNotRegistered) || errors.Is(err, service.ErrUinNameMismatch) || errors.Is(err, service.ErrUinLicenceInactive) {
+			return ctx.Status(fiber.StatusUnprocessableEntity).JSON(err.Error())
+		}
+		return updateError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(updated)
+}
+
+func (m *doctorModeratorController) GetDoctorHistory(ctx *fiber.Ctx) error {
+	doctorId := new(dto.QueryChangeHistory)
+
+	if err := ctx.QueryParser(doctorId); err != nil {
+		return err
+	}
+
+	changes := new([]dto.ResponseChange)
+
+	if err := m.service.FindDoctorChanges(doctorId, changes); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(changes)
+}
+
+func (m *doctorModeratorController) ImportRegistry(ctx *fiber.Ctx) error {
+	registryHeader, err := ctx.FormFile("registry")
+	if err != nil {
+		return err
+	}
+
+	registry, err := registryHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer registry.Close()
+
+	result := new(dto.ResponseModeratorImportRegistry)
+
+	if err := m.service.ImportPhysicianRegistry(actor(ctx, "moderatorId", service.ActorDoctorModerator), registry, result); err != nil {
+		if errors.Is(err, service.ErrRegistryInvalidCsv) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+		}
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(result)
+}
+
+func (m *doctorModeratorController) RecheckLicences(ctx *fiber.Ctx) error {
+	query := new(dto.QueryList)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	doctors := new(dto.ResponseList[dto.ResponseModeratorGetDoctors])
+
+	if err := m.service.RecheckDoctorLicences(actor(ctx, "moderatorId", service.ActorDoctorModerator), query, doctors); err != nil {
+		if errors.Is(err, service.ErrRegistryEmpty) {
+			return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+		}
+		return listError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(doctors)
+}
+
+func (m *doctorModeratorController) GetHospitals(ctx *fiber.Ctx) error {
+	hospitals := new([]dto.ResponseHospital)
+
+	if err := m.service.FindAllHospitals(hospitals); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(hospitals)
+}
+
+func (m *doctorModeratorController) AddHospital(ctx *fiber.Ctx) error {
+	newHospital := new(dto.RequestModeratorCreateHospital)
+
+	if err := ctx.BodyParser(newHospital); err != nil {
+		return err
+	}
+
+	if err := newHospital.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.service.CreateHospital(actor(ctx, "moderatorId", service.ActorDoctorModerator), newHospital); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(nil)
+}
+
+func (m *doctorModeratorController) UpdateHospital(ctx *fiber.Ctx) error {
+	hospital := new(dto.RequestModeratorUpdateHospital)
+
+	if err := ctx.BodyParser(hospital); err != nil {
+		return err
+	}
+
+	if err := hospital.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.service.UpdateHospital(actor(ctx, "moderatorId", service.ActorDoctorModerator), hospital); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) DeleteHospital(ctx *fiber.Ctx) error {
+	hospitalId := new(dto.QueryModeratorDeleteHospital)
+
+	if err := ctx.QueryParser(hospitalId); err != nil {
+		return err
+	}
+
+	if err := m.service.DeleteHospital(actor(ctx, "moderatorId", service.ActorDoctorModerator), hospitalId); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) GetAffiliations(ctx *fiber.Ctx) error {
+	doctorId := new(dto.QueryModeratorGetAffiliations)
+
+	if err := ctx.QueryParser(doctorId); err != nil {
+		return err
+	}
+
+	affiliations := new([]dto.ResponseModeratorGetAffiliation)
+
+	if err := m.service.FindAffiliations(doctorId, affiliations); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(affiliations)
+}
+
+func (m *doctorModeratorController) AddAffiliation(ctx *fiber.Ctx) error {
+	newAffiliation := new(dto.RequestModeratorCreateAffiliation)
+
+	if err := ctx.BodyParser(newAffiliation); err != nil {
+		return err
+	}
+
+	if err := newAffiliation.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.service.CreateAffiliation(actor(ctx, "moderatorId", service.ActorDoctorModerator), newAffiliation); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(nil)
+}
+
+func (m *doctorModeratorController) EndAffiliation(ctx *fiber.Ctx) error {
+	endAffiliation := new(dto.RequestModeratorEndAffiliation)
+
+	if err := ctx.BodyParser(endAffiliation); err != nil {
+		return err
+	}
+
+	if err := m.service.EndAffiliation(actor(ctx, "moderatorId", service.ActorDoctorModerator), endAffiliation); err != nil {
+		switch {
+		case errors.Is(err, service.ErrAffiliationEndsBeforeStart):
+			return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+		}
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) DeleteAffiliation(ctx *fiber.Ctx) error {
+	affiliationId := new(dto.QueryModeratorDeleteAffiliation)
+
+	if err := ctx.QueryParser(affiliationId); err != nil {
+		return err
+	}
+
+	if err := m.service.DeleteAffiliation(actor(ctx, "moderatorId", service.ActorDoctorModerator), affiliationId); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) GetSpecialties(ctx *fiber.Ctx) error {
+	specialties := new([]dto.ResponseSpecialty)
+
+	if err := m.service.FindAllSpecialties(specialties); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(specialties)
+}
+
+func (m *doctorModeratorController) AddSpecialty(ctx *fiber.Ctx) error {
+	newSpecialty := new(dto.RequestModeratorCreateSpecialty)
+
+	if err := ctx.BodyParser(newSpecialty); err != nil {
+		return err
+	}
+
+	if err := newSpecialty.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.service.CreateSpecialty(actor(ctx, "moderatorId", service.ActorDoctorModerator), newSpecialty); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(nil)
+}
+
+func (m *doctorModeratorController) DeleteSpecialty(ctx *fiber.Ctx) error {
+	specialtyId := new(dto.QueryModeratorDeleteSpecialty)
+
+	if err := ctx.QueryParser(specialtyId); err != nil {
+		return err
+	}
+
+	if err := m.service.DeleteSpecialty(actor(ctx, "moderatorId", service.ActorDoctorModerator), specialtyId); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) AssignSpecialty(ctx *fiber.Ctx) error {
+	doctorSpecialty := new(dto.RequestModeratorDoctorSpecialty)
+
+	if err := ctx.BodyParser(doctorSpecialty); err != nil {
+		return err
+	}
+
+	if err := m.service.AssignSpecialty(actor(ctx, "moderatorId", service.ActorDoctorModerator), doctorSpecialty); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+		}
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) UnassignSpecialty(ctx *fiber.Ctx) error {
+	doctorSpecialty := new(dto.RequestModeratorDoctorSpecialty)
+
+	if err := ctx.BodyParser(doctorSpecialty); err != nil {
+		return err
+	}
+
+	if err := m.service.UnassignSpecialty(actor(ctx, "moderatorId", service.ActorDoctorModerator), doctorSpecialty); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *doctorModeratorController) GetSigningKeys(ctx *fiber.Ctx) error {
+	doctorId := new(dto.QueryModeratorGetSigningKeys)
+
+	if err := ctx.QueryParser(doctorId); err != nil {
+		return err
+	}
+
+	keys := new([]dto.ResponseModeratorSigningKey)
+
+	if err := m.service.FindSigningKeys(doctorId, keys); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(keys)
+}
+
+func (m *doctorModeratorController) RotateSigningKey(ctx *fiber.Ctx) error {
+	rotateKey := new(dto.RequestModeratorRotateSigningKey)
+
+	if err := ctx.BodyParser(rotateKey); err != nil {
+		return err
+	}
+
+	if err := m.service.RotateSigningKey(actor(ctx, "moderatorId", service.ActorDoctorModerator), rotateKey); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(nil)
+}
+
+func (m *doctorModeratorController) RevokeSigningKey(ctx *fiber.Ctx) error {
+	revokeKey := new(dto.RequestModeratorRevokeSigningKey)
+
+	if err := ctx.BodyParser(revokeKey); err != nil {
+		return err
+	}
+
+	if err := revokeKey.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.service.RevokeSigningKey(actor(ctx, "moderatorId", service.ActorDoctorModerator), revokeKey); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+		}
 		return err
 	}
 
@@ -157,6 +546,12 @@ type PharmaModeratorController interface {
 	GetPharmacies(ctx *fiber.Ctx) error
 	AddPharmacy(ctx *fiber.Ctx) error
 	DeletePharmacy(ctx *fiber.Ctx) error
+	RestorePharmacy(ctx *fiber.Ctx) error
+	UpdatePharmacy(ctx *fiber.Ctx) error
+	GetPharmacyHistory(ctx *fiber.Ctx) error
+
+	GetRegistrations(ctx *fiber.Ctx) error
+	ReviewRegistration(ctx *fiber.Ctx) error
 }
 
 type pharmaModeratorController struct {
@@ -194,12 +589,22 @@ func (m *pharmaModeratorController) VerifySession(ctx *fiber.Ctx) error {
 }
 
 func (m *pharmaModeratorController) GetPharmacies(ctx *fiber.Ctx) error {
-	pharmacies := new([]dto.ResponseModeratorGetPharmacies)
+	query := new(dto.QueryModeratorGetPharmacies)
 
-	if err := m.service.FindAllPharmacies(pharmacies); err != nil {
+	if err := ctx.QueryParser(query); err != nil {
 		return err
 	}
 
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	pharmacies := new(dto.ResponseList[dto.ResponseModeratorGetPharmacies])
+
+	if err := m.service.FindAllPharmacies(query, pharmacies); err != nil {
+		return listError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(pharmacies)
 }
 func (m *pharmaModeratorController) AddPharmacy(ctx *fiber.Ctx) error {
@@ -209,7 +614,7 @@ func (m *pharmaModeratorController) AddPharmacy(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	err := m.service.CreatePharmacyAndOwner(newPharmacy)
+	err := m.service.CreatePharmacyAndOwner(actor(ctx, "moderatorId", service.ActorPharmacyModerator), newPharmacy)
 	if err != nil {
 		return err
 	}
@@ -223,10 +628,98 @@ func (m *pharmaModeratorController) DeletePharmacy(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	if err := m.service.DeletePharmacy(pharmacyId); err != nil {
+	if err := m.service.DeletePharmacy(actor(ctx, "moderatorId", service.ActorPharmacyModerator), pharmacyId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *pharmaModeratorController) RestorePharmacy(ctx *fiber.Ctx) error {
+	pharmacyId := new(dto.QueryModeratorRestorePharmacy)
+
+	if err := ctx.QueryParser(pharmacyId); err != nil {
 		return err
 	}
 
+	if err := m.service.RestorePharmacy(actor(ctx, "moderatorId", service.ActorPharmacyModerator), pharmacyId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *pharmaModeratorController) UpdatePharmacy(ctx *fiber.Ctx) error {
+	updatePharmacy := new(dto.RequestModeratorUpdatePharmacy)
+
+	if err := ctx.BodyParser(updatePharmacy); err != nil {
+		return err
+	}
+
+	if err := updatePharmacy.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	updated := new(dto.ResponseUpdated)
+
+	if err := m.service.UpdatePharmacy(actor(ctx, "moderatorId", service.ActorPharmacyModerator), updatePharmacy, updated); err != nil {
+		return updateError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(updated)
+}
+
+func (m *pharmaModeratorController) GetPharmacyHistory(ctx *fiber.Ctx) error {
+	pharmacyId := new(dto.QueryChangeHistory)
+
+	if err := ctx.QueryParser(pharmacyId); err != nil {
+		return err
+	}
+
+	changes := new([]dto.ResponseChange)
+
+	if err := m.service.FindPharmacyChanges(pharmacyId, changes); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(changes)
+}
+
+func (m *pharmaModeratorController) GetRegistrations(ctx *fiber.Ctx) error {
+	query := new(dto.QueryModeratorGetRegistrations)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	registrations := new(dto.ResponseList[dto.ResponseModeratorGetRegistration])
+
+	if err := m.service.FindAllRegistrations(query, registrations); err != nil {
+		return listError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(registrations)
+}
+
+func (m *pharmaModeratorController) ReviewRegistration(ctx *fiber.Ctx) error {
+	review := new(dto.RequestModeratorReviewRegistration)
+
+	if err := ctx.BodyParser(review); err != nil {
+		return err
+	}
+
+	if err := review.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := m.service.ReviewRegistration(actor(ctx, "moderatorId", service.ActorPharmacyModerator), review); err != nil {
+		return registrationError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(nil)
 }
 
@@ -238,6 +731,12 @@ type MedicamentModeratorController interface {
 	GetMedicaments(ctx *fiber.Ctx) error
 	AddMedicament(ctx *fiber.Ctx) error
 	DeleteMedicament(ctx *fiber.Ctx) error
+	RestoreMedicament(ctx *fiber.Ctx) error
+	UpdateMedicament(ctx *fiber.Ctx) error
+	GetMedicamentHistory(ctx *fiber.Ctx) error
+
+	GetSpecialties(ctx *fiber.Ctx) error
+	SetRestrictions(ctx *fiber.Ctx) error
 }
 
 type medicamentModeratorController struct {
@@ -275,12 +774,22 @@ func (m *medicamentModeratorController) VerifySession(ctx *fiber.Ctx) error {
 }
 
 func (m *medicamentModeratorController) GetMedicaments(ctx *fiber.Ctx) error {
-	medicaments := new([]dto.ResponseModeratorGetMedicaments)
+	query := new(dto.QueryModeratorGetMedicaments)
 
-	if err := m.service.FindAllMedicaments(medicaments); err != nil {
+	if err := ctx.QueryParser(query); err != nil {
 		return err
 	}
 
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	medicaments := new(dto.ResponseList[dto.ResponseModeratorGetMedicaments])
+
+	if err := m.service.FindAllMedicaments(query, medicaments); err != nil {
+		return listError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(medicaments)
 }
 func (m *medicamentModeratorController) AddMedicament(ctx *fiber.Ctx) error {
@@ -290,7 +799,7 @@ func (m *medicamentModeratorController) AddMedicament(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	err := m.service.CreateMedicament(newMedicament)
+	err := m.service.CreateMedicament(actor(ctx, "moderatorId", service.ActorMedicamentModerator), newMedicament)
 	if err != nil {
 		return err
 	}
@@ -304,7 +813,84 @@ func (m *medicamentModeratorController) DeleteMedicament(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	if err := m.service.DeleteMedicament(medicamentId); err != nil {
+	if err := m.service.DeleteMedicament(actor(ctx, "moderatorId", service.ActorMedicamentModerator), medicamentId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *medicamentModeratorController) RestoreMedicament(ctx *fiber.Ctx) error {
+	medicamentId := new(dto.QueryModeratorRestoreMedicament)
+
+	if err := ctx.QueryParser(medicamentId); err != nil {
+		return err
+	}
+
+	if err := m.service.RestoreMedicament(actor(ctx, "moderatorId", service.ActorMedicamentModerator), medicamentId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *medicamentModeratorController) UpdateMedicament(ctx *fiber.Ctx) error {
+	updateMedicament := new(dto.RequestModeratorUpdateMedicament)
+
+	if err := ctx.BodyParser(updateMedicament); err != nil {
+		return err
+	}
+
+	if err := updateMedicament.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	updated := new(dto.ResponseUpdated)
+
+	if err := m.service.UpdateMedicament(actor(ctx, "moderatorId", service.ActorMedicamentModerator), updateMedicament, updated); err != nil {
+		return updateError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(updated)
+}
+
+func (m *medicamentModeratorController) GetMedicamentHistory(ctx *fiber.Ctx) error {
+	medicamentId := new(dto.QueryChangeHistory)
+
+	if err := ctx.QueryParser(medicamentId); err != nil {
+		return err
+	}
+
+	changes := new([]dto.ResponseChange)
+
+	if err := m.service.FindMedicamentChanges(medicamentId, changes); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(changes)
+}
+
+func (m *medicamentModeratorController) GetSpecialties(ctx *fiber.Ctx) error {
+	specialties := new([]dto.ResponseSpecialty)
+
+	if err := m.service.FindAllSpecialties(specialties); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(specialties)
+}
+
+func (m *medicamentModeratorController) SetRestrictions(ctx *fiber.Ctx) error {
+	restrictions := new(dto.RequestModeratorMedicamentRestrictions)
+
+	if err := ctx.BodyParser(restrictions); err != nil {
+		return err
+	}
+
+	if err := m.service.SetMedicamentRestrictions(actor(ctx, "moderatorId", service.ActorMedicamentModerator), restrictions); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+		}
 		return err
 	}
 
@@ -319,6 +905,9 @@ type CitizenModeratorController interface {
 	GetCitizens(ctx *fiber.Ctx) error
 	AddCitizen(ctx *fiber.Ctx) error
 	DeleteCitizen(ctx *fiber.Ctx) error
+	RestoreCitizen(ctx *fiber.Ctx) error
+	UpdateCitizen(ctx *fiber.Ctx) error
+	GetCitizenHistory(ctx *fiber.Ctx) error
 }
 
 type citizenModeratorController struct {
@@ -356,12 +945,22 @@ func (m *citizenModeratorController) VerifySession(ctx *fiber.Ctx) error {
 }
 
 func (m *citizenModeratorController) GetCitizens(ctx *fiber.Ctx) error {
-	citizens := new([]dto.ResponseModeratorGetCitizens)
+	query := new(dto.QueryModeratorGetCitizens)
 
-	if err := m.service.FindAllCitizens(citizens); err != nil {
+	if err := ctx.QueryParser(query); err != nil {
 		return err
 	}
 
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	citizens := new(dto.ResponseList[dto.ResponseModeratorGetCitizens])
+
+	if err := m.service.FindAllCitizens(query, citizens); err != nil {
+		return listError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(citizens)
 }
 func (m *citizenModeratorController) AddCitizen(ctx *fiber.Ctx) error {
@@ -371,7 +970,11 @@ func (m *citizenModeratorController) AddCitizen(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	err := m.service.CreateCitizen(newCitizen)
+	if err := newCitizen.Validate(); err != nil {
+		return err
+	}
+
+	err := m.service.CreateCitizen(actor(ctx, "moderatorId", service.ActorCitizenModerator), newCitizen)
 	if err != nil {
 		return err
 	}
@@ -385,9 +988,59 @@ func (m *citizenModeratorController) DeleteCitizen(ctx *fiber.Ctx) error {
 		return err
 	}
 
-	if err := m.service.DeleteCitizen(citizenId); err != nil {
+	if err := m.service.DeleteCitizen(actor(ctx, "moderatorId", service.ActorCitizenModerator), citizenId); err != nil {
+		return deleteError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (m *citizenModeratorController) RestoreCitizen(ctx *fiber.Ctx) error {
+	citizenId := new(dto.QueryModeratorRestoreCitizen)
+
+	if err := ctx.QueryParser(citizenId); err != nil {
 		return err
 	}
 
+	if err := m.service.RestoreCitizen(actor(ctx, "moderatorId", service.ActorCitizenModerator), citizenId); err != nil {
+		return deleteError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(nil)
 }
+
+func (m *citizenModeratorController) UpdateCitizen(ctx *fiber.Ctx) error {
+	updateCitizen := new(dto.RequestModeratorUpdateCitizen)
+
+	if err := ctx.BodyParser(updateCitizen); err != nil {
+		return err
+	}
+
+	if err := updateCitizen.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	updated := new(dto.ResponseUpdated)
+
+	if err := m.service.UpdateCitizen(actor(ctx, "moderatorId", service.ActorCitizenModerator), updateCitizen, updated); err != nil {
+		return updateError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(updated)
+}
+
+func (m *citizenModeratorController) GetCitizenHistory(ctx *fiber.Ctx) error {
+	citizenId := new(dto.QueryChangeHistory)
+
+	if err := ctx.QueryParser(citizenId); err != nil {
+		return err
+	}
+
+	changes := new([]dto.ResponseChange)
+
+	if err := m.service.FindCitizenChanges(citizenId, changes); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(changes)
+}
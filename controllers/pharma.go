@@ -1,12 +1,15 @@
 package controllers
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"medico/dto"
 	"medico/models"
+	"medico/repo"
 	"medico/service"
 	"time"
 )
@@ -21,6 +24,26 @@ type PharmacyOwnerController interface {
 	GetAllPharmacists(ctx *fiber.Ctx) error
 	NewPharmacyBranch(ctx *fiber.Ctx) error
 	NewPharmacist(ctx *fiber.Ctx) error
+
+	GetBranch(ctx *fiber.Ctx) error
+	UpdateBranch(ctx *fiber.Ctx) error
+	SetBranchOpeningHours(ctx *fiber.Ctx) error
+	NewBranchHoliday(ctx *fiber.Ctx) error
+	DeleteBranchHoliday(ctx *fiber.Ctx) error
+	CloseBranch(ctx *fiber.Ctx) error
+	ReopenBranch(ctx *fiber.Ctx) error
+	DecommissionBranch(ctx *fiber.Ctx) error
+
+	TransferStock(ctx *fiber.Ctx) error
+	GetStockHistory(ctx *fiber.Ctx) error
+	ReconcileStock(ctx *fiber.Ctx) error
+	GetExpiringStock(ctx *fiber.Ctx) error
+
+	SetStockLevel(ctx *fiber.Ctx) error
+	DeleteStockLevel(ctx *fiber.Ctx) error
+	GetStockLevels(ctx *fiber.Ctx) error
+	GetLowStock(ctx *fiber.Ctx) error
+	ExportPurchaseOrders(ctx *fiber.Ctx) error
 }
 
 type pharmacyOwnerController struct {
@@ -150,6 +173,10 @@ func (c *pharmacyOwnerController) NewPharmacyBranch(ctx *fiber.Ctx) error {
 		return err
 	}
 
+	if err := newBranch.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
 	err := c.service.NewPharmacyBranch(ctx.Locals("pharmacyOwnerId").(uuid.UUID), newBranch)
 	if err != nil {
 		return err
@@ -167,12 +194,315 @@ func (c *pharmacyOwnerController) NewPharmacist(ctx *fiber.Ctx) error {
 	fmt.Println(newPharmacist)
 
 	if err := c.service.NewPharmacist(ctx.Locals("pharmacyOwnerId").(uuid.UUID), newPharmacist); err != nil {
-		return err
+		return branchError(ctx, err)
 	}
 
 	return nil
 }
 
+func (c *pharmacyOwnerController) GetBranch(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerGetBranch)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	branch := new(dto.ResponsePharmacyOwnerBranch)
+
+	if err := c.service.GetBranch(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query, branch); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(branch)
+}
+
+func (c *pharmacyOwnerController) UpdateBranch(ctx *fiber.Ctx) error {
+	update := new(dto.RequestPharmacyOwnerUpdateBranch)
+
+	if err := ctx.BodyParser(update); err != nil {
+		return err
+	}
+
+	if err := update.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.UpdateBranch(ctx.Locals("pharmacyOwnerId").(uuid.UUID), update); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) SetBranchOpeningHours(ctx *fiber.Ctx) error {
+	hours := new(dto.RequestPharmacyOwnerBranchHours)
+
+	if err := ctx.BodyParser(hours); err != nil {
+		return err
+	}
+
+	if err := hours.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.SetBranchOpeningHours(ctx.Locals("pharmacyOwnerId").(uuid.UUID), hours); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) NewBranchHoliday(ctx *fiber.Ctx) error {
+	holiday := new(dto.RequestPharmacyOwnerNewBranchHoliday)
+
+	if err := ctx.BodyParser(holiday); err != nil {
+		return err
+	}
+
+	if err := holiday.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.NewBranchHoliday(ctx.Locals("pharmacyOwnerId").(uuid.UUID), holiday); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) DeleteBranchHoliday(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerDeleteBranchHoliday)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := c.service.DeleteBranchHoliday(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) CloseBranch(ctx *fiber.Ctx) error {
+	closure := new(dto.RequestPharmacyOwnerCloseBranch)
+
+	if err := ctx.BodyParser(closure); err != nil {
+		return err
+	}
+
+	if err := closure.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.CloseBranch(ctx.Locals("pharmacyOwnerId").(uuid.UUID), closure); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) ReopenBranch(ctx *fiber.Ctx) error {
+	reopen := new(dto.RequestPharmacyOwnerReopenBranch)
+
+	if err := ctx.BodyParser(reopen); err != nil {
+		return err
+	}
+
+	if err := c.service.ReopenBranch(ctx.Locals("pharmacyOwnerId").(uuid.UUID), reopen); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) DecommissionBranch(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerDecommissionBranch)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := c.service.DecommissionBranch(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query); err != nil {
+		return branchError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) TransferStock(ctx *fiber.Ctx) error {
+	transfer := new(dto.RequestPharmacyOwnerStockTransfer)
+
+	if err := ctx.BodyParser(transfer); err != nil {
+		return err
+	}
+
+	if err := transfer.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.TransferStock(ctx.Locals("pharmacyOwnerId").(uuid.UUID), transfer); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) GetStockHistory(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerStockHistory)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	movementsDto := new(dto.ResponseList[dto.ResponseStockMovement])
+
+	if err := c.service.GetStockHistory(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query, movementsDto); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(movementsDto)
+}
+
+func (c *pharmacyOwnerController) ReconcileStock(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerStockReconciliation)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	reconciliation := new(dto.ResponseStockReconciliation)
+
+	if err := c.service.ReconcileStock(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query, reconciliation); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(reconciliation)
+}
+
+func (c *pharmacyOwnerController) GetExpiringStock(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerExpiringStock)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	stockDto := new([]dto.ResponseExpiringStock)
+
+	if err := c.service.GetExpiringStock(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query, stockDto); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(*stockDto)
+}
+
+func (c *pharmacyOwnerController) SetStockLevel(ctx *fiber.Ctx) error {
+	level := new(dto.RequestPharmacyOwnerStockLevel)
+
+	if err := ctx.BodyParser(level); err != nil {
+		return err
+	}
+
+	if err := level.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.SetStockLevel(ctx.Locals("pharmacyOwnerId").(uuid.UUID), level); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) DeleteStockLevel(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerDeleteStockLevel)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := c.service.DeleteStockLevel(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacyOwnerController) GetStockLevels(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerStockLevels)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	levelsDto := new([]dto.ResponseStockLevel)
+
+	if err := c.service.GetStockLevels(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query, levelsDto); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(*levelsDto)
+}
+
+func (c *pharmacyOwnerController) GetLowStock(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerStockLevels)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	levelsDto := new([]dto.ResponseStockLevel)
+
+	if err := c.service.GetLowStock(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query, levelsDto); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(*levelsDto)
+}
+
+func (c *pharmacyOwnerController) ExportPurchaseOrders(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacyOwnerStockLevels)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	orders := new(bytes.Buffer)
+
+	if err := c.service.ExportPurchaseOrders(ctx.Locals("pharmacyOwnerId").(uuid.UUID), query, orders); err != nil {
+		return stockError(ctx, err)
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	ctx.Attachment(fmt.Sprintf("purchase-orders-%s.csv", time.Now().Format(time.DateOnly)))
+
+	return ctx.Status(fiber.StatusOK).Send(orders.Bytes())
+}
+
+// branchError answers a change to a branch that is not there or cannot take it in its state
+func branchError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repo.ErrBranchDecommissioned),
+		errors.Is(err, repo.ErrBranchNotClosed),
+		errors.Is(err, repo.ErrBranchNotEmpty):
+		return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+	case errors.Is(err, repo.ErrTransferBranchInvalid):
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+	}
+
+	return err
+}
+
 type PharmacistController interface {
 	Login(ctx *fiber.Ctx) error
 	Logout(ctx *fiber.Ctx) error
@@ -181,8 +511,16 @@ type PharmacistController interface {
 	GetCitizenPrescription(ctx *fiber.Ctx) error
 	FulfillPrescription(ctx *fiber.Ctx) error
 	FulfillMedicamentFromPrescription(ctx *fiber.Ctx) error
+	GetPrescriptionHistory(ctx *fiber.Ctx) error
+	ResolvePrescription(ctx *fiber.Ctx) error
+
+	GetReservations(ctx *fiber.Ctx) error
+	FulfillReservation(ctx *fiber.Ctx) error
 
 	AddMedicamentToBranchStorage(ctx *fiber.Ctx) error
+	AdjustStock(ctx *fiber.Ctx) error
+	WriteOffStock(ctx *fiber.Ctx) error
+	GetStockHistory(ctx *fiber.Ctx) error
 	GetMedicamentsByCommonName(ctx *fiber.Ctx) error
 }
 
@@ -292,7 +630,7 @@ func (c *pharmacistController) FulfillPrescription(ctx *fiber.Ctx) error {
 	}
 
 	if err := c.service.FulfillWholePrescription(ctx.Locals("pharmacistId").(uuid.UUID), input); err != nil {
-		return err
+		return signatureError(ctx, err)
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(nil)
@@ -305,9 +643,80 @@ func (c *pharmacistController) FulfillMedicamentFromPrescription(ctx *fiber.Ctx)
 		return err
 	}
 
-	if err := c.service.FulfillMedicamentFromPrescription(input); err != nil {
+	if err := c.service.FulfillMedicamentFromPrescription(ctx.Locals("pharmacistId").(uuid.UUID), input); err != nil {
+		return signatureError(ctx, err)
+	}
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacistController) ResolvePrescription(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacistResolvePrescription)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	prescriptionDto := new(dto.ResponsePharmacistCitizenPrescription)
+
+	if err := c.service.ResolvePrescription(query, prescriptionDto); err != nil {
+		switch {
+		case errors.Is(err, service.ErrVerificationMissing), errors.Is(err, service.ErrVerificationCodeInvalid):
+			return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+		case errors.Is(err, service.ErrQrPayloadInvalid):
+			return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+		case errors.Is(err, service.ErrPrescriptionRevoked):
+			return ctx.Status(fiber.StatusGone).JSON(err.Error())
+		case errors.Is(err, service.ErrPrescriptionSuperseded), errors.Is(err, repo.ErrPrescriptionNotDispensable):
+			return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+		}
+		return signatureError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(prescriptionDto)
+}
+
+func (c *pharmacistController) GetPrescriptionHistory(ctx *fiber.Ctx) error {
+	query := new(dto.QueryPharmacistGetPrescriptionHistory)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	historyDto := new([]dto.ResponsePrescriptionVersion)
+
+	if err := c.service.GetPrescriptionHistory(query, historyDto); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(historyDto)
+}
+
+func (c *pharmacistController) GetReservations(ctx *fiber.Ctx) error {
+	reservations := new([]dto.ResponseReservation)
+
+	if err := c.service.GetReservations(ctx.Locals("pharmacistId").(uuid.UUID), reservations); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(reservations)
+}
+
+func (c *pharmacistController) FulfillReservation(ctx *fiber.Ctx) error {
+	input := new(dto.RequestPharmacistFulfillReservation)
+
+	if err := ctx.BodyParser(input); err != nil {
 		return err
 	}
+
+	if err := c.service.FulfillReservation(ctx.Locals("pharmacistId").(uuid.UUID), input); err != nil {
+		if err := signatureError(ctx, err); err != nil {
+			return reservationError(ctx, err)
+		}
+		return nil
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(nil)
 }
 
@@ -317,12 +726,74 @@ func (c *pharmacistController) AddMedicamentToBranchStorage(ctx *fiber.Ctx) erro
 	if err := ctx.BodyParser(input); err != nil {
 		return err
 	}
+
+	if err := input.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
 	if err := c.service.AddMedicamentToBranchStorage(ctx.Locals("pharmacistId").(uuid.UUID), input); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacistController) AdjustStock(ctx *fiber.Ctx) error {
+	input := new(dto.RequestPharmacistStockAdjustment)
+
+	if err := ctx.BodyParser(input); err != nil {
 		return err
 	}
+
+	if err := input.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.AdjustStock(ctx.Locals("pharmacistId").(uuid.UUID), input); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
+
+func (c *pharmacistController) WriteOffStock(ctx *fiber.Ctx) error {
+	input := new(dto.RequestPharmacistStockWriteOff)
+
+	if err := ctx.BodyParser(input); err != nil {
+		return err
+	}
+
+	if err := input.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.WriteOffStock(ctx.Locals("pharmacistId").(uuid.UUID), input); err != nil {
+		return stockError(ctx, err)
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(nil)
 }
 
+func (c *pharmacistController) GetStockHistory(ctx *fiber.Ctx) error {
+	query := new(dto.QueryStockHistory)
+
+	if err := ctx.QueryParser(query); err != nil {
+		return err
+	}
+
+	if err := query.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	movementsDto := new(dto.ResponseList[dto.ResponseStockMovement])
+
+	if err := c.service.GetStockHistory(ctx.Locals("pharmacistId").(uuid.UUID), query, movementsDto); err != nil {
+		return stockError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(movementsDto)
+}
+
 func (c *pharmacistController) GetMedicamentsByCommonName(ctx *fiber.Ctx) error {
 	commonName := new(dto.QueryDoctorGetMedicamentByCommonName)
 
@@ -339,3 +810,14 @@ func (c *pharmacistController) GetMedicamentsByCommonName(ctx *fiber.Ctx) error
 
 	return ctx.Status(200).JSON(medicamentsDto)
 }
+
+// signatureError refuses prescriptions whose signature does not hold
+func signatureError(ctx *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrPrescriptionUnsigned) ||
+		errors.Is(err, service.ErrSignatureInvalid) ||
+		errors.Is(err, service.ErrSigningKeyRevoked) {
+		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(err.Error())
+	}
+
+	return err
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"medico/dto"
+	"medico/repo"
+	"medico/service"
+)
+
+// registrationError answers a registration that cannot move on from the state it is in
+func registrationError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repo.ErrRegistrationNotPending),
+		errors.Is(err, repo.ErrRegistrationNotReturned),
+		errors.Is(err, repo.ErrOwnerEmailTaken):
+		return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+	case errors.Is(err, service.ErrRegistrationPasswordMismatch):
+		return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+	}
+
+	return err
+}
+
+// PharmacyRegistrationController serves the public registration of pharmacy chains. The
+// reference returned on submission is all an applicant needs to follow their registration.
+type PharmacyRegistrationController interface {
+	Submit(ctx *fiber.Ctx) error
+	Status(ctx *fiber.Ctx) error
+	Resubmit(ctx *fiber.Ctx) error
+}
+
+type pharmacyRegistrationController struct {
+	service service.PharmacyRegistrationService
+}
+
+func NewPharmacyRegistrationController() PharmacyRegistrationController {
+	return &pharmacyRegistrationController{service: service.NewPharmacyRegistrationService()}
+}
+
+func (c *pharmacyRegistrationController) Submit(ctx *fiber.Ctx) error {
+	register := new(dto.RequestPharmacyRegistration)
+
+	if err := ctx.BodyParser(register); err != nil {
+		return err
+	}
+
+	if err := register.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	submitted := new(dto.ResponsePharmacyRegistrationSubmitted)
+
+	if err := c.service.SubmitRegistration(register, submitted); err != nil {
+		return registrationError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(submitted)
+}
+
+func (c *pharmacyRegistrationController) Status(ctx *fiber.Ctx) error {
+	registrationId := new(dto.QueryPharmacyRegistrationStatus)
+
+	if err := ctx.QueryParser(registrationId); err != nil {
+		return err
+	}
+
+	status := new(dto.ResponsePharmacyRegistrationStatus)
+
+	if err := c.service.FindRegistrationStatus(registrationId, status); err != nil {
+		return registrationError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(status)
+}
+
+func (c *pharmacyRegistrationController) Resubmit(ctx *fiber.Ctx) error {
+	resubmit := new(dto.RequestPharmacyRegistrationResubmit)
+
+	if err := ctx.BodyParser(resubmit); err != nil {
+		return err
+	}
+
+	if err := resubmit.Validate(); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(err.Error())
+	}
+
+	if err := c.service.ResubmitRegistration(resubmit); err != nil {
+		return registrationError(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(nil)
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"medico/repo"
+)
+
+// reservationError answers a reservation that cannot be made, picked up or cancelled
+func reservationError(ctx *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, repo.ErrReservationNotActive),
+		errors.Is(err, repo.ErrPrescriptionReserved),
+		errors.Is(err, repo.ErrInsufficientStock),
+		errors.Is(err, repo.ErrPrescriptionNotDispensable),
+		errors.Is(err, repo.ErrNothingToReserve),
+		errors.Is(err, repo.ErrNothingToDispense),
+		errors.Is(err, repo.ErrBranchNotReservable):
+		return ctx.Status(fiber.StatusConflict).JSON(err.Error())
+	case errors.Is(err, repo.ErrReservationOtherBranch):
+		return ctx.Status(fiber.StatusForbidden).JSON(err.Error())
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ctx.Status(fiber.StatusNotFound).JSON(err.Error())
+	}
+
+	return err
+}
@@ -41,10 +41,46 @@ func (a *RequestAdminCreateModerator) Validate() error {
 		validateModeratorType(a.Type))
 }
 
+type QueryAdminGetModerators struct {
+	QueryList
+	Name    string `query:"name"`
+	Email   string `query:"email"`
+	Type    string `query:"type"`
+	Deleted bool   `query:"deleted"`
+}
+
+func (a *QueryAdminGetModerators) Validate() error {
+	errs := []error{a.QueryList.Validate()}
+	if a.Type != "" {
+		errs = append(errs, validateModeratorType(a.Type))
+	}
+	return errors.Join(errs...)
+}
+
 type QueryAdminDeleteModerator struct {
 	ModeratorId uuid.UUID `query:"moderatorId"`
 }
 
+type QueryAdminRestoreModerator struct {
+	ModeratorId uuid.UUID `query:"moderatorId"`
+}
+
+// QueryAdminPurge names a soft-deleted record to remove for good
+type QueryAdminPurge struct {
+	Id uuid.UUID `query:"id"`
+}
+
+type ResponseAdminReference struct {
+	Table string `json:"table"`
+	Count int64  `json:"count"`
+}
+
+// ResponseAdminPurgeBlocked lists what still references a record that could not be purged
+type ResponseAdminPurgeBlocked struct {
+	Message    string                   `json:"message"`
+	References []ResponseAdminReference `json:"references"`
+}
+
 type ResponseAdminGetModerator struct {
 	ID         uuid.UUID            `json:"id"`
 	FirstName  string               `json:"firstName"`
@@ -52,4 +88,25 @@ type ResponseAdminGetModerator struct {
 	LastName   string               `json:"lastName"`
 	Email      string               `json:"email"`
 	Type       common.ModeratorType `json:"type"`
+	Version    uint                 `json:"version"`
+}
+
+type RequestAdminUpdateModerator struct {
+	ModeratorId uuid.UUID `json:"moderatorId"`
+	Version     uint      `json:"version"`
+	FirstName   *string   `json:"firstName"`
+	SecondName  *string   `json:"secondName"`
+	LastName    *string   `json:"lastName"`
+	Email       *string   `json:"email"`
+	Type        *string   `json:"type"`
+}
+
+func (a *RequestAdminUpdateModerator) Validate() error {
+	return errors.Join(
+		validateVersion(a.Version),
+		validateIfSet(a.FirstName, validateName),
+		validateIfSet(a.SecondName, validateName),
+		validateIfSet(a.LastName, validateName),
+		validateIfSet(a.Email, validateEmail),
+		validateIfSet(a.Type, validateModeratorType))
 }
@@ -0,0 +1,53 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+type QueryAdminGetAuditEntries struct {
+	QueryList
+	ActorId    *uuid.UUID `query:"actorId"`
+	ActorRole  string     `query:"actorRole"`
+	Action     string     `query:"action"`
+	EntityType string     `query:"entityType"`
+	EntityId   *uuid.UUID `query:"entityId"`
+	From       *time.Time `query:"from"`
+	To         *time.Time `query:"to"`
+}
+
+func (a *QueryAdminGetAuditEntries) Validate() error {
+	errs := []error{a.QueryList.Validate()}
+
+	if a.From != nil && a.To != nil && !a.From.Before(*a.To) {
+		errs = append(errs, ErrAuditPeriodInvalid)
+	}
+
+	return errors.Join(errs...)
+}
+
+type ResponseAdminAuditEntry struct {
+	ID         uuid.UUID       `json:"id"`
+	Sequence   uint64          `json:"sequence"`
+	ActorId    uuid.UUID       `json:"actorId"`
+	ActorRole  string          `json:"actorRole"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType"`
+	EntityId   uuid.UUID       `json:"entityId"`
+	Diff       json.RawMessage `json:"diff"`
+	IP         string          `json:"ip"`
+	RequestId  string          `json:"requestId"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Hash       string          `json:"hash"`
+}
+
+// ResponseAdminAuditVerification is the outcome of checking the audit chain. BrokenAt is the
+// sequence number of the first entry that failed the check.
+type ResponseAdminAuditVerification struct {
+	Valid    bool    `json:"valid"`
+	Checked  uint64  `json:"checked"`
+	BrokenAt *uint64 `json:"brokenAt,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
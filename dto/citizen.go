@@ -6,6 +6,11 @@ import (
 	"time"
 )
 
+const (
+	SexMale   = "male"
+	SexFemale = "female"
+)
+
 type RequestCitizenLogin struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -35,28 +40,136 @@ type ResponseCitizenPersonalDoctor struct {
 	Email      string `json:"email"`
 }
 
+// QueryCitizenAvailablePharmacyGet searches the pharmacies around the citizen. Radius is in
+// kilometres and falls back to a default when it is not given.
 type QueryCitizenAvailablePharmacyGet struct {
 	PrescriptionId uuid.UUID `query:"prescriptionId"`
+	Latitude       float32   `query:"latitude"`
+	Longitude      float32   `query:"longitude"`
+	Radius         float32   `query:"radius"`
+}
+
+func (q *QueryCitizenAvailablePharmacyGet) Validate() error {
+	return errors.Join(
+		validateCoordinates(q.Latitude, q.Longitude),
+		validateSearchRadius(q.Radius))
 }
 
+// MaxSearchRadius is the widest area in kilometres a pharmacy search may cover
+const MaxSearchRadius = 100
+
+// How much of the open prescription lines a pharmacy has in stock
+const (
+	CoverageAll  = "all"
+	CoverageSome = "some"
+	CoverageNone = "none"
+)
+
 type ResponseCitizenAvailablePharmacy struct {
-	Name      string  `json:"name"`
-	Latitude  float32 `json:"latitude"`
-	Longitude float32 `json:"longitude"`
+	Id        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address"`
+	Latitude  float32   `json:"latitude"`
+	Longitude float32   `json:"longitude"`
+	// Distance is the great-circle distance from the citizen in kilometres
+	Distance     float64 `json:"distance"`
+	Coverage     string  `json:"coverage"`
+	CoveredLines int     `json:"coveredLines"`
+	TotalLines   int     `json:"totalLines"`
 }
 
-type ResponseCitizenPrescription struct {
-	ID        uuid.UUID `json:"id"`
+// QueryCitizenMedicamentAvailability looks for medicaments sold without a prescription in the
+// pharmacies around the citizen. Search matches the name, the ATC code or an active ingredient.
+type QueryCitizenMedicamentAvailability struct {
+	Search    string  `query:"search"`
+	Latitude  float32 `query:"latitude"`
+	Longitude float32 `query:"longitude"`
+	Radius    float32 `query:"radius"`
+}
+
+func (q *QueryCitizenMedicamentAvailability) Validate() error {
+	return errors.Join(
+		validateSearchTerm(q.Search),
+		validateCoordinates(q.Latitude, q.Longitude),
+		validateSearchRadius(q.Radius))
+}
+
+// How much of a medicament a pharmacy has, citizens are not shown the exact quantity
+const (
+	StockAvailable = "available"
+	StockLow       = "low"
+	StockOut       = "out"
+)
+
+type ResponseMedicamentPharmacyStock struct {
+	Id        uuid.UUID `json:"id"`
 	Name      string    `json:"name"`
-	State     string    `json:"status"`
-	StartDate time.Time `json:"issuedDate"`
+	Address   string    `json:"address"`
+	Latitude  float32   `json:"latitude"`
+	Longitude float32   `json:"longitude"`
+	Distance  float64   `json:"distance"`
+	Stock     string    `json:"stock"`
+}
+
+type ResponseCitizenMedicamentAvailability struct {
+	Id                uuid.UUID                         `json:"id"`
+	OfficialName      string                            `json:"officialName"`
+	BulgarianName     string                            `json:"bulgarianName"`
+	ATC               string                            `json:"atc"`
+	ActiveIngredients string                            `json:"activeIngredients"`
+	Pharmacies        []ResponseMedicamentPharmacyStock `json:"pharmacies"`
+}
+
+type ResponseCitizenPrescription struct {
+	ID        uuid.UUID                   `json:"id"`
+	Name      string                      `json:"name"`
+	State     string                      `json:"status"`
+	Version   uint                        `json:"version"`
+	Code      string                      `json:"code"`
+	StartDate time.Time                   `json:"issuedDate"`
+	Hospital  *ResponseHospital           `json:"hospital"`
+	Refills   ResponsePrescriptionRefills `json:"refills"`
 	Doctor    struct {
 		FirstName string `json:"firstName"`
 		LastName  string `json:"lastName"`
 		UIN       string `json:"uin"`
 	} `json:"doctor"`
-	Medicaments []struct {
-		Name     string `json:"officialName"`
-		Quantity uint   `json:"quantity"`
-	} `json:"medicaments"`
+	Medicaments []ResponseCitizenPrescriptionMedicament `json:"medicaments"`
+}
+
+type ResponseCitizenPrescriptionMedicament struct {
+	Name     string                     `json:"officialName"`
+	Quantity uint                       `json:"quantity"`
+	Dosage   ResponsePrescriptionDosage `json:"dosage"`
+}
+
+type QueryCitizenGetHospitals struct {
+	Name string `query:"name"`
+}
+
+type QueryCitizenGetDoctorsByHospital struct {
+	HospitalId uuid.UUID `query:"hospitalId"`
+	Name       string    `query:"name"`
+}
+
+type ResponseCitizenHospitalDoctor struct {
+	ID        uuid.UUID        `json:"id"`
+	FirstName string           `json:"firstName"`
+	LastName  string           `json:"lastName"`
+	UIN       string           `json:"uin"`
+	Role      string           `json:"role"`
+	Hospital  ResponseHospital `json:"hospital"`
+}
+
+type QueryCitizenGetPrescriptionHistory struct {
+	PrescriptionId uuid.UUID `query:"prescriptionId"`
+}
+
+type QueryCitizenPrescriptionVerification struct {
+	PrescriptionId uuid.UUID `query:"prescriptionId"`
+}
+
+type ResponseCitizenPrescriptionVerification struct {
+	Code      string `json:"code"`
+	QrPayload string `json:"qrPayload"`
 }
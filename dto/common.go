@@ -1,5 +1,10 @@
 package dto
 
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
 type Modeler interface {
 	FromModel(interface{}) error
 	ToModel(interface{}) error
@@ -12,3 +17,95 @@ type Validator interface {
 type Defaulter interface {
 	ToDefault()
 }
+
+type ResponseHospital struct {
+	ID          uuid.UUID `json:"id"`
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	City        string    `json:"city"`
+	PhoneNumber string    `json:"phoneNumber"`
+}
+
+type ResponseSpecialty struct {
+	ID   uuid.UUID `json:"id"`
+	Code string    `json:"code"`
+	Name string    `json:"name"`
+}
+
+type RequestPrescriptionDosage struct {
+	Amount       float32  `json:"amount"`
+	Unit         string   `json:"unit"`
+	TimesPerDay  uint8    `json:"timesPerDay"`
+	TimesOfDay   []string `json:"timesOfDay"`
+	DurationDays uint16   `json:"durationDays"`
+	Route        string   `json:"route"`
+	Notes        string   `json:"notes"`
+}
+
+type ResponsePrescriptionDosage struct {
+	Amount       float32  `json:"amount"`
+	Unit         string   `json:"unit"`
+	TimesPerDay  uint8    `json:"timesPerDay"`
+	TimesOfDay   []string `json:"timesOfDay"`
+	DurationDays uint16   `json:"durationDays"`
+	Route        string   `json:"route"`
+	Notes        string   `json:"notes"`
+	Sig          string   `json:"sig"`
+}
+
+type ResponsePrescriptionRefills struct {
+	Total            uint       `json:"total"`
+	Remaining        uint       `json:"remaining"`
+	IntervalDays     uint       `json:"intervalDays"`
+	Cancelled        bool       `json:"cancelled"`
+	NextDispenseDate *time.Time `json:"nextDispenseDate"`
+}
+
+type ResponsePrescriptionVersion struct {
+	Id                uuid.UUID         `json:"id"`
+	Version           uint              `json:"version"`
+	PreviousVersionId *uuid.UUID        `json:"previousVersionId"`
+	Name              string            `json:"name"`
+	State             string            `json:"status"`
+	Hospital          *ResponseHospital `json:"hospital"`
+	Doctor            struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+		UIN       string `json:"uin"`
+	} `json:"doctor"`
+	Medicaments      []ResponsePrescriptionVersionMedicament `json:"medicaments"`
+	CreationDate     time.Time                               `json:"createdDate"`
+	EndDate          time.Time                               `json:"endDate"`
+	AmendmentReason  string                                  `json:"amendmentReason"`
+	RevokedAt        *time.Time                              `json:"revokedAt"`
+	RevocationReason string                                  `json:"revocationReason"`
+}
+
+type ResponsePrescriptionVersionMedicament struct {
+	Id           uuid.UUID                  `json:"id"`
+	OfficialName string                     `json:"officialName"`
+	Quantity     uint                       `json:"quantity"`
+	Dosage       ResponsePrescriptionDosage `json:"dosage"`
+}
+
+type QueryChangeHistory struct {
+	Id uuid.UUID `query:"id"`
+}
+
+type ResponseUpdated struct {
+	Version uint `json:"version"`
+}
+
+type ResponseChangeField struct {
+	Field    string `json:"field"`
+	OldValue string `json:"oldValue"`
+	NewValue string `json:"newValue"`
+}
+
+type ResponseChange struct {
+	Version   uint                  `json:"version"`
+	ChangedBy uuid.UUID             `json:"changedBy"`
+	ChangedAt time.Time             `json:"changedAt"`
+	Fields    []ResponseChangeField `json:"fields"`
+}
@@ -18,19 +18,44 @@ func (d *RequestDoctorLogin) Validate() error {
 }
 
 type RequestDoctorCreatePrescription struct {
-	CitizenId   uuid.UUID `json:"citizenId"`
-	Name        string    `json:"name"`
-	EndDate     time.Time `json:"end_date"`
-	Medicaments []struct {
-		Id       uuid.UUID `json:"id"`
-		Quantity uint      `json:"quantity"`
-	} `json:"medicaments"`
+	CitizenId  uuid.UUID  `json:"citizenId"`
+	HospitalId *uuid.UUID `json:"hospitalId"`
+	Name       string     `json:"name"`
+	// StartDate postpones dispensing, prescriptions without one can be dispensed right away
+	StartDate          *time.Time                            `json:"startDate"`
+	EndDate            time.Time                             `json:"end_date"`
+	Refills            uint                                  `json:"refills"`
+	RefillIntervalDays uint                                  `json:"refillIntervalDays"`
+	Medicaments        []RequestDoctorPrescriptionMedicament `json:"medicaments"`
+	// SubmissionId identifies the FHIR submission the prescription is created from
+	SubmissionId string `json:"-"`
+}
+
+type RequestDoctorPrescriptionMedicament struct {
+	Id       uuid.UUID                  `json:"id"`
+	Quantity uint                       `json:"quantity"`
+	Dosage   *RequestPrescriptionDosage `json:"dosage"`
 }
 
 func (d *RequestDoctorCreatePrescription) Validate() error {
-	return errors.Join(
+	errs := []error{
 		validateNameLength(d.Name, 3, 32),
-		validateTime(d.EndDate, time.Now(), TimeAfter))
+		validateTime(d.EndDate, time.Now(), TimeAfter),
+		validateRefills(d.Refills, d.RefillIntervalDays),
+	}
+
+	if d.StartDate != nil {
+		errs = append(errs, validateTime(d.EndDate, *d.StartDate, TimeAfter))
+	}
+
+	// The dosage is optional so that clients written before structured dosages keep working.
+	for i := range d.Medicaments {
+		if d.Medicaments[i].Dosage != nil {
+			errs = append(errs, validateDosage(d.Medicaments[i].Dosage))
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
 type QueryDoctorGetCitizenInfo struct {
@@ -57,16 +82,22 @@ type ResponseDoctorCitizenInfo struct {
 }
 
 type ResponseDoctorGetCitizenPrescription struct {
-	Id          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Medicaments []struct {
-		OfficialName string `json:"officialName"`
-		Quantity     uint   `json:"quantity"`
-	} `json:"medicaments"`
-	State       string    `json:"status"`
-	CreatedDate time.Time `json:"createdDate"`
-	StartDate   time.Time `json:"issuedDate"`
-	EndDate     time.Time `json:"endDate"`
+	Id          uuid.UUID                                     `json:"id"`
+	Name        string                                        `json:"name"`
+	Medicaments []ResponseDoctorCitizenPrescriptionMedicament `json:"medicaments"`
+	State       string                                        `json:"status"`
+	Version     uint                                          `json:"version"`
+	Hospital    *ResponseHospital                             `json:"hospital"`
+	Refills     ResponsePrescriptionRefills                   `json:"refills"`
+	CreatedDate time.Time                                     `json:"createdDate"`
+	StartDate   time.Time                                     `json:"issuedDate"`
+	EndDate     time.Time                                     `json:"endDate"`
+}
+
+type ResponseDoctorCitizenPrescriptionMedicament struct {
+	OfficialName string                     `json:"officialName"`
+	Quantity     uint                       `json:"quantity"`
+	Dosage       ResponsePrescriptionDosage `json:"dosage"`
 }
 
 type QueryDoctorGetMedicamentByCommonName struct {
@@ -77,3 +108,59 @@ type ResponseDoctorGetMedicamentPrescription struct {
 	Id   uuid.UUID `json:"id"`
 	Name string    `json:"officialName"`
 }
+
+type ResponseDoctorAffiliation struct {
+	ID        uuid.UUID        `json:"id"`
+	Hospital  ResponseHospital `json:"hospital"`
+	Role      string           `json:"role"`
+	StartDate time.Time        `json:"startDate"`
+	EndDate   *time.Time       `json:"endDate"`
+}
+
+type ResponseDoctorCreatedPrescription struct {
+	Id   uuid.UUID `json:"id"`
+	Code string    `json:"code"`
+}
+
+type ResponseDoctorBlockedMedicament struct {
+	Id                 uuid.UUID           `json:"id"`
+	OfficialName       string              `json:"officialName"`
+	AllowedSpecialties []ResponseSpecialty `json:"allowedSpecialties"`
+}
+
+type ResponseDoctorPrescriptionBlocked struct {
+	Message     string                            `json:"message"`
+	Medicaments []ResponseDoctorBlockedMedicament `json:"medicaments"`
+}
+
+type RequestDoctorCancelRefills struct {
+	PrescriptionId uuid.UUID `json:"prescriptionId"`
+}
+
+type RequestDoctorRevokePrescription struct {
+	PrescriptionId uuid.UUID `json:"prescriptionId"`
+	Reason         string    `json:"reason"`
+}
+
+func (d *RequestDoctorRevokePrescription) Validate() error {
+	return validateReason(d.Reason)
+}
+
+// RequestDoctorAmendPrescription replaces a prescription with a new version. The citizen is
+// carried over from the amended prescription.
+type RequestDoctorAmendPrescription struct {
+	PrescriptionId uuid.UUID `json:"prescriptionId"`
+	Reason         string    `json:"reason"`
+	RequestDoctorCreatePrescription
+}
+
+func (d *RequestDoctorAmendPrescription) Validate() error {
+	return errors.Join(
+		validateReason(d.Reason),
+		d.RequestDoctorCreatePrescription.Validate(),
+	)
+}
+
+type QueryDoctorGetPrescriptionHistory struct {
+	PrescriptionId uuid.UUID `query:"prescriptionId"`
+}
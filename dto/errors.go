@@ -36,11 +36,85 @@ const (
 )
 
 const (
-	UcnInvalid = "ucn of citizen is invalid"
+	UcnInvalid          = "ucn of citizen is invalid"
+	UcnInvalidChecksum  = "ucn of citizen has an invalid checksum"
+	UcnInvalidBirthDate = "ucn of citizen encodes an invalid birth date"
+	UcnBirthdayMismatch = "birthday does not match the ucn of citizen"
+	UcnSexMismatch      = "sex does not match the ucn of citizen"
 )
 
 const (
-	CoordinatesInvalid = "coordinates are invalid"
+	CoordinatesInvalid  = "coordinates are invalid"
+	SearchRadiusInvalid = "search radius must be between 0 and 100 kilometres"
+	SearchTermInvalid   = "search must contain between 2 and 64 characters"
+)
+
+const (
+	DoseAmountInvalid = "dose amount must be greater than zero"
+	DoseUnitInvalid   = "provided dose unit is not valid"
+	DoseFrequency     = "dose frequency must be between 1 and 24 times per day"
+	DoseTimeOfDay     = "provided time of day is not valid"
+	DoseDuration      = "dose duration must be between 1 and 365 days"
+	DoseRouteInvalid  = "provided administration route is not valid"
+	DoseNotesTooLong  = "dosage notes must contain at most 500 characters"
+)
+
+const (
+	RefillsOutOfRange        = "refills must be between 0 and 12"
+	RefillIntervalOutOfRange = "refill interval must be between 1 and 180 days"
+)
+
+const (
+	ReasonInvalidNumberOfChars = "reason must contain between 3 and 500 characters"
+)
+
+const (
+	AuditPeriodInvalid = "audit period must end after it starts"
+)
+
+const (
+	VersionMissing = "version of the record being changed is required"
+)
+
+const (
+	ListPageInvalid = "page must be a positive number"
+	ListSizeInvalid = "size must be between 1 and 100"
+)
+
+const (
+	FhirResourceInvalid = "fhir resource is invalid"
+)
+
+const (
+	CompanyNumberInvalid        = "company number must be 9 or 13 digits"
+	LicenceNumberInvalid        = "licence number must contain between 3 and 32 characters"
+	AddressInvalid              = "address must contain between 5 and 300 characters"
+	PhoneNumberInvalid          = "phone number is invalid"
+	RegistrationDecisionInvalid = "provided registration decision is not valid"
+)
+
+const (
+	WeekdayInvalid      = "weekday must be between 0 (sunday) and 6 (saturday)"
+	WeekdayRepeated     = "opening hours may be given once per weekday"
+	OpeningHoursInvalid = "opening hours must be HH:MM and must not open and close at the same time"
+	HolidayDateInvalid  = "holiday date is required"
+	HolidayNoteTooLong  = "holiday note must contain at most 300 characters"
+)
+
+const (
+	StockQuantityInvalid     = "stock quantity must be greater than zero"
+	StockMovementTypeInvalid = "provided stock movement type is not valid"
+	StockPeriodInvalid       = "stock history period must end after it starts"
+	StockReferenceTooLong    = "stock reference must contain at most 64 characters"
+	BatchNumberInvalid       = "batch number must contain between 1 and 64 characters"
+	BatchExpiryInvalid       = "received batch cannot be expired already"
+	ExpiryWindowInvalid      = "expiry window cannot be longer than a year"
+	StockLevelInvalid        = "target stock level must be above zero and not below the minimum"
+)
+
+const (
+	HospitalTypeInvalid    = "provided hospital type is not valid"
+	AffiliationRoleInvalid = "provided affiliation role is not valid"
 )
 
 var (
@@ -77,9 +151,83 @@ var (
 )
 
 var (
-	ErrUcnInvalid = errors.New(UcnInvalid)
+	ErrUcnInvalid          = errors.New(UcnInvalid)
+	ErrUcnInvalidChecksum  = errors.New(UcnInvalidChecksum)
+	ErrUcnInvalidBirthDate = errors.New(UcnInvalidBirthDate)
+	ErrUcnBirthdayMismatch = errors.New(UcnBirthdayMismatch)
+	ErrUcnSexMismatch      = errors.New(UcnSexMismatch)
+)
+
+var (
+	ErrCoordinatesInvalid  = errors.New(CoordinatesInvalid)
+	ErrSearchRadiusInvalid = errors.New(SearchRadiusInvalid)
+	ErrSearchTermInvalid   = errors.New(SearchTermInvalid)
+)
+
+var (
+	ErrDoseAmountInvalid = errors.New(DoseAmountInvalid)
+	ErrDoseUnitInvalid   = errors.New(DoseUnitInvalid)
+	ErrDoseFrequency     = errors.New(DoseFrequency)
+	ErrDoseTimeOfDay     = errors.New(DoseTimeOfDay)
+	ErrDoseDuration      = errors.New(DoseDuration)
+	ErrDoseRouteInvalid  = errors.New(DoseRouteInvalid)
+	ErrDoseNotesTooLong  = errors.New(DoseNotesTooLong)
+)
+
+var (
+	ErrRefillsOutOfRange        = errors.New(RefillsOutOfRange)
+	ErrRefillIntervalOutOfRange = errors.New(RefillIntervalOutOfRange)
+)
+
+var (
+	ErrReasonInvalidNumberOfChars = errors.New(ReasonInvalidNumberOfChars)
+)
+
+var (
+	ErrAuditPeriodInvalid = errors.New(AuditPeriodInvalid)
+)
+
+var (
+	ErrVersionMissing = errors.New(VersionMissing)
+)
+
+var (
+	ErrListPageInvalid = errors.New(ListPageInvalid)
+	ErrListSizeInvalid = errors.New(ListSizeInvalid)
+)
+
+var (
+	ErrFhirResourceInvalid = errors.New(FhirResourceInvalid)
+)
+
+var (
+	ErrHospitalTypeInvalid    = errors.New(HospitalTypeInvalid)
+	ErrAffiliationRoleInvalid = errors.New(AffiliationRoleInvalid)
+)
+
+var (
+	ErrCompanyNumberInvalid        = errors.New(CompanyNumberInvalid)
+	ErrLicenceNumberInvalid        = errors.New(LicenceNumberInvalid)
+	ErrAddressInvalid              = errors.New(AddressInvalid)
+	ErrPhoneNumberInvalid          = errors.New(PhoneNumberInvalid)
+	ErrRegistrationDecisionInvalid = errors.New(RegistrationDecisionInvalid)
+)
+
+var (
+	ErrWeekdayInvalid      = errors.New(WeekdayInvalid)
+	ErrWeekdayRepeated     = errors.New(WeekdayRepeated)
+	ErrOpeningHoursInvalid = errors.New(OpeningHoursInvalid)
+	ErrHolidayDateInvalid  = errors.New(HolidayDateInvalid)
+	ErrHolidayNoteTooLong  = errors.New(HolidayNoteTooLong)
 )
 
 var (
-	ErrCoordinatesInvalid = errors.New(CoordinatesInvalid)
+	ErrStockQuantityInvalid     = errors.New(StockQuantityInvalid)
+	ErrStockMovementTypeInvalid = errors.New(StockMovementTypeInvalid)
+	ErrStockPeriodInvalid       = errors.New(StockPeriodInvalid)
+	ErrStockReferenceTooLong    = errors.New(StockReferenceTooLong)
+	ErrBatchNumberInvalid       = errors.New(BatchNumberInvalid)
+	ErrBatchExpiryInvalid       = errors.New(BatchExpiryInvalid)
+	ErrExpiryWindowInvalid      = errors.New(ExpiryWindowInvalid)
+	ErrStockLevelInvalid        = errors.New(StockLevelInvalid)
 )
@@ -0,0 +1,419 @@
+package dto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	FhirContentType = "application/fhir+json"
+
+	FhirUcnSystem          = "urn:medico:ucn"
+	FhirUinSystem          = "urn:medico:uin"
+	FhirPrescriptionSystem = "urn:medico:prescription"
+	FhirAtcSystem          = "http://www.whocc.no/atc"
+)
+
+// FhirResource is implemented by every FHIR resource the API serves
+type FhirResource interface {
+	FhirResourceType() string
+	FhirId() string
+}
+
+type FhirIdentifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+
+type FhirHumanName struct {
+	Use    string   `json:"use,omitempty"`
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type FhirContactPoint struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+type FhirCoding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type FhirCodeableConcept struct {
+	Coding []FhirCoding `json:"coding,omitempty"`
+	Text   string       `json:"text,omitempty"`
+}
+
+type FhirReference struct {
+	Reference  string          `json:"reference,omitempty"`
+	Identifier *FhirIdentifier `json:"identifier,omitempty"`
+	Display    string          `json:"display,omitempty"`
+}
+
+type FhirQuantity struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+	Code  string  `json:"code,omitempty"`
+}
+
+type FhirDuration struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+	Code  string  `json:"code,omitempty"`
+}
+
+type FhirPeriod struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+type FhirMeta struct {
+	VersionId   string     `json:"versionId,omitempty"`
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+}
+
+type FhirPatient struct {
+	ResourceType string             `json:"resourceType"`
+	Id           string             `json:"id"`
+	Identifier   []FhirIdentifier   `json:"identifier,omitempty"`
+	Name         []FhirHumanName    `json:"name,omitempty"`
+	Telecom      []FhirContactPoint `json:"telecom,omitempty"`
+	Gender       string             `json:"gender,omitempty"`
+	BirthDate    string             `json:"birthDate,omitempty"`
+}
+
+func (p *FhirPatient) FhirResourceType() string { return "Patient" }
+func (p *FhirPatient) FhirId() string           { return p.Id }
+
+type FhirPractitionerQualification struct {
+	Code FhirCodeableConcept `json:"code"`
+}
+
+type FhirPractitioner struct {
+	ResourceType  string                          `json:"resourceType"`
+	Id            string                          `json:"id"`
+	Identifier    []FhirIdentifier                `json:"identifier,omitempty"`
+	Active        bool                            `json:"active"`
+	Name          []FhirHumanName                 `json:"name,omitempty"`
+	Telecom       []FhirContactPoint              `json:"telecom,omitempty"`
+	Qualification []FhirPractitionerQualification `json:"qualification,omitempty"`
+}
+
+func (p *FhirPractitioner) FhirResourceType() string { return "Practitioner" }
+func (p *FhirPractitioner) FhirId() string           { return p.Id }
+
+type FhirMedication struct {
+	ResourceType string              `json:"resourceType"`
+	Id           string              `json:"id"`
+	Code         FhirCodeableConcept `json:"code"`
+	Status       string              `json:"status"`
+}
+
+func (m *FhirMedication) FhirResourceType() string { return "Medication" }
+func (m *FhirMedication) FhirId() string           { return m.Id }
+
+type FhirTimingRepeat struct {
+	BoundsDuration *FhirDuration `json:"boundsDuration,omitempty"`
+	Frequency      uint8         `json:"frequency,omitempty"`
+	Period         float64       `json:"period,omitempty"`
+	PeriodUnit     string        `json:"periodUnit,omitempty"`
+	When           []string      `json:"when,omitempty"`
+}
+
+type FhirTiming struct {
+	Repeat FhirTimingRepeat `json:"repeat"`
+}
+
+type FhirDoseAndRate struct {
+	DoseQuantity FhirQuantity `json:"doseQuantity"`
+}
+
+type FhirDosage struct {
+	Text               string               `json:"text,omitempty"`
+	PatientInstruction string               `json:"patientInstruction,omitempty"`
+	Timing             *FhirTiming          `json:"timing,omitempty"`
+	Route              *FhirCodeableConcept `json:"route,omitempty"`
+	DoseAndRate        []FhirDoseAndRate    `json:"doseAndRate,omitempty"`
+}
+
+type FhirDispenseRequest struct {
+	ValidityPeriod         *FhirPeriod   `json:"validityPeriod,omitempty"`
+	NumberOfRepeatsAllowed uint          `json:"numberOfRepeatsAllowed"`
+	Quantity               *FhirQuantity `json:"quantity,omitempty"`
+	DispenseInterval       *FhirDuration `json:"dispenseInterval,omitempty"`
+}
+
+type FhirMedicationRequest struct {
+	ResourceType              string               `json:"resourceType"`
+	Id                        string               `json:"id,omitempty"`
+	Meta                      *FhirMeta            `json:"meta,omitempty"`
+	Identifier                []FhirIdentifier     `json:"identifier,omitempty"`
+	GroupIdentifier           *FhirIdentifier      `json:"groupIdentifier,omitempty"`
+	Status                    string               `json:"status"`
+	Intent                    string               `json:"intent"`
+	MedicationReference       *FhirReference       `json:"medicationReference,omitempty"`
+	MedicationCodeableConcept *FhirCodeableConcept `json:"medicationCodeableConcept,omitempty"`
+	Subject                   FhirReference        `json:"subject"`
+	AuthoredOn                *time.Time           `json:"authoredOn,omitempty"`
+	Requester                 *FhirReference       `json:"requester,omitempty"`
+	DosageInstruction         []FhirDosage         `json:"dosageInstruction,omitempty"`
+	DispenseRequest           *FhirDispenseRequest `json:"dispenseRequest,omitempty"`
+}
+
+func (m *FhirMedicationRequest) FhirResourceType() string { return "MedicationRequest" }
+func (m *FhirMedicationRequest) FhirId() string           { return m.Id }
+
+type FhirMedicationDispense struct {
+	ResourceType            string          `json:"resourceType"`
+	Id                      string          `json:"id"`
+	Status                  string          `json:"status"`
+	MedicationReference     FhirReference   `json:"medicationReference"`
+	Subject                 FhirReference   `json:"subject"`
+	AuthorizingPrescription []FhirReference `json:"authorizingPrescription,omitempty"`
+	Quantity                FhirQuantity    `json:"quantity"`
+	WhenHandedOver          time.Time       `json:"whenHandedOver"`
+	Location                *FhirReference  `json:"location,omitempty"`
+}
+
+func (m *FhirMedicationDispense) FhirResourceType() string { return "MedicationDispense" }
+func (m *FhirMedicationDispense) FhirId() string           { return m.Id }
+
+type FhirBundleLink struct {
+	Relation string `json:"relation"`
+	Url      string `json:"url"`
+}
+
+type FhirBundleEntrySearch struct {
+	Mode string `json:"mode"`
+}
+
+type FhirBundleEntryResponse struct {
+	Status   string `json:"status"`
+	Location string `json:"location,omitempty"`
+}
+
+type FhirBundleEntry struct {
+	FullUrl  string                   `json:"fullUrl,omitempty"`
+	Resource FhirResource             `json:"resource"`
+	Search   *FhirBundleEntrySearch   `json:"search,omitempty"`
+	Response *FhirBundleEntryResponse `json:"response,omitempty"`
+}
+
+type FhirBundle struct {
+	ResourceType string            `json:"resourceType"`
+	Type         string            `json:"type"`
+	Total        *int64            `json:"total,omitempty"`
+	Link         []FhirBundleLink  `json:"link,omitempty"`
+	Entry        []FhirBundleEntry `json:"entry"`
+}
+
+type FhirOperationOutcomeIssue struct {
+	Severity    string   `json:"severity"`
+	Code        string   `json:"code"`
+	Diagnostics string   `json:"diagnostics,omitempty"`
+	Expression  []string `json:"expression,omitempty"`
+}
+
+type FhirOperationOutcome struct {
+	ResourceType string                      `json:"resourceType"`
+	Issue        []FhirOperationOutcomeIssue `json:"issue"`
+}
+
+func (o *FhirOperationOutcome) FhirResourceType() string { return "OperationOutcome" }
+func (o *FhirOperationOutcome) FhirId() string           { return "" }
+
+// QueryFhirPaging holds the paging parameters shared by every search
+type QueryFhirPaging struct {
+	Count  int `query:"_count"`
+	Offset int `query:"_offset"`
+}
+
+type QueryFhirPatientSearch struct {
+	QueryFhirPaging
+	Id         string `query:"_id"`
+	Identifier string `query:"identifier"`
+	Name       string `query:"name"`
+	BirthDate  string `query:"birthdate"`
+	Gender     string `query:"gender"`
+}
+
+type QueryFhirPractitionerSearch struct {
+	QueryFhirPaging
+	Id         string `query:"_id"`
+	Identifier string `query:"identifier"`
+	Name       string `query:"name"`
+}
+
+type QueryFhirMedicationSearch struct {
+	QueryFhirPaging
+	Id   string `query:"_id"`
+	Code string `query:"code"`
+}
+
+type QueryFhirMedicationRequestSearch struct {
+	QueryFhirPaging
+	Id         string `query:"_id"`
+	Patient    string `query:"patient"`
+	Requester  string `query:"requester"`
+	Medication string `query:"medication"`
+	Status     string `query:"status"`
+	AuthoredOn string `query:"authoredon"`
+}
+
+type QueryFhirMedicationDispenseSearch struct {
+	QueryFhirPaging
+	Id           string `query:"_id"`
+	Patient      string `query:"patient"`
+	Medication   string `query:"medication"`
+	Prescription string `query:"prescription"`
+}
+
+const (
+	FhirDefaultCount = 20
+	FhirMaxCount     = 100
+)
+
+// Normalize applies the default page size and keeps paging within bounds
+func (q *QueryFhirPaging) Normalize() {
+	if q.Count <= 0 {
+		q.Count = FhirDefaultCount
+	}
+	if q.Count > FhirMaxCount {
+		q.Count = FhirMaxCount
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+}
+
+// FhirIssueError is an error about one element of a submitted resource. Expression is the
+// FHIRPath of the element, it becomes the expression of the OperationOutcome issue.
+type FhirIssueError struct {
+	Expression string
+	Err        error
+}
+
+func (e *FhirIssueError) Error() string {
+	return e.Expression + ": " + e.Err.Error()
+}
+
+func (e *FhirIssueError) Unwrap() error {
+	return e.Err
+}
+
+// FhirIssue is an invalid element of a submitted resource
+func FhirIssue(expression, format string, args ...any) error {
+	return &FhirIssueError{
+		Expression: expression,
+		Err:        fmt.Errorf("%w: "+format, append([]any{ErrFhirResourceInvalid}, args...)...),
+	}
+}
+
+type RequestFhirBundleEntry struct {
+	FullUrl  string          `json:"fullUrl"`
+	Resource json.RawMessage `json:"resource"`
+}
+
+type RequestFhirBundle struct {
+	ResourceType string                   `json:"resourceType"`
+	Identifier   *FhirIdentifier          `json:"identifier"`
+	Type         string                   `json:"type"`
+	Entry        []RequestFhirBundleEntry `json:"entry"`
+}
+
+// RequestFhirMedicationRequest is a submitted MedicationRequest and where it was in the body
+type RequestFhirMedicationRequest struct {
+	Path     string
+	Resource FhirMedicationRequest
+}
+
+// RequestFhirSubmission is a MedicationRequest or a Bundle of them. Identifier names the
+// submission, so that submitting it again finds the prescription created the first time.
+type RequestFhirSubmission struct {
+	Identifier string
+	Requests   []RequestFhirMedicationRequest
+}
+
+// ParseFhirIfNoneExist reads an If-None-Exist header, of which only the identifier search
+// is supported
+func ParseFhirIfNoneExist(ifNoneExist string) (string, error) {
+	identifier, ok := strings.CutPrefix(ifNoneExist, "identifier=")
+	if !ok || identifier == "" || strings.Contains(identifier, "&") {
+		return "", FhirIssue("If-None-Exist", "only a search by identifier is supported")
+	}
+
+	return identifier, nil
+}
+
+// ParseFhirMedicationRequests reads a MedicationRequest or a transaction Bundle of them.
+// Every MedicationRequest of a submission is a line of the same prescription, which is why
+// batches and collections, whose entries stand on their own, are refused.
+func ParseFhirMedicationRequests(body []byte, submission *RequestFhirSubmission) error {
+	header := struct {
+		ResourceType string `json:"resourceType"`
+	}{}
+
+	if err := json.Unmarshal(body, &header); err != nil {
+		return FhirIssue("", "%s", err)
+	}
+
+	switch header.ResourceType {
+	case "MedicationRequest":
+		request := RequestFhirMedicationRequest{Path: "MedicationRequest"}
+		if err := json.Unmarshal(body, &request.Resource); err != nil {
+			return FhirIssue(request.Path, "%s", err)
+		}
+		submission.Requests = []RequestFhirMedicationRequest{request}
+		return nil
+	case "Bundle":
+	default:
+		return FhirIssue("resourceType", "expected a MedicationRequest or a Bundle")
+	}
+
+	bundle := RequestFhirBundle{}
+	if err := json.Unmarshal(body, &bundle); err != nil {
+		return FhirIssue("Bundle", "%s", err)
+	}
+
+	if bundle.Type != "transaction" {
+		return FhirIssue("Bundle.type", "bundle must be a transaction")
+	}
+
+	if len(bundle.Entry) == 0 {
+		return FhirIssue("Bundle.entry", "bundle has no entries")
+	}
+
+	if bundle.Identifier != nil && bundle.Identifier.Value != "" {
+		submission.Identifier = bundle.Identifier.Value
+		if bundle.Identifier.System != "" {
+			submission.Identifier = bundle.Identifier.System + "|" + bundle.Identifier.Value
+		}
+	}
+
+	var errs []error
+	submission.Requests = make([]RequestFhirMedicationRequest, 0, len(bundle.Entry))
+
+	for i, entry := range bundle.Entry {
+		request := RequestFhirMedicationRequest{Path: fmt.Sprintf("Bundle.entry[%d].resource", i)}
+
+		if err := json.Unmarshal(entry.Resource, &request.Resource); err != nil {
+			errs = append(errs, FhirIssue(request.Path, "%s", err))
+			continue
+		}
+		if request.Resource.ResourceType != "MedicationRequest" {
+			errs = append(errs, FhirIssue(request.Path, "only MedicationRequest entries are accepted"))
+			continue
+		}
+
+		submission.Requests = append(submission.Requests, request)
+	}
+
+	return errors.Join(errs...)
+}
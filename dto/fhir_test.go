@@ -0,0 +1,126 @@
+package dto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFhirMedicationRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		identifier string
+		paths      []string
+		expression string
+	}{
+		{
+			name:  "single request",
+			body:  `{"resourceType":"MedicationRequest","status":"active","intent":"order"}`,
+			paths: []string{"MedicationRequest"},
+		},
+		{
+			name: "transaction",
+			body: `{"resourceType":"Bundle","type":"transaction","identifier":{"system":"urn:ehr","value":"42"},"entry":[
+				{"resource":{"resourceType":"MedicationRequest"}},
+				{"resource":{"resourceType":"MedicationRequest"}}]}`,
+			identifier: "urn:ehr|42",
+			paths:      []string{"Bundle.entry[0].resource", "Bundle.entry[1].resource"},
+		},
+		{
+			name:       "identifier without system",
+			body:       `{"resourceType":"Bundle","type":"transaction","identifier":{"value":"42"},"entry":[{"resource":{"resourceType":"MedicationRequest"}}]}`,
+			identifier: "42",
+			paths:      []string{"Bundle.entry[0].resource"},
+		},
+		{
+			name:       "batch",
+			body:       `{"resourceType":"Bundle","type":"batch","entry":[{"resource":{"resourceType":"MedicationRequest"}}]}`,
+			expression: "Bundle.type",
+		},
+		{
+			name:       "collection",
+			body:       `{"resourceType":"Bundle","type":"collection","entry":[{"resource":{"resourceType":"MedicationRequest"}}]}`,
+			expression: "Bundle.type",
+		},
+		{
+			name:       "no entries",
+			body:       `{"resourceType":"Bundle","type":"transaction","entry":[]}`,
+			expression: "Bundle.entry",
+		},
+		{
+			name:       "other resource in bundle",
+			body:       `{"resourceType":"Bundle","type":"transaction","entry":[{"resource":{"resourceType":"Patient"}}]}`,
+			expression: "Bundle.entry[0].resource",
+		},
+		{
+			name:       "other resource",
+			body:       `{"resourceType":"Patient"}`,
+			expression: "resourceType",
+		},
+		{
+			name:       "not json",
+			body:       `MedicationRequest`,
+			expression: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			submission := RequestFhirSubmission{}
+			err := ParseFhirMedicationRequests([]byte(test.body), &submission)
+
+			if test.paths == nil {
+				issue := &FhirIssueError{}
+				if !errors.As(err, &issue) || !errors.Is(err, ErrFhirResourceInvalid) {
+					t.Fatalf("ParseFhirMedicationRequests() error = %v, want an invalid resource issue", err)
+				}
+				if issue.Expression != test.expression {
+					t.Errorf("issue expression = %q, want %q", issue.Expression, test.expression)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseFhirMedicationRequests() error = %v", err)
+			}
+			if submission.Identifier != test.identifier {
+				t.Errorf("identifier = %q, want %q", submission.Identifier, test.identifier)
+			}
+			if len(submission.Requests) != len(test.paths) {
+				t.Fatalf("got %d requests, want %d", len(submission.Requests), len(test.paths))
+			}
+			for i, request := range submission.Requests {
+				if request.Path != test.paths[i] {
+					t.Errorf("request %d path = %q, want %q", i, request.Path, test.paths[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseFhirIfNoneExist(t *testing.T) {
+	tests := []struct {
+		header     string
+		identifier string
+		err        error
+	}{
+		{"identifier=urn:ehr|42", "urn:ehr|42", nil},
+		{"identifier=42", "42", nil},
+		{"identifier=", "", ErrFhirResourceInvalid},
+		{"patient=Patient/1", "", ErrFhirResourceInvalid},
+		{"identifier=42&patient=Patient/1", "", ErrFhirResourceInvalid},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			identifier, err := ParseFhirIfNoneExist(test.header)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ParseFhirIfNoneExist(%q) error = %v, want %v", test.header, err, test.err)
+			}
+			if identifier != test.identifier {
+				t.Errorf("ParseFhirIfNoneExist(%q) = %q, want %q", test.header, identifier, test.identifier)
+			}
+		})
+	}
+}
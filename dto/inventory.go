@@ -0,0 +1,214 @@
+package dto
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// RequestPharmacistStockAdjustment corrects the stock of the pharmacist's branch after a
+// count. Delta is negative when less was found than recorded. Stock found is added to
+// BatchNumber, which needs ExpiresOn unless the branch stocks it already. Without BatchNumber
+// missing stock is taken from the batches expiring first.
+type RequestPharmacistStockAdjustment struct {
+	MedicamentId uuid.UUID  `json:"medicamentId"`
+	Delta        int64      `json:"delta"`
+	BatchNumber  string     `json:"batchNumber"`
+	ExpiresOn    *time.Time `json:"expiresOn"`
+	Reason       string     `json:"reason"`
+}
+
+func (r *RequestPharmacistStockAdjustment) Validate() error {
+	var errs []error
+
+	if r.Delta == 0 {
+		errs = append(errs, ErrStockQuantityInvalid)
+	}
+
+	if r.Delta > 0 || r.BatchNumber != "" {
+		errs = append(errs, validateBatchNumber(r.BatchNumber))
+	}
+
+	return errors.Join(append(errs, validateReason(r.Reason))...)
+}
+
+// RequestPharmacistStockWriteOff takes stock that cannot be sold, e.g. damaged or expired
+// packs, out of the pharmacist's branch. Expired stock is only written off by its batch.
+type RequestPharmacistStockWriteOff struct {
+	MedicamentId uuid.UUID `json:"medicamentId"`
+	Quantity     uint      `json:"quantity"`
+	BatchNumber  string    `json:"batchNumber"`
+	Reason       string    `json:"reason"`
+}
+
+func (r *RequestPharmacistStockWriteOff) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateStockQuantity(r.Quantity), validateReason(r.Reason))
+
+	if r.BatchNumber != "" {
+		errs = append(errs, validateBatchNumber(r.BatchNumber))
+	}
+
+	return errors.Join(errs...)
+}
+
+// RequestPharmacyOwnerStockTransfer moves stock between branches of the owner. Without
+// BatchNumber the unexpired batches expiring first are moved.
+type RequestPharmacyOwnerStockTransfer struct {
+	FromBranchId uuid.UUID `json:"fromBranchId"`
+	ToBranchId   uuid.UUID `json:"toBranchId"`
+	MedicamentId uuid.UUID `json:"medicamentId"`
+	Quantity     uint      `json:"quantity"`
+	BatchNumber  string    `json:"batchNumber"`
+	Reason       string    `json:"reason"`
+}
+
+func (r *RequestPharmacyOwnerStockTransfer) Validate() error {
+	var errs []error
+
+	errs = append(errs, validateStockQuantity(r.Quantity))
+
+	if r.BatchNumber != "" {
+		errs = append(errs, validateBatchNumber(r.BatchNumber))
+	}
+
+	if r.Reason != "" {
+		errs = append(errs, validateReason(r.Reason))
+	}
+
+	return errors.Join(errs...)
+}
+
+// QueryStockHistory filters the stock movements of a branch. To is exclusive.
+type QueryStockHistory struct {
+	QueryList
+	MedicamentId *uuid.UUID `query:"medicamentId"`
+	Type         string     `query:"type"`
+	From         *time.Time `query:"from"`
+	To           *time.Time `query:"to"`
+}
+
+func (q *QueryStockHistory) Validate() error {
+	var errs []error
+
+	errs = append(errs, q.QueryList.Validate())
+
+	if q.Type != "" {
+		errs = append(errs, validateStockMovementType(q.Type))
+	}
+
+	if q.From != nil && q.To != nil && !q.To.After(*q.From) {
+		errs = append(errs, ErrStockPeriodInvalid)
+	}
+
+	return errors.Join(errs...)
+}
+
+type QueryPharmacyOwnerStockHistory struct {
+	BranchId uuid.UUID `query:"branchId"`
+	QueryStockHistory
+}
+
+type QueryPharmacyOwnerStockReconciliation struct {
+	BranchId uuid.UUID `query:"branchId"`
+}
+
+// QueryPharmacyOwnerExpiringStock asks for the stock of a branch expiring within Days, or
+// within the configured warning period without it
+type QueryPharmacyOwnerExpiringStock struct {
+	BranchId uuid.UUID `query:"branchId"`
+	Days     *uint     `query:"days"`
+}
+
+func (q *QueryPharmacyOwnerExpiringStock) Validate() error {
+	if q.Days != nil && *q.Days > MaxExpiryWindowDays {
+		return ErrExpiryWindowInvalid
+	}
+	return nil
+}
+
+const MaxExpiryWindowDays = 365
+
+// RequestPharmacyOwnerStockLevel sets how much of a medicament a branch should hold. Falling
+// below Minimum suggests reordering up to Target.
+type RequestPharmacyOwnerStockLevel struct {
+	BranchId     uuid.UUID `json:"branchId"`
+	MedicamentId uuid.UUID `json:"medicamentId"`
+	Minimum      uint      `json:"minimum"`
+	Target       uint      `json:"target"`
+}
+
+func (r *RequestPharmacyOwnerStockLevel) Validate() error {
+	if r.Target == 0 || r.Target < r.Minimum {
+		return ErrStockLevelInvalid
+	}
+	return nil
+}
+
+type QueryPharmacyOwnerDeleteStockLevel struct {
+	BranchId     uuid.UUID `query:"branchId"`
+	MedicamentId uuid.UUID `query:"medicamentId"`
+}
+
+// QueryPharmacyOwnerStockLevels narrows the stock levels to one branch. Without BranchId
+// every operating branch of the owner is included.
+type QueryPharmacyOwnerStockLevels struct {
+	BranchId *uuid.UUID `query:"branchId"`
+}
+
+type ResponseStockMovement struct {
+	Id            uuid.UUID  `json:"id"`
+	BranchId      uuid.UUID  `json:"branchId"`
+	MedicamentId  uuid.UUID  `json:"medicamentId"`
+	OfficialName  string     `json:"officialName"`
+	Type          string     `json:"type"`
+	Delta         int64      `json:"delta"`
+	QuantityAfter uint       `json:"quantityAfter"`
+	ActorRole     string     `json:"actorRole"`
+	ActorId       uuid.UUID  `json:"actorId"`
+	BatchNumber   string     `json:"batchNumber"`
+	ExpiresOn     *time.Time `json:"expiresOn"`
+	Reason        string     `json:"reason"`
+	Reference     string     `json:"reference"`
+	OccurredAt    time.Time  `json:"occurredAt"`
+}
+
+// ResponseStockDiscrepancy is a medicament whose stock differs from what its movements add up to
+type ResponseStockDiscrepancy struct {
+	MedicamentId   uuid.UUID `json:"medicamentId"`
+	OfficialName   string    `json:"officialName"`
+	Quantity       uint      `json:"quantity"`
+	LedgerQuantity int64     `json:"ledgerQuantity"`
+}
+
+type ResponseStockReconciliation struct {
+	BranchId      uuid.UUID                  `json:"branchId"`
+	Consistent    bool                       `json:"consistent"`
+	Discrepancies []ResponseStockDiscrepancy `json:"discrepancies"`
+}
+
+type ResponseExpiringStock struct {
+	MedicamentId uuid.UUID `json:"medicamentId"`
+	OfficialName string    `json:"officialName"`
+	BatchNumber  string    `json:"batchNumber"`
+	ExpiresOn    time.Time `json:"expiresOn"`
+	Quantity     uint      `json:"quantity"`
+	Expired      bool      `json:"expired"`
+}
+
+// ResponseStockLevel is a medicament with the stock levels set for it at a branch.
+// ReorderQuantity is how much to order to get back to the target and cover the recent
+// dispensing.
+type ResponseStockLevel struct {
+	BranchId        uuid.UUID `json:"branchId"`
+	BranchName      string    `json:"branchName"`
+	MedicamentId    uuid.UUID `json:"medicamentId"`
+	OfficialName    string    `json:"officialName"`
+	Minimum         uint      `json:"minimum"`
+	Target          uint      `json:"target"`
+	Quantity        uint      `json:"quantity"`
+	Reserved        uint      `json:"reserved"`
+	DailyDispensed  float64   `json:"dailyDispensed"`
+	ReorderQuantity uint      `json:"reorderQuantity"`
+}
@@ -0,0 +1,47 @@
+package dto
+
+import "errors"
+
+const (
+	ListDefaultSize = 20
+	ListMaxSize     = 100
+)
+
+// QueryList holds the paging and sorting parameters shared by every list endpoint. Sort is a
+// comma separated list of fields, a field prefixed with - is sorted in descending order.
+type QueryList struct {
+	Page int    `query:"page"`
+	Size int    `query:"size"`
+	Sort string `query:"sort"`
+}
+
+func (q *QueryList) Validate() error {
+	var errs []error
+
+	if q.Page < 0 {
+		errs = append(errs, ErrListPageInvalid)
+	}
+	if q.Size < 0 || q.Size > ListMaxSize {
+		errs = append(errs, ErrListSizeInvalid)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Normalize applies the first page and the default size to parameters that were left out
+func (q *QueryList) Normalize() {
+	if q.Page == 0 {
+		q.Page = 1
+	}
+	if q.Size == 0 {
+		q.Size = ListDefaultSize
+	}
+}
+
+// ResponseList is one page of a list with the number of items across all pages
+type ResponseList[T any] struct {
+	Items []T   `json:"items"`
+	Page  int   `json:"page"`
+	Size  int   `json:"size"`
+	Total int64 `json:"total"`
+}
@@ -3,6 +3,7 @@ package dto
 import (
 	"errors"
 	"github.com/google/uuid"
+	"time"
 )
 
 type RequestModeratorLogin struct {
@@ -40,17 +41,60 @@ func (m *RequestModeratorCreateDoctor) Validate() error {
 		validateUinLength(m.UIN))
 }
 
+type QueryModeratorGetDoctors struct {
+	QueryList
+	Name               string `query:"name"`
+	UIN                string `query:"uin"`
+	Email              string `query:"email"`
+	Specialty          string `query:"specialty"`
+	PrescribingBlocked *bool  `query:"prescribingBlocked"`
+	Deleted            bool   `query:"deleted"`
+}
+
+type QueryModeratorRestoreDoctor struct {
+	DoctorId uuid.UUID `query:"doctorId"`
+}
+
 type QueryModeratorDeleteDoctor struct {
 	DoctorId uuid.UUID `json:"doctorId"`
 }
 
 type ResponseModeratorGetDoctors struct {
-	ID         uuid.UUID `json:"id"`
-	FirstName  string    `json:"firstName"`
-	SecondName string    `json:"secondName"`
-	LastName   string    `json:"lastName"`
-	UIN        string    `json:"uin"`
-	Email      string    `json:"email"`
+	ID                 uuid.UUID           `json:"id"`
+	FirstName          string              `json:"firstName"`
+	SecondName         string              `json:"secondName"`
+	LastName           string              `json:"lastName"`
+	UIN                string              `json:"uin"`
+	Email              string              `json:"email"`
+	PrescribingBlocked bool                `json:"prescribingBlocked"`
+	Specialties        []ResponseSpecialty `json:"specialties"`
+	Version            uint                `json:"version"`
+}
+
+// RequestModeratorUpdateDoctor changes the fields that are set. Version is the version of the
+// doctor the changes were made against.
+type RequestModeratorUpdateDoctor struct {
+	DoctorId   uuid.UUID `json:"doctorId"`
+	Version    uint      `json:"version"`
+	FirstName  *string   `json:"firstName"`
+	SecondName *string   `json:"secondName"`
+	LastName   *string   `json:"lastName"`
+	UIN        *string   `json:"uin"`
+	Email      *string   `json:"email"`
+}
+
+func (m *RequestModeratorUpdateDoctor) Validate() error {
+	return errors.Join(
+		validateVersion(m.Version),
+		validateIfSet(m.FirstName, validateName),
+		validateIfSet(m.SecondName, validateName),
+		validateIfSet(m.LastName, validateName),
+		validateIfSet(m.UIN, validateUinLength),
+		validateIfSet(m.Email, validateEmail))
+}
+
+type ResponseModeratorImportRegistry struct {
+	Imported int `json:"imported"`
 }
 
 type RequestModeratorCreateMedicament struct {
@@ -67,14 +111,48 @@ func (m *RequestModeratorCreateMedicament) Validate() error {
 		validateAtcCode(m.ATC))
 }
 
+type QueryModeratorGetMedicaments struct {
+	QueryList
+	Name       string `query:"name"`
+	ATC        string `query:"atc"`
+	Restricted *bool  `query:"restricted"`
+	Deleted    bool   `query:"deleted"`
+}
+
+type QueryModeratorRestoreMedicament struct {
+	MedicamentId uuid.UUID `query:"medicamentId"`
+}
+
 type QueryModeratorDeleteMedicament struct {
 	MedicamentId uuid.UUID `json:"medicamentId"`
 }
 type ResponseModeratorGetMedicaments struct {
-	ID                uuid.UUID `json:"id"`
-	OfficialName      string    `json:"name"`
-	ActiveIngredients []string  `json:"activeIngredients"`
-	ATC               string    `json:"atc"`
+	ID                      uuid.UUID           `json:"id"`
+	OfficialName            string              `json:"name"`
+	ActiveIngredients       []string            `json:"activeIngredients"`
+	ATC                     string              `json:"atc"`
+	RestrictedToSpecialties []ResponseSpecialty `json:"restrictedToSpecialties"`
+	Version                 uint                `json:"version"`
+}
+
+type RequestModeratorUpdateMedicament struct {
+	MedicamentId      uuid.UUID `json:"medicamentId"`
+	Version           uint      `json:"version"`
+	OfficialName      *string   `json:"name"`
+	ActiveIngredients *[]string `json:"activeIngredients"`
+	ATC               *string   `json:"atc"`
+}
+
+func (m *RequestModeratorUpdateMedicament) Validate() error {
+	return errors.Join(
+		validateVersion(m.Version),
+		validateIfSet(m.OfficialName, func(name string) error { return validateNameLength(name, 3, 1000) }),
+		validateIfSet(m.ATC, validateAtcCode))
+}
+
+type RequestModeratorMedicamentRestrictions struct {
+	MedicamentId uuid.UUID   `json:"medicamentId"`
+	SpecialtyIds []uuid.UUID `json:"specialtyIds"`
 }
 
 type RequestModeratorCreatePharmacy struct {
@@ -97,6 +175,17 @@ func (m *RequestModeratorCreatePharmacy) Validate() error {
 		validateNotIncludedWhiteSpaces(m.OwnerPassword))
 }
 
+type QueryModeratorGetPharmacies struct {
+	QueryList
+	Name    string `query:"name"`
+	Owner   string `query:"owner"`
+	Deleted bool   `query:"deleted"`
+}
+
+type QueryModeratorRestorePharmacy struct {
+	PharmacyId uuid.UUID `query:"pharmacyId"`
+}
+
 type QueryModeratorDeletePharmacy struct {
 	PharmacyId uuid.UUID `json:"pharmacyId"`
 }
@@ -104,16 +193,33 @@ type ResponseModeratorGetPharmacies struct {
 	ID        uuid.UUID `json:"id"`
 	Name      string    `json:"name"`
 	OwnerName string    `json:"ownerName"`
+	Version   uint      `json:"version"`
+}
+
+type RequestModeratorUpdatePharmacy struct {
+	PharmacyId          uuid.UUID `json:"pharmacyId"`
+	Version             uint      `json:"version"`
+	Name                *string   `json:"name"`
+	Website             *string   `json:"website"`
+	HeadquartersAddress *string   `json:"headquartersAddress"`
+}
+
+func (m *RequestModeratorUpdatePharmacy) Validate() error {
+	return errors.Join(
+		validateVersion(m.Version),
+		validateIfSet(m.Name, func(name string) error { return validateNameLength(name, 1, 300) }))
 }
 
 type RequestModeratorCreateCitizen struct {
-	FirstName        string    `json:"firstName"`
-	SecondName       string    `json:"secondName"`
-	LastName         string    `json:"lastName"`
-	UCN              string    `json:"ucn"`
-	Email            string    `json:"email"`
-	Password         string    `json:"password"`
-	PersonalDoctorId uuid.UUID `json:"personal_doctor_id"`
+	FirstName        string     `json:"firstName"`
+	SecondName       string     `json:"secondName"`
+	LastName         string     `json:"lastName"`
+	UCN              string     `json:"ucn"`
+	Birthday         *time.Time `json:"birthday"`
+	Sex              string     `json:"sex"`
+	Email            string     `json:"email"`
+	Password         string     `json:"password"`
+	PersonalDoctorId uuid.UUID  `json:"personal_doctor_id"`
 }
 
 func (m *RequestModeratorCreateCitizen) Validate() error {
@@ -128,7 +234,21 @@ func (m *RequestModeratorCreateCitizen) Validate() error {
 		validateNumberOfSpecialCharacters(m.Password),
 		validateTotalNumberOfCharacters(m.Password),
 		validateNotIncludedWhiteSpaces(m.Password),
-		validateUcn(m.UCN))
+		validateUcn(m.UCN),
+		validateUcnBirthday(m.UCN, m.Birthday),
+		validateUcnSex(m.UCN, m.Sex))
+}
+
+type QueryModeratorGetCitizens struct {
+	QueryList
+	Name    string `query:"name"`
+	UCN     string `query:"ucn"`
+	Email   string `query:"email"`
+	Deleted bool   `query:"deleted"`
+}
+
+type QueryModeratorRestoreCitizen struct {
+	CitizenId uuid.UUID `query:"citizenId"`
 }
 
 type QueryModeratorDeleteCitizen struct {
@@ -140,4 +260,151 @@ type ResponseModeratorGetCitizens struct {
 	SecondName string    `json:"secondName"`
 	LastName   string    `json:"lastName"`
 	UCN        string    `json:"ucn"`
+	Version    uint      `json:"version"`
+}
+
+// RequestModeratorUpdateCitizen changes the fields that are set. The birthday and sex of the
+// citizen follow a changed UCN, like they do when the citizen is created.
+type RequestModeratorUpdateCitizen struct {
+	CitizenId   uuid.UUID `json:"citizenId"`
+	Version     uint      `json:"version"`
+	FirstName   *string   `json:"firstName"`
+	SecondName  *string   `json:"secondName"`
+	LastName    *string   `json:"lastName"`
+	UCN         *string   `json:"ucn"`
+	Email       *string   `json:"email"`
+	PhoneNumber *string   `json:"phoneNumber"`
+}
+
+func (m *RequestModeratorUpdateCitizen) Validate() error {
+	return errors.Join(
+		validateVersion(m.Version),
+		validateIfSet(m.FirstName, validateName),
+		validateIfSet(m.SecondName, validateName),
+		validateIfSet(m.LastName, validateName),
+		validateIfSet(m.UCN, validateUcn),
+		validateIfSet(m.Email, validateEmail))
+}
+
+type RequestModeratorCreateHospital struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	City        string `json:"city"`
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+func (m *RequestModeratorCreateHospital) Validate() error {
+	return errors.Join(
+		validateHospitalType(m.Type),
+		validateNameLength(m.Name, 3, 300),
+		validateNameLength(m.Address, 3, 300),
+		validateNameLength(m.City, 2, 64))
+}
+
+type RequestModeratorUpdateHospital struct {
+	ID          uuid.UUID `json:"id"`
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Address     string    `json:"address"`
+	City        string    `json:"city"`
+	PhoneNumber string    `json:"phoneNumber"`
+}
+
+func (m *RequestModeratorUpdateHospital) Validate() error {
+	return errors.Join(
+		validateHospitalType(m.Type),
+		validateNameLength(m.Name, 3, 300),
+		validateNameLength(m.Address, 3, 300),
+		validateNameLength(m.City, 2, 64))
+}
+
+type QueryModeratorDeleteHospital struct {
+	HospitalId uuid.UUID `query:"hospitalId"`
+}
+
+type RequestModeratorCreateAffiliation struct {
+	DoctorId   uuid.UUID  `json:"doctorId"`
+	HospitalId uuid.UUID  `json:"hospitalId"`
+	Role       string     `json:"role"`
+	StartDate  time.Time  `json:"startDate"`
+	EndDate    *time.Time `json:"endDate"`
+}
+
+func (m *RequestModeratorCreateAffiliation) Validate() error {
+	errs := []error{validateAffiliationRole(m.Role)}
+	if m.EndDate != nil {
+		errs = append(errs, validateTime(*m.EndDate, m.StartDate, TimeAfter))
+	}
+	return errors.Join(errs...)
+}
+
+type RequestModeratorEndAffiliation struct {
+	AffiliationId uuid.UUID `json:"affiliationId"`
+	EndDate       time.Time `json:"endDate"`
+}
+
+type QueryModeratorGetAffiliations struct {
+	DoctorId uuid.UUID `query:"doctorId"`
+}
+
+type QueryModeratorDeleteAffiliation struct {
+	AffiliationId uuid.UUID `query:"affiliationId"`
+}
+
+type ResponseModeratorGetAffiliation struct {
+	ID        uuid.UUID        `json:"id"`
+	DoctorId  uuid.UUID        `json:"doctorId"`
+	Hospital  ResponseHospital `json:"hospital"`
+	Role      string           `json:"role"`
+	StartDate time.Time        `json:"startDate"`
+	EndDate   *time.Time       `json:"endDate"`
+}
+
+type RequestModeratorCreateSpecialty struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+func (m *RequestModeratorCreateSpecialty) Validate() error {
+	return errors.Join(
+		validateNameLength(m.Code, 1, 16),
+		validateNameLength(m.Name, 3, 128))
+}
+
+type QueryModeratorDeleteSpecialty struct {
+	SpecialtyId uuid.UUID `query:"specialtyId"`
+}
+
+type RequestModeratorDoctorSpecialty struct {
+	DoctorId    uuid.UUID `json:"doctorId"`
+	SpecialtyId uuid.UUID `json:"specialtyId"`
+}
+
+type RequestModeratorRotateSigningKey struct {
+	DoctorId uuid.UUID `json:"doctorId"`
+}
+
+type RequestModeratorRevokeSigningKey struct {
+	KeyId  uuid.UUID `json:"keyId"`
+	Reason string    `json:"reason"`
+}
+
+func (r *RequestModeratorRevokeSigningKey) Validate() error {
+	return validateReason(r.Reason)
+}
+
+type QueryModeratorGetSigningKeys struct {
+	DoctorId uuid.UUID `query:"doctorId"`
+}
+
+type ResponseModeratorSigningKey struct {
+	ID               uuid.UUID  `json:"id"`
+	DoctorId         uuid.UUID  `json:"doctorId"`
+	PublicKey        string     `json:"publicKey"`
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	RetiredAt        *time.Time `json:"retiredAt"`
+	RevokedAt        *time.Time `json:"revokedAt"`
+	RevocationReason string     `json:"revocationReason"`
 }
@@ -15,3 +15,8 @@ const (
 const (
 	atcPattern = `\w\d\d\w\w\d\d`
 )
+
+const (
+	companyNumberPattern = `^(\d{9}|\d{13})$`
+	phoneNumberPattern   = `^\+?[0-9 ]{6,20}$`
+)
@@ -18,8 +18,9 @@ func (p *RequestPharmacyOwnerAuth) Validate() error {
 }
 
 type ResponsePharmacyOwnerBranches struct {
-	ID   uuid.UUID `json:"id"`
-	Name string    `json:"name"`
+	ID     uuid.UUID `json:"id"`
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
 }
 
 type QueryGetBranchesByCommonName struct {
@@ -32,17 +33,149 @@ type ResponseGetBranchesByCommonName struct {
 }
 
 type RequestPharmacyOwnerNewBranch struct {
-	Name      string  `json:"name"`
-	Latitude  float32 `json:"latitude"`
-	Longitude float32 `json:"longitude"`
+	Name         string                      `json:"name"`
+	Address      string                      `json:"address"`
+	Latitude     float32                     `json:"latitude"`
+	Longitude    float32                     `json:"longitude"`
+	OpeningHours []RequestBranchOpeningHours `json:"openingHours"`
 }
 
 func (p *RequestPharmacyOwnerNewBranch) Validate() error {
 	return errors.Join(
 		validateNameLength(p.Name, 3, 64),
+		validateAddress(p.Address),
+		validateCoordinates(p.Latitude, p.Longitude),
+		validateOpeningHours(p.OpeningHours))
+}
+
+// RequestBranchOpeningHours opens a branch on a day of the week, 0 being Sunday. Opens and
+// Closes are "HH:MM" and a branch open until midnight closes at "24:00".
+type RequestBranchOpeningHours struct {
+	Weekday int    `json:"weekday"`
+	Opens   string `json:"opens"`
+	Closes  string `json:"closes"`
+}
+
+type RequestPharmacyOwnerUpdateBranch struct {
+	BranchId  uuid.UUID `json:"branchId"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address"`
+	Latitude  float32   `json:"latitude"`
+	Longitude float32   `json:"longitude"`
+}
+
+func (p *RequestPharmacyOwnerUpdateBranch) Validate() error {
+	return errors.Join(
+		validateNameLength(p.Name, 3, 64),
+		validateAddress(p.Address),
 		validateCoordinates(p.Latitude, p.Longitude))
 }
 
+// RequestPharmacyOwnerBranchHours replaces the weekly hours of a branch. Days left out are
+// days the branch is closed.
+type RequestPharmacyOwnerBranchHours struct {
+	BranchId     uuid.UUID                   `json:"branchId"`
+	OpeningHours []RequestBranchOpeningHours `json:"openingHours"`
+}
+
+func (p *RequestPharmacyOwnerBranchHours) Validate() error {
+	return validateOpeningHours(p.OpeningHours)
+}
+
+// RequestPharmacyOwnerNewBranchHoliday sets the hours of a branch on one date. A closed day
+// needs no hours.
+type RequestPharmacyOwnerNewBranchHoliday struct {
+	BranchId uuid.UUID `json:"branchId"`
+	Date     time.Time `json:"date"`
+	Closed   bool      `json:"closed"`
+	Opens    string    `json:"opens"`
+	Closes   string    `json:"closes"`
+	Note     string    `json:"note"`
+}
+
+func (p *RequestPharmacyOwnerNewBranchHoliday) Validate() error {
+	var errs []error
+
+	if p.Date.IsZero() {
+		errs = append(errs, ErrHolidayDateInvalid)
+	}
+
+	if !p.Closed {
+		errs = append(errs, validateClockRange(p.Opens, p.Closes))
+	}
+
+	if len(p.Note) > 300 {
+		errs = append(errs, ErrHolidayNoteTooLong)
+	}
+
+	return errors.Join(errs...)
+}
+
+type QueryPharmacyOwnerDeleteBranchHoliday struct {
+	BranchId  uuid.UUID `query:"branchId"`
+	HolidayId uuid.UUID `query:"holidayId"`
+}
+
+// RequestPharmacyOwnerCloseBranch closes a branch for a while. Without Until it stays closed
+// until the owner reopens it.
+type RequestPharmacyOwnerCloseBranch struct {
+	BranchId uuid.UUID  `json:"branchId"`
+	Until    *time.Time `json:"until"`
+	Reason   string     `json:"reason"`
+}
+
+func (p *RequestPharmacyOwnerCloseBranch) Validate() error {
+	return errors.Join(
+		validateReason(p.Reason),
+		validateIfSet(p.Until, func(until time.Time) error {
+			return validateTime(until, time.Now(), TimeAfter)
+		}))
+}
+
+type RequestPharmacyOwnerReopenBranch struct {
+	BranchId uuid.UUID `json:"branchId"`
+}
+
+// QueryPharmacyOwnerDecommissionBranch closes a branch for good. The stock and pharmacists
+// left in it move to TransferTo, without it the branch must already be empty.
+type QueryPharmacyOwnerDecommissionBranch struct {
+	BranchId   uuid.UUID  `query:"branchId"`
+	TransferTo *uuid.UUID `query:"transferTo"`
+}
+
+type QueryPharmacyOwnerGetBranch struct {
+	BranchId uuid.UUID `query:"branchId"`
+}
+
+type ResponseBranchOpeningHours struct {
+	Weekday int    `json:"weekday"`
+	Opens   string `json:"opens"`
+	Closes  string `json:"closes"`
+}
+
+type ResponseBranchHoliday struct {
+	Id     uuid.UUID `json:"id"`
+	Date   time.Time `json:"date"`
+	Closed bool      `json:"closed"`
+	Opens  string    `json:"opens,omitempty"`
+	Closes string    `json:"closes,omitempty"`
+	Note   string    `json:"note"`
+}
+
+type ResponsePharmacyOwnerBranch struct {
+	ID               uuid.UUID                    `json:"id"`
+	Name             string                       `json:"name"`
+	Address          string                       `json:"address"`
+	Latitude         float32                      `json:"latitude"`
+	Longitude        float32                      `json:"longitude"`
+	Status           string                       `json:"status"`
+	ClosedUntil      *time.Time                   `json:"closedUntil"`
+	ClosedReason     string                       `json:"closedReason"`
+	DecommissionedAt *time.Time                   `json:"decommissionedAt"`
+	OpeningHours     []ResponseBranchOpeningHours `json:"openingHours"`
+	Holidays         []ResponseBranchHoliday      `json:"holidays"`
+}
+
 type ResponsePharmacyOwnerPharmacist struct {
 	ID        uuid.UUID `json:"id"`
 	FirstName string    `json:"first_name"`
@@ -106,23 +239,66 @@ type RequestPharmacistCitizenFulfillMedicamentFromPrescription struct {
 	} `json:"prescriptions"`
 }
 
+// RequestPharmacistBranchAddMedicament receives a delivery into the pharmacist's branch.
+// Reference is what the delivery came with, e.g. the number of its delivery note.
 type RequestPharmacistBranchAddMedicament struct {
 	Medicaments []struct {
 		MedicamentId uuid.UUID `json:"id"`
 		Quantity     uint      `json:"quantity"`
+		BatchNumber  string    `json:"batchNumber"`
+		ExpiresOn    time.Time `json:"expiresOn"`
 	} `json:"medicaments"`
+	Reference string `json:"reference"`
+}
+
+func (r *RequestPharmacistBranchAddMedicament) Validate() error {
+	var errs []error
+
+	for _, medicament := range r.Medicaments {
+		errs = append(errs,
+			validateStockQuantity(medicament.Quantity),
+			validateBatchNumber(medicament.BatchNumber),
+			validateBatchExpiry(medicament.ExpiresOn))
+	}
+
+	if len(r.Reference) > 64 {
+		errs = append(errs, ErrStockReferenceTooLong)
+	}
+
+	return errors.Join(errs...)
 }
 
 type ResponsePharmacistCitizenPrescription struct {
-	ID           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	CreationDate time.Time `json:"creation_date"`
-	StartDate    time.Time `json:"issuedDate"`
-	EndDate      time.Time `json:"end_date"`
-	Medicaments  []struct {
-		Id           uuid.UUID `json:"id"`
-		OfficialName string    `json:"officialName"`
-		Quantity     uint      `json:"quantity"`
-		Fulfilled    bool      `json:"fulfilled"`
-	} `json:"medicaments"`
+	ID           uuid.UUID                                  `json:"id"`
+	Name         string                                     `json:"name"`
+	Version      uint                                       `json:"version"`
+	CreationDate time.Time                                  `json:"creation_date"`
+	StartDate    time.Time                                  `json:"issuedDate"`
+	EndDate      time.Time                                  `json:"end_date"`
+	Hospital     *ResponseHospital                          `json:"hospital"`
+	Refill       uint                                       `json:"refill"`
+	Medicaments  []ResponsePharmacistPrescriptionMedicament `json:"medicaments"`
+	// SignatureValid is false for a prescription whose signature does not verify, which must
+	// not be dispensed. SignatureError tells why.
+	SignatureValid bool   `json:"signatureValid"`
+	SignatureError string `json:"signatureError"`
+}
+
+type ResponsePharmacistPrescriptionMedicament struct {
+	Id           uuid.UUID                  `json:"id"`
+	OfficialName string                     `json:"officialName"`
+	Quantity     uint                       `json:"quantity"`
+	Fulfilled    bool                       `json:"fulfilled"`
+	Dosage       ResponsePrescriptionDosage `json:"dosage"`
+}
+
+type QueryPharmacistGetPrescriptionHistory struct {
+	PrescriptionId uuid.UUID `query:"prescriptionId"`
+}
+
+// QueryPharmacistResolvePrescription carries either the code the citizen reads out or the
+// content of the scanned QR code.
+type QueryPharmacistResolvePrescription struct {
+	Code string `query:"code"`
+	Qr   string `query:"qr"`
 }
@@ -0,0 +1,127 @@
+package dto
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"medico/common"
+	"time"
+)
+
+type RequestPharmacyRegistration struct {
+	CompanyName         string `json:"companyName"`
+	CompanyNumber       string `json:"companyNumber"`
+	Website             string `json:"website"`
+	LicenceNumber       string `json:"licenceNumber"`
+	HeadquartersAddress string `json:"headquartersAddress"`
+	OwnerName           string `json:"ownerName"`
+	OwnerEmail          string `json:"ownerEmail"`
+	OwnerPhone          string `json:"ownerPhone"`
+	OwnerPassword       string `json:"ownerPassword"`
+}
+
+func (r *RequestPharmacyRegistration) Validate() error {
+	return errors.Join(
+		validateNameLength(r.CompanyName, 1, 300),
+		validateCompanyNumber(r.CompanyNumber),
+		validateLicenceNumber(r.LicenceNumber),
+		validateAddress(r.HeadquartersAddress),
+		validateName(r.OwnerName),
+		validateEmail(r.OwnerEmail),
+		validatePhoneNumber(r.OwnerPhone),
+		validateNumberOfLowerCase(r.OwnerPassword),
+		validateNumberOfUpperCase(r.OwnerPassword),
+		validateNumberOfDigits(r.OwnerPassword),
+		validateNumberOfSpecialCharacters(r.OwnerPassword),
+		validateTotalNumberOfCharacters(r.OwnerPassword),
+		validateNotIncludedWhiteSpaces(r.OwnerPassword))
+}
+
+// RequestPharmacyRegistrationResubmit replaces the company and contact data of a registration
+// after a moderator asked for changes. Id is the reference the applicant got when they
+// submitted it and OwnerPassword the password they submitted it with. The owner email and
+// password become the owner's login on approval, so a resubmission cannot change them.
+type RequestPharmacyRegistrationResubmit struct {
+	Id                  uuid.UUID `json:"id"`
+	CompanyName         string    `json:"companyName"`
+	CompanyNumber       string    `json:"companyNumber"`
+	Website             string    `json:"website"`
+	LicenceNumber       string    `json:"licenceNumber"`
+	HeadquartersAddress string    `json:"headquartersAddress"`
+	OwnerName           string    `json:"ownerName"`
+	OwnerPhone          string    `json:"ownerPhone"`
+	OwnerPassword       string    `json:"ownerPassword"`
+}
+
+func (r *RequestPharmacyRegistrationResubmit) Validate() error {
+	return errors.Join(
+		validateNameLength(r.CompanyName, 1, 300),
+		validateCompanyNumber(r.CompanyNumber),
+		validateLicenceNumber(r.LicenceNumber),
+		validateAddress(r.HeadquartersAddress),
+		validateName(r.OwnerName),
+		validatePhoneNumber(r.OwnerPhone))
+}
+
+type QueryPharmacyRegistrationStatus struct {
+	Id uuid.UUID `query:"id"`
+}
+
+type ResponsePharmacyRegistrationSubmitted struct {
+	Id uuid.UUID `json:"id"`
+}
+
+type ResponseRegistrationReview struct {
+	Decision   string    `json:"decision"`
+	Comment    string    `json:"comment"`
+	ReviewedAt time.Time `json:"reviewedAt"`
+}
+
+type ResponsePharmacyRegistrationStatus struct {
+	Id          uuid.UUID                    `json:"id"`
+	CompanyName string                       `json:"companyName"`
+	Status      string                       `json:"status"`
+	SubmittedAt time.Time                    `json:"submittedAt"`
+	Reviews     []ResponseRegistrationReview `json:"reviews"`
+}
+
+type QueryModeratorGetRegistrations struct {
+	QueryList
+	Status  string `query:"status"`
+	Company string `query:"company"`
+}
+
+type ResponseModeratorGetRegistration struct {
+	Id                  uuid.UUID                    `json:"id"`
+	CompanyName         string                       `json:"companyName"`
+	CompanyNumber       string                       `json:"companyNumber"`
+	Website             string                       `json:"website"`
+	LicenceNumber       string                       `json:"licenceNumber"`
+	HeadquartersAddress string                       `json:"headquartersAddress"`
+	OwnerName           string                       `json:"ownerName"`
+	OwnerEmail          string                       `json:"ownerEmail"`
+	OwnerPhone          string                       `json:"ownerPhone"`
+	Status              string                       `json:"status"`
+	SubmittedAt         time.Time                    `json:"submittedAt"`
+	PharmacyId          *uuid.UUID                   `json:"pharmacyId"`
+	Reviews             []ResponseRegistrationReview `json:"reviews"`
+}
+
+// RequestModeratorReviewRegistration decides a registration. Rejecting it or asking for
+// changes needs a comment that tells the applicant why.
+type RequestModeratorReviewRegistration struct {
+	RegistrationId uuid.UUID `json:"registrationId"`
+	Decision       string    `json:"decision"`
+	Comment        string    `json:"comment"`
+}
+
+func (r *RequestModeratorReviewRegistration) Validate() error {
+	if err := validateRegistrationDecision(r.Decision); err != nil {
+		return err
+	}
+
+	if common.RegistrationDecision(r.Decision) == common.ApproveRegistration && r.Comment == "" {
+		return nil
+	}
+
+	return validateReason(r.Comment)
+}
@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// RequestCitizenNewReservation holds the stock for a prescription at a branch. Without
+// MedicamentIds every line of the prescription that is still to be dispensed is reserved.
+type RequestCitizenNewReservation struct {
+	PrescriptionId uuid.UUID   `json:"prescriptionId"`
+	BranchId       uuid.UUID   `json:"branchId"`
+	MedicamentIds  []uuid.UUID `json:"medicamentIds"`
+}
+
+type RequestCitizenCancelReservation struct {
+	ReservationId uuid.UUID `json:"reservationId"`
+}
+
+type RequestPharmacistFulfillReservation struct {
+	ReservationId uuid.UUID `json:"reservationId"`
+}
+
+type ResponseReservationLine struct {
+	MedicamentId uuid.UUID `json:"medicamentId"`
+	OfficialName string    `json:"officialName"`
+	Quantity     uint      `json:"quantity"`
+	Released     bool      `json:"released"`
+}
+
+type ResponseReservation struct {
+	Id             uuid.UUID                 `json:"id"`
+	PrescriptionId uuid.UUID                 `json:"prescriptionId"`
+	BranchId       uuid.UUID                 `json:"branchId"`
+	BranchName     string                    `json:"branchName"`
+	BranchAddress  string                    `json:"branchAddress"`
+	Status         string                    `json:"status"`
+	CreatedAt      time.Time                 `json:"createdAt"`
+	ExpiresAt      time.Time                 `json:"expiresAt"`
+	ClosedAt       *time.Time                `json:"closedAt"`
+	Lines          []ResponseReservationLine `json:"lines"`
+}
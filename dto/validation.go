@@ -1,6 +1,8 @@
 package dto
 
 import (
+	"errors"
+	"fmt"
 	"medico/common"
 	"regexp"
 	"time"
@@ -107,17 +109,338 @@ func validateAtcCode(atc string) error {
 	return nil
 }
 
+func validateCompanyNumber(companyNumber string) error {
+	if !regexp.MustCompile(companyNumberPattern).MatchString(companyNumber) {
+		return ErrCompanyNumberInvalid
+	}
+	return nil
+}
+
+func validateLicenceNumber(licenceNumber string) error {
+	if len(licenceNumber) < 3 || len(licenceNumber) > 32 {
+		return ErrLicenceNumberInvalid
+	}
+	return nil
+}
+
+func validateAddress(address string) error {
+	if len(address) < 5 || len(address) > 300 {
+		return ErrAddressInvalid
+	}
+	return nil
+}
+
+func validatePhoneNumber(phoneNumber string) error {
+	if !regexp.MustCompile(phoneNumberPattern).MatchString(phoneNumber) {
+		return ErrPhoneNumberInvalid
+	}
+	return nil
+}
+
+var ucnWeights = [9]int{2, 4, 8, 5, 10, 9, 7, 3, 6}
+
 func validateUcn(ucn string) error {
+	_, _, err := ParseUcn(ucn)
+	return err
+}
+
+// ParseUcn validates a Bulgarian UCN (EGN) and returns the birthday and the sex
+// encoded in it. The month is offset by 20 for births in the 1800s and by 40 for
+// births in the 2000s, and the ninth digit is even for men and odd for women.
+func ParseUcn(ucn string) (birthday time.Time, female bool, err error) {
 	if len(ucn) != 10 {
-		return ErrUcnInvalid
+		return time.Time{}, false, ErrUcnInvalid
+	}
+
+	var digits [10]int
+	for i, r := range ucn {
+		if r < '0' || r > '9' {
+			return time.Time{}, false, ErrUcnInvalid
+		}
+		digits[i] = int(r - '0')
+	}
+
+	checksum := 0
+	for i, weight := range ucnWeights {
+		checksum += digits[i] * weight
+	}
+	checksum = checksum % 11 % 10
+
+	if checksum != digits[9] {
+		return time.Time{}, false, ErrUcnInvalidChecksum
+	}
+
+	year := digits[0]*10 + digits[1]
+	month := digits[2]*10 + digits[3]
+	day := digits[4]*10 + digits[5]
+
+	switch {
+	case month > 40:
+		year += 2000
+		month -= 40
+	case month > 20:
+		year += 1800
+		month -= 20
+	default:
+		year += 1900
+	}
+
+	birthday = time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if month < 1 || month > 12 || birthday.Day() != day || birthday.Month() != time.Month(month) {
+		return time.Time{}, false, ErrUcnInvalidBirthDate
+	}
+
+	return birthday, digits[8]%2 == 1, nil
+}
+
+func validateUcnBirthday(ucn string, birthday *time.Time) error {
+	ucnBirthday, _, err := ParseUcn(ucn)
+	if err != nil || birthday == nil {
+		return nil
+	}
+
+	year, month, day := birthday.Date()
+	if !ucnBirthday.Equal(time.Date(year, month, day, 0, 0, 0, 0, time.UTC)) {
+		return ErrUcnBirthdayMismatch
+	}
+	return nil
+}
+
+func validateUcnSex(ucn string, sex string) error {
+	_, female, err := ParseUcn(ucn)
+	if err != nil || sex == "" {
+		return nil
 	}
 
+	if (sex == SexFemale) != female || (sex != SexFemale && sex != SexMale) {
+		return ErrUcnSexMismatch
+	}
 	return nil
 }
 
 func validateCoordinates(latitude, longitude float32) error {
-	if latitude < -90 && latitude > 90 && longitude < 0 && longitude > 180 {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
 		return ErrCoordinatesInvalid
 	}
 	return nil
 }
+
+// ParseClock reads an "HH:MM" time of day as minutes after midnight. "24:00" is the end of
+// the day.
+func ParseClock(clock string) (uint16, error) {
+	if clock == "24:00" {
+		return 24 * 60, nil
+	}
+
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, ErrOpeningHoursInvalid
+	}
+
+	return uint16(parsed.Hour()*60 + parsed.Minute()), nil
+}
+
+// FormatClock writes minutes after midnight as "HH:MM"
+func FormatClock(minutes uint16) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// validateClockRange accepts hours that close before they open, those run past midnight
+func validateClockRange(opens, closes string) error {
+	opensAt, err := ParseClock(opens)
+	if err != nil {
+		return err
+	}
+
+	closesAt, err := ParseClock(closes)
+	if err != nil {
+		return err
+	}
+
+	if opensAt == closesAt {
+		return ErrOpeningHoursInvalid
+	}
+	return nil
+}
+
+func validateOpeningHours(hours []RequestBranchOpeningHours) error {
+	var errs []error
+	seen := make(map[int]bool, len(hours))
+
+	for _, day := range hours {
+		if day.Weekday < int(time.Sunday) || day.Weekday > int(time.Saturday) {
+			errs = append(errs, ErrWeekdayInvalid)
+			continue
+		}
+
+		if seen[day.Weekday] {
+			errs = append(errs, ErrWeekdayRepeated)
+		}
+		seen[day.Weekday] = true
+
+		errs = append(errs, validateClockRange(day.Opens, day.Closes))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateSearchRadius(radius float32) error {
+	if radius < 0 || radius > MaxSearchRadius {
+		return ErrSearchRadiusInvalid
+	}
+	return nil
+}
+
+func validateSearchTerm(search string) error {
+	if len(search) < 2 || len(search) > 64 {
+		return ErrSearchTermInvalid
+	}
+	return nil
+}
+
+func validateHospitalType(hospitalType string) error {
+	if hospitalType != string(common.Hospital) &&
+		hospitalType != string(common.Practice) {
+		return ErrHospitalTypeInvalid
+	}
+	return nil
+}
+
+func validateAffiliationRole(role string) error {
+	if role != string(common.AttendingPhysician) &&
+		role != string(common.ConsultantPhysician) &&
+		role != string(common.ResidentPhysician) &&
+		role != string(common.HeadOfDepartment) &&
+		role != string(common.GeneralPractitioner) {
+		return ErrAffiliationRoleInvalid
+	}
+	return nil
+}
+
+func validateRegistrationDecision(decision string) error {
+	if decision != string(common.ApproveRegistration) &&
+		decision != string(common.RejectRegistration) &&
+		decision != string(common.RequestRegistrationChanges) {
+		return ErrRegistrationDecisionInvalid
+	}
+	return nil
+}
+
+func validateStockQuantity(quantity uint) error {
+	if quantity == 0 {
+		return ErrStockQuantityInvalid
+	}
+	return nil
+}
+
+func validateBatchNumber(batchNumber string) error {
+	if len(batchNumber) < 1 || len(batchNumber) > 64 {
+		return ErrBatchNumberInvalid
+	}
+	return nil
+}
+
+// validateBatchExpiry refuses batches that expired before today
+func validateBatchExpiry(expiresOn time.Time) error {
+	if expiresOn.Format(time.DateOnly) < time.Now().Format(time.DateOnly) {
+		return ErrBatchExpiryInvalid
+	}
+	return nil
+}
+
+func validateStockMovementType(movementType string) error {
+	switch common.StockMovementType(movementType) {
+	case common.StockReceipt, common.StockDispense, common.StockAdjustment, common.StockTransfer, common.StockWriteOff:
+		return nil
+	}
+	return ErrStockMovementTypeInvalid
+}
+
+func (d *RequestPrescriptionDosage) Validate() error {
+	return validateDosage(d)
+}
+
+func validateDosage(dosage *RequestPrescriptionDosage) error {
+	var errs []error
+
+	if dosage.Amount <= 0 {
+		errs = append(errs, ErrDoseAmountInvalid)
+	}
+
+	switch common.DoseUnit(dosage.Unit) {
+	case common.Tablet, common.Capsule, common.Millilitre, common.Milligram, common.Drop,
+		common.Puff, common.Sachet, common.Application, common.DosageUnit:
+	default:
+		errs = append(errs, ErrDoseUnitInvalid)
+	}
+
+	if dosage.TimesPerDay < 1 || dosage.TimesPerDay > 24 {
+		errs = append(errs, ErrDoseFrequency)
+	}
+
+	for _, timeOfDay := range dosage.TimesOfDay {
+		switch common.TimeOfDay(timeOfDay) {
+		case common.Morning, common.Noon, common.Evening, common.Bedtime:
+		default:
+			errs = append(errs, ErrDoseTimeOfDay)
+		}
+	}
+
+	if dosage.DurationDays < 1 || dosage.DurationDays > 365 {
+		errs = append(errs, ErrDoseDuration)
+	}
+
+	switch common.AdministrationRoute(dosage.Route) {
+	case common.OralRoute, common.SublingualRoute, common.TopicalRoute, common.InhalationRoute,
+		common.NasalRoute, common.OphthalmicRoute, common.OticRoute, common.RectalRoute,
+		common.VaginalRoute, common.SubcutaneousRoute, common.IntramuscularRoute, common.IntravenousRoute:
+	default:
+		errs = append(errs, ErrDoseRouteInvalid)
+	}
+
+	if len(dosage.Notes) > 500 {
+		errs = append(errs, ErrDoseNotesTooLong)
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateRefills(refills, intervalDays uint) error {
+	if refills > 12 {
+		return ErrRefillsOutOfRange
+	}
+
+	if refills > 0 && (intervalDays < 1 || intervalDays > 180) {
+		return ErrRefillIntervalOutOfRange
+	}
+
+	return nil
+}
+
+func validateReason(reason string) error {
+	if len(reason) < 3 || len(reason) > 500 {
+		return ErrReasonInvalidNumberOfChars
+	}
+
+	return nil
+}
+
+func validateVersion(version uint) error {
+	if version == 0 {
+		return ErrVersionMissing
+	}
+	return nil
+}
+
+// validateName checks a person's name like the create requests do
+func validateName(name string) error {
+	return validateNameLength(name, 3, 32)
+}
+
+// validateIfSet validates a field of a partial update only when the update sets it
+func validateIfSet[T any](value *T, validate func(T) error) error {
+	if value == nil {
+		return nil
+	}
+	return validate(*value)
+}
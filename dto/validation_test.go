@@ -0,0 +1,42 @@
+package dto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseUcn(t *testing.T) {
+	tests := []struct {
+		name     string
+		ucn      string
+		birthday time.Time
+		female   bool
+		err      error
+	}{
+		{"1900s female", "7501010010", time.Date(1975, 1, 1, 0, 0, 0, 0, time.UTC), true, nil},
+		{"1900s male", "8512314588", time.Date(1985, 12, 31, 0, 0, 0, 0, time.UTC), false, nil},
+		{"2000s female", "0542151235", time.Date(2005, 2, 15, 0, 0, 0, 0, time.UTC), true, nil},
+		{"2000 leap day", "0042291239", time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC), true, nil},
+		{"1800s female", "9922123456", time.Date(1899, 2, 12, 0, 0, 0, 0, time.UTC), true, nil},
+		{"too short", "750101001", time.Time{}, false, ErrUcnInvalid},
+		{"not a number", "75010100a0", time.Time{}, false, ErrUcnInvalid},
+		{"wrong checksum", "7501010011", time.Time{}, false, ErrUcnInvalidChecksum},
+		{"no such day", "0230456788", time.Time{}, false, ErrUcnInvalidBirthDate},
+		{"no leap day in 1994", "9402291230", time.Time{}, false, ErrUcnInvalidBirthDate},
+		{"no leap day in 1900", "0002291230", time.Time{}, false, ErrUcnInvalidBirthDate},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			birthday, female, err := ParseUcn(test.ucn)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ParseUcn(%q) error = %v, want %v", test.ucn, err, test.err)
+			}
+			if !birthday.Equal(test.birthday) || female != test.female {
+				t.Errorf("ParseUcn(%q) = %v, %v, want %v, %v", test.ucn, birthday, female, test.birthday, test.female)
+			}
+		})
+	}
+}
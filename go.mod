@@ -6,6 +6,8 @@ require (
 	github.com/gofiber/fiber/v2 v2.52.6
 	github.com/gofiber/storage/redis/v3 v3.1.3
 	github.com/google/uuid v1.6.0
+	github.com/jung-kurt/gofpdf v1.16.2
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	golang.org/x/crypto v0.33.0
 	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/driver/mysql v1.5.7
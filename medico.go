@@ -1,13 +1,35 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
+	"log"
 	"medico/config"
+	"medico/dto"
 	"medico/repo"
 	"medico/routes"
+	"medico/service"
+	"os"
 )
 
 func main() {
+	verifyAudit := flag.Bool("verify-audit", false, "verify the audit log hash chain and exit")
+	flag.Parse()
+
+	if *verifyAudit {
+		os.Exit(verifyAuditChain())
+	}
+
+	if err := config.CheckPrescriptionConfig(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := config.CheckAuditConfig(); err != nil {
+		log.Fatal(err)
+	}
+
 	migrationConfig := config.LoadMigrationConfig()
 
 	if migrationConfig.Migration {
@@ -18,9 +40,48 @@ func main() {
 		}
 	}
 
+	registryConfig := config.LoadRegistryConfig()
+	service.ScheduleLicenceRecheck(registryConfig.RecheckInterval)
+
+	stockConfig := config.LoadStockConfig()
+	service.ScheduleReservationExpiry(stockConfig.ReservationSweepInterval)
+
 	medicoFiber := fiber.New()
 
 	routes.SetupRoutes(medicoFiber)
 
 	_ = medicoFiber.Listen(":8080")
 }
+
+// verifyAuditChain prints the outcome of checking the audit log and returns the exit code. It
+// is 1 when the chain is broken and 2 when the log could not be checked at all.
+func verifyAuditChain() (code int) {
+	// the repositories panic when they cannot connect to the database
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Fprintln(os.Stderr, "audit log not verified:", err)
+			code = 2
+		}
+	}()
+
+	if err := config.CheckAuditConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "audit log not verified:", err)
+		return 2
+	}
+
+	result := dto.ResponseAdminAuditVerification{}
+
+	if err := service.NewAuditService().VerifyChain(&result); err != nil {
+		fmt.Fprintln(os.Stderr, "audit log not verified:", err)
+		return 2
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(result)
+
+	if !result.Valid {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditCreate   AuditAction = "create"
+	AuditUpdate   AuditAction = "update"
+	AuditDelete   AuditAction = "delete"
+	AuditRestore  AuditAction = "restore"
+	AuditPurge    AuditAction = "purge"
+	AuditImport   AuditAction = "import"
+	AuditRecheck  AuditAction = "recheck"
+	AuditAssign   AuditAction = "assign"
+	AuditUnassign AuditAction = "unassign"
+	AuditEnd      AuditAction = "end"
+	AuditRotate   AuditAction = "rotate"
+	AuditRevoke   AuditAction = "revoke"
+	AuditReview   AuditAction = "review"
+)
+
+type AuditEntity string
+
+const (
+	AuditedDoctor            AuditEntity = "doctor"
+	AuditedCitizen           AuditEntity = "citizen"
+	AuditedPharmacy          AuditEntity = "pharmacy"
+	AuditedMedicament        AuditEntity = "medicament"
+	AuditedModerator         AuditEntity = "moderator"
+	AuditedHospital          AuditEntity = "hospital"
+	AuditedAffiliation       AuditEntity = "affiliation"
+	AuditedSpecialty         AuditEntity = "specialty"
+	AuditedSigningKey        AuditEntity = "signing_key"
+	AuditedPhysicianRegistry AuditEntity = "physician_registry"
+	AuditedRegistration      AuditEntity = "pharmacy_registration"
+)
+
+// AuditEntry is one moderator or admin action. Entries are only ever appended. Every entry
+// carries the hash of the one before it, so changing or removing an entry breaks the chain.
+type AuditEntry struct {
+	ID         uuid.UUID   `gorm:"primaryKey;unique;type:uuid;not null"`
+	Sequence   uint64      `gorm:"not null;uniqueIndex"`
+	ActorID    uuid.UUID   `gorm:"type:uuid;not null;index"`
+	ActorRole  string      `gorm:"size:32;not null"`
+	Action     AuditAction `gorm:"size:32;not null"`
+	EntityType AuditEntity `gorm:"size:32;not null;index:idx_audit_entries_entity"`
+	EntityID   uuid.UUID   `gorm:"type:uuid;not null;index:idx_audit_entries_entity"`
+	// Diff is a JSON object of the changed fields with their values before and after
+	Diff      string    `gorm:"type:text"`
+	IP        string    `gorm:"size:45"`
+	RequestID string    `gorm:"size:64"`
+	CreatedAt time.Time `gorm:"not null;index"`
+	PrevHash  string    `gorm:"size:64;not null"`
+	Hash      string    `gorm:"size:64;not null"`
+}
+
+// AuditChainHead is the single row that points at the newest audit entry. Appending locks
+// it, which keeps the chain linear when several actions are audited at once.
+type AuditChainHead struct {
+	ID       uint   `gorm:"primaryKey"`
+	Sequence uint64 `gorm:"not null"`
+	Hash     string `gorm:"size:64;not null"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type ChangedEntity string
+
+const (
+	ChangedDoctor     ChangedEntity = "doctor"
+	ChangedCitizen    ChangedEntity = "citizen"
+	ChangedPharmacy   ChangedEntity = "pharmacy"
+	ChangedMedicament ChangedEntity = "medicament"
+	ChangedModerator  ChangedEntity = "moderator"
+)
+
+// EntityChange is one update of a record made through the moderator or admin API. The history
+// outlives the record, so it does not reference it with a foreign key.
+type EntityChange struct {
+	ID         uuid.UUID     `gorm:"primaryKey;unique;type:uuid;not null"`
+	EntityType ChangedEntity `gorm:"size:32;not null;index:idx_entity_changes_entity"`
+	EntityID   uuid.UUID     `gorm:"type:uuid;not null;index:idx_entity_changes_entity"`
+	// Version is the version of the record the update produced
+	Version   uint                `gorm:"not null"`
+	ChangedBy uuid.UUID           `gorm:"type:uuid;not null"`
+	ChangedAt time.Time           `gorm:"not null"`
+	Fields    []EntityChangeField `gorm:"foreignKey:ChangeID;constraint:OnDelete:CASCADE;"`
+}
+
+type EntityChangeField struct {
+	ID       uuid.UUID `gorm:"primaryKey;unique;type:uuid;not null"`
+	ChangeID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Field    string    `gorm:"size:64;not null"`
+	OldValue string    `gorm:"type:text"`
+	NewValue string    `gorm:"type:text"`
+}
@@ -2,14 +2,15 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"time"
 )
 
 type Sex string
 
 const (
-	Male   Sex = "M"
-	Female Sex = "F"
+	Male   Sex = "male"
+	Female Sex = "female"
 )
 
 type Province string
@@ -31,10 +32,11 @@ const (
 )
 
 type CitizenAuth struct {
-	ID       uuid.UUID `gorm:"primary_key;unique;type:uuid;not null;"`
-	Email    string    `gorm:"type:text;not null"`
-	Password string    `gorm:"type:text;not null"`
-	Citizen  Citizen   `gorm:"foreignKey:ID;references:ID;constraint:OnDelete:CASCADE;"`
+	ID        uuid.UUID      `gorm:"primary_key;unique;type:uuid;not null;"`
+	Email     string         `gorm:"type:text;not null"`
+	Password  string         `gorm:"type:text;not null"`
+	Citizen   Citizen        `gorm:"foreignKey:ID;references:ID;constraint:OnDelete:CASCADE;"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Citizen struct {
@@ -54,6 +56,8 @@ type Citizen struct {
 	//PersonalDoctorID uuid.UUID      `gorm:"type:uuid;not null;"`
 	//PersonalDoctor   Doctor         `gorm:"foreignKey:PersonalDoctorID;references:ID;"`
 	Prescriptions []Prescription `gorm:"foreignKey:CitizenID;"`
+	Version       uint           `gorm:"default:1;not null"`
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
 }
 
 type CitizenAddress struct {
@@ -1,28 +1,101 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"medico/common"
+	"time"
+)
+
+type LicenceStatus string
+
+const (
+	LicenceActive    LicenceStatus = "active"
+	LicenceSuspended LicenceStatus = "suspended"
+	LicenceRevoked   LicenceStatus = "revoked"
+)
 
 type Hospital struct {
-	ID      uuid.UUID `gorm:"primaryKey;unique;type:uuid;not null"`
-	Name    Text
-	Address Text
-	//Doctors []Doctor `gorm:"foreignKey:HospitalID"`
+	ID           uuid.UUID           `gorm:"primaryKey;unique;type:uuid;not null"`
+	Type         common.HospitalType `gorm:"type:enum('hospital','practice');not null"`
+	Name         Text
+	Address      Text
+	City         string
+	PhoneNumber  string
+	Affiliations []DoctorAffiliation `gorm:"foreignKey:HospitalID;constraint:OnDelete:CASCADE;"`
+}
+
+// DoctorAffiliation links a doctor to a hospital or practice they work at
+type DoctorAffiliation struct {
+	ID         uuid.UUID              `gorm:"primaryKey;unique;type:uuid;not null"`
+	DoctorID   uuid.UUID              `gorm:"type:uuid;not null"`
+	Doctor     Doctor                 `gorm:"foreignKey:DoctorID;references:ID"`
+	HospitalID uuid.UUID              `gorm:"type:uuid;not null"`
+	Hospital   Hospital               `gorm:"foreignKey:HospitalID;references:ID"`
+	Role       common.AffiliationRole `gorm:"type:enum('attending','consultant','resident','head_of_department','general_practitioner');not null"`
+	StartDate  time.Time              `gorm:"not null"`
+	EndDate    *time.Time
 }
 
 type DoctorAuth struct {
-	ID       uuid.UUID `gorm:"primary_key;unique;type:uuid;not null"`
-	Email    string    `gorm:"type:text;not null"`
-	Password string    `gorm:"type:text;not null"`
-	Doctor   Doctor    `gorm:"foreignKey:ID;references:ID;constraint:OnDelete:CASCADE;"`
+	ID        uuid.UUID      `gorm:"primary_key;unique;type:uuid;not null"`
+	Email     string         `gorm:"type:text;not null"`
+	Password  string         `gorm:"type:text;not null"`
+	Doctor    Doctor         `gorm:"foreignKey:ID;references:ID;constraint:OnDelete:CASCADE;"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Doctor struct {
-	ID         uuid.UUID `gorm:"primaryKey;unique;type:uuid;not null"`
+	ID                 uuid.UUID `gorm:"primaryKey;unique;type:uuid;not null"`
+	FirstName          string
+	SecondName         string
+	LastName           string
+	Affiliations       []DoctorAffiliation `gorm:"foreignKey:DoctorID;constraint:OnDelete:CASCADE;"`
+	Specialties        []Specialty         `gorm:"many2many:doctor_specialties;constraint:OnDelete:CASCADE;"`
+	SigningKeys        []DoctorSigningKey  `gorm:"foreignKey:DoctorID;constraint:OnDelete:CASCADE;"`
+	UIN                string
+	Email              string
+	LicenceCheckedAt   time.Time
+	PrescribingBlocked bool           `gorm:"default:false;not null"`
+	Version            uint           `gorm:"default:1;not null"`
+	DeletedAt          gorm.DeletedAt `gorm:"index"`
+}
+
+type SigningKeyStatus string
+
+const (
+	SigningKeyActive  SigningKeyStatus = "active"
+	SigningKeyRetired SigningKeyStatus = "retired"
+	SigningKeyRevoked SigningKeyStatus = "revoked"
+)
+
+// DoctorSigningKey is an Ed25519 key pair the server signs prescriptions with on behalf of
+// the doctor. Retired keys still verify the prescriptions they signed, revoked keys do not.
+type DoctorSigningKey struct {
+	ID        uuid.UUID `gorm:"primaryKey;unique;type:uuid;not null"`
+	DoctorID  uuid.UUID `gorm:"type:uuid;not null;index"`
+	PublicKey []byte    `gorm:"type:varbinary(32);not null"`
+	// PrivateKey is the seed of the key sealed with the signing master key
+	PrivateKey       []byte           `gorm:"type:varbinary(128);not null"`
+	Status           SigningKeyStatus `gorm:"type:enum('active','retired','revoked');default:'active';not null"`
+	CreatedAt        time.Time        `gorm:"not null"`
+	RetiredAt        *time.Time
+	RevokedAt        *time.Time
+	RevocationReason string
+}
+
+type Specialty struct {
+	ID   uuid.UUID `gorm:"primaryKey;unique;type:uuid;not null"`
+	Code string    `gorm:"size:16;unique;not null"`
+	Name string
+}
+
+// PhysicianRegistryEntry is a row of the medical-association register of licensed physicians
+type PhysicianRegistryEntry struct {
+	UIN        string `gorm:"primaryKey;size:10;not null"`
 	FirstName  string
 	SecondName string
 	LastName   string
-	//HospitalID uuid.UUID `gorm:"type:uuid;not null"`
-	//Hospital   Hospital  `gorm:"foreignKey:HospitalID"`
-	UIN   string
-	Email string
+	Status     LicenceStatus `gorm:"type:enum('active','suspended','revoked');not null"`
+	ImportedAt time.Time     `gorm:"not null"`
 }
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"medico/common"
+	"time"
+)
+
+type StockActorRole string
+
+const (
+	StockActorPharmacist    StockActorRole = "pharmacist"
+	StockActorPharmacyOwner StockActorRole = "pharmacy_owner"
+	StockActorSystem        StockActorRole = "system"
+)
+
+// StockMovement is one change to the stock of a medicament at a branch. Movements are only
+// ever appended, the sum of their deltas is the quantity the branch should hold and
+// PharmacyBranchStorage.Quantity is kept equal to it.
+type StockMovement struct {
+	ID               uuid.UUID                `gorm:"not null;type:uuid;primary_key"`
+	PharmacyBranchID uuid.UUID                `gorm:"not null;type:uuid;index:idx_stock_movement_item"`
+	MedicamentID     uuid.UUID                `gorm:"not null;type:uuid;index:idx_stock_movement_item"`
+	Medicament       Medicament               `gorm:"foreignKey:MedicamentID;references:ID"`
+	Type             common.StockMovementType `gorm:"size:32;not null"`
+	Delta            int64                    `gorm:"not null"`
+	BatchNumber      string                   `gorm:"size:64"`
+	// ExpiresOn is the expiry date of the batch. A receipt of a new batch sets it.
+	ExpiresOn *time.Time `gorm:"type:date"`
+	// QuantityAfter is the quantity the branch held right after the movement
+	QuantityAfter uint           `gorm:"not null"`
+	ActorRole     StockActorRole `gorm:"size:32;not null"`
+	ActorID       uuid.UUID      `gorm:"type:uuid"`
+	Reason        string         `gorm:"type:text"`
+	// Reference ties the movement to what caused it, e.g. a prescription, a delivery note or the
+	// transfer both sides of it belong to
+	Reference  string    `gorm:"size:64;index"`
+	OccurredAt time.Time `gorm:"not null;index"`
+}
+
+// StockBatch is the stock of a medicament at a branch that came from one manufacturer lot.
+// The batches of a medicament add up to PharmacyBranchStorage.Quantity.
+type StockBatch struct {
+	PharmacyBranchID uuid.UUID  `gorm:"not null;type:uuid;primary_key"`
+	MedicamentID     uuid.UUID  `gorm:"not null;type:uuid;primary_key"`
+	Medicament       Medicament `gorm:"foreignKey:MedicamentID;references:ID"`
+	BatchNumber      string     `gorm:"size:64;not null;primary_key"`
+	// ExpiresOn is the last day the batch may be dispensed on
+	ExpiresOn time.Time `gorm:"type:date;not null;index"`
+	Quantity  uint      `gorm:"not null"`
+}
+
+// StockLevel is how much of a medicament an owner wants a branch to hold. Below Minimum the
+// medicament is reordered up to Target.
+type StockLevel struct {
+	PharmacyBranchID uuid.UUID  `gorm:"not null;type:uuid;primary_key"`
+	MedicamentID     uuid.UUID  `gorm:"not null;type:uuid;primary_key"`
+	Medicament       Medicament `gorm:"foreignKey:MedicamentID;references:ID"`
+	Minimum          uint       `gorm:"not null"`
+	Target           uint       `gorm:"not null"`
+	UpdatedAt        time.Time
+}
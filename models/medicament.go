@@ -1,6 +1,9 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
 
 type Unit string
 
@@ -60,4 +63,8 @@ type Medicament struct {
 	//AuthorisationHolder   AuthorizationHolder `gorm:"foreignKey:AuthorizationHolderID;references:ID"`
 	ATC                  string
 	RequiredPrescription bool
+	// RestrictedToSpecialties lists the only specialties allowed to prescribe the medicament, empty means everyone
+	RestrictedToSpecialties []Specialty    `gorm:"many2many:medicament_specialty_restrictions;constraint:OnDelete:CASCADE;"`
+	Version                 uint           `gorm:"default:1;not null"`
+	DeletedAt               gorm.DeletedAt `gorm:"index"`
 }
@@ -2,14 +2,16 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"medico/common"
 )
 
 type ModeratorAuth struct {
-	ID        uuid.UUID `gorm:"primary_key;unique;type:uuid;not null"`
-	Email     string    `gorm:"type:text;not null"`
-	Password  string    `gorm:"type:text;not null"`
-	Moderator Moderator `gorm:"foreignKey:ID;references:ID;constraint:OnDelete:CASCADE;"`
+	ID        uuid.UUID      `gorm:"primary_key;unique;type:uuid;not null"`
+	Email     string         `gorm:"type:text;not null"`
+	Password  string         `gorm:"type:text;not null"`
+	Moderator Moderator      `gorm:"foreignKey:ID;references:ID;constraint:OnDelete:CASCADE;"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Moderator struct {
@@ -19,4 +21,6 @@ type Moderator struct {
 	LastName   string
 	Email      string
 	Type       common.ModeratorType `gorm:"type:enum('doctor','citizen','pharmacy','medicament');not null"`
+	Version    uint                 `gorm:"default:1;not null"`
+	DeletedAt  gorm.DeletedAt       `gorm:"index"`
 }
@@ -2,6 +2,8 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"medico/common"
 	"time"
 )
 
@@ -24,23 +26,59 @@ type PharmacyBrand struct {
 	OwnerID             uuid.UUID     `gorm:"not null;type:uuid"`
 	Owner               PharmacyOwner `gorm:"foreignkey:OwnerID;references:ID"`
 	HeadquartersAddress string
+	LicenceNumber       string
 	PharmacyBranches    []PharmacyBranch `gorm:"foreignKey:PharmacyBrandID;"`
+	Version             uint             `gorm:"default:1;not null"`
+	DeletedAt           gorm.DeletedAt   `gorm:"index"`
 }
 
 type PharmacyBranch struct {
-	ID                uuid.UUID `gorm:"not null;type:uuid;primary_key"`
-	Name              string
-	Address           string
-	PharmacyBrandID   uuid.UUID     `gorm:"not null;type:uuid"`
-	PharmacyBrand     PharmacyBrand `gorm:"foreignKey:PharmacyBrandID;references:ID"`
-	Latitude          float32
-	Longitude         float32
-	Storage           []PharmacyBranchStorage `gorm:"foreignKey:PharmacyBranchID;"`
-	Pharmacists       []Pharmacist            `gorm:"foreignKey:PharmacyBranchID;"`
-	WorkdaysStartTime time.Time
-	WorkdaysEndTime   time.Time
-	WeekendsStartTime time.Time
-	WeekendsEndTime   time.Time
+	ID              uuid.UUID `gorm:"not null;type:uuid;primary_key"`
+	Name            string
+	Address         string
+	PharmacyBrandID uuid.UUID               `gorm:"not null;type:uuid"`
+	PharmacyBrand   PharmacyBrand           `gorm:"foreignKey:PharmacyBrandID;references:ID"`
+	Latitude        float32                 `gorm:"index:idx_branch_location"`
+	Longitude       float32                 `gorm:"index:idx_branch_location"`
+	Storage         []PharmacyBranchStorage `gorm:"foreignKey:PharmacyBranchID;"`
+	Pharmacists     []Pharmacist            `gorm:"foreignKey:PharmacyBranchID;"`
+	Status          BranchStatus            `gorm:"size:32;not null;default:'open';index"`
+	// ClosedUntil ends a temporary closure on its own, a closure without it lasts until reopened
+	ClosedUntil      *time.Time
+	ClosedReason     string
+	DecommissionedAt *time.Time
+	OpeningHours     []PharmacyBranchOpeningHours `gorm:"foreignKey:PharmacyBranchID;constraint:OnDelete:CASCADE;"`
+	Holidays         []PharmacyBranchHoliday      `gorm:"foreignKey:PharmacyBranchID;constraint:OnDelete:CASCADE;"`
+}
+
+type BranchStatus string
+
+const (
+	BranchOpen              BranchStatus = "open"
+	BranchTemporarilyClosed BranchStatus = "temporarily_closed"
+	BranchDecommissioned    BranchStatus = "decommissioned"
+)
+
+// PharmacyBranchOpeningHours is when a branch is open on a day of the week, in minutes after
+// midnight. Hours that close before they open run past midnight into the next day. A day
+// without hours is a day the branch is closed, unless the branch has no hours at all.
+type PharmacyBranchOpeningHours struct {
+	PharmacyBranchID uuid.UUID `gorm:"not null;type:uuid;primary_key"`
+	Weekday          WeekDay   `gorm:"not null;primary_key;autoIncrement:false"`
+	Opens            uint16    `gorm:"not null"`
+	Closes           uint16    `gorm:"not null"`
+}
+
+// PharmacyBranchHoliday overrides the weekly hours of a branch on one date, either closing it
+// for the day or opening it for other hours
+type PharmacyBranchHoliday struct {
+	ID               uuid.UUID `gorm:"not null;type:uuid;primary_key"`
+	PharmacyBranchID uuid.UUID `gorm:"not null;type:uuid;uniqueIndex:idx_branch_holiday_date"`
+	Date             time.Time `gorm:"type:date;not null;uniqueIndex:idx_branch_holiday_date"`
+	Closed           bool      `gorm:"not null"`
+	Opens            uint16
+	Closes           uint16
+	Note             string
 }
 
 type PharmacyBranchStorage struct {
@@ -48,6 +86,8 @@ type PharmacyBranchStorage struct {
 	MedicamentID     uuid.UUID  `gorm:"not null;type:uuid"`
 	Medicament       Medicament `gorm:"foreignKey:MedicamentID;references:ID"`
 	Quantity         uint
+	// Reserved is the part of Quantity held for active reservations
+	Reserved uint `gorm:"default:0;not null"`
 }
 
 type PharmacistAuth struct {
@@ -65,3 +105,42 @@ type Pharmacist struct {
 	PharmacyBranchID uuid.UUID      `gorm:"not null;type:uuid"`
 	PharmacyBranch   PharmacyBranch `gorm:"foreignKey:PharmacyBranchID;"`
 }
+
+type RegistrationStatus string
+
+const (
+	RegistrationPending          RegistrationStatus = "pending"
+	RegistrationChangesRequested RegistrationStatus = "changes_requested"
+	RegistrationApproved         RegistrationStatus = "approved"
+	RegistrationRejected         RegistrationStatus = "rejected"
+)
+
+// PharmacyRegistration is a pharmacy chain asking to join. The owner password is kept hashed
+// until a moderator approves the request and the owner account is made from it.
+type PharmacyRegistration struct {
+	ID                  uuid.UUID `gorm:"not null;type:uuid;primary_key"`
+	CompanyName         string    `gorm:"not null"`
+	CompanyNumber       string    `gorm:"size:13;not null"`
+	Website             string
+	LicenceNumber       string             `gorm:"size:32;not null"`
+	HeadquartersAddress string             `gorm:"not null"`
+	OwnerName           string             `gorm:"not null"`
+	OwnerEmail          string             `gorm:"size:254;not null;index"`
+	OwnerPhone          string             `gorm:"size:32;not null"`
+	OwnerPassword       string             `gorm:"type:text;not null"`
+	Status              RegistrationStatus `gorm:"size:32;not null;index"`
+	SubmittedAt         time.Time          `gorm:"not null"`
+	UpdatedAt           time.Time
+	// PharmacyBrandID is the pharmacy the approval created
+	PharmacyBrandID *uuid.UUID                   `gorm:"type:uuid"`
+	Reviews         []PharmacyRegistrationReview `gorm:"foreignKey:RegistrationID;constraint:OnDelete:CASCADE;"`
+}
+
+type PharmacyRegistrationReview struct {
+	ID             uuid.UUID                   `gorm:"not null;type:uuid;primary_key"`
+	RegistrationID uuid.UUID                   `gorm:"not null;type:uuid;index"`
+	ModeratorID    uuid.UUID                   `gorm:"not null;type:uuid"`
+	Decision       common.RegistrationDecision `gorm:"size:32;not null"`
+	Comment        string                      `gorm:"type:text"`
+	ReviewedAt     time.Time                   `gorm:"not null"`
+}
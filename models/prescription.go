@@ -2,6 +2,7 @@ package models
 
 import (
 	"github.com/google/uuid"
+	"medico/common"
 	"time"
 )
 
@@ -11,25 +12,82 @@ const (
 	Active    PrescriptionState = "active"
 	Invalid   PrescriptionState = "invalid"
 	Fulfilled PrescriptionState = "fulfilled"
+	// Revoked prescriptions were withdrawn by the issuing doctor before dispensing
+	Revoked PrescriptionState = "revoked"
+	// Superseded prescriptions were replaced by an amended version
+	Superseded PrescriptionState = "superseded"
 )
 
 type Prescription struct {
-	ID           uuid.UUID                `gorm:"primaryKey;unique;type:uuid;not null"`
-	DoctorID     uuid.UUID                `gorm:"type:uuid;not null"`
-	Doctor       Doctor                   `gorm:"foreignKey:DoctorID;references:ID"`
-	CitizenID    uuid.UUID                `gorm:"type:uuid;not null"`
-	Medicaments  []PrescriptionMedicament `gorm:"foreignKey:PrescriptionID"`
-	State        PrescriptionState        `gorm:"type:enum('active','fulfilled','invalid'); not null"`
-	Name         string
+	ID          uuid.UUID                `gorm:"primaryKey;unique;type:uuid;not null"`
+	DoctorID    uuid.UUID                `gorm:"type:uuid;not null;uniqueIndex:idx_prescription_submission"`
+	Doctor      Doctor                   `gorm:"foreignKey:DoctorID;references:ID"`
+	CitizenID   uuid.UUID                `gorm:"type:uuid;not null"`
+	HospitalID  *uuid.UUID               `gorm:"type:uuid"`
+	Hospital    *Hospital                `gorm:"foreignKey:HospitalID;references:ID"`
+	Medicaments []PrescriptionMedicament `gorm:"foreignKey:PrescriptionID"`
+	State       PrescriptionState        `gorm:"type:enum('active','fulfilled','invalid','revoked','superseded'); not null"`
+	Name        string
+	// Code is the short verification code the citizen shows at the pharmacy
+	Code         string    `gorm:"size:9;unique;not null"`
 	CreationDate time.Time `gorm:"not null"`
 	StartDate    time.Time `gorm:"not null"`
 	EndDate      time.Time `gorm:"not null"`
+	// Refills is the number of repeat dispensings allowed after the first one
+	Refills            uint `gorm:"default:0;not null"`
+	RefillsUsed        uint `gorm:"default:0;not null"`
+	RefillIntervalDays uint `gorm:"default:0;not null"`
+	RefillsCancelled   bool `gorm:"default:false;not null"`
+	// WindowStartDate is when the current dispensing window opens
+	WindowStartDate time.Time `gorm:"not null"`
+	// RootID is shared by every version of the prescription and equals the ID of the first one
+	RootID            uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Version           uint       `gorm:"default:1;not null"`
+	PreviousVersionID *uuid.UUID `gorm:"type:uuid"`
+	AmendmentReason   string
+	RevokedAt         *time.Time
+	RevocationReason  string
+	// Signature covers the canonical form of the prescription and is made with SigningKey
+	SigningKeyID *uuid.UUID        `gorm:"type:uuid"`
+	SigningKey   *DoctorSigningKey `gorm:"foreignKey:SigningKeyID;references:ID"`
+	Signature    []byte            `gorm:"type:varbinary(64)"`
+	// SubmissionID identifies the FHIR submission the prescription was created from, so that
+	// a resubmission finds it instead of creating it again
+	SubmissionID *string `gorm:"size:255;uniqueIndex:idx_prescription_submission"`
 }
 
 type PrescriptionMedicament struct {
-	PrescriptionID uuid.UUID  `gorm:"primaryKey;type:uuid;not null"`
-	MedicamentID   uuid.UUID  `gorm:"type:uuid;not null"`
-	Medicament     Medicament `gorm:"foreignKey:MedicamentID;references:ID"`
-	Quantity       uint
-	Fulfilled      bool
+	PrescriptionID uuid.UUID     `gorm:"primaryKey;type:uuid;not null"`
+	Prescription   *Prescription `gorm:"foreignKey:PrescriptionID;references:ID"`
+	MedicamentID   uuid.UUID     `gorm:"primaryKey;type:uuid;not null"`
+	Medicament     Medicament    `gorm:"foreignKey:MedicamentID;references:ID"`
+	// LineID identifies the line on its own, e.g. as a FHIR MedicationRequest
+	LineID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex"`
+	Quantity    uint
+	Fulfilled   bool
+	DoseAmount  float32
+	DoseUnit    common.DoseUnit `gorm:"type:enum('tablet','capsule','ml','mg','drop','puff','sachet','application','unit');default:'tablet';not null"`
+	TimesPerDay uint8
+	// TimesOfDay is a comma separated list of common.TimeOfDay
+	TimesOfDay   string
+	DurationDays uint16
+	Route        common.AdministrationRoute `gorm:"type:enum('oral','sublingual','topical','inhalation','nasal','ophthalmic','otic','rectal','vaginal','subcutaneous','intramuscular','intravenous');default:'oral';not null"`
+	Notes        string
+}
+
+// PrescriptionFulfillment records a single dispensing of a prescription line
+type PrescriptionFulfillment struct {
+	ID               uuid.UUID      `gorm:"primaryKey;unique;type:uuid;not null"`
+	PrescriptionID   uuid.UUID      `gorm:"type:uuid;not null;index"`
+	Prescription     *Prescription  `gorm:"foreignKey:PrescriptionID;references:ID"`
+	LineID           uuid.UUID      `gorm:"type:uuid;not null;index"`
+	MedicamentID     uuid.UUID      `gorm:"type:uuid;not null"`
+	Medicament       Medicament     `gorm:"foreignKey:MedicamentID;references:ID"`
+	PharmacistID     uuid.UUID      `gorm:"type:uuid;not null"`
+	PharmacyBranchID uuid.UUID      `gorm:"type:uuid;not null"`
+	PharmacyBranch   PharmacyBranch `gorm:"foreignKey:PharmacyBranchID;references:ID"`
+	Quantity         uint
+	// Refill is the number of the dispensing window, 0 for the first dispensing
+	Refill      uint
+	FulfilledAt time.Time `gorm:"not null"`
 }
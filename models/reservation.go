@@ -0,0 +1,41 @@
+package models
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+type ReservationStatus string
+
+const (
+	ReservationActive    ReservationStatus = "active"
+	ReservationFulfilled ReservationStatus = "fulfilled"
+	ReservationCancelled ReservationStatus = "cancelled"
+	ReservationExpired   ReservationStatus = "expired"
+)
+
+// StockReservation holds the stock a citizen needs for a prescription at a branch until they
+// pick it up. The held quantities are counted in PharmacyBranchStorage.Reserved while the
+// reservation is active.
+type StockReservation struct {
+	ID               uuid.UUID         `gorm:"not null;type:uuid;primary_key"`
+	PrescriptionID   uuid.UUID         `gorm:"not null;type:uuid;index"`
+	CitizenID        uuid.UUID         `gorm:"not null;type:uuid;index"`
+	PharmacyBranchID uuid.UUID         `gorm:"not null;type:uuid;index"`
+	PharmacyBranch   PharmacyBranch    `gorm:"foreignKey:PharmacyBranchID;references:ID"`
+	Status           ReservationStatus `gorm:"size:32;not null;index"`
+	CreatedAt        time.Time         `gorm:"not null"`
+	ExpiresAt        time.Time         `gorm:"not null;index"`
+	ClosedAt         *time.Time
+	Lines            []StockReservationLine `gorm:"foreignKey:ReservationID;constraint:OnDelete:CASCADE;"`
+}
+
+// StockReservationLine is the stock held for one medicament of a reservation. A line is
+// released once its medicament is dispensed, the reservation holds nothing for it after that.
+type StockReservationLine struct {
+	ReservationID uuid.UUID  `gorm:"not null;type:uuid;primary_key"`
+	MedicamentID  uuid.UUID  `gorm:"not null;type:uuid;primary_key"`
+	Medicament    Medicament `gorm:"foreignKey:MedicamentID;references:ID"`
+	Quantity      uint       `gorm:"not null"`
+	Released      bool       `gorm:"not null;default:false"`
+}
@@ -2,15 +2,40 @@ package repo
 
 import (
 	"github.com/google/uuid"
-	"medico/config"
+	"gorm.io/gorm"
+	"medico/common"
 	"medico/models"
 )
 
 type AdminRepo interface {
 	FindAuthByEmail(email string, adminAuth *models.AdminAuth) error
-	CreateModerator(moderatorAuth *models.ModeratorAuth) error
-	DeleteModerator(moderatorId uuid.UUID) error
-	FindAllModerators(moderators *[]models.Moderator) error
+	CreateModerator(moderatorAuth *models.ModeratorAuth, audit *models.AuditEntry) error
+	DeleteModerator(moderatorId uuid.UUID, audit *models.AuditEntry) error
+	RestoreModerator(moderatorId uuid.UUID, audit *models.AuditEntry) error
+	FindAllModerators(filter *ModeratorListFilter, spec *ListSpec, moderators *[]models.Moderator, total *int64) error
+	FindModeratorById(moderatorId uuid.UUID, moderator *models.Moderator) error
+	UpdateModerator(moderatorId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error
+	FindModeratorChanges(moderatorId uuid.UUID, changes *[]models.EntityChange) error
+
+	PurgeDoctor(doctorId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error
+	PurgeCitizen(citizenId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error
+	PurgePharmacy(pharmacyId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error
+	PurgeMedicament(medicamentId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error
+	PurgeModerator(moderatorId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error
+}
+
+type ModeratorListFilter struct {
+	Name    string
+	Email   string
+	Type    common.ModeratorType
+	Deleted bool
+}
+
+var moderatorSortColumns = sortColumns{
+	"firstName": "first_name",
+	"lastName":  "last_name",
+	"email":     "email",
+	"type":      "type",
 }
 
 type adminRepo struct {
@@ -18,22 +43,120 @@ type adminRepo struct {
 }
 
 func NewAdminRepo() AdminRepo {
-	databaseConfig := config.LoadDatabaseConfig()
-	return &adminRepo{repo: CreateNewRepository(databaseConfig)}
+	return &adminRepo{repo: SharedRepository()}
 }
 
 func (r *adminRepo) FindAuthByEmail(email string, adminAuth *models.AdminAuth) error {
 	return r.repo.First(adminAuth, "email = ?", email).Error
 }
 
-func (r *adminRepo) CreateModerator(moderatorAuth *models.ModeratorAuth) error {
-	return r.repo.Create(moderatorAuth).Error
+func (r *adminRepo) CreateModerator(moderatorAuth *models.ModeratorAuth, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		return tx.Create(moderatorAuth).Error
+	})
+}
+
+func (r *adminRepo) DeleteModerator(moderatorId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		return softDelete(tx, moderatorId, &models.ModeratorAuth{}, &models.Moderator{})
+	})
+}
+
+func (r *adminRepo) RestoreModerator(moderatorId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		return restore(tx, moderatorId, &models.ModeratorAuth{}, &models.Moderator{})
+	})
+}
+
+func (r *adminRepo) FindAllModerators(filter *ModeratorListFilter, spec *ListSpec, moderators *[]models.Moderator, total *int64) error {
+	order, err := moderatorSortColumns.orderBy(spec.Sort, "last_name, first_name")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.Deleted {
+			db = onlyDeleted(db)
+		}
+		if filter.Name != "" {
+			db = whereName(db, filter.Name)
+		}
+		if filter.Email != "" {
+			db = db.Where("email LIKE ? ESCAPE '!'", likeContains(filter.Email))
+		}
+		if filter.Type != "" {
+			db = db.Where("type = ?", filter.Type)
+		}
+		return db
+	}
+
+	return findList(r.repo, &models.Moderator{}, scope, order, spec, moderators, total)
+}
+
+func (r *adminRepo) FindModeratorById(moderatorId uuid.UUID, moderator *models.Moderator) error {
+	return r.repo.First(moderator, "id = ?", moderatorId).Error
+}
+
+// UpdateModerator also changes the login email when the moderator's email changes
+func (r *adminRepo) UpdateModerator(moderatorId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		if err := updateVersioned(tx, &models.Moderator{}, moderatorId, version, updates, change); err != nil {
+			return err
+		}
+
+		if email, ok := updates["email"]; ok {
+			return tx.Model(&models.ModeratorAuth{}).Where("id = ?", moderatorId).Update("email", email).Error
+		}
+
+		return nil
+	})
+}
+
+func (r *adminRepo) FindModeratorChanges(moderatorId uuid.UUID, changes *[]models.EntityChange) error {
+	return findChanges(r.repo, models.ChangedModerator, moderatorId, changes)
+}
+
+func (r *adminRepo) PurgeDoctor(doctorId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		return purge(tx, doctorId, doctorReferences, references, &models.DoctorAuth{}, &models.Doctor{})
+	})
+}
+
+func (r *adminRepo) PurgeCitizen(citizenId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		return purge(tx, citizenId, citizenReferences, references, &models.CitizenAuth{}, &models.Citizen{})
+	})
+}
+
+// PurgePharmacy removes the pharmacy together with its owner and the owner's login, an owner
+// is only ever created for its pharmacy.
+func (r *adminRepo) PurgePharmacy(pharmacyId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		brand := models.PharmacyBrand{}
+		if err := tx.Model(&models.PharmacyBrand{}).Unscoped().First(&brand, "id = ?", pharmacyId).Error; err != nil {
+			return err
+		}
+
+		if err := purgeIn(tx, pharmacyId, pharmacyReferences, references, &models.PharmacyBrand{}); err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", brand.OwnerID).Delete(&models.PharmacyOwnerAuth{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", brand.OwnerID).Delete(&models.PharmacyOwner{}).Error
+	})
 }
 
-func (r *adminRepo) DeleteModerator(moderatorId uuid.UUID) error {
-	return r.repo.Where("id = ?", moderatorId.String()).Delete(models.ModeratorAuth{}).Error
+func (r *adminRepo) PurgeMedicament(medicamentId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		return purge(tx, medicamentId, medicamentReferences, references, &models.Medicament{})
+	})
 }
 
-func (r *adminRepo) FindAllModerators(moderators *[]models.Moderator) error {
-	return r.repo.Find(moderators).Error
+func (r *adminRepo) PurgeModerator(moderatorId uuid.UUID, references *[]ReferenceCount, audit *models.AuditEntry) error {
+	return audited(r.repo, audit, func(tx Repository) error {
+		return purge(tx, moderatorId, nil, references, &models.ModeratorAuth{}, &models.Moderator{})
+	})
 }
@@ -0,0 +1,183 @@
+package repo
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"medico/config"
+	"medico/models"
+	"sync"
+	"time"
+)
+
+// auditChainHeadId is the id of the only row of the audit chain head table
+const auditChainHeadId = 1
+
+// canonicalAuditEntry is the hashed form of an audit entry. Fields are serialized in
+// declaration order and the time in UTC, so the hash does not depend on the connection.
+type canonicalAuditEntry struct {
+	Sequence   uint64    `json:"sequence"`
+	PrevHash   string    `json:"prevHash"`
+	ID         uuid.UUID `json:"id"`
+	ActorID    uuid.UUID `json:"actorId"`
+	ActorRole  string    `json:"actorRole"`
+	Action     string    `json:"action"`
+	EntityType string    `json:"entityType"`
+	EntityID   uuid.UUID `json:"entityId"`
+	Diff       string    `json:"diff"`
+	IP         string    `json:"ip"`
+	RequestID  string    `json:"requestId"`
+	CreatedAt  string    `json:"createdAt"`
+}
+
+// auditKey is the key of the audit hashes. It comes from outside the database, so rewriting
+// the log there cannot produce hashes that verify.
+var auditKey = sync.OnceValue(func() []byte {
+	return config.LoadAuditConfig().HashKey
+})
+
+// AuditEntryHash returns the hash an audit entry is chained with
+func AuditEntryHash(entry *models.AuditEntry) string {
+	return auditEntryHash(entry, auditKey())
+}
+
+// auditEntryHash is the HMAC-SHA256 of the canonical form of entry under key
+func auditEntryHash(entry *models.AuditEntry, key []byte) string {
+	// the canonical entry only holds strings, numbers and uuids, so it always marshals
+	canonical, _ := json.Marshal(canonicalAuditEntry{
+		Sequence:   entry.Sequence,
+		PrevHash:   entry.PrevHash,
+		ID:         entry.ID,
+		ActorID:    entry.ActorID,
+		ActorRole:  entry.ActorRole,
+		Action:     string(entry.Action),
+		EntityType: string(entry.EntityType),
+		EntityID:   entry.EntityID,
+		Diff:       entry.Diff,
+		IP:         entry.IP,
+		RequestID:  entry.RequestID,
+		CreatedAt:  entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(canonical)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// appendAudit chains entry onto the newest audit entry and stores it. The column keeps
+// milliseconds, so the time is cut to them before it is hashed.
+func appendAudit(tx Repository, entry *models.AuditEntry) error {
+	head := models.AuditChainHead{}
+	if err := tx.Where("id = ?", auditChainHeadId).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&head).Error; err != nil {
+		return err
+	}
+
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+	entry.Sequence = head.Sequence + 1
+	entry.PrevHash = head.Hash
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Millisecond)
+	entry.Hash = AuditEntryHash(entry)
+
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.AuditChainHead{}).Where("id = ?", auditChainHeadId).Updates(map[string]interface{}{
+		"sequence": entry.Sequence,
+		"hash":     entry.Hash,
+	}).Error
+}
+
+// audited runs change and appends entry to the audit log in the same transaction
+func audited(r Repository, entry *models.AuditEntry, change func(tx Repository) error) error {
+	return r.Transaction(func(tx Repository) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+
+		return appendAudit(tx, entry)
+	})
+}
+
+type AuditListFilter struct {
+	ActorID    *uuid.UUID
+	ActorRole  string
+	Action     models.AuditAction
+	EntityType models.AuditEntity
+	EntityID   *uuid.UUID
+	From       *time.Time
+	To         *time.Time
+}
+
+var auditSortColumns = sortColumns{
+	"sequence":  "sequence",
+	"createdAt": "created_at",
+}
+
+type AuditRepo interface {
+	FindAuditEntries(filter *AuditListFilter, spec *ListSpec, entries *[]models.AuditEntry, total *int64) error
+	FindAuditChain(afterSequence uint64, limit int, entries *[]models.AuditEntry) error
+	FindAuditChainHead(head *models.AuditChainHead) error
+}
+
+type auditRepo struct {
+	repo Repository
+}
+
+func NewAuditRepo() AuditRepo {
+	return &auditRepo{repo: SharedRepository()}
+}
+
+func (a *auditRepo) FindAuditEntries(filter *AuditListFilter, spec *ListSpec, entries *[]models.AuditEntry, total *int64) error {
+	order, err := auditSortColumns.orderBy(spec.Sort, "sequence DESC")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.ActorID != nil {
+			db = db.Where("actor_id = ?", *filter.ActorID)
+		}
+		if filter.ActorRole != "" {
+			db = db.Where("actor_role = ?", filter.ActorRole)
+		}
+		if filter.Action != "" {
+			db = db.Where("action = ?", filter.Action)
+		}
+		if filter.EntityType != "" {
+			db = db.Where("entity_type = ?", filter.EntityType)
+		}
+		if filter.EntityID != nil {
+			db = db.Where("entity_id = ?", *filter.EntityID)
+		}
+		if filter.From != nil {
+			db = db.Where("created_at >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			db = db.Where("created_at < ?", *filter.To)
+		}
+		return db
+	}
+
+	return findList(a.repo, &models.AuditEntry{}, scope, order, spec, entries, total)
+}
+
+// FindAuditChain loads up to limit entries that follow afterSequence, in chain order
+func (a *auditRepo) FindAuditChain(afterSequence uint64, limit int, entries *[]models.AuditEntry) error {
+	return a.repo.Where("sequence > ?", afterSequence).
+		Order("sequence").
+		Limit(limit).
+		Find(entries).Error
+}
+
+func (a *auditRepo) FindAuditChainHead(head *models.AuditChainHead) error {
+	return a.repo.First(head, "id = ?", auditChainHeadId).Error
+}
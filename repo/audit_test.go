@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"medico/models"
+	"testing"
+	"time"
+)
+
+func TestAuditEntryHash(t *testing.T) {
+	key := []byte("audit key")
+	entry := models.AuditEntry{
+		ID:         uuid.MustParse("0b9f3c1e-4a57-4f0e-9d3a-6a1f2c8e7b10"),
+		Sequence:   7,
+		PrevHash:   "5d41402abc4b2a76b9719d911017c592",
+		ActorID:    uuid.MustParse("6c2f0e1a-8b3d-4c5e-9f70-1a2b3c4d5e6f"),
+		ActorRole:  "admin",
+		Action:     models.AuditDelete,
+		EntityType: models.AuditedPharmacy,
+		EntityID:   uuid.MustParse("9e8d7c6b-5a49-4382-b1a0-f9e8d7c6b5a4"),
+		Diff:       `{"deleted":{"before":"false","after":"true"}}`,
+		IP:         "10.0.0.1",
+		RequestID:  "2f1e0d9c-8b7a-4695-a4b3-c2d1e0f9a8b7",
+		CreatedAt:  time.Date(2026, 3, 1, 9, 30, 0, 123000000, time.UTC),
+	}
+	hash := auditEntryHash(&entry, key)
+
+	if len(hash) != 64 {
+		t.Fatalf("auditEntryHash() = %q, want 64 hex digits", hash)
+	}
+
+	sofia, err := time.LoadLocation("Europe/Sofia")
+	if err != nil {
+		t.Skip(err)
+	}
+	local := entry
+	local.CreatedAt = entry.CreatedAt.In(sofia)
+	local.Hash = "ignored"
+	if got := auditEntryHash(&local, key); got != hash {
+		t.Errorf("hash of the entry in another zone = %s, want %s", got, hash)
+	}
+
+	changes := []struct {
+		name   string
+		change func(entry *models.AuditEntry)
+	}{
+		{"sequence", func(entry *models.AuditEntry) { entry.Sequence++ }},
+		{"previous hash", func(entry *models.AuditEntry) { entry.PrevHash = "" }},
+		{"id", func(entry *models.AuditEntry) { entry.ID = uuid.Nil }},
+		{"actor", func(entry *models.AuditEntry) { entry.ActorID = uuid.Nil }},
+		{"role", func(entry *models.AuditEntry) { entry.ActorRole = "moderator:pharmacy" }},
+		{"action", func(entry *models.AuditEntry) { entry.Action = models.AuditRestore }},
+		{"entity type", func(entry *models.AuditEntry) { entry.EntityType = models.AuditedMedicament }},
+		{"entity", func(entry *models.AuditEntry) { entry.EntityID = uuid.Nil }},
+		{"diff", func(entry *models.AuditEntry) { entry.Diff = "{}" }},
+		{"ip", func(entry *models.AuditEntry) { entry.IP = "10.0.0.2" }},
+		{"request", func(entry *models.AuditEntry) { entry.RequestID = "" }},
+		{"time", func(entry *models.AuditEntry) { entry.CreatedAt = entry.CreatedAt.Add(time.Millisecond) }},
+	}
+
+	for _, test := range changes {
+		t.Run(test.name, func(t *testing.T) {
+			changed := entry
+			test.change(&changed)
+
+			if got := auditEntryHash(&changed, key); got == hash {
+				t.Errorf("changing the %s keeps the hash %s", test.name, hash)
+			}
+		})
+	}
+
+	if got := auditEntryHash(&entry, []byte("another key")); got == hash {
+		t.Errorf("hash under another key = %s, want it to differ", got)
+	}
+}
@@ -0,0 +1,30 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"medico/models"
+)
+
+// updateVersioned applies updates to the row of model with id if the row is still at the
+// version the update was made against. It moves the row to the next version and records change.
+func updateVersioned(tx Repository, model interface{}, id uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange) error {
+	updates["version"] = version + 1
+
+	result := tx.Model(model).Where("id = ? AND version = ?", id, version).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+
+	return tx.Create(change).Error
+}
+
+func findChanges(r Repository, entityType models.ChangedEntity, id uuid.UUID, changes *[]models.EntityChange) error {
+	return r.Preload("Fields").
+		Where("entity_type = ? AND entity_id = ?", entityType, id).
+		Order("version DESC").
+		Find(changes).Error
+}
@@ -2,16 +2,24 @@ package repo
 
 import (
 	"github.com/google/uuid"
-	"medico/config"
 	"medico/models"
+	"time"
 )
 
 type CitizenRepo interface {
 	FindAuthByEmail(email string, citizenAuth *models.CitizenAuth) error
 	FindMedicalInfo(citizenId uuid.UUID, citizen *models.Citizen) error
 	FindAllPrescriptions(citizenId uuid.UUID, prescriptions *[]models.Prescription) error
+	FindPrescriptionById(prescriptionId uuid.UUID, prescription *models.Prescription) error
+	FindPrescriptionHistory(prescriptionId uuid.UUID, history *[]models.Prescription) error
+	FindPrescriptionForPrint(prescriptionId uuid.UUID, prescription *models.Prescription, citizen *models.Citizen) error
 	FindPersonalDoctor(citizenId uuid.UUID, doctor *models.Doctor) error
-	FindAvailablePharmacies(prescriptionId uuid.UUID, branches *[]models.PharmacyBranch) error
+	FindPharmaciesInArea(area GeoArea, at time.Time, branches *[]models.PharmacyBranch) error
+	FindPrescriptionStockCoverage(prescriptionId uuid.UUID, branchIds []uuid.UUID, at time.Time, openLines *int64, coverage *[]BranchStockCoverage) error
+	FindOverTheCounterMedicaments(search string, limit int, medicaments *[]models.Medicament) error
+	FindBranchStock(branchIds, medicamentIds []uuid.UUID, at time.Time, storage *[]models.PharmacyBranchStorage) error
+	FindHospitalsByCommonName(commonName string, hospitals *[]models.Hospital) error
+	FindDoctorAffiliationsByHospital(hospitalId uuid.UUID, commonName string, at time.Time, affiliations *[]models.DoctorAffiliation) error
 }
 
 type citizenRepo struct {
@@ -19,8 +27,7 @@ type citizenRepo struct {
 }
 
 func NewCitizenRepo() CitizenRepo {
-	databaseConfig := config.LoadDatabaseConfig()
-	return &citizenRepo{repo: CreateNewRepository(databaseConfig)}
+	return &citizenRepo{repo: SharedRepository()}
 }
 
 func (c *citizenRepo) FindAuthByEmail(email string, citizenAuth *models.CitizenAuth) error {
@@ -36,13 +43,120 @@ func (c *citizenRepo) FindPersonalDoctor(citizenId uuid.UUID, doctor *models.Doc
 }
 
 func (c *citizenRepo) FindAllPrescriptions(citizenId uuid.UUID, prescriptions *[]models.Prescription) error {
-	return c.repo.Preload("Doctor").Preload("Medicaments.Medicament").Find(prescriptions, "citizen_id = ?", citizenId).Error
+	return c.repo.Preload("Doctor", withDeleted).Preload("Hospital").Preload("Medicaments.Medicament", withDeleted).Find(prescriptions, "citizen_id = ?", citizenId).Error
 }
 
-func (c *citizenRepo) FindAvailablePharmacies(prescriptionId uuid.UUID, branches *[]models.PharmacyBranch) error {
-	return c.repo.Model(models.PharmacyBranch{}).
-		Joins("LEFT JOIN pharmacy_branch_storages ON pharmacy_branches.id = pharmacy_branch_storages.pharmacy_branch_id").
-		Joins("LEFT JOIN prescription_medicaments ON pharmacy_branch_storages.medicament_id = prescription_medicaments.medicament_id AND prescription_medicaments.prescription_id = ?", prescriptionId).
-		Where("pharmacy_branch_storages.quantity >= prescription_medicaments.quantity").
-		Find(branches).Error
+// GeoArea is a bounding box of coordinates. A box that crosses the antimeridian has MinLongitude
+// greater than MaxLongitude.
+type GeoArea struct {
+	MinLatitude  float64
+	MaxLatitude  float64
+	MinLongitude float64
+	MaxLongitude float64
+}
+
+// BranchStockCoverage is how many open lines of a prescription a branch can dispense
+type BranchStockCoverage struct {
+	PharmacyBranchID uuid.UUID
+	CoveredLines     int64
+}
+
+// FindPharmaciesInArea finds the branches inside the area that are not closed at the time,
+// along with their hours for that day. The area is matched against the location index, the
+// exact distance is left to the caller.
+func (c *citizenRepo) FindPharmaciesInArea(area GeoArea, at time.Time, branches *[]models.PharmacyBranch) error {
+	query := c.repo.Model(models.PharmacyBranch{}).
+		Scopes(ofLiveBrand).
+		Preload("OpeningHours", "weekday = ?", at.Weekday()).
+		Preload("Holidays", "date = ?", at.Format(time.DateOnly)).
+		Where("status = ? OR (status = ? AND closed_until <= ?)",
+			models.BranchOpen, models.BranchTemporarilyClosed, at).
+		Where("latitude BETWEEN ? AND ?", area.MinLatitude, area.MaxLatitude)
+
+	if area.MinLongitude <= area.MaxLongitude {
+		query = query.Where("longitude BETWEEN ? AND ?", area.MinLongitude, area.MaxLongitude)
+	} else {
+		query = query.Where("longitude >= ? OR longitude <= ?", area.MinLongitude, area.MaxLongitude)
+	}
+
+	return query.Find(branches).Error
+}
+
+// FindPrescriptionStockCoverage counts the lines of the prescription still to be dispensed and,
+// for each of the branches, how many of them it has enough unexpired stock for. Branches that
+// cover no line are left out.
+func (c *citizenRepo) FindPrescriptionStockCoverage(prescriptionId uuid.UUID, branchIds []uuid.UUID, at time.Time, openLines *int64, coverage *[]BranchStockCoverage) error {
+	if err := c.repo.Model(models.PrescriptionMedicament{}).
+		Where("prescription_id = ? AND fulfilled = ?", prescriptionId, false).
+		Count(openLines).Error; err != nil {
+		return err
+	}
+
+	if *openLines == 0 || len(branchIds) == 0 {
+		*coverage = []BranchStockCoverage{}
+		return nil
+	}
+
+	return c.repo.Model(models.PharmacyBranchStorage{}).
+		Select("pharmacy_branch_storages.pharmacy_branch_id, COUNT(*) AS covered_lines").
+		Joins("INNER JOIN prescription_medicaments ON prescription_medicaments.medicament_id = pharmacy_branch_storages.medicament_id").
+		Where("prescription_medicaments.prescription_id = ? AND prescription_medicaments.fulfilled = ?", prescriptionId, false).
+		Where(dispensableQuantity+" >= pharmacy_branch_storages.reserved + prescription_medicaments.quantity", at.Format(time.DateOnly)).
+		Where("pharmacy_branch_storages.pharmacy_branch_id IN ?", branchIds).
+		Group("pharmacy_branch_storages.pharmacy_branch_id").
+		Scan(coverage).Error
+}
+
+// FindOverTheCounterMedicaments finds the medicaments sold without a prescription by the start
+// of their name or ATC code, or by one of their active ingredients
+func (c *citizenRepo) FindOverTheCounterMedicaments(search string, limit int, medicaments *[]models.Medicament) error {
+	return c.repo.Model(models.Medicament{}).
+		Where("required_prescription = ?", false).
+		Where("official_name LIKE ? ESCAPE '!' OR bulgarian_name LIKE ? ESCAPE '!' OR atc LIKE ? ESCAPE '!' OR active_ingredients LIKE ? ESCAPE '!'",
+			likePrefix(search), likePrefix(search), likePrefix(search), likeContains(search)).
+		Order("official_name").
+		Limit(limit).
+		Find(medicaments).Error
+}
+
+// FindBranchStock finds the stock of the medicaments at the branches. Quantity counts only the
+// batches not expired at the time.
+func (c *citizenRepo) FindBranchStock(branchIds, medicamentIds []uuid.UUID, at time.Time, storage *[]models.PharmacyBranchStorage) error {
+	if len(branchIds) == 0 || len(medicamentIds) == 0 {
+		*storage = []models.PharmacyBranchStorage{}
+		return nil
+	}
+
+	return c.repo.Model(models.PharmacyBranchStorage{}).
+		Select("pharmacy_branch_id, medicament_id, reserved, "+dispensableQuantity+" AS quantity", at.Format(time.DateOnly)).
+		Where("pharmacy_branch_id IN ? AND medicament_id IN ?", branchIds, medicamentIds).
+		Find(storage).Error
+}
+
+func (c *citizenRepo) FindHospitalsByCommonName(commonName string, hospitals *[]models.Hospital) error {
+	return c.repo.Find(hospitals, "name LIKE ? ESCAPE '!'", likePrefix(commonName)).Error
+}
+
+func (c *citizenRepo) FindDoctorAffiliationsByHospital(hospitalId uuid.UUID, commonName string, at time.Time, affiliations *[]models.DoctorAffiliation) error {
+	return c.repo.Model(models.DoctorAffiliation{}).
+		Preload("Doctor").
+		Preload("Hospital").
+		InnerJoins("INNER JOIN doctors ON doctors.id = doctor_affiliations.doctor_id").
+		Where("doctor_affiliations.hospital_id = ?", hospitalId).
+		Where("doctor_affiliations.start_date <= ?", at).
+		Where("doctor_affiliations.end_date IS NULL OR doctor_affiliations.end_date > ?", at).
+		Where("doctors.first_name LIKE ? ESCAPE '!' OR doctors.last_name LIKE ? ESCAPE '!'", likePrefix(commonName), likePrefix(commonName)).
+		Find(affiliations).Error
+}
+
+func (c *citizenRepo) FindPrescriptionById(prescriptionId uuid.UUID, prescription *models.Prescription) error {
+	return c.repo.First(prescription, "id = ?", prescriptionId).Error
+}
+
+func (c *citizenRepo) FindPrescriptionHistory(prescriptionId uuid.UUID, history *[]models.Prescription) error {
+	return findPrescriptionHistory(c.repo, prescriptionId, history)
+}
+
+func (c *citizenRepo) FindPrescriptionForPrint(prescriptionId uuid.UUID, prescription *models.Prescription, citizen *models.Citizen) error {
+	return findPrescriptionForPrint(c.repo, prescriptionId, prescription, citizen)
 }
@@ -0,0 +1,131 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// withDeleted lets a preload load soft-deleted rows. Prescriptions and dispensings keep
+// pointing at the doctor and medicament they were made with after those are deleted.
+func withDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// onlyDeleted narrows a list down to the soft-deleted rows
+func onlyDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where("deleted_at IS NOT NULL")
+}
+
+// ofLiveBrand leaves out the branches of soft-deleted pharmacies. They are kept for the
+// prescriptions dispensed there but no longer serve anyone.
+func ofLiveBrand(db *gorm.DB) *gorm.DB {
+	return db.Where("pharmacy_branches.pharmacy_brand_id IN (SELECT id FROM pharmacy_brands WHERE deleted_at IS NULL)")
+}
+
+// reference is a column of another table that points at the id of a record
+type reference struct {
+	table  string
+	column string
+}
+
+// ReferenceCount is the number of rows of a table that still reference a record
+type ReferenceCount struct {
+	Table string
+	Count int64
+}
+
+var (
+	doctorReferences     = []reference{{"prescriptions", "doctor_id"}}
+	citizenReferences    = []reference{{"prescriptions", "citizen_id"}}
+	medicamentReferences = []reference{
+		{"prescription_medicaments", "medicament_id"},
+		{"prescription_fulfillments", "medicament_id"},
+		{"pharmacy_branch_storages", "medicament_id"},
+		{"stock_reservation_lines", "medicament_id"},
+		{"stock_movements", "medicament_id"},
+		{"stock_batches", "medicament_id"},
+		{"stock_levels", "medicament_id"},
+	}
+	pharmacyReferences = []reference{{"pharmacy_branches", "pharmacy_brand_id"}}
+)
+
+// softDelete marks the record with id as deleted in every one of models, which share the id
+func softDelete(r Repository, id uuid.UUID, models ...interface{}) error {
+	return r.Transaction(func(tx Repository) error {
+		for _, model := range models {
+			result := tx.Where("id = ?", id).Delete(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+		}
+		return nil
+	})
+}
+
+// restore clears the deletion of the record with id in every one of models
+func restore(r Repository, id uuid.UUID, models ...interface{}) error {
+	return r.Transaction(func(tx Repository) error {
+		for _, model := range models {
+			result := tx.Model(model).Unscoped().
+				Where("id = ? AND deleted_at IS NOT NULL", id).
+				Update("deleted_at", nil)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrRecordNotDeleted
+			}
+		}
+		return nil
+	})
+}
+
+// purge removes a soft-deleted record for good. It refuses when any of references still point
+// at the record and reports how many rows of every table do in counts. models are removed in
+// order, so an auth row goes before the record it cascades to.
+func purge(r Repository, id uuid.UUID, references []reference, counts *[]ReferenceCount, models ...interface{}) error {
+	return r.Transaction(func(tx Repository) error {
+		return purgeIn(tx, id, references, counts, models...)
+	})
+}
+
+// purgeIn is purge inside the transaction tx, for purges that remove more than the record
+func purgeIn(tx Repository, id uuid.UUID, references []reference, counts *[]ReferenceCount, models ...interface{}) error {
+	var deleted int64
+	if err := tx.Model(models[len(models)-1]).Unscoped().
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Count(&deleted).Error; err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrRecordNotDeleted
+	}
+
+	*counts = make([]ReferenceCount, 0, len(references))
+	for _, ref := range references {
+		count := ReferenceCount{Table: ref.table}
+		if err := tx.Raw("SELECT COUNT(*) FROM "+ref.table+" WHERE "+ref.column+" = ?", id).
+			Scan(&count.Count).Error; err != nil {
+			return err
+		}
+		if count.Count > 0 {
+			*counts = append(*counts, count)
+		}
+	}
+
+	if len(*counts) > 0 {
+		return ErrRecordReferenced
+	}
+
+	for _, model := range models {
+		if err := tx.Model(model).Unscoped().Where("id = ?", id).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,245 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/google/uuid"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"io"
+	"medico/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMedicamentReferencesComplete fails when a model gains a medicament column that purging a
+// medicament does not check, the purge would then break the rows of that model.
+func TestMedicamentReferencesComplete(t *testing.T) {
+	packages, err := parser.ParseDir(token.NewFileSet(), "../models", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed := make(map[reference]bool, len(medicamentReferences))
+	for _, ref := range medicamentReferences {
+		listed[ref] = true
+	}
+
+	naming := schema.NamingStrategy{}
+	for _, file := range packages["models"].Files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			spec, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			model, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return false
+			}
+
+			for _, field := range model.Fields.List {
+				for _, name := range field.Names {
+					if name.Name != "MedicamentID" {
+						continue
+					}
+					ref := reference{naming.TableName(spec.Name.Name), naming.ColumnName("", name.Name)}
+					if !listed[ref] {
+						t.Errorf("%s.%s references medicaments but is missing from medicamentReferences", ref.table, ref.column)
+					}
+				}
+			}
+			return false
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	id := uuid.New()
+
+	tests := []struct {
+		name       string
+		counts     map[string]int64
+		err        error
+		references []ReferenceCount
+		deleted    bool
+	}{
+		{
+			name:       "referenced",
+			counts:     map[string]int64{"FROM `medicaments`": 1, "FROM prescription_fulfillments": 2},
+			err:        ErrRecordReferenced,
+			references: []ReferenceCount{{Table: "prescription_fulfillments", Count: 2}},
+		},
+		{
+			name:       "not deleted",
+			counts:     map[string]int64{},
+			err:        ErrRecordNotDeleted,
+			references: nil,
+		},
+		{
+			name:       "unreferenced",
+			counts:     map[string]int64{"FROM `medicaments`": 1},
+			references: []ReferenceCount{},
+			deleted:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &scriptedConn{counts: test.counts}
+			var references []ReferenceCount
+
+			err := purge(scriptedRepository(t, conn), id, medicamentReferences, &references, &models.Medicament{})
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("purge() error = %v, want %v", err, test.err)
+			}
+			if !reflect.DeepEqual(references, test.references) {
+				t.Errorf("purge() references = %v, want %v", references, test.references)
+			}
+			if deleted := conn.executed("DELETE"); deleted != test.deleted {
+				t.Errorf("purge() deleted = %v, want %v", deleted, test.deleted)
+			}
+			if committed := conn.executed("COMMIT"); committed != (test.err == nil) {
+				t.Errorf("purge() committed = %v, want %v", committed, test.err == nil)
+			}
+		})
+	}
+}
+
+func TestPurgePharmacyRemovesOwner(t *testing.T) {
+	defer func(key func() []byte) { auditKey = key }(auditKey)
+	auditKey = func() []byte { return []byte("audit key") }
+	conn := &scriptedConn{counts: map[string]int64{"FROM `pharmacy_brands`": 1}}
+	admin := &adminRepo{repo: scriptedRepository(t, conn)}
+	var references []ReferenceCount
+
+	if err := admin.PurgePharmacy(uuid.New(), &references, &models.AuditEntry{}); err != nil {
+		t.Fatalf("PurgePharmacy() error = %v", err)
+	}
+
+	for _, table := range []string{"pharmacy_brands", "pharmacy_owner_auths", "pharmacy_owners", "audit_entries"} {
+		if !conn.executed("DELETE FROM `"+table+"`") && !conn.executed("INSERT INTO `"+table+"`") {
+			t.Errorf("PurgePharmacy() did not write to %s", table)
+		}
+	}
+	if !conn.executed("COMMIT") {
+		t.Error("PurgePharmacy() did not commit")
+	}
+}
+
+// scriptedRepository is a repository over conn, which answers every query with one row
+func scriptedRepository(t *testing.T, conn *scriptedConn) Repository {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      sql.OpenDB(conn),
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &repository{db: db}
+}
+
+// scriptedConn is a database connection that records the statements it is sent. A query gets
+// a single row, which holds the count of a fragment of counts the query contains or 0.
+// A row selected with SELECT * has no columns and leaves the record it is read into empty.
+type scriptedConn struct {
+	counts     map[string]int64
+	statements []string
+}
+
+func (c *scriptedConn) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *scriptedConn) Driver() driver.Driver                        { return nil }
+func (c *scriptedConn) Close() error                                 { return nil }
+
+func (c *scriptedConn) Prepare(query string) (driver.Stmt, error) {
+	return &scriptedStmt{conn: c, query: query}, nil
+}
+
+func (c *scriptedConn) Begin() (driver.Tx, error) {
+	c.statements = append(c.statements, "BEGIN")
+	return c, nil
+}
+
+func (c *scriptedConn) Commit() error {
+	c.statements = append(c.statements, "COMMIT")
+	return nil
+}
+
+func (c *scriptedConn) Rollback() error {
+	c.statements = append(c.statements, "ROLLBACK")
+	return nil
+}
+
+// executed tells whether a statement starting with prefix was sent
+func (c *scriptedConn) executed(prefix string) bool {
+	for _, statement := range c.statements {
+		if strings.HasPrefix(statement, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type scriptedStmt struct {
+	conn  *scriptedConn
+	query string
+}
+
+func (s *scriptedStmt) Close() error  { return nil }
+func (s *scriptedStmt) NumInput() int { return -1 }
+
+func (s *scriptedStmt) Exec([]driver.Value) (driver.Result, error) {
+	s.conn.statements = append(s.conn.statements, s.query)
+	return scriptedResult{}, nil
+}
+
+// scriptedResult reports a single row written, with id 1 when it was inserted
+type scriptedResult struct{}
+
+func (scriptedResult) LastInsertId() (int64, error) { return 1, nil }
+func (scriptedResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (s *scriptedStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.conn.statements = append(s.conn.statements, s.query)
+
+	if strings.HasPrefix(s.query, "SELECT *") {
+		return &scriptedRows{}, nil
+	}
+
+	rows := &scriptedRows{columns: []string{"count"}}
+	for fragment, count := range s.conn.counts {
+		if strings.Contains(s.query, fragment) {
+			rows.count = count
+		}
+	}
+	return rows, nil
+}
+
+type scriptedRows struct {
+	columns []string
+	count   int64
+	read    bool
+}
+
+func (r *scriptedRows) Columns() []string { return r.columns }
+func (r *scriptedRows) Close() error      { return nil }
+
+func (r *scriptedRows) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read = true
+	if len(dest) > 0 {
+		dest[0] = r.count
+	}
+	return nil
+}
@@ -2,20 +2,30 @@ package repo
 
 import (
 	"github.com/google/uuid"
-	"medico/config"
 	"medico/models"
+	"time"
 )
 
 type DoctorRepo interface {
 	FindAuthByEmail(email string, doctorAuth *models.DoctorAuth) error
+	FindDoctorById(doctorId uuid.UUID, doctor *models.Doctor) error
+	FindActiveAffiliations(doctorId uuid.UUID, at time.Time, affiliations *[]models.DoctorAffiliation) error
 	FindCitizenByUcn(doctorId uuid.UUID, citizenUcn string, citizen *models.Citizen) error
 	FindCitizensByCommonUcn(citizenUcn string, citizens *[]models.Citizen) error
 	FindPrescriptionsByCitizenId(citizenId uuid.UUID, prescriptions *[]models.Prescription) error
 
 	FindMedicamentByCommonName(commonName string, medicament *[]models.Medicament) error
 	FindMedicamentByName(name string, medicament *models.Medicament) error
+	FindMedicamentsWithRestrictions(medicamentIds []uuid.UUID, medicaments *[]models.Medicament) error
 
+	FindPrescriptionById(prescriptionId uuid.UUID, prescription *models.Prescription) error
 	CreatePrescription(prescription *models.Prescription) error
+	CancelRefills(prescriptionId uuid.UUID, windowPending bool) error
+	RevokePrescription(prescriptionId uuid.UUID, reason string) error
+	AmendPrescription(previousId uuid.UUID, amended *models.Prescription) error
+	FindActiveSigningKey(doctorId uuid.UUID, key *models.DoctorSigningKey) error
+	FindPrescriptionHistory(prescriptionId uuid.UUID, history *[]models.Prescription) error
+	FindPrescriptionForPrint(prescriptionId uuid.UUID, prescription *models.Prescription, citizen *models.Citizen) error
 }
 
 type doctorRepo struct {
@@ -23,9 +33,8 @@ type doctorRepo struct {
 }
 
 func NewDoctorRepo() DoctorRepo {
-	databaseConfig := config.LoadDatabaseConfig()
 	return &doctorRepo{
-		repo: CreateNewRepository(databaseConfig),
+		repo: SharedRepository(),
 	}
 }
 
@@ -33,6 +42,17 @@ func (d *doctorRepo) FindAuthByEmail(email string, doctorAuth *models.DoctorAuth
 	return d.repo.First(doctorAuth, "email = ?", email).Error
 }
 
+func (d *doctorRepo) FindDoctorById(doctorId uuid.UUID, doctor *models.Doctor) error {
+	return d.repo.Preload("Specialties").First(doctor, "id = ?", doctorId).Error
+}
+
+func (d *doctorRepo) FindActiveAffiliations(doctorId uuid.UUID, at time.Time, affiliations *[]models.DoctorAffiliation) error {
+	return d.repo.Preload("Hospital").
+		Where("doctor_id = ? AND start_date <= ?", doctorId, at).
+		Where("end_date IS NULL OR end_date > ?", at).
+		Find(affiliations).Error
+}
+
 //	func (d *doctorRepo) FindCitizenByUcn(doctorId uuid.UUID, citizenUcn string, citizen *models.Citizen) error {
 //		return d.repo.First(citizen, "personal_doctor_id = ? AND ucn = ?", doctorId, citizenUcn).Error
 //	}
@@ -41,21 +61,98 @@ func (d *doctorRepo) FindCitizenByUcn(doctorId uuid.UUID, citizenUcn string, cit
 }
 
 func (d *doctorRepo) FindPrescriptionsByCitizenId(citizenId uuid.UUID, prescriptions *[]models.Prescription) error {
-	return d.repo.Preload("Medicaments.Medicament").Find(prescriptions, "citizen_id = ?", citizenId).Error
+	return d.repo.Preload("Hospital").Preload("Medicaments.Medicament", withDeleted).Find(prescriptions, "citizen_id = ?", citizenId).Error
 }
 
 func (d *doctorRepo) FindCitizensByCommonUcn(citizenUcn string, citizens *[]models.Citizen) error {
-	return d.repo.Where("ucn LIKE", citizenUcn+"%").Find(citizens).Error
+	return d.repo.Where("ucn LIKE ? ESCAPE '!'", likePrefix(citizenUcn)).Find(citizens).Error
 }
 
 func (d *doctorRepo) FindMedicamentByName(name string, medicament *models.Medicament) error {
 	return d.repo.First(medicament, "official_name = ?", name).Error
 }
 
+func (d *doctorRepo) FindMedicamentsWithRestrictions(medicamentIds []uuid.UUID, medicaments *[]models.Medicament) error {
+	return d.repo.Preload("RestrictedToSpecialties").Find(medicaments, "id IN ?", medicamentIds).Error
+}
+
 func (d *doctorRepo) CreatePrescription(prescription *models.Prescription) error {
 	return d.repo.Create(prescription).Error
 }
 
 func (d *doctorRepo) FindMedicamentByCommonName(commonName string, medicament *[]models.Medicament) error {
-	return d.repo.Find(medicament, "official_name LIKE ?", commonName+"%").Limit(7).Error
+	return d.repo.Find(medicament, "official_name LIKE ? ESCAPE '!'", likePrefix(commonName)).Limit(7).Error
+}
+
+func (d *doctorRepo) FindPrescriptionById(prescriptionId uuid.UUID, prescription *models.Prescription) error {
+	return d.repo.First(prescription, "id = ?", prescriptionId).Error
+}
+
+// CancelRefills drops the refills of an active prescription that have not been opened yet.
+// When the current refill window has not started, it is dropped as well and the prescription
+// is closed.
+func (d *doctorRepo) CancelRefills(prescriptionId uuid.UUID, windowPending bool) error {
+	updates := map[string]interface{}{
+		"refills_cancelled": true,
+	}
+
+	if windowPending {
+		updates["state"] = models.Fulfilled
+	}
+
+	result := d.repo.Model(&models.Prescription{}).
+		Where("id = ? AND state = ?", prescriptionId, models.Active).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPrescriptionNotActive
+	}
+
+	return nil
+}
+
+func (d *doctorRepo) RevokePrescription(prescriptionId uuid.UUID, reason string) error {
+	return d.repo.Transaction(func(tx Repository) error {
+		prescription := models.Prescription{}
+		if err := lockUndispensedPrescription(tx, prescriptionId, &prescription); err != nil {
+			return err
+		}
+
+		return tx.Model(&prescription).Updates(map[string]interface{}{
+			"state":             models.Revoked,
+			"revoked_at":        time.Now(),
+			"revocation_reason": reason,
+		}).Error
+	})
+}
+
+// AmendPrescription supersedes the previous version and stores amended as the next version
+// of the same prescription.
+func (d *doctorRepo) AmendPrescription(previousId uuid.UUID, amended *models.Prescription) error {
+	return d.repo.Transaction(func(tx Repository) error {
+		previous := models.Prescription{}
+		if err := lockUndispensedPrescription(tx, previousId, &previous); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&previous).Update("state", models.Superseded).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(amended).Error
+	})
+}
+
+func (d *doctorRepo) FindActiveSigningKey(doctorId uuid.UUID, key *models.DoctorSigningKey) error {
+	return d.repo.First(key, "doctor_id = ? AND status = ?", doctorId, models.SigningKeyActive).Error
+}
+
+func (d *doctorRepo) FindPrescriptionHistory(prescriptionId uuid.UUID, history *[]models.Prescription) error {
+	return findPrescriptionHistory(d.repo, prescriptionId, history)
+}
+
+func (d *doctorRepo) FindPrescriptionForPrint(prescriptionId uuid.UUID, prescription *models.Prescription, citizen *models.Citizen) error {
+	return findPrescriptionForPrint(d.repo, prescriptionId, prescription, citizen)
 }
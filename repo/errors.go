@@ -0,0 +1,105 @@
+package repo
+
+import "errors"
+
+const (
+	PrescriptionNotDispensable = "prescription is not open for dispensing"
+	NothingToDispense          = "no open prescription lines match the request"
+	InsufficientStock          = "branch does not have enough stock of the medicament"
+)
+
+const (
+	PrescriptionNotActive = "prescription is no longer active"
+	PrescriptionDispensed = "prescription has already been partially or fully dispensed"
+)
+
+const (
+	VersionConflict = "record was changed by someone else, reload it and try again"
+)
+
+const (
+	RecordNotDeleted = "record is not deleted"
+	RecordReferenced = "record is still referenced by other records"
+)
+
+const (
+	RegistrationNotPending  = "registration is not awaiting review"
+	RegistrationNotReturned = "registration is not waiting for changes"
+	OwnerEmailTaken         = "owner email is already registered or awaiting review"
+)
+
+const (
+	BranchDecommissioned  = "pharmacy branch is decommissioned"
+	BranchNotClosed       = "pharmacy branch is not temporarily closed"
+	BranchNotEmpty        = "pharmacy branch still has stock or pharmacists, transfer them to another branch"
+	TransferBranchInvalid = "stock and pharmacists can only be transferred to another operating branch of the pharmacy"
+)
+
+const (
+	ReservationNotActive   = "reservation is no longer active"
+	ReservationOtherBranch = "reservation was made at another branch"
+	PrescriptionReserved   = "prescription already has an active reservation"
+	NothingToReserve       = "no open prescription lines match the request"
+	BranchNotReservable    = "pharmacy branch is closed and does not take reservations"
+)
+
+const (
+	BatchRequired       = "stock can only be added to a batch"
+	BatchExpiryRequired = "a new batch needs an expiry date"
+	BatchExpiryMismatch = "batch is already stocked with another expiry date"
+)
+
+const (
+	SortFieldUnknown = "list cannot be sorted by the requested field"
+)
+
+var (
+	ErrVersionConflict = errors.New(VersionConflict)
+)
+
+var (
+	ErrRecordNotDeleted = errors.New(RecordNotDeleted)
+	ErrRecordReferenced = errors.New(RecordReferenced)
+)
+
+var (
+	ErrRegistrationNotPending  = errors.New(RegistrationNotPending)
+	ErrRegistrationNotReturned = errors.New(RegistrationNotReturned)
+	ErrOwnerEmailTaken         = errors.New(OwnerEmailTaken)
+)
+
+var (
+	ErrBranchDecommissioned  = errors.New(BranchDecommissioned)
+	ErrBranchNotClosed       = errors.New(BranchNotClosed)
+	ErrBranchNotEmpty        = errors.New(BranchNotEmpty)
+	ErrTransferBranchInvalid = errors.New(TransferBranchInvalid)
+)
+
+var (
+	ErrReservationNotActive   = errors.New(ReservationNotActive)
+	ErrReservationOtherBranch = errors.New(ReservationOtherBranch)
+	ErrPrescriptionReserved   = errors.New(PrescriptionReserved)
+	ErrNothingToReserve       = errors.New(NothingToReserve)
+	ErrBranchNotReservable    = errors.New(BranchNotReservable)
+)
+
+var (
+	ErrBatchRequired       = errors.New(BatchRequired)
+	ErrBatchExpiryRequired = errors.New(BatchExpiryRequired)
+	ErrBatchExpiryMismatch = errors.New(BatchExpiryMismatch)
+)
+
+var (
+	ErrSortFieldUnknown = errors.New(SortFieldUnknown)
+)
+
+var (
+	ErrPrescriptionNotDispensable = errors.New(PrescriptionNotDispensable)
+	ErrNothingToDispense          = errors.New(NothingToDispense)
+	ErrInsufficientStock          = errors.New(InsufficientStock)
+)
+
+var (
+	ErrPrescriptionNotActive = errors.New(PrescriptionNotActive)
+	ErrPrescriptionDispensed = errors.New(PrescriptionDispensed)
+)
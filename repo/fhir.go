@@ -0,0 +1,249 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"medico/models"
+	"time"
+)
+
+// FhirPage limits a search to Limit results starting at Offset
+type FhirPage struct {
+	Offset int
+	Limit  int
+}
+
+// FhirDateFilter compares the day of a column with the day starting at Date using one of the
+// FHIR prefixes eq, ne, lt, le, gt and ge
+type FhirDateFilter struct {
+	Prefix string
+	Date   time.Time
+}
+
+type FhirCitizenFilter struct {
+	ID        *uuid.UUID
+	UCN       string
+	Name      string
+	BirthDate *time.Time
+	Sex       string
+}
+
+type FhirDoctorFilter struct {
+	ID   *uuid.UUID
+	UIN  string
+	Name string
+}
+
+type FhirMedicamentFilter struct {
+	ID  *uuid.UUID
+	ATC string
+}
+
+type FhirPrescriptionLineFilter struct {
+	LineID         *uuid.UUID
+	PrescriptionID *uuid.UUID
+	CitizenID      *uuid.UUID
+	DoctorID       *uuid.UUID
+	MedicamentID   *uuid.UUID
+	SubmissionID   *string
+	States         []models.PrescriptionState
+	AuthoredOn     *FhirDateFilter
+	// Dispensable keeps only lines of prescriptions whose dispensing window is open
+	Dispensable bool
+	// Signed keeps only lines of prescriptions signed with a key that is not revoked. Whether
+	// the signature itself holds can only be checked after loading.
+	Signed bool
+}
+
+type FhirFulfillmentFilter struct {
+	ID               *uuid.UUID
+	CitizenID        *uuid.UUID
+	MedicamentID     *uuid.UUID
+	LineID           *uuid.UUID
+	PharmacyBranchID *uuid.UUID
+}
+
+type FhirRepo interface {
+	FindCitizens(filter *FhirCitizenFilter, page FhirPage, citizens *[]models.Citizen, total *int64) error
+	FindDoctors(filter *FhirDoctorFilter, page FhirPage, doctors *[]models.Doctor, total *int64) error
+	FindMedicaments(filter *FhirMedicamentFilter, page FhirPage, medicaments *[]models.Medicament, total *int64) error
+	FindPrescriptionLines(filter *FhirPrescriptionLineFilter, page FhirPage, lines *[]models.PrescriptionMedicament, total *int64) error
+	FindFulfillments(filter *FhirFulfillmentFilter, page FhirPage, fulfillments *[]models.PrescriptionFulfillment, total *int64) error
+	FindPharmacistBranchId(pharmacistId uuid.UUID, branchId *uuid.UUID) error
+}
+
+type fhirRepo struct {
+	repo Repository
+}
+
+func NewFhirRepo() FhirRepo {
+	return &fhirRepo{
+		repo: SharedRepository(),
+	}
+}
+
+// findPage counts every match of the scope and loads the requested page of it. Resources
+// reference what they were made with, so preloads include soft-deleted rows.
+func (f *fhirRepo) findPage(model interface{}, scope func(*gorm.DB) *gorm.DB, page FhirPage, out interface{}, total *int64, preloads ...string) error {
+	if err := f.repo.Model(model).Scopes(scope).Count(total).Error; err != nil {
+		return err
+	}
+
+	query := f.repo.Scopes(scope)
+	for _, preload := range preloads {
+		query = query.Preload(preload, withDeleted)
+	}
+
+	return query.Offset(page.Offset).Limit(page.Limit).Find(out).Error
+}
+
+func (f *fhirRepo) FindCitizens(filter *FhirCitizenFilter, page FhirPage, citizens *[]models.Citizen, total *int64) error {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.ID != nil {
+			db = db.Where("id = ?", *filter.ID)
+		}
+		if filter.UCN != "" {
+			db = db.Where("ucn = ?", filter.UCN)
+		}
+		if filter.Name != "" {
+			db = whereName(db, filter.Name)
+		}
+		if filter.BirthDate != nil {
+			db = db.Where("DATE(birthday) = DATE(?)", *filter.BirthDate)
+		}
+		if filter.Sex != "" {
+			db = db.Where("sex = ?", filter.Sex)
+		}
+		return db.Order("last_name, first_name, id")
+	}
+
+	return f.findPage(&models.Citizen{}, scope, page, citizens, total)
+}
+
+func (f *fhirRepo) FindDoctors(filter *FhirDoctorFilter, page FhirPage, doctors *[]models.Doctor, total *int64) error {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.ID != nil {
+			db = db.Where("id = ?", *filter.ID)
+		}
+		if filter.UIN != "" {
+			db = db.Where("uin = ?", filter.UIN)
+		}
+		if filter.Name != "" {
+			db = whereName(db, filter.Name)
+		}
+		return db.Order("last_name, first_name, id")
+	}
+
+	return f.findPage(&models.Doctor{}, scope, page, doctors, total, "Specialties")
+}
+
+func (f *fhirRepo) FindMedicaments(filter *FhirMedicamentFilter, page FhirPage, medicaments *[]models.Medicament, total *int64) error {
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.ID != nil {
+			db = db.Where("id = ?", *filter.ID)
+		}
+		if filter.ATC != "" {
+			db = db.Where("atc = ?", filter.ATC)
+		}
+		return db.Order("official_name, id")
+	}
+
+	return f.findPage(&models.Medicament{}, scope, page, medicaments, total)
+}
+
+func (f *fhirRepo) FindPrescriptionLines(filter *FhirPrescriptionLineFilter, page FhirPage, lines *[]models.PrescriptionMedicament, total *int64) error {
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Joins("JOIN prescriptions ON prescriptions.id = prescription_medicaments.prescription_id")
+		if filter.LineID != nil {
+			db = db.Where("prescription_medicaments.line_id = ?", *filter.LineID)
+		}
+		if filter.PrescriptionID != nil {
+			db = db.Where("prescription_medicaments.prescription_id = ?", *filter.PrescriptionID)
+		}
+		if filter.CitizenID != nil {
+			db = db.Where("prescriptions.citizen_id = ?", *filter.CitizenID)
+		}
+		if filter.DoctorID != nil {
+			db = db.Where("prescriptions.doctor_id = ?", *filter.DoctorID)
+		}
+		if filter.MedicamentID != nil {
+			db = db.Where("prescription_medicaments.medicament_id = ?", *filter.MedicamentID)
+		}
+		if filter.SubmissionID != nil {
+			db = db.Where("prescriptions.submission_id = ?", *filter.SubmissionID)
+		}
+		if len(filter.States) > 0 {
+			db = db.Where("prescriptions.state IN ?", filter.States)
+		}
+		if filter.AuthoredOn != nil {
+			db = whereDate(db, "prescriptions.creation_date", filter.AuthoredOn)
+		}
+		if filter.Dispensable {
+			db = db.Where("prescriptions.window_start_date <= ? AND prescriptions.end_date >= ?", time.Now(), time.Now())
+		}
+		if filter.Signed {
+			db = db.Joins("JOIN doctor_signing_keys ON doctor_signing_keys.id = prescriptions.signing_key_id").
+				Where("doctor_signing_keys.status <> ? AND doctor_signing_keys.doctor_id = prescriptions.doctor_id", models.SigningKeyRevoked).
+				Where("prescriptions.signature IS NOT NULL")
+		}
+		return db.Order("prescriptions.creation_date DESC, prescription_medicaments.line_id")
+	}
+
+	return f.findPage(&models.PrescriptionMedicament{}, scope, page, lines, total,
+		"Medicament", "Prescription.Doctor", "Prescription.Medicaments", "Prescription.SigningKey")
+}
+
+func (f *fhirRepo) FindFulfillments(filter *FhirFulfillmentFilter, page FhirPage, fulfillments *[]models.PrescriptionFulfillment, total *int64) error {
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Joins("JOIN prescriptions ON prescriptions.id = prescription_fulfillments.prescription_id")
+		if filter.ID != nil {
+			db = db.Where("prescription_fulfillments.id = ?", *filter.ID)
+		}
+		if filter.CitizenID != nil {
+			db = db.Where("prescriptions.citizen_id = ?", *filter.CitizenID)
+		}
+		if filter.MedicamentID != nil {
+			db = db.Where("prescription_fulfillments.medicament_id = ?", *filter.MedicamentID)
+		}
+		if filter.LineID != nil {
+			db = db.Where("prescription_fulfillments.line_id = ?", *filter.LineID)
+		}
+		if filter.PharmacyBranchID != nil {
+			db = db.Where("prescription_fulfillments.pharmacy_branch_id = ?", *filter.PharmacyBranchID)
+		}
+		return db.Order("prescription_fulfillments.fulfilled_at DESC, prescription_fulfillments.id")
+	}
+
+	return f.findPage(&models.PrescriptionFulfillment{}, scope, page, fulfillments, total,
+		"Medicament", "Prescription", "PharmacyBranch")
+}
+
+func (f *fhirRepo) FindPharmacistBranchId(pharmacistId uuid.UUID, branchId *uuid.UUID) error {
+	pharmacist := models.Pharmacist{}
+	if err := f.repo.Select("pharmacy_branch_id").First(&pharmacist, "id = ?", pharmacistId).Error; err != nil {
+		return err
+	}
+
+	*branchId = pharmacist.PharmacyBranchID
+	return nil
+}
+
+func whereDate(db *gorm.DB, column string, filter *FhirDateFilter) *gorm.DB {
+	day := filter.Date
+	next := day.AddDate(0, 0, 1)
+
+	switch filter.Prefix {
+	case "ne":
+		return db.Where("("+column+" < ? OR "+column+" >= ?)", day, next)
+	case "lt":
+		return db.Where(column+" < ?", day)
+	case "le":
+		return db.Where(column+" < ?", next)
+	case "gt":
+		return db.Where(column+" >= ?", next)
+	case "ge":
+		return db.Where(column+" >= ?", day)
+	}
+
+	return db.Where(column+" >= ? AND "+column+" < ?", day, next)
+}
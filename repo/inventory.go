@@ -0,0 +1,428 @@
+package repo
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"medico/common"
+	"medico/models"
+	"time"
+)
+
+type InventoryRepo interface {
+	RecordMovements(movements []models.StockMovement) error
+	TransferStock(fromBranchId, toBranchId, medicamentId uuid.UUID, batchNumber string, quantity uint, pharmacyOwnerId uuid.UUID, reason string, at time.Time) error
+	FindMovements(filter *StockMovementFilter, spec *ListSpec, movements *[]models.StockMovement, total *int64) error
+	FindBranchStorage(pharmacyBranchId uuid.UUID, storage *[]models.PharmacyBranchStorage) error
+	FindLedgerBalances(pharmacyBranchId uuid.UUID, balances *[]LedgerBalance) error
+	FindExpiringBatches(pharmacyBranchId uuid.UUID, until time.Time, batches *[]models.StockBatch) error
+	SetStockLevel(level *models.StockLevel) error
+	DeleteStockLevel(pharmacyBranchId, medicamentId uuid.UUID) error
+	FindStockLevels(pharmacyBranchIds []uuid.UUID, belowMinimum bool, at time.Time, levels *[]StockLevelStatus) error
+	FindDispensedQuantities(pharmacyBranchIds []uuid.UUID, since time.Time, dispensed *[]DispensedQuantity) error
+}
+
+// StockMovementFilter narrows the stock history of a branch. Zero fields do not filter.
+type StockMovementFilter struct {
+	PharmacyBranchID uuid.UUID
+	MedicamentID     *uuid.UUID
+	Type             common.StockMovementType
+	From             *time.Time
+	To               *time.Time
+}
+
+// LedgerBalance is the quantity of a medicament the movements of a branch add up to
+type LedgerBalance struct {
+	MedicamentID uuid.UUID
+	Quantity     int64
+}
+
+// StockLevelStatus is a stock level together with the unexpired stock the branch holds
+type StockLevelStatus struct {
+	PharmacyBranchID uuid.UUID
+	MedicamentID     uuid.UUID
+	OfficialName     string
+	Minimum          uint
+	Target           uint
+	Quantity         uint
+	Reserved         uint
+}
+
+// DispensedQuantity is how much of a medicament a branch dispensed
+type DispensedQuantity struct {
+	PharmacyBranchID uuid.UUID
+	MedicamentID     uuid.UUID
+	Quantity         int64
+}
+
+// dispensableQuantity is the part of the stock of a pharmacy_branch_storages row in batches
+// that have not expired. It takes the day as its argument.
+const dispensableQuantity = "(SELECT COALESCE(SUM(stock_batches.quantity), 0) FROM stock_batches " +
+	"WHERE stock_batches.pharmacy_branch_id = pharmacy_branch_storages.pharmacy_branch_id " +
+	"AND stock_batches.medicament_id = pharmacy_branch_storages.medicament_id AND stock_batches.expires_on >= ?)"
+
+var stockMovementSortColumns = sortColumns{
+	"occurredAt": "occurred_at",
+	"type":       "type",
+	"delta":      "delta",
+}
+
+type inventoryRepo struct {
+	repo Repository
+}
+
+func NewInventoryRepo() InventoryRepo {
+	return &inventoryRepo{repo: SharedRepository()}
+}
+
+// RecordMovements applies the movements to the stock of their branches, all of them or none
+func (i *inventoryRepo) RecordMovements(movements []models.StockMovement) error {
+	return i.repo.Transaction(func(tx Repository) error {
+		for j := range movements {
+			if _, err := moveStock(tx, &movements[j]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TransferStock moves stock from one branch to another on behalf of their owner
+func (i *inventoryRepo) TransferStock(fromBranchId, toBranchId, medicamentId uuid.UUID, batchNumber string, quantity uint, pharmacyOwnerId uuid.UUID, reason string, at time.Time) error {
+	return i.repo.Transaction(func(tx Repository) error {
+		return transferStock(tx, fromBranchId, toBranchId, medicamentId, batchNumber, quantity,
+			models.StockActorPharmacyOwner, pharmacyOwnerId, reason, at)
+	})
+}
+
+func (i *inventoryRepo) FindMovements(filter *StockMovementFilter, spec *ListSpec, movements *[]models.StockMovement, total *int64) error {
+	order, err := stockMovementSortColumns.orderBy(spec.Sort, "occurred_at DESC")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("pharmacy_branch_id = ?", filter.PharmacyBranchID)
+		if filter.MedicamentID != nil {
+			db = db.Where("medicament_id = ?", *filter.MedicamentID)
+		}
+		if filter.Type != "" {
+			db = db.Where("type = ?", filter.Type)
+		}
+		if filter.From != nil {
+			db = db.Where("occurred_at >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			db = db.Where("occurred_at < ?", *filter.To)
+		}
+		return db
+	}
+
+	return findList(i.repo, &models.StockMovement{}, scope, order, spec, movements, total, "Medicament")
+}
+
+func (i *inventoryRepo) FindBranchStorage(pharmacyBranchId uuid.UUID, storage *[]models.PharmacyBranchStorage) error {
+	return i.repo.Preload("Medicament", withDeleted).
+		Find(storage, "pharmacy_branch_id = ?", pharmacyBranchId).Error
+}
+
+func (i *inventoryRepo) FindLedgerBalances(pharmacyBranchId uuid.UUID, balances *[]LedgerBalance) error {
+	return i.repo.Model(models.StockMovement{}).
+		Select("medicament_id, SUM(delta) AS quantity").
+		Where("pharmacy_branch_id = ?", pharmacyBranchId).
+		Group("medicament_id").
+		Scan(balances).Error
+}
+
+// FindExpiringBatches finds the stocked batches of the branch expiring on or before until,
+// expired ones included, the ones expiring first first
+func (i *inventoryRepo) FindExpiringBatches(pharmacyBranchId uuid.UUID, until time.Time, batches *[]models.StockBatch) error {
+	return i.repo.Preload("Medicament", withDeleted).
+		Where("pharmacy_branch_id = ? AND quantity > 0 AND expires_on <= ?", pharmacyBranchId, until.Format(time.DateOnly)).
+		Order("expires_on, batch_number").
+		Find(batches).Error
+}
+
+// SetStockLevel creates the stock level of the medicament at the branch or replaces it
+func (i *inventoryRepo) SetStockLevel(level *models.StockLevel) error {
+	return i.repo.Save(level).Error
+}
+
+func (i *inventoryRepo) DeleteStockLevel(pharmacyBranchId, medicamentId uuid.UUID) error {
+	result := i.repo.Where("pharmacy_branch_id = ? AND medicament_id = ?", pharmacyBranchId, medicamentId).
+		Delete(&models.StockLevel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// FindStockLevels finds the stock levels of the branches with the stock they hold in batches
+// not expired at the time. With belowMinimum only the medicaments whose stock not held for
+// reservations is below the minimum are found.
+func (i *inventoryRepo) FindStockLevels(pharmacyBranchIds []uuid.UUID, belowMinimum bool, at time.Time, levels *[]StockLevelStatus) error {
+	if len(pharmacyBranchIds) == 0 {
+		*levels = []StockLevelStatus{}
+		return nil
+	}
+
+	day := at.Format(time.DateOnly)
+	query := i.repo.Model(&models.StockLevel{}).
+		Select("stock_levels.pharmacy_branch_id, stock_levels.medicament_id, medicaments.official_name, "+
+			"stock_levels.minimum, stock_levels.target, "+
+			"COALESCE("+dispensableQuantity+", 0) AS quantity, COALESCE(pharmacy_branch_storages.reserved, 0) AS reserved", day).
+		Joins("INNER JOIN medicaments ON medicaments.id = stock_levels.medicament_id").
+		Joins("LEFT JOIN pharmacy_branch_storages ON pharmacy_branch_storages.pharmacy_branch_id = stock_levels.pharmacy_branch_id "+
+			"AND pharmacy_branch_storages.medicament_id = stock_levels.medicament_id").
+		Where("stock_levels.pharmacy_branch_id IN ?", pharmacyBranchIds)
+
+	if belowMinimum {
+		query = query.Where("COALESCE("+dispensableQuantity+", 0) < COALESCE(pharmacy_branch_storages.reserved, 0) + stock_levels.minimum", day)
+	}
+
+	return query.Order("stock_levels.pharmacy_branch_id, medicaments.official_name").
+		Scan(levels).Error
+}
+
+// FindDispensedQuantities sums up what the branches dispensed of each medicament since
+func (i *inventoryRepo) FindDispensedQuantities(pharmacyBranchIds []uuid.UUID, since time.Time, dispensed *[]DispensedQuantity) error {
+	if len(pharmacyBranchIds) == 0 {
+		*dispensed = []DispensedQuantity{}
+		return nil
+	}
+
+	return i.repo.Model(&models.StockMovement{}).
+		Select("pharmacy_branch_id, medicament_id, -SUM(delta) AS quantity").
+		Where("pharmacy_branch_id IN ? AND type = ? AND occurred_at >= ?", pharmacyBranchIds, common.StockDispense, since).
+		Group("pharmacy_branch_id, medicament_id").
+		Scan(dispensed).Error
+}
+
+// moveStock changes the stock of a medicament at a branch by the delta of the movement and
+// appends the movement to the ledger. Stock is added to the batch of the movement. Stock is
+// taken from the batch of the movement or, without one, from the unexpired batches expiring
+// first, with one movement per batch. Stock held for reservations cannot be taken. Returns
+// the movements recorded.
+func moveStock(tx Repository, movement *models.StockMovement) ([]models.StockMovement, error) {
+	storage := models.PharmacyBranchStorage{}
+	err := tx.Where("pharmacy_branch_id = ? AND medicament_id = ?", movement.PharmacyBranchID, movement.MedicamentID).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Take(&storage).Error
+	stocked := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	quantity := int64(storage.Quantity) + movement.Delta
+	if quantity < int64(storage.Reserved) {
+		return nil, ErrInsufficientStock
+	}
+
+	var movements []models.StockMovement
+	if movement.Delta > 0 {
+		err = addToBatch(tx, movement)
+		movements = []models.StockMovement{*movement}
+	} else {
+		movements, err = takeFromBatches(tx, movement)
+		if err == nil {
+			err = keepReservedDispensable(tx, movement, movements, storage.Reserved)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stocked {
+		err = tx.Model(&models.PharmacyBranchStorage{}).
+			Where("pharmacy_branch_id = ? AND medicament_id = ?", movement.PharmacyBranchID, movement.MedicamentID).
+			Update("quantity", quantity).Error
+	} else {
+		err = tx.Create(&models.PharmacyBranchStorage{
+			PharmacyBranchID: movement.PharmacyBranchID,
+			MedicamentID:     movement.MedicamentID,
+			Quantity:         uint(quantity),
+		}).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	after := int64(storage.Quantity)
+	for i := range movements {
+		after += movements[i].Delta
+		movements[i].QuantityAfter = uint(after)
+
+		if err := tx.Create(&movements[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return movements, nil
+}
+
+func addToBatch(tx Repository, movement *models.StockMovement) error {
+	if movement.BatchNumber == "" {
+		return ErrBatchRequired
+	}
+
+	batch := models.StockBatch{}
+	err := tx.Where("pharmacy_branch_id = ? AND medicament_id = ? AND batch_number = ?",
+		movement.PharmacyBranchID, movement.MedicamentID, movement.BatchNumber).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Take(&batch).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if movement.ExpiresOn == nil {
+			return ErrBatchExpiryRequired
+		}
+
+		return tx.Create(&models.StockBatch{
+			PharmacyBranchID: movement.PharmacyBranchID,
+			MedicamentID:     movement.MedicamentID,
+			BatchNumber:      movement.BatchNumber,
+			ExpiresOn:        *movement.ExpiresOn,
+			Quantity:         uint(movement.Delta),
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+
+	if movement.ExpiresOn != nil && movement.ExpiresOn.Format(time.DateOnly) != batch.ExpiresOn.Format(time.DateOnly) {
+		return ErrBatchExpiryMismatch
+	}
+	movement.ExpiresOn = &batch.ExpiresOn
+
+	return tx.Model(&models.StockBatch{}).
+		Where("pharmacy_branch_id = ? AND medicament_id = ? AND batch_number = ?",
+			batch.PharmacyBranchID, batch.MedicamentID, batch.BatchNumber).
+		Update("quantity", gorm.Expr("quantity + ?", movement.Delta)).Error
+}
+
+// keepReservedDispensable refuses a take of unexpired stock that leaves less unexpired stock
+// than is reserved. Taking expired batches is always allowed.
+func keepReservedDispensable(tx Repository, movement *models.StockMovement, taken []models.StockMovement, reserved uint) error {
+	day := movement.OccurredAt.Format(time.DateOnly)
+
+	unexpired := false
+	for _, part := range taken {
+		if part.ExpiresOn.Format(time.DateOnly) >= day {
+			unexpired = true
+		}
+	}
+	if !unexpired || reserved == 0 {
+		return nil
+	}
+
+	var dispensable int64
+	if err := tx.Model(&models.StockBatch{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("pharmacy_branch_id = ? AND medicament_id = ? AND expires_on >= ?", movement.PharmacyBranchID, movement.MedicamentID, day).
+		Scan(&dispensable).Error; err != nil {
+		return err
+	}
+	if dispensable < int64(reserved) {
+		return ErrInsufficientStock
+	}
+
+	return nil
+}
+
+// takeFromBatches splits the movement into one movement per batch it takes from. Batches that
+// run out are removed.
+func takeFromBatches(tx Repository, movement *models.StockMovement) ([]models.StockMovement, error) {
+	query := tx.Where("pharmacy_branch_id = ? AND medicament_id = ? AND quantity > 0", movement.PharmacyBranchID, movement.MedicamentID)
+	if movement.BatchNumber != "" {
+		query = query.Where("batch_number = ?", movement.BatchNumber)
+	} else {
+		// expired stock only leaves by naming its batch
+		query = query.Where("expires_on >= ?", movement.OccurredAt.Format(time.DateOnly))
+	}
+
+	batches := new([]models.StockBatch)
+	if err := query.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Order("expires_on, batch_number").
+		Find(batches).Error; err != nil {
+		return nil, err
+	}
+
+	var movements []models.StockMovement
+	remaining := uint(-movement.Delta)
+	for _, batch := range *batches {
+		if remaining == 0 {
+			break
+		}
+		taken := min(remaining, batch.Quantity)
+
+		batchScope := tx.Where("pharmacy_branch_id = ? AND medicament_id = ? AND batch_number = ?",
+			batch.PharmacyBranchID, batch.MedicamentID, batch.BatchNumber)
+
+		var err error
+		if taken == batch.Quantity {
+			err = batchScope.Delete(&models.StockBatch{}).Error
+		} else {
+			err = batchScope.Model(&models.StockBatch{}).Update("quantity", batch.Quantity-taken).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		part := *movement
+		if len(movements) > 0 {
+			part.ID = uuid.New()
+		}
+		expiresOn := batch.ExpiresOn
+		part.Delta = -int64(taken)
+		part.BatchNumber = batch.BatchNumber
+		part.ExpiresOn = &expiresOn
+
+		movements = append(movements, part)
+		remaining -= taken
+	}
+
+	if remaining > 0 {
+		return nil, ErrInsufficientStock
+	}
+
+	return movements, nil
+}
+
+// transferStock moves stock of a medicament between branches, from the given batch or from the
+// batches expiring first, keeping the batches. Both sides reference the transfer by one id.
+func transferStock(tx Repository, fromBranchId, toBranchId, medicamentId uuid.UUID, batchNumber string, quantity uint, role models.StockActorRole, actorId uuid.UUID, reason string, at time.Time) error {
+	transferId := uuid.New().String()
+
+	taken, err := moveStock(tx, &models.StockMovement{
+		ID:               uuid.New(),
+		PharmacyBranchID: fromBranchId,
+		MedicamentID:     medicamentId,
+		Type:             common.StockTransfer,
+		Delta:            -int64(quantity),
+		BatchNumber:      batchNumber,
+		ActorRole:        role,
+		ActorID:          actorId,
+		Reason:           reason,
+		Reference:        transferId,
+		OccurredAt:       at,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, part := range taken {
+		received := part
+		received.ID = uuid.New()
+		received.PharmacyBranchID = toBranchId
+		received.Delta = -part.Delta
+
+		if _, err := moveStock(tx, &received); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"gorm.io/gorm"
+	"strings"
+)
+
+// ListSpec selects a page of a list and the order of its rows. Page starts at 1. Sort keys use
+// the field names of the API, every list maps the fields it can be sorted by to its columns.
+type ListSpec struct {
+	Page int
+	Size int
+	Sort []SortKey
+}
+
+type SortKey struct {
+	Field      string
+	Descending bool
+}
+
+type sortColumns map[string]string
+
+// orderBy builds the ORDER BY clause of keys. The id goes last so that rows with equal sort
+// values keep their place between pages.
+func (c sortColumns) orderBy(keys []SortKey, defaults string) (string, error) {
+	if len(keys) == 0 {
+		return defaults + ", id", nil
+	}
+
+	clauses := make([]string, 0, len(keys)+1)
+
+	for _, key := range keys {
+		column, ok := c[key.Field]
+		if !ok {
+			return "", ErrSortFieldUnknown
+		}
+
+		if key.Descending {
+			column += " DESC"
+		}
+		clauses = append(clauses, column)
+	}
+
+	return strings.Join(append(clauses, "id"), ", "), nil
+}
+
+// findList counts the rows the filter selects and loads one page of them
+func findList(r Repository, model interface{}, filter func(*gorm.DB) *gorm.DB, order string, spec *ListSpec, out interface{}, total *int64, preloads ...string) error {
+	if err := r.Model(model).Scopes(filter).Count(total).Error; err != nil {
+		return err
+	}
+
+	query := r.Scopes(filter)
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+
+	return query.Order(order).Offset((spec.Page - 1) * spec.Size).Limit(spec.Size).Find(out).Error
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern with the escape character that the
+// ESCAPE '!' clause names. The backslash MySQL uses by default depends on the SQL mode.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// likePrefix is a LIKE pattern matching the values that start with value
+func likePrefix(value string) string {
+	return likeEscaper.Replace(value) + "%"
+}
+
+// likeContains is a LIKE pattern matching the values that contain value
+func likeContains(value string) string {
+	return "%" + likeEscaper.Replace(value) + "%"
+}
+
+// whereName matches part of a person's full name
+func whereName(db *gorm.DB, name string) *gorm.DB {
+	return db.Where("CONCAT_WS(' ', first_name, second_name, last_name) LIKE ? ESCAPE '!'", likeContains(name))
+}
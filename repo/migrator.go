@@ -1,7 +1,6 @@
 package repo
 
 import (
-	"medico/config"
 	"medico/models"
 )
 
@@ -14,8 +13,7 @@ type migratorRepo struct {
 }
 
 func NewMigratorRepo() MigratorRepo {
-	databaseConfig := config.LoadDatabaseConfig()
-	return migratorRepo{repo: CreateNewRepository(databaseConfig)}
+	return migratorRepo{repo: SharedRepository()}
 }
 
 func (m migratorRepo) MigrateAll() error {
@@ -31,6 +29,9 @@ func (m migratorRepo) MigrateAll() error {
 	if err := m.repo.DropTableIfExists(models.Medicament{}); err != nil {
 		return err
 	}
+	if err := m.repo.DropTableIfExists("medicament_specialty_restrictions"); err != nil {
+		return err
+	}
 
 	if err := m.repo.DropTableIfExists(models.PharmacyOwnerAuth{}); err != nil {
 		return err
@@ -53,6 +54,27 @@ func (m migratorRepo) MigrateAll() error {
 	if err := m.repo.DropTableIfExists(models.PharmacyBranchStorage{}); err != nil {
 		return err
 	}
+	if err := m.repo.DropTableIfExists(models.PharmacyBranchOpeningHours{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.PharmacyBranchHoliday{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.StockMovement{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.StockBatch{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.StockLevel{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.PharmacyRegistration{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.PharmacyRegistrationReview{}); err != nil {
+		return err
+	}
 
 	if err := m.repo.DropTableIfExists(models.Hospital{}); err != nil {
 		return err
@@ -63,6 +85,18 @@ func (m migratorRepo) MigrateAll() error {
 	if err := m.repo.DropTableIfExists(models.DoctorAuth{}); err != nil {
 		return err
 	}
+	if err := m.repo.DropTableIfExists(models.PhysicianRegistryEntry{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.DoctorAffiliation{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.Specialty{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists("doctor_specialties"); err != nil {
+		return err
+	}
 
 	if err := m.repo.DropTableIfExists(models.Citizen{}); err != nil {
 		return err
@@ -80,6 +114,25 @@ func (m migratorRepo) MigrateAll() error {
 	if err := m.repo.DropTableIfExists(models.PrescriptionMedicament{}); err != nil {
 		return err
 	}
+	if err := m.repo.DropTableIfExists(models.PrescriptionFulfillment{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.StockReservation{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.StockReservationLine{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.DoctorSigningKey{}); err != nil {
+		return err
+	}
+
+	if err := m.repo.DropTableIfExists(models.EntityChange{}); err != nil {
+		return err
+	}
+	if err := m.repo.DropTableIfExists(models.EntityChangeField{}); err != nil {
+		return err
+	}
 	/*
 		if err := m.repo.DropTableIfExists(models.ModeratorAuth{}); err != nil {
 			return err
@@ -92,6 +145,9 @@ func (m migratorRepo) MigrateAll() error {
 			return err
 		}
 	*/
+	if err := m.repo.AutoMigrate(models.Specialty{}); err != nil {
+		return err
+	}
 	if err := m.repo.AutoMigrate(models.AuthorizationHolder{}); err != nil {
 		return err
 	}
@@ -126,6 +182,27 @@ func (m migratorRepo) MigrateAll() error {
 	if err := m.repo.AutoMigrate(models.PharmacyBranchStorage{}); err != nil {
 		return err
 	}
+	if err := m.repo.AutoMigrate(models.PharmacyBranchOpeningHours{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.PharmacyBranchHoliday{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.StockMovement{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.StockBatch{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.StockLevel{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.PharmacyRegistration{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.PharmacyRegistrationReview{}); err != nil {
+		return err
+	}
 
 	if err := m.repo.AutoMigrate(models.Hospital{}); err != nil {
 		return err
@@ -136,6 +213,15 @@ func (m migratorRepo) MigrateAll() error {
 	if err := m.repo.AutoMigrate(models.DoctorAuth{}); err != nil {
 		return err
 	}
+	if err := m.repo.AutoMigrate(models.PhysicianRegistryEntry{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.DoctorAffiliation{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.DoctorSigningKey{}); err != nil {
+		return err
+	}
 
 	if err := m.repo.AutoMigrate(models.Citizen{}); err != nil {
 		return err
@@ -153,6 +239,40 @@ func (m migratorRepo) MigrateAll() error {
 	if err := m.repo.AutoMigrate(models.PrescriptionMedicament{}); err != nil {
 		return err
 	}
+	if err := m.repo.AutoMigrate(models.PrescriptionFulfillment{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.StockReservation{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.StockReservationLine{}); err != nil {
+		return err
+	}
+
+	if err := m.repo.AutoMigrate(models.EntityChange{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.EntityChangeField{}); err != nil {
+		return err
+	}
+	// moderators are kept across migrations, migrating the tables only adds new columns
+	if err := m.repo.AutoMigrate(models.ModeratorAuth{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.Moderator{}); err != nil {
+		return err
+	}
+
+	// the audit log is never dropped, the chain starts from an empty head
+	if err := m.repo.AutoMigrate(models.AuditEntry{}); err != nil {
+		return err
+	}
+	if err := m.repo.AutoMigrate(models.AuditChainHead{}); err != nil {
+		return err
+	}
+	if err := m.repo.Where("id = ?", auditChainHeadId).FirstOrCreate(&models.AuditChainHead{ID: auditChainHeadId}).Error; err != nil {
+		return err
+	}
 	/*
 		if err := m.repo.AutoMigrate(models.ModeratorAuth{}); err != nil {
 			return err
@@ -4,8 +4,8 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"medico/common"
-	"medico/config"
 	"medico/models"
+	"time"
 )
 
 type ModeratorRepo interface {
@@ -13,29 +13,73 @@ type ModeratorRepo interface {
 }
 
 type moderatorRepo struct {
-	db *gorm.DB
+	repo Repository
 }
 
 func NewModeratorRepo() ModeratorRepo {
-	connection, err := createConnection(config.LoadDatabaseConfig())
-	if err != nil {
-		panic(err)
-	}
-	return &moderatorRepo{db: connection}
+	return &moderatorRepo{repo: SharedRepository()}
 }
 
 func (m moderatorRepo) FindAuthByEmail(email string, moderator *models.ModeratorAuth) error {
-	return m.db.Preload("Moderator").Find(&moderator, "email = ?", email).Error
+	return m.repo.Preload("Moderator").Find(&moderator, "email = ?", email).Error
 }
 
 // DOCTOR
 
+type DoctorListFilter struct {
+	Name               string
+	UIN                string
+	Email              string
+	SpecialtyCode      string
+	PrescribingBlocked *bool
+	// Deleted lists the soft-deleted doctors instead of the current ones
+	Deleted bool
+}
+
+var doctorSortColumns = sortColumns{
+	"firstName": "first_name",
+	"lastName":  "last_name",
+	"uin":       "uin",
+	"email":     "email",
+}
+
 type DoctorModeratorRepo interface {
 	FindById(id uuid.UUID, moderator *models.Moderator) error
 
 	CreateDoctor(doctorAuth *models.DoctorAuth) error
-	DeleteDoctor(doctorId uuid.UUID) error
-	FindAllDoctors(doctors *[]models.Doctor) error
+	DeleteDoctor(doctorId uuid.UUID, audit *models.AuditEntry) error
+	RestoreDoctor(doctorId uuid.UUID, audit *models.AuditEntry) error
+	FindAllDoctors(filter *DoctorListFilter, spec *ListSpec, doctors *[]models.Doctor, total *int64) error
+	FindDoctorById(doctorId uuid.UUID, doctor *models.Doctor) error
+	UpdateDoctor(doctorId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error
+	FindDoctorChanges(doctorId uuid.UUID, changes *[]models.EntityChange) error
+
+	ReplacePhysicianRegistry(entries *[]models.PhysicianRegistryEntry, audit *models.AuditEntry) error
+	FindPhysicianRegistryEntry(uin string, entry *models.PhysicianRegistryEntry) error
+	CountPhysicianRegistryEntries(count *int64) error
+	RecheckDoctorLicences(checkedAt time.Time, audit *models.AuditEntry) error
+
+	CreateHospital(hospital *models.Hospital, audit *models.AuditEntry) error
+	UpdateHospital(hospital *models.Hospital, audit *models.AuditEntry) error
+	DeleteHospital(hospitalId uuid.UUID, audit *models.AuditEntry) error
+	FindAllHospitals(hospitals *[]models.Hospital) error
+
+	CreateAffiliation(affiliation *models.DoctorAffiliation, audit *models.AuditEntry) error
+	FindAffiliationById(affiliationId uuid.UUID, affiliation *models.DoctorAffiliation) error
+	EndAffiliation(affiliationId uuid.UUID, endDate time.Time, audit *models.AuditEntry) error
+	DeleteAffiliation(affiliationId uuid.UUID, audit *models.AuditEntry) error
+	FindAffiliationsByDoctorId(doctorId uuid.UUID, affiliations *[]models.DoctorAffiliation) error
+
+	CreateSpecialty(specialty *models.Specialty, audit *models.AuditEntry) error
+	DeleteSpecialty(specialtyId uuid.UUID, audit *models.AuditEntry) error
+	FindAllSpecialties(specialties *[]models.Specialty) error
+	AddDoctorSpecialty(doctorId, specialtyId uuid.UUID, audit *models.AuditEntry) error
+	RemoveDoctorSpecialty(doctorId, specialtyId uuid.UUID, audit *models.AuditEntry) error
+
+	CreateSigningKey(key *models.DoctorSigningKey) error
+	RotateSigningKey(key *models.DoctorSigningKey, audit *models.AuditEntry) error
+	RevokeSigningKey(keyId uuid.UUID, reason string, audit *models.AuditEntry) error
+	FindSigningKeysByDoctorId(doctorId uuid.UUID, keys *[]models.DoctorSigningKey) error
 }
 
 type doctorModeratorRepo struct {
@@ -43,9 +87,8 @@ type doctorModeratorRepo struct {
 }
 
 func NewDoctorModeratorRepo() DoctorModeratorRepo {
-	databaseConfig := config.LoadDatabaseConfig()
 	return &doctorModeratorRepo{
-		repo: CreateNewRepository(databaseConfig),
+		repo: SharedRepository(),
 	}
 }
 
@@ -56,23 +99,235 @@ func (m *doctorModeratorRepo) FindById(id uuid.UUID, moderator *models.Moderator
 func (m *doctorModeratorRepo) CreateDoctor(doctorAuth *models.DoctorAuth) error {
 	return m.repo.Create(doctorAuth).Error
 }
-func (m *doctorModeratorRepo) DeleteDoctor(doctorId uuid.UUID) error {
-	return m.repo.Where("id = ?", doctorId.String()).Delete(models.DoctorAuth{}).Error
+func (m *doctorModeratorRepo) DeleteDoctor(doctorId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return softDelete(tx, doctorId, &models.DoctorAuth{}, &models.Doctor{})
+	})
+}
+func (m *doctorModeratorRepo) RestoreDoctor(doctorId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return restore(tx, doctorId, &models.DoctorAuth{}, &models.Doctor{})
+	})
+}
+func (m *doctorModeratorRepo) FindAllDoctors(filter *DoctorListFilter, spec *ListSpec, doctors *[]models.Doctor, total *int64) error {
+	order, err := doctorSortColumns.orderBy(spec.Sort, "last_name, first_name")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.Deleted {
+			db = onlyDeleted(db)
+		}
+		if filter.Name != "" {
+			db = whereName(db, filter.Name)
+		}
+		if filter.UIN != "" {
+			db = db.Where("uin LIKE ? ESCAPE '!'", likePrefix(filter.UIN))
+		}
+		if filter.Email != "" {
+			db = db.Where("email LIKE ? ESCAPE '!'", likeContains(filter.Email))
+		}
+		if filter.SpecialtyCode != "" {
+			db = db.Where("id IN (SELECT doctor_specialties.doctor_id FROM doctor_specialties "+
+				"JOIN specialties ON specialties.id = doctor_specialties.specialty_id WHERE specialties.code = ?)", filter.SpecialtyCode)
+		}
+		if filter.PrescribingBlocked != nil {
+			db = db.Where("prescribing_blocked = ?", *filter.PrescribingBlocked)
+		}
+		return db
+	}
+
+	return findList(m.repo, &models.Doctor{}, scope, order, spec, doctors, total, "Specialties")
+}
+
+func (m *doctorModeratorRepo) FindDoctorById(doctorId uuid.UUID, doctor *models.Doctor) error {
+	return m.repo.First(doctor, "id = ?", doctorId).Error
+}
+
+// UpdateDoctor also changes the login email when the doctor's email changes
+func (m *doctorModeratorRepo) UpdateDoctor(doctorId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		if err := updateVersioned(tx, &models.Doctor{}, doctorId, version, updates, change); err != nil {
+			return err
+		}
+
+		if email, ok := updates["email"]; ok {
+			return tx.Model(&models.DoctorAuth{}).Where("id = ?", doctorId).Update("email", email).Error
+		}
+
+		return nil
+	})
+}
+
+func (m *doctorModeratorRepo) FindDoctorChanges(doctorId uuid.UUID, changes *[]models.EntityChange) error {
+	return findChanges(m.repo, models.ChangedDoctor, doctorId, changes)
+}
+
+func (m *doctorModeratorRepo) ReplacePhysicianRegistry(entries *[]models.PhysicianRegistryEntry, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		if err := tx.Where("1 = 1").Delete(&models.PhysicianRegistryEntry{}).Error; err != nil {
+			return err
+		}
+
+		if len(*entries) == 0 {
+			return nil
+		}
+
+		return tx.Model(&models.PhysicianRegistryEntry{}).CreateInBatches(entries, 500).Error
+	})
+}
+
+func (m *doctorModeratorRepo) FindPhysicianRegistryEntry(uin string, entry *models.PhysicianRegistryEntry) error {
+	return m.repo.First(entry, "uin = ?", uin).Error
 }
-func (m *doctorModeratorRepo) FindAllDoctors(doctors *[]models.Doctor) error {
-	return m.repo.Find(doctors).Error
+
+func (m *doctorModeratorRepo) CountPhysicianRegistryEntries(count *int64) error {
+	return m.repo.Model(&models.PhysicianRegistryEntry{}).Count(count).Error
+}
+
+func (m *doctorModeratorRepo) RecheckDoctorLicences(checkedAt time.Time, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Model(&models.Doctor{}).
+			Where("1 = 1").
+			Updates(map[string]interface{}{
+				"prescribing_blocked": gorm.Expr("NOT EXISTS (?)", tx.
+					Model(&models.PhysicianRegistryEntry{}).
+					Select("1").
+					Where("physician_registry_entries.uin = doctors.uin AND physician_registry_entries.status = ?", models.LicenceActive)),
+				"licence_checked_at": checkedAt,
+			}).Error
+	})
+}
+
+func (m *doctorModeratorRepo) CreateHospital(hospital *models.Hospital, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Create(hospital).Error
+	})
+}
+
+func (m *doctorModeratorRepo) UpdateHospital(hospital *models.Hospital, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Model(hospital).
+			Select("type", "name", "address", "city", "phone_number").
+			Updates(hospital).Error
+	})
+}
+
+func (m *doctorModeratorRepo) DeleteHospital(hospitalId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Where("id = ?", hospitalId.String()).Delete(models.Hospital{}).Error
+	})
+}
+
+func (m *doctorModeratorRepo) FindAllHospitals(hospitals *[]models.Hospital) error {
+	return m.repo.Find(hospitals).Error
+}
+
+func (m *doctorModeratorRepo) CreateAffiliation(affiliation *models.DoctorAffiliation, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Create(affiliation).Error
+	})
+}
+
+func (m *doctorModeratorRepo) FindAffiliationById(affiliationId uuid.UUID, affiliation *models.DoctorAffiliation) error {
+	return m.repo.First(affiliation, "id = ?", affiliationId).Error
+}
+
+func (m *doctorModeratorRepo) EndAffiliation(affiliationId uuid.UUID, endDate time.Time, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Model(&models.DoctorAffiliation{}).
+			Where("id = ?", affiliationId).
+			Update("end_date", endDate).Error
+	})
+}
+
+func (m *doctorModeratorRepo) DeleteAffiliation(affiliationId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Where("id = ?", affiliationId.String()).Delete(models.DoctorAffiliation{}).Error
+	})
+}
+
+func (m *doctorModeratorRepo) FindAffiliationsByDoctorId(doctorId uuid.UUID, affiliations *[]models.DoctorAffiliation) error {
+	return m.repo.Preload("Hospital").Find(affiliations, "doctor_id = ?", doctorId).Error
+}
+
+func (m *doctorModeratorRepo) CreateSpecialty(specialty *models.Specialty, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Create(specialty).Error
+	})
+}
+
+func (m *doctorModeratorRepo) DeleteSpecialty(specialtyId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Where("id = ?", specialtyId.String()).Delete(models.Specialty{}).Error
+	})
+}
+
+func (m *doctorModeratorRepo) FindAllSpecialties(specialties *[]models.Specialty) error {
+	return m.repo.Find(specialties).Error
+}
+
+func (m *doctorModeratorRepo) AddDoctorSpecialty(doctorId, specialtyId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		specialty := models.Specialty{}
+		if err := tx.First(&specialty, "id = ?", specialtyId).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Doctor{ID: doctorId}).
+			Association("Specialties").
+			Append(&specialty)
+	})
+}
+
+func (m *doctorModeratorRepo) RemoveDoctorSpecialty(doctorId, specialtyId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Model(&models.Doctor{ID: doctorId}).
+			Association("Specialties").
+			Delete(&models.Specialty{ID: specialtyId})
+	})
 }
 
 // PHARMA
 
+type PharmacyListFilter struct {
+	Name      string
+	OwnerName string
+	Deleted   bool
+}
+
+var pharmacySortColumns = sortColumns{
+	"name": "name",
+}
+
+type RegistrationListFilter struct {
+	Status      models.RegistrationStatus
+	CompanyName string
+}
+
+var registrationSortColumns = sortColumns{
+	"companyName": "company_name",
+	"submittedAt": "submitted_at",
+}
+
 type PharmaModeratorRepo interface {
 	FindById(id uuid.UUID, moderator *models.Moderator) error
 
 	CreatePharmacyOwner(owner *models.PharmacyOwnerAuth) error
 	CreatePharmacy(pharmacy *models.PharmacyBrand) error
 	DeletePharmacyOwner(pharmacyOwnerId uuid.UUID) error
-	DeletePharmacy(pharmacyId uuid.UUID) error
-	FindAllPharmacies(pharmacies *[]models.PharmacyBrand) error
+	DeletePharmacy(pharmacyId uuid.UUID, audit *models.AuditEntry) error
+	RestorePharmacy(pharmacyId uuid.UUID, audit *models.AuditEntry) error
+	FindAllPharmacies(filter *PharmacyListFilter, spec *ListSpec, pharmacies *[]models.PharmacyBrand, total *int64) error
+	FindPharmacyById(pharmacyId uuid.UUID, pharmacy *models.PharmacyBrand) error
+	UpdatePharmacy(pharmacyId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error
+	FindPharmacyChanges(pharmacyId uuid.UUID, changes *[]models.EntityChange) error
+
+	FindAllRegistrations(filter *RegistrationListFilter, spec *ListSpec, registrations *[]models.PharmacyRegistration, total *int64) error
+	FindRegistrationById(registrationId uuid.UUID, registration *models.PharmacyRegistration) error
+	ReviewRegistration(review *models.PharmacyRegistrationReview, status models.RegistrationStatus, audit *models.AuditEntry) error
+	ApproveRegistration(review *models.PharmacyRegistrationReview, owner *models.PharmacyOwnerAuth, pharmacy *models.PharmacyBrand, audit *models.AuditEntry) error
 }
 
 type pharmaModeratorRepo struct {
@@ -80,9 +335,8 @@ type pharmaModeratorRepo struct {
 }
 
 func NewPharmaModeratorRepo() PharmaModeratorRepo {
-	databaseConfig := config.LoadDatabaseConfig()
 	return &pharmaModeratorRepo{
-		repo: CreateNewRepository(databaseConfig),
+		repo: SharedRepository(),
 	}
 }
 
@@ -99,21 +353,134 @@ func (m *pharmaModeratorRepo) CreatePharmacy(pharmacy *models.PharmacyBrand) err
 func (m *pharmaModeratorRepo) DeletePharmacyOwner(pharmacyOwnerId uuid.UUID) error {
 	return m.repo.Where("id = ?", pharmacyOwnerId.String()).Delete(models.PharmacyOwner{}).Error
 }
-func (m *pharmaModeratorRepo) DeletePharmacy(pharmacyId uuid.UUID) error {
-	return m.repo.Where("id = ?", pharmacyId.String()).Delete(models.PharmacyBrand{}).Error
+func (m *pharmaModeratorRepo) DeletePharmacy(pharmacyId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return softDelete(tx, pharmacyId, &models.PharmacyBrand{})
+	})
 }
-func (m *pharmaModeratorRepo) FindAllPharmacies(pharmacies *[]models.PharmacyBrand) error {
-	return m.repo.Preload("Owner").Find(pharmacies).Error
+func (m *pharmaModeratorRepo) RestorePharmacy(pharmacyId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return restore(tx, pharmacyId, &models.PharmacyBrand{})
+	})
+}
+func (m *pharmaModeratorRepo) FindAllPharmacies(filter *PharmacyListFilter, spec *ListSpec, pharmacies *[]models.PharmacyBrand, total *int64) error {
+	order, err := pharmacySortColumns.orderBy(spec.Sort, "name")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.Deleted {
+			db = onlyDeleted(db)
+		}
+		if filter.Name != "" {
+			db = db.Where("name LIKE ? ESCAPE '!'", likeContains(filter.Name))
+		}
+		if filter.OwnerName != "" {
+			db = db.Where("owner_id IN (SELECT id FROM pharmacy_owners WHERE name LIKE ? ESCAPE '!')", likeContains(filter.OwnerName))
+		}
+		return db
+	}
+
+	return findList(m.repo, &models.PharmacyBrand{}, scope, order, spec, pharmacies, total, "Owner")
+}
+
+func (m *pharmaModeratorRepo) FindPharmacyById(pharmacyId uuid.UUID, pharmacy *models.PharmacyBrand) error {
+	return m.repo.First(pharmacy, "id = ?", pharmacyId).Error
+}
+
+func (m *pharmaModeratorRepo) UpdatePharmacy(pharmacyId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return updateVersioned(tx, &models.PharmacyBrand{}, pharmacyId, version, updates, change)
+	})
+}
+
+func (m *pharmaModeratorRepo) FindPharmacyChanges(pharmacyId uuid.UUID, changes *[]models.EntityChange) error {
+	return findChanges(m.repo, models.ChangedPharmacy, pharmacyId, changes)
+}
+
+func (m *pharmaModeratorRepo) FindAllRegistrations(filter *RegistrationListFilter, spec *ListSpec, registrations *[]models.PharmacyRegistration, total *int64) error {
+	order, err := registrationSortColumns.orderBy(spec.Sort, "submitted_at")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.Status != "" {
+			db = db.Where("status = ?", filter.Status)
+		}
+		if filter.CompanyName != "" {
+			db = db.Where("company_name LIKE ? ESCAPE '!'", likeContains(filter.CompanyName))
+		}
+		return db
+	}
+
+	return findList(m.repo, &models.PharmacyRegistration{}, scope, order, spec, registrations, total, "Reviews")
+}
+
+func (m *pharmaModeratorRepo) FindRegistrationById(registrationId uuid.UUID, registration *models.PharmacyRegistration) error {
+	return m.repo.Preload("Reviews", reviewsInOrder).First(registration, "id = ?", registrationId).Error
+}
+
+// ReviewRegistration rejects a registration or returns it to the applicant for changes
+func (m *pharmaModeratorRepo) ReviewRegistration(review *models.PharmacyRegistrationReview, status models.RegistrationStatus, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return decideRegistration(tx, review, status, nil)
+	})
+}
+
+// ApproveRegistration provisions the owner account and the pharmacy of a registration together
+// with its approval, so an approved registration always has both
+func (m *pharmaModeratorRepo) ApproveRegistration(review *models.PharmacyRegistrationReview, owner *models.PharmacyOwnerAuth, pharmacy *models.PharmacyBrand, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		if err := decideRegistration(tx, review, models.RegistrationApproved, &pharmacy.ID); err != nil {
+			return err
+		}
+
+		taken, err := ownerEmailTaken(tx, owner.Email, review.RegistrationID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrOwnerEmailTaken
+		}
+
+		if err := tx.Create(owner).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(pharmacy).Error
+	})
 }
 
 // MEDICAMENT
 
+type MedicamentListFilter struct {
+	Name string
+	ATC  string
+	// Restricted keeps only medicaments that are, or are not, restricted to some specialties
+	Restricted *bool
+	Deleted    bool
+}
+
+var medicamentSortColumns = sortColumns{
+	"officialName": "official_name",
+	"atc":          "atc",
+}
+
 type MedicamentModeratorRepo interface {
 	FindById(id uuid.UUID, moderator *models.Moderator) error
 
-	CreateMedicament(medicament *models.Medicament) error
-	DeleteMedicament(medicamentId uuid.UUID) error
-	FindAllMedicaments(medicaments *[]models.Medicament) error
+	CreateMedicament(medicament *models.Medicament, audit *models.AuditEntry) error
+	DeleteMedicament(medicamentId uuid.UUID, audit *models.AuditEntry) error
+	RestoreMedicament(medicamentId uuid.UUID, audit *models.AuditEntry) error
+	FindAllMedicaments(filter *MedicamentListFilter, spec *ListSpec, medicaments *[]models.Medicament, total *int64) error
+	FindMedicamentById(medicamentId uuid.UUID, medicament *models.Medicament) error
+	UpdateMedicament(medicamentId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error
+	FindMedicamentChanges(medicamentId uuid.UUID, changes *[]models.EntityChange) error
+
+	FindAllSpecialties(specialties *[]models.Specialty) error
+	ReplaceMedicamentRestrictions(medicamentId uuid.UUID, specialtyIds []uuid.UUID, audit *models.AuditEntry) error
 }
 
 type medicamentModeratorRepo struct {
@@ -121,9 +488,8 @@ type medicamentModeratorRepo struct {
 }
 
 func NewMedicamentModeratorRepo() MedicamentModeratorRepo {
-	databaseConfig := config.LoadDatabaseConfig()
 	return &medicamentModeratorRepo{
-		repo: CreateNewRepository(databaseConfig),
+		repo: SharedRepository(),
 	}
 }
 
@@ -131,24 +497,118 @@ func (m *medicamentModeratorRepo) FindById(id uuid.UUID, moderator *models.Moder
 	return m.repo.First(&moderator, "id = ? AND type = ?", id, common.MedicamentMod).Error
 }
 
-func (m *medicamentModeratorRepo) CreateMedicament(medicament *models.Medicament) error {
-	return m.repo.Create(medicament).Error
+func (m *medicamentModeratorRepo) CreateMedicament(medicament *models.Medicament, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return tx.Create(medicament).Error
+	})
+}
+func (m *medicamentModeratorRepo) DeleteMedicament(medicamentId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return softDelete(tx, medicamentId, &models.Medicament{})
+	})
+}
+func (m *medicamentModeratorRepo) RestoreMedicament(medicamentId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return restore(tx, medicamentId, &models.Medicament{})
+	})
+}
+func (m *medicamentModeratorRepo) FindAllMedicaments(filter *MedicamentListFilter, spec *ListSpec, medicaments *[]models.Medicament, total *int64) error {
+	order, err := medicamentSortColumns.orderBy(spec.Sort, "official_name")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.Deleted {
+			db = onlyDeleted(db)
+		}
+		if filter.Name != "" {
+			db = db.Where("official_name LIKE ? ESCAPE '!'", likeContains(filter.Name))
+		}
+		if filter.ATC != "" {
+			db = db.Where("atc LIKE ? ESCAPE '!'", likePrefix(filter.ATC))
+		}
+		if filter.Restricted != nil {
+			restricted := "id IN (SELECT medicament_id FROM medicament_specialty_restrictions)"
+			if !*filter.Restricted {
+				restricted = "id NOT IN (SELECT medicament_id FROM medicament_specialty_restrictions)"
+			}
+			db = db.Where(restricted)
+		}
+		return db
+	}
+
+	return findList(m.repo, &models.Medicament{}, scope, order, spec, medicaments, total, "RestrictedToSpecialties")
+}
+
+func (m *medicamentModeratorRepo) FindMedicamentById(medicamentId uuid.UUID, medicament *models.Medicament) error {
+	return m.repo.First(medicament, "id = ?", medicamentId).Error
 }
-func (m *medicamentModeratorRepo) DeleteMedicament(medicamentId uuid.UUID) error {
-	return m.repo.Where("id = ?", medicamentId.String()).Delete(models.Medicament{}).Error
+
+func (m *medicamentModeratorRepo) UpdateMedicament(medicamentId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return updateVersioned(tx, &models.Medicament{}, medicamentId, version, updates, change)
+	})
+}
+
+func (m *medicamentModeratorRepo) FindMedicamentChanges(medicamentId uuid.UUID, changes *[]models.EntityChange) error {
+	return findChanges(m.repo, models.ChangedMedicament, medicamentId, changes)
+}
+
+func (m *medicamentModeratorRepo) FindAllSpecialties(specialties *[]models.Specialty) error {
+	return m.repo.Find(specialties).Error
 }
-func (m *medicamentModeratorRepo) FindAllMedicaments(medicaments *[]models.Medicament) error {
-	return m.repo.Find(medicaments).Error
+
+func (m *medicamentModeratorRepo) ReplaceMedicamentRestrictions(medicamentId uuid.UUID, specialtyIds []uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		specialties := make([]models.Specialty, 0, len(specialtyIds))
+		if len(specialtyIds) > 0 {
+			if err := tx.Find(&specialties, "id IN ?", specialtyIds).Error; err != nil {
+				return err
+			}
+		}
+
+		// every specialty has to exist, repeated ids count once
+		unique := make(map[uuid.UUID]struct{}, len(specialtyIds))
+		for _, specialtyId := range specialtyIds {
+			unique[specialtyId] = struct{}{}
+		}
+		if len(specialties) != len(unique) {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Model(&models.Medicament{ID: medicamentId}).
+			Association("RestrictedToSpecialties").
+			Replace(specialties)
+	})
 }
 
 // CITIZEN
 
+type CitizenListFilter struct {
+	Name    string
+	UCN     string
+	Email   string
+	Deleted bool
+}
+
+var citizenSortColumns = sortColumns{
+	"firstName": "first_name",
+	"lastName":  "last_name",
+	"ucn":       "ucn",
+	"birthday":  "birthday",
+}
+
 type CitizenModeratorRepo interface {
 	FindById(id uuid.UUID, moderator *models.Moderator) error
 
 	CreateCitizen(citizenAuth *models.CitizenAuth) error
-	DeleteCitizen(citizenId uuid.UUID) error
-	FindAllCitizens(citizens *[]models.Citizen) error
+	DeleteCitizen(citizenId uuid.UUID, audit *models.AuditEntry) error
+	RestoreCitizen(citizenId uuid.UUID, audit *models.AuditEntry) error
+	FindAllCitizens(filter *CitizenListFilter, spec *ListSpec, citizens *[]models.Citizen, total *int64) error
+	FindCitizenById(citizenId uuid.UUID, citizen *models.Citizen) error
+	UpdateCitizen(citizenId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error
+	FindCitizenChanges(citizenId uuid.UUID, changes *[]models.EntityChange) error
 }
 
 type citizenModeratorRepo struct {
@@ -156,9 +616,8 @@ type citizenModeratorRepo struct {
 }
 
 func NewCitizenModeratorRepo() CitizenModeratorRepo {
-	databaseConfig := config.LoadDatabaseConfig()
 	return &citizenModeratorRepo{
-		repo: CreateNewRepository(databaseConfig),
+		repo: SharedRepository(),
 	}
 }
 
@@ -169,9 +628,105 @@ func (m *citizenModeratorRepo) FindById(id uuid.UUID, moderator *models.Moderato
 func (m *citizenModeratorRepo) CreateCitizen(citizenAuth *models.CitizenAuth) error {
 	return m.repo.Create(citizenAuth).Error
 }
-func (m *citizenModeratorRepo) DeleteCitizen(doctorId uuid.UUID) error {
-	return m.repo.Where("id = ?", doctorId.String()).Delete(models.CitizenAuth{}).Error
+func (m *citizenModeratorRepo) DeleteCitizen(citizenId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return softDelete(tx, citizenId, &models.CitizenAuth{}, &models.Citizen{})
+	})
+}
+func (m *citizenModeratorRepo) RestoreCitizen(citizenId uuid.UUID, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		return restore(tx, citizenId, &models.CitizenAuth{}, &models.Citizen{})
+	})
+}
+func (m *citizenModeratorRepo) FindAllCitizens(filter *CitizenListFilter, spec *ListSpec, citizens *[]models.Citizen, total *int64) error {
+	order, err := citizenSortColumns.orderBy(spec.Sort, "last_name, first_name")
+	if err != nil {
+		return err
+	}
+
+	scope := func(db *gorm.DB) *gorm.DB {
+		if filter.Deleted {
+			db = onlyDeleted(db)
+		}
+		if filter.Name != "" {
+			db = whereName(db, filter.Name)
+		}
+		if filter.UCN != "" {
+			db = db.Where("ucn LIKE ? ESCAPE '!'", likePrefix(filter.UCN))
+		}
+		if filter.Email != "" {
+			db = db.Where("email LIKE ? ESCAPE '!'", likeContains(filter.Email))
+		}
+		return db
+	}
+
+	return findList(m.repo, &models.Citizen{}, scope, order, spec, citizens, total)
 }
-func (m *citizenModeratorRepo) FindAllCitizens(citizens *[]models.Citizen) error {
-	return m.repo.Find(citizens).Error
+
+func (m *citizenModeratorRepo) FindCitizenById(citizenId uuid.UUID, citizen *models.Citizen) error {
+	return m.repo.First(citizen, "id = ?", citizenId).Error
+}
+
+// UpdateCitizen also changes the login email when the citizen's email changes
+func (m *citizenModeratorRepo) UpdateCitizen(citizenId uuid.UUID, version uint, updates map[string]interface{}, change *models.EntityChange, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		if err := updateVersioned(tx, &models.Citizen{}, citizenId, version, updates, change); err != nil {
+			return err
+		}
+
+		if email, ok := updates["email"]; ok {
+			return tx.Model(&models.CitizenAuth{}).Where("id = ?", citizenId).Update("email", email).Error
+		}
+
+		return nil
+	})
+}
+
+func (m *citizenModeratorRepo) FindCitizenChanges(citizenId uuid.UUID, changes *[]models.EntityChange) error {
+	return findChanges(m.repo, models.ChangedCitizen, citizenId, changes)
+}
+
+// RotateSigningKey retires the active key of the doctor and makes key the active one
+func (m *doctorModeratorRepo) CreateSigningKey(key *models.DoctorSigningKey) error {
+	return m.repo.Create(key).Error
+}
+
+func (m *doctorModeratorRepo) RotateSigningKey(key *models.DoctorSigningKey, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		if err := tx.Model(&models.DoctorSigningKey{}).
+			Where("doctor_id = ? AND status = ?", key.DoctorID, models.SigningKeyActive).
+			Updates(map[string]interface{}{
+				"status":     models.SigningKeyRetired,
+				"retired_at": key.CreatedAt,
+			}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(key).Error
+	})
+}
+
+func (m *doctorModeratorRepo) RevokeSigningKey(keyId uuid.UUID, reason string, audit *models.AuditEntry) error {
+	return audited(m.repo, audit, func(tx Repository) error {
+		result := tx.Model(&models.DoctorSigningKey{}).
+			Where("id = ? AND status <> ?", keyId, models.SigningKeyRevoked).
+			Updates(map[string]interface{}{
+				"status":            models.SigningKeyRevoked,
+				"revoked_at":        time.Now(),
+				"revocation_reason": reason,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+func (m *doctorModeratorRepo) FindSigningKeysByDoctorId(doctorId uuid.UUID, keys *[]models.DoctorSigningKey) error {
+	return m.repo.Where("doctor_id = ?", doctorId).Order("created_at DESC").Find(keys).Error
 }
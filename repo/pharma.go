@@ -1,11 +1,13 @@
 package repo
 
 import (
-	"errors"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
-	"medico/config"
+	"gorm.io/gorm/clause"
+	"medico/common"
 	"medico/models"
+	"slices"
+	"time"
 )
 
 type PharmacyOwnerRepo interface {
@@ -19,8 +21,18 @@ type PharmacyOwnerRepo interface {
 	FindPharmacistsByBranchID(pharmacyBranchId uuid.UUID, pharmacists *[]models.Pharmacist) error
 	FindPharmacistsByPharmacyOwnerId(pharmacyOwnerId uuid.UUID, pharmacists *[]models.Pharmacist) error
 
+	FindPharmacyBranchByOwnerId(pharmacyOwnerId, pharmacyBranchId uuid.UUID, pharmacyBranch *models.PharmacyBranch) error
+
 	CreatePharmacyBranch(pharmacyBranch *models.PharmacyBranch) error
 	CreatePharmacist(pharmacist *models.PharmacistAuth) error
+
+	UpdatePharmacyBranch(pharmacyBranchId uuid.UUID, updates map[string]interface{}) error
+	ReplaceBranchOpeningHours(pharmacyBranchId uuid.UUID, hours []models.PharmacyBranchOpeningHours) error
+	SetBranchHoliday(holiday *models.PharmacyBranchHoliday) error
+	DeleteBranchHoliday(pharmacyBranchId, holidayId uuid.UUID) error
+	CloseBranch(pharmacyBranchId uuid.UUID, until *time.Time, reason string) error
+	ReopenBranch(pharmacyBranchId uuid.UUID) error
+	DecommissionBranch(pharmacyOwnerId, pharmacyBranchId uuid.UUID, transferTo *uuid.UUID, at time.Time) error
 }
 
 type pharmacyOwnerRepo struct {
@@ -28,14 +40,15 @@ type pharmacyOwnerRepo struct {
 }
 
 func NewPharmacyOwnerRepo() PharmacyOwnerRepo {
-	databaseConfig := config.LoadDatabaseConfig()
 	return &pharmacyOwnerRepo{
-		repo: CreateNewRepository(databaseConfig),
+		repo: SharedRepository(),
 	}
 }
 
+// FindAuthByEmail finds the login of an owner who still has a pharmacy that is not deleted
 func (p *pharmacyOwnerRepo) FindAuthByEmail(email string, pharmacyOwner *models.PharmacyOwnerAuth) error {
-	return p.repo.First(pharmacyOwner, "email = ?", email).Error
+	return p.repo.Where("id IN (SELECT owner_id FROM pharmacy_brands WHERE deleted_at IS NULL)").
+		First(pharmacyOwner, "email = ?", email).Error
 }
 
 func (p *pharmacyOwnerRepo) FindDataById(pharmacyOwnerId uuid.UUID, pharmacyOwner *models.PharmacyOwner) error {
@@ -53,15 +66,15 @@ func (p *pharmacyOwnerRepo) FindPharmacyBranchesByBrandId(pharmacyBrandId uuid.U
 func (p *pharmacyOwnerRepo) FindPharmacyBranchesByOwnerIdAndCommonName(pharmacyOwnerId uuid.UUID, commonName string, pharmacyBranches *[]models.PharmacyBranch) error {
 	return p.repo.Model(models.PharmacyBranch{}).
 		InnerJoins("INNER JOIN pharmacy_brands ON pharmacy_branches.pharmacy_brand_id = pharmacy_brands.id").
-		Where("pharmacy_brands.owner_id = ?", pharmacyOwnerId).
-		Where("pharmacy_branches.name LIKE ?", commonName+"%").
+		Where("pharmacy_brands.owner_id = ? AND pharmacy_brands.deleted_at IS NULL", pharmacyOwnerId).
+		Where("pharmacy_branches.name LIKE ? ESCAPE '!'", likePrefix(commonName)).
 		Find(pharmacyBranches).Error
 }
 
 func (p *pharmacyOwnerRepo) FindPharmacyBranchesByOwnerId(pharmacyOwnerId uuid.UUID, pharmacyBranches *[]models.PharmacyBranch) error {
 	return p.repo.Model(models.PharmacyBranch{}).
 		InnerJoins("INNER JOIN pharmacy_brands ON pharmacy_branches.pharmacy_brand_id = pharmacy_brands.id").
-		Where("pharmacy_brands.owner_id = ?", pharmacyOwnerId).
+		Where("pharmacy_brands.owner_id = ? AND pharmacy_brands.deleted_at IS NULL", pharmacyOwnerId).
 		Find(pharmacyBranches).Error
 }
 
@@ -73,7 +86,7 @@ func (p *pharmacyOwnerRepo) FindPharmacistsByPharmacyOwnerId(pharmacyOwnerId uui
 	return p.repo.Model(models.Pharmacist{}).
 		InnerJoins("INNER JOIN pharmacy_branches ON pharmacists.pharmacy_branch_id = pharmacy_branches.id").
 		InnerJoins("INNER JOIN pharmacy_brands ON pharmacy_branches.pharmacy_brand_id = pharmacy_brands.id").
-		Where("pharmacy_brands.owner_id = ?", pharmacyOwnerId).
+		Where("pharmacy_brands.owner_id = ? AND pharmacy_brands.deleted_at IS NULL", pharmacyOwnerId).
 		Find(pharmacists).Error
 }
 
@@ -85,15 +98,223 @@ func (p *pharmacyOwnerRepo) CreatePharmacist(pharmacist *models.PharmacistAuth)
 	return p.repo.Create(pharmacist).Error
 }
 
+// FindPharmacyBranchByOwnerId loads a branch with its hours, as long as it belongs to the
+// pharmacy of the owner
+func (p *pharmacyOwnerRepo) FindPharmacyBranchByOwnerId(pharmacyOwnerId, pharmacyBranchId uuid.UUID, pharmacyBranch *models.PharmacyBranch) error {
+	return p.repo.Model(models.PharmacyBranch{}).
+		Preload("OpeningHours", func(db *gorm.DB) *gorm.DB {
+			return db.Order("weekday")
+		}).
+		Preload("Holidays", func(db *gorm.DB) *gorm.DB {
+			return db.Order("date")
+		}).
+		InnerJoins("INNER JOIN pharmacy_brands ON pharmacy_branches.pharmacy_brand_id = pharmacy_brands.id").
+		Where("pharmacy_brands.owner_id = ? AND pharmacy_brands.deleted_at IS NULL", pharmacyOwnerId).
+		First(pharmacyBranch, "pharmacy_branches.id = ?", pharmacyBranchId).Error
+}
+
+// operatingBranch narrows a branch update to branches that are not decommissioned
+func operatingBranch(tx Repository, pharmacyBranchId uuid.UUID) *gorm.DB {
+	return tx.Model(&models.PharmacyBranch{}).
+		Where("id = ? AND status <> ?", pharmacyBranchId, models.BranchDecommissioned)
+}
+
+func (p *pharmacyOwnerRepo) UpdatePharmacyBranch(pharmacyBranchId uuid.UUID, updates map[string]interface{}) error {
+	result := operatingBranch(p.repo, pharmacyBranchId).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBranchDecommissioned
+	}
+
+	return nil
+}
+
+func (p *pharmacyOwnerRepo) ReplaceBranchOpeningHours(pharmacyBranchId uuid.UUID, hours []models.PharmacyBranchOpeningHours) error {
+	return p.repo.Transaction(func(tx Repository) error {
+		if err := tx.Where("pharmacy_branch_id = ?", pharmacyBranchId).
+			Delete(&models.PharmacyBranchOpeningHours{}).Error; err != nil {
+			return err
+		}
+
+		if len(hours) == 0 {
+			return nil
+		}
+
+		return tx.Create(&hours).Error
+	})
+}
+
+// SetBranchHoliday stores the hours of a branch on a date, replacing what was set for that
+// date before
+func (p *pharmacyOwnerRepo) SetBranchHoliday(holiday *models.PharmacyBranchHoliday) error {
+	return p.repo.Transaction(func(tx Repository) error {
+		if err := tx.Where("pharmacy_branch_id = ? AND date = ?", holiday.PharmacyBranchID, holiday.Date.Format(time.DateOnly)).
+			Delete(&models.PharmacyBranchHoliday{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(holiday).Error
+	})
+}
+
+func (p *pharmacyOwnerRepo) DeleteBranchHoliday(pharmacyBranchId, holidayId uuid.UUID) error {
+	result := p.repo.Where("id = ? AND pharmacy_branch_id = ?", holidayId, pharmacyBranchId).
+		Delete(&models.PharmacyBranchHoliday{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (p *pharmacyOwnerRepo) CloseBranch(pharmacyBranchId uuid.UUID, until *time.Time, reason string) error {
+	return p.UpdatePharmacyBranch(pharmacyBranchId, map[string]interface{}{
+		"status":        models.BranchTemporarilyClosed,
+		"closed_until":  until,
+		"closed_reason": reason,
+	})
+}
+
+func (p *pharmacyOwnerRepo) ReopenBranch(pharmacyBranchId uuid.UUID) error {
+	result := p.repo.Model(&models.PharmacyBranch{}).
+		Where("id = ? AND status = ?", pharmacyBranchId, models.BranchTemporarilyClosed).
+		Updates(map[string]interface{}{
+			"status":        models.BranchOpen,
+			"closed_until":  nil,
+			"closed_reason": "",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBranchNotClosed
+	}
+
+	return nil
+}
+
+// DecommissionBranch closes a branch for good. Its stock is added to the stock of transferTo
+// and its pharmacists move there. Without transferTo the branch may hold neither. Active
+// reservations at the branch are cancelled.
+func (p *pharmacyOwnerRepo) DecommissionBranch(pharmacyOwnerId, pharmacyBranchId uuid.UUID, transferTo *uuid.UUID, at time.Time) error {
+	return p.repo.Transaction(func(tx Repository) error {
+		branch := models.PharmacyBranch{}
+		if err := tx.Where("id = ?", pharmacyBranchId).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&branch).Error; err != nil {
+			return err
+		}
+		if branch.Status == models.BranchDecommissioned {
+			return ErrBranchDecommissioned
+		}
+
+		if err := tx.Model(&models.StockReservation{}).
+			Where("pharmacy_branch_id = ? AND status = ?", pharmacyBranchId, models.ReservationActive).
+			Updates(map[string]interface{}{
+				"status":    models.ReservationCancelled,
+				"closed_at": at,
+			}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.PharmacyBranchStorage{}).
+			Where("pharmacy_branch_id = ?", pharmacyBranchId).
+			Update("reserved", 0).Error; err != nil {
+			return err
+		}
+
+		if transferTo != nil {
+			if err := transferBranch(tx, pharmacyOwnerId, pharmacyBranchId, *transferTo, at); err != nil {
+				return err
+			}
+		} else if err := requireEmptyBranch(tx, pharmacyBranchId); err != nil {
+			return err
+		}
+
+		if err := tx.Where("pharmacy_branch_id = ?", pharmacyBranchId).
+			Delete(&models.PharmacyBranchStorage{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("pharmacy_branch_id = ?", pharmacyBranchId).
+			Delete(&models.StockBatch{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.PharmacyBranch{}).
+			Where("id = ?", pharmacyBranchId).
+			Updates(map[string]interface{}{
+				"status":            models.BranchDecommissioned,
+				"decommissioned_at": at,
+			}).Error
+	})
+}
+
+func transferBranch(tx Repository, pharmacyOwnerId, fromBranchId, toBranchId uuid.UUID, at time.Time) error {
+	target := models.PharmacyBranch{}
+	if err := tx.Where("id = ?", toBranchId).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&target).Error; err != nil {
+		return err
+	}
+	if target.Status == models.BranchDecommissioned {
+		return ErrTransferBranchInvalid
+	}
+
+	batches := new([]models.StockBatch)
+	if err := tx.Where("pharmacy_branch_id = ? AND quantity > 0", fromBranchId).Find(batches).Error; err != nil {
+		return err
+	}
+
+	for _, batch := range *batches {
+		if err := transferStock(tx, fromBranchId, toBranchId, batch.MedicamentID, batch.BatchNumber, batch.Quantity,
+			models.StockActorPharmacyOwner, pharmacyOwnerId, "branch decommissioned", at); err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&models.Pharmacist{}).
+		Where("pharmacy_branch_id = ?", fromBranchId).
+		Update("pharmacy_branch_id", toBranchId).Error
+}
+
+func requireEmptyBranch(tx Repository, pharmacyBranchId uuid.UUID) error {
+	var stocked, pharmacists int64
+
+	if err := tx.Model(&models.PharmacyBranchStorage{}).
+		Where("pharmacy_branch_id = ? AND quantity > 0", pharmacyBranchId).
+		Count(&stocked).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Model(&models.Pharmacist{}).
+		Where("pharmacy_branch_id = ?", pharmacyBranchId).
+		Count(&pharmacists).Error; err != nil {
+		return err
+	}
+
+	if stocked > 0 || pharmacists > 0 {
+		return ErrBranchNotEmpty
+	}
+
+	return nil
+}
+
 type PharmacistRepo interface {
 	FindAuthByEmail(email string, pharmacist *models.PharmacistAuth) error
 
 	FindActivePrescriptionsByCitizenUcn(citizenUcn string, activePrescriptions *[]models.Prescription) error
-	FulfillWholePrescription(branchId, prescriptionId uuid.UUID) error
-	FulfillMedicamentFromPrescription(medicamentId uuid.UUID) error
+	FindPrescriptionByCode(code string, prescription *models.Prescription) error
+	FulfillWholePrescription(pharmacistId, prescriptionId uuid.UUID, verify func(prescription *models.Prescription) error) error
+	FulfillMedicamentFromPrescription(pharmacistId, prescriptionId, medicamentId uuid.UUID, verify func(prescription *models.Prescription) error) error
+	FindPrescriptionHistory(prescriptionId uuid.UUID, history *[]models.Prescription) error
 
-	AddMedicamentToBranchStorage(branchId uuid.UUID, medicamentId uuid.UUID, quantity uint) error
-	AddMedicamentToBranchStorageViaPharmacistId(pharmacistId uuid.UUID, medicamentId uuid.UUID, quantity uint) error
+	FindPharmacistById(pharmacistId uuid.UUID, pharmacist *models.Pharmacist) error
 	FindMedicamentByCommonName(commonName string, medicament *[]models.Medicament) error
 }
 
@@ -102,100 +323,235 @@ type pharmacistRepo struct {
 }
 
 func NewPharmacistRepo() PharmacistRepo {
-	databaseConfig := config.LoadDatabaseConfig()
 	return &pharmacistRepo{
-		repo: CreateNewRepository(databaseConfig),
+		repo: SharedRepository(),
 	}
 }
 
+// FindAuthByEmail finds the login of a pharmacist working at a branch of a pharmacy that is
+// not deleted
 func (p pharmacistRepo) FindAuthByEmail(email string, pharmacist *models.PharmacistAuth) error {
-	return p.repo.First(pharmacist, "email = ?", email).Error
+	return p.repo.Where("id IN (?)", p.repo.
+		Model(models.Pharmacist{}).
+		Select("pharmacists.id").
+		Joins("INNER JOIN pharmacy_branches ON pharmacy_branches.id = pharmacists.pharmacy_branch_id").
+		Scopes(ofLiveBrand)).
+		First(pharmacist, "email = ?", email).Error
 }
 
 func (p pharmacistRepo) FindActivePrescriptionsByCitizenUcn(citizenUcn string, activePrescriptions *[]models.Prescription) error {
-	return p.repo.Preload("Medicaments.Medicament").
+	return p.repo.Preload("Hospital").
+		Preload("Medicaments.Medicament", withDeleted).
+		Preload("SigningKey").
 		Where("citizen_id IN (?)", p.repo.
 			Model(models.Citizen{}).
 			Select("id").
 			Where("ucn = ?", citizenUcn)).
 		Where("state = ?", "active").
+		Where("window_start_date <= ?", time.Now()).
 		Find(activePrescriptions).Error
 }
 
-func (p pharmacistRepo) FulfillWholePrescription(pharmacistId, prescriptionId uuid.UUID) error {
-	pharmacist := models.Pharmacist{}
-	p.repo.Model(&models.Pharmacist{}).Where("id = ?", pharmacistId).First(&pharmacist)
+// FindPrescriptionByCode finds the prescription behind a verification code in any state, so
+// that a revoked or superseded one can be told apart from an unknown code.
+func (p pharmacistRepo) FindPrescriptionByCode(code string, prescription *models.Prescription) error {
+	return p.repo.Preload("Hospital").
+		Preload("Medicaments.Medicament", withDeleted).
+		Preload("SigningKey").
+		Where("code = ?", code).
+		First(prescription).Error
+}
 
+func (p pharmacistRepo) FulfillWholePrescription(pharmacistId, prescriptionId uuid.UUID, verify func(prescription *models.Prescription) error) error {
 	return p.repo.Transaction(func(tx Repository) error {
-		return errors.Join(
-			tx.Model(models.Prescription{}).
-				Where("id = ?", prescriptionId).
-				Update("state", "fulfilled").Error,
-
-			tx.Model(models.PrescriptionMedicament{}).
-				Where("prescription_id = ?", prescriptionId).
-				Update("fulfilled", true).Error,
-
-			tx.Model(models.PharmacyBranchStorage{}).
-				Where("pharmacy_branch_storages.pharmacy_branch_id = ?", pharmacist.PharmacyBranchID).
-				Update("pharmacy_branch_storages.quantity",
-					gorm.Expr("pharmacy_branch_storages.quantity - (?)",
-						tx.Model(models.PrescriptionMedicament{}).
-							Select("quantity").
-							Where("prescription_id = ?", prescriptionId))).Error,
-		)
+		return fulfillPrescriptionLines(tx, pharmacistId, prescriptionId, nil, verify)
 	})
 }
 
-func (p pharmacistRepo) FulfillMedicamentFromPrescription(medicamentId uuid.UUID) error {
-	return p.repo.Model(models.PrescriptionMedicament{}).
-		Where("medicament_id = ?", medicamentId).
-		Update("fulfilled", true).Error
+func (p pharmacistRepo) FulfillMedicamentFromPrescription(pharmacistId, prescriptionId, medicamentId uuid.UUID, verify func(prescription *models.Prescription) error) error {
+	return p.repo.Transaction(func(tx Repository) error {
+		return fulfillPrescriptionLines(tx, pharmacistId, prescriptionId, []uuid.UUID{medicamentId}, verify)
+	})
 }
 
-func (p pharmacistRepo) AddMedicamentToBranchStorage(branchId uuid.UUID, medicamentId uuid.UUID, quantity uint) error {
-	pharmacyBranchStorage := models.PharmacyBranchStorage{
-		PharmacyBranchID: branchId,
-		MedicamentID:     medicamentId,
-		Quantity:         quantity,
+// releasePrescriptionReservations gives back the stock the active reservations of a prescription
+// hold for the medicaments being dispensed. A reservation left holding nothing is closed, as
+// fulfilled at the dispensing branch, as cancelled elsewhere and as expired past its hold.
+func releasePrescriptionReservations(tx Repository, prescriptionId, pharmacyBranchId uuid.UUID, medicamentIds []uuid.UUID, at time.Time) error {
+	reservations := new([]models.StockReservation)
+	if err := tx.Where("prescription_id = ? AND status = ?", prescriptionId, models.ReservationActive).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Lines").
+		Find(reservations).Error; err != nil {
+		return err
 	}
 
-	if err := p.repo.First(&pharmacyBranchStorage, "pharmacy_branch_id = ? AND medicament_id = ?", branchId, medicamentId).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			p.repo.Create(&pharmacyBranchStorage)
-		} else {
+	for i := range *reservations {
+		reservation := &(*reservations)[i]
+
+		holding := false
+		for j := range reservation.Lines {
+			line := &reservation.Lines[j]
+			if line.Released {
+				continue
+			}
+			if !slices.Contains(medicamentIds, line.MedicamentID) {
+				holding = true
+				continue
+			}
+
+			if err := releaseReservationLine(tx, reservation, line); err != nil {
+				return err
+			}
+		}
+		if holding {
+			continue
+		}
+
+		status := models.ReservationCancelled
+		if !reservation.ExpiresAt.After(at) {
+			status = models.ReservationExpired
+		} else if reservation.PharmacyBranchID == pharmacyBranchId {
+			status = models.ReservationFulfilled
+		}
+
+		if err := closeReservation(tx, reservation, status, at); err != nil {
 			return err
 		}
-	} else {
-		p.repo.Model(&pharmacyBranchStorage).Update("quantity", gorm.Expr("quantity + ?", quantity))
 	}
 
 	return nil
 }
 
-func (p pharmacistRepo) AddMedicamentToBranchStorageViaPharmacistId(pharmacistId uuid.UUID, medicamentId uuid.UUID, quantity uint) error {
+// fulfillPrescriptionLines dispenses the open lines of a prescription from the pharmacist's
+// branch, or only the given medicaments when medicamentIds is not nil, and records every
+// dispensing. The locked prescription is handed to verify first, so that it is checked in the
+// very state it is dispensed from. Once every line of the current window is dispensed the next
+// refill window is opened or the prescription is marked as fulfilled.
+func fulfillPrescriptionLines(tx Repository, pharmacistId, prescriptionId uuid.UUID, medicamentIds []uuid.UUID, verify func(prescription *models.Prescription) error) error {
 	pharmacist := models.Pharmacist{}
-	p.repo.Model(&models.Pharmacist{}).Where("id = ?", pharmacistId).First(&pharmacist)
+	if err := tx.First(&pharmacist, "id = ?", pharmacistId).Error; err != nil {
+		return err
+	}
+
+	prescription := models.Prescription{}
+	if err := tx.Where("id = ?", prescriptionId).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Medicaments").
+		Preload("SigningKey").
+		First(&prescription).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if prescription.State != models.Active || prescription.WindowStartDate.After(now) || prescription.EndDate.Before(now) {
+		return ErrPrescriptionNotDispensable
+	}
 
-	pharmacyBranchStorage := models.PharmacyBranchStorage{
-		PharmacyBranchID: pharmacist.PharmacyBranchID,
-		MedicamentID:     medicamentId,
-		Quantity:         quantity,
+	if err := verify(&prescription); err != nil {
+		return err
 	}
 
-	if err := p.repo.First(&pharmacyBranchStorage, "pharmacy_branch_id = ? AND medicament_id = ?", pharmacist.PharmacyBranchID, medicamentId).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			p.repo.Create(&pharmacyBranchStorage)
-		} else {
+	dispensing := make([]uuid.UUID, 0, len(prescription.Medicaments))
+	for _, line := range prescription.Medicaments {
+		if !line.Fulfilled && (medicamentIds == nil || slices.Contains(medicamentIds, line.MedicamentID)) {
+			dispensing = append(dispensing, line.MedicamentID)
+		}
+	}
+
+	if err := releasePrescriptionReservations(tx, prescription.ID, pharmacist.PharmacyBranchID, dispensing, now); err != nil {
+		return err
+	}
+
+	dispensed := false
+	for i := range prescription.Medicaments {
+		line := &prescription.Medicaments[i]
+		if !slices.Contains(dispensing, line.MedicamentID) {
+			continue
+		}
+
+		if _, err := moveStock(tx, &models.StockMovement{
+			ID:               uuid.New(),
+			PharmacyBranchID: pharmacist.PharmacyBranchID,
+			MedicamentID:     line.MedicamentID,
+			Type:             common.StockDispense,
+			Delta:            -int64(line.Quantity),
+			ActorRole:        models.StockActorPharmacist,
+			ActorID:          pharmacist.ID,
+			Reference:        prescription.ID.String(),
+			OccurredAt:       now,
+		}); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.PrescriptionMedicament{}).
+			Where("prescription_id = ? AND medicament_id = ?", prescription.ID, line.MedicamentID).
+			Update("fulfilled", true).Error; err != nil {
 			return err
 		}
-	} else {
-		p.repo.Model(&pharmacyBranchStorage).Where("pharmacy_branch_id = ? AND medicament_id = ?", pharmacist.PharmacyBranchID, medicamentId).Update("quantity", gorm.Expr("quantity + ?", quantity))
+		line.Fulfilled = true
+
+		if err := tx.Create(&models.PrescriptionFulfillment{
+			ID:               uuid.New(),
+			PrescriptionID:   prescription.ID,
+			LineID:           line.LineID,
+			MedicamentID:     line.MedicamentID,
+			PharmacistID:     pharmacist.ID,
+			PharmacyBranchID: pharmacist.PharmacyBranchID,
+			Quantity:         line.Quantity,
+			Refill:           prescription.RefillsUsed,
+			FulfilledAt:      now,
+		}).Error; err != nil {
+			return err
+		}
+
+		dispensed = true
 	}
 
-	return nil
+	if !dispensed {
+		return ErrNothingToDispense
+	}
+
+	return completeDispensingWindow(tx, &prescription, now)
+}
+
+func completeDispensingWindow(tx Repository, prescription *models.Prescription, now time.Time) error {
+	for _, line := range prescription.Medicaments {
+		if !line.Fulfilled {
+			return nil
+		}
+	}
+
+	nextWindowStart := now.AddDate(0, 0, int(prescription.RefillIntervalDays))
+
+	if prescription.RefillsCancelled || prescription.RefillsUsed >= prescription.Refills || nextWindowStart.After(prescription.EndDate) {
+		return tx.Model(&models.Prescription{}).
+			Where("id = ?", prescription.ID).
+			Update("state", models.Fulfilled).Error
+	}
+
+	if err := tx.Model(&models.PrescriptionMedicament{}).
+		Where("prescription_id = ?", prescription.ID).
+		Update("fulfilled", false).Error; err != nil {
+		return err
+	}
+
+	return tx.Model(&models.Prescription{}).
+		Where("id = ?", prescription.ID).
+		Updates(map[string]interface{}{
+			"refills_used":      prescription.RefillsUsed + 1,
+			"window_start_date": nextWindowStart,
+		}).Error
+}
+
+func (p pharmacistRepo) FindPrescriptionHistory(prescriptionId uuid.UUID, history *[]models.Prescription) error {
+	return findPrescriptionHistory(p.repo, prescriptionId, history)
+}
+
+func (p pharmacistRepo) FindPharmacistById(pharmacistId uuid.UUID, pharmacist *models.Pharmacist) error {
+	return p.repo.First(pharmacist, "id = ?", pharmacistId).Error
 }
 
 func (p pharmacistRepo) FindMedicamentByCommonName(commonName string, medicament *[]models.Medicament) error {
-	return p.repo.Find(medicament, "official_name LIKE ?", commonName+"%").Limit(7).Error
+	return p.repo.Find(medicament, "official_name LIKE ? ESCAPE '!'", likePrefix(commonName)).Limit(7).Error
 }
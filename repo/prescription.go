@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
+	"medico/models"
+)
+
+// findPrescriptionHistory loads every version of the prescription the given version belongs
+// to, oldest first.
+func findPrescriptionHistory(r Repository, prescriptionId uuid.UUID, history *[]models.Prescription) error {
+	prescription := models.Prescription{}
+	if err := r.Select("root_id").First(&prescription, "id = ?", prescriptionId).Error; err != nil {
+		return err
+	}
+
+	return r.Where("root_id = ?", prescription.RootID).
+		Preload("Doctor", withDeleted).
+		Preload("Hospital").
+		Preload("Medicaments.Medicament", withDeleted).
+		Order("version").
+		Find(history).Error
+}
+
+// findPrescriptionForPrint loads a prescription with everything shown on its printable copy
+func findPrescriptionForPrint(r Repository, prescriptionId uuid.UUID, prescription *models.Prescription, citizen *models.Citizen) error {
+	if err := r.Preload("Doctor", withDeleted).
+		Preload("Hospital").
+		Preload("Medicaments.Medicament", withDeleted).
+		First(prescription, "id = ?", prescriptionId).Error; err != nil {
+		return err
+	}
+
+	return r.First(citizen, "id = ?", prescription.CitizenID).Error
+}
+
+// lockUndispensedPrescription locks an active prescription for update and makes sure nothing
+// has been dispensed from it yet.
+func lockUndispensedPrescription(tx Repository, prescriptionId uuid.UUID, prescription *models.Prescription) error {
+	if err := tx.Where("id = ?", prescriptionId).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(prescription).Error; err != nil {
+		return err
+	}
+
+	if prescription.State != models.Active {
+		return ErrPrescriptionNotActive
+	}
+
+	var fulfillments int64
+	if err := tx.Model(&models.PrescriptionFulfillment{}).
+		Where("prescription_id = ?", prescription.ID).
+		Count(&fulfillments).Error; err != nil {
+		return err
+	}
+
+	if fulfillments > 0 || prescription.RefillsUsed > 0 {
+		return ErrPrescriptionDispensed
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"medico/models"
+)
+
+// openRegistrationStatuses are the statuses of a registration that is still under way, its
+// owner email stays reserved for it. Only a pending one can be decided, see decideRegistration.
+var openRegistrationStatuses = []models.RegistrationStatus{models.RegistrationPending, models.RegistrationChangesRequested}
+
+// reviewsInOrder preloads the reviews of a registration from the first one
+func reviewsInOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("reviewed_at")
+}
+
+// ownerEmailTaken tells whether email already signs in a pharmacy owner or belongs to another
+// open registration than the one with exceptId
+func ownerEmailTaken(r Repository, email string, exceptId uuid.UUID) (bool, error) {
+	var owners, registrations int64
+
+	if err := r.Model(&models.PharmacyOwnerAuth{}).Where("email = ?", email).Count(&owners).Error; err != nil {
+		return false, err
+	}
+
+	if err := r.Model(&models.PharmacyRegistration{}).
+		Where("owner_email = ? AND status IN ? AND id <> ?", email, openRegistrationStatuses, exceptId).
+		Count(&registrations).Error; err != nil {
+		return false, err
+	}
+
+	return owners+registrations > 0, nil
+}
+
+// decideRegistration moves a pending registration to status and records the review. A
+// registration that another moderator decided in the meantime is left alone.
+func decideRegistration(tx Repository, review *models.PharmacyRegistrationReview, status models.RegistrationStatus, pharmacyId *uuid.UUID) error {
+	result := tx.Model(&models.PharmacyRegistration{}).
+		Where("id = ? AND status = ?", review.RegistrationID, models.RegistrationPending).
+		Updates(map[string]interface{}{
+			"status":            status,
+			"pharmacy_brand_id": pharmacyId,
+			"updated_at":        review.ReviewedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRegistrationNotPending
+	}
+
+	return tx.Create(review).Error
+}
+
+type PharmacyRegistrationRepo interface {
+	CreateRegistration(registration *models.PharmacyRegistration) error
+	FindRegistrationById(registrationId uuid.UUID, registration *models.PharmacyRegistration) error
+	ResubmitRegistration(registrationId uuid.UUID, updates map[string]interface{}) error
+}
+
+type pharmacyRegistrationRepo struct {
+	repo Repository
+}
+
+func NewPharmacyRegistrationRepo() PharmacyRegistrationRepo {
+	return &pharmacyRegistrationRepo{repo: SharedRepository()}
+}
+
+func (r *pharmacyRegistrationRepo) CreateRegistration(registration *models.PharmacyRegistration) error {
+	return r.repo.Transaction(func(tx Repository) error {
+		taken, err := ownerEmailTaken(tx, registration.OwnerEmail, registration.ID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrOwnerEmailTaken
+		}
+
+		return tx.Create(registration).Error
+	})
+}
+
+func (r *pharmacyRegistrationRepo) FindRegistrationById(registrationId uuid.UUID, registration *models.PharmacyRegistration) error {
+	return r.repo.Preload("Reviews", reviewsInOrder).First(registration, "id = ?", registrationId).Error
+}
+
+// ResubmitRegistration replaces the data of a registration a moderator returned for changes
+// and puts it back in the review queue
+func (r *pharmacyRegistrationRepo) ResubmitRegistration(registrationId uuid.UUID, updates map[string]interface{}) error {
+	updates["status"] = models.RegistrationPending
+
+	result := r.repo.Model(&models.PharmacyRegistration{}).
+		Where("id = ? AND status = ?", registrationId, models.RegistrationChangesRequested).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRegistrationNotReturned
+	}
+
+	return nil
+}
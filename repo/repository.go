@@ -6,6 +6,7 @@ import (
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"medico/config"
+	"sync"
 )
 
 type Repository interface {
@@ -33,6 +34,20 @@ type repository struct {
 	db *gorm.DB
 }
 
+var (
+	sharedOnce       sync.Once
+	sharedRepository Repository
+)
+
+// SharedRepository returns the repository of the configured database. Every repo works
+// through it, so the application keeps a single connection pool.
+func SharedRepository() Repository {
+	sharedOnce.Do(func() {
+		sharedRepository = CreateNewRepository(config.LoadDatabaseConfig())
+	})
+	return sharedRepository
+}
+
 func CreateNewRepository(databaseConfig *config.DatabaseConfig) Repository {
 	db, err := createConnection(databaseConfig)
 
@@ -49,7 +64,8 @@ func createConnection(databaseConfig *config.DatabaseConfig) (*gorm.DB, error) {
 		databaseConfig.Username, databaseConfig.Password,
 		databaseConfig.Host, databaseConfig.DBName)
 
-	return gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	// translated errors let callers recognise unique key collisions as gorm.ErrDuplicatedKey
+	return gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
 }
 
 func (r *repository) Model(value interface{}) *gorm.DB {
@@ -121,23 +137,10 @@ func (r *repository) AutoMigrate(value interface{}) error {
 	return r.db.AutoMigrate(value)
 }
 
-func (r *repository) Transaction(fc func(tx Repository) error) (err error) {
-	panicked := true
-	tx := r.db.Begin()
-	defer func() {
-		if panicked || err != nil {
-			tx.Rollback()
-		}
-	}()
-
-	txrep := &repository{}
-	txrep.db = tx
-	err = fc(txrep)
-
-	if err == nil {
-		err = tx.Commit().Error
-	}
-
-	panicked = false
-	return
+// Transaction runs fc in a transaction. Called on a repository that is already in one, it
+// runs fc in a savepoint of it, so an audited change can use helpers that open their own.
+func (r *repository) Transaction(fc func(tx Repository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fc(&repository{db: tx})
+	})
 }
@@ -0,0 +1,262 @@
+package repo
+
+import (
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"medico/models"
+	"slices"
+	"time"
+)
+
+type ReservationRepo interface {
+	CreateReservation(reservation *models.StockReservation, medicamentIds []uuid.UUID) error
+	FindReservationsByCitizenId(citizenId uuid.UUID, reservations *[]models.StockReservation) error
+	FindActiveReservationsByPharmacistId(pharmacistId uuid.UUID, at time.Time, reservations *[]models.StockReservation) error
+	FindReservationById(reservationId uuid.UUID, reservation *models.StockReservation) error
+	CancelReservation(citizenId, reservationId uuid.UUID, at time.Time) error
+	FulfillReservation(pharmacistId, reservationId uuid.UUID, at time.Time, verify func(prescription *models.Prescription) error) error
+	ExpireReservations(at time.Time) (int, error)
+}
+
+type reservationRepo struct {
+	repo Repository
+}
+
+func NewReservationRepo() ReservationRepo {
+	return &reservationRepo{repo: SharedRepository()}
+}
+
+// CreateReservation holds the stock for the open lines of the prescription at the branch, or
+// only for the given medicaments when medicamentIds is not empty. The lines of the reservation
+// are filled in from the prescription. Either every line is held or nothing is.
+func (r *reservationRepo) CreateReservation(reservation *models.StockReservation, medicamentIds []uuid.UUID) error {
+	return r.repo.Transaction(func(tx Repository) error {
+		prescription := models.Prescription{}
+		if err := tx.Where("id = ?", reservation.PrescriptionID).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Medicaments").
+			First(&prescription).Error; err != nil {
+			return err
+		}
+
+		// the prescription has to be dispensable at some point while the stock is held
+		if prescription.State != models.Active || prescription.EndDate.Before(reservation.CreatedAt) ||
+			prescription.WindowStartDate.After(reservation.ExpiresAt) {
+			return ErrPrescriptionNotDispensable
+		}
+
+		branch := models.PharmacyBranch{}
+		if err := tx.Scopes(ofLiveBrand).First(&branch, "pharmacy_branches.id = ?", reservation.PharmacyBranchID).Error; err != nil {
+			return err
+		}
+		if branch.Status != models.BranchOpen &&
+			(branch.Status != models.BranchTemporarilyClosed || branch.ClosedUntil == nil || branch.ClosedUntil.After(reservation.CreatedAt)) {
+			return ErrBranchNotReservable
+		}
+
+		var reserved int64
+		if err := tx.Model(&models.StockReservation{}).
+			Where("prescription_id = ? AND status = ? AND expires_at > ?", prescription.ID, models.ReservationActive, reservation.CreatedAt).
+			Count(&reserved).Error; err != nil {
+			return err
+		}
+		if reserved > 0 {
+			return ErrPrescriptionReserved
+		}
+
+		reservation.Lines = nil
+		for _, line := range prescription.Medicaments {
+			if line.Fulfilled || (len(medicamentIds) > 0 && !slices.Contains(medicamentIds, line.MedicamentID)) {
+				continue
+			}
+
+			result := tx.Model(&models.PharmacyBranchStorage{}).
+				Where("pharmacy_branch_id = ? AND medicament_id = ?", branch.ID, line.MedicamentID).
+				Where(dispensableQuantity+" >= reserved + ?", reservation.CreatedAt.Format(time.DateOnly), line.Quantity).
+				Update("reserved", gorm.Expr("reserved + ?", line.Quantity))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrInsufficientStock
+			}
+
+			reservation.Lines = append(reservation.Lines, models.StockReservationLine{
+				ReservationID: reservation.ID,
+				MedicamentID:  line.MedicamentID,
+				Quantity:      line.Quantity,
+			})
+		}
+
+		if len(reservation.Lines) == 0 {
+			return ErrNothingToReserve
+		}
+
+		return tx.Create(reservation).Error
+	})
+}
+
+func (r *reservationRepo) FindReservationsByCitizenId(citizenId uuid.UUID, reservations *[]models.StockReservation) error {
+	return r.repo.Preload("PharmacyBranch").
+		Preload("Lines.Medicament", withDeleted).
+		Where("citizen_id = ?", citizenId).
+		Order("created_at DESC").
+		Find(reservations).Error
+}
+
+// FindActiveReservationsByPharmacistId finds the reservations waiting at the branch of the
+// pharmacist, the ones expiring first first
+func (r *reservationRepo) FindActiveReservationsByPharmacistId(pharmacistId uuid.UUID, at time.Time, reservations *[]models.StockReservation) error {
+	return r.repo.Preload("PharmacyBranch").
+		Preload("Lines.Medicament", withDeleted).
+		Where("pharmacy_branch_id IN (?)", r.repo.
+			Model(models.Pharmacist{}).
+			Select("pharmacy_branch_id").
+			Where("id = ?", pharmacistId)).
+		Where("status = ? AND expires_at > ?", models.ReservationActive, at).
+		Order("expires_at").
+		Find(reservations).Error
+}
+
+func (r *reservationRepo) FindReservationById(reservationId uuid.UUID, reservation *models.StockReservation) error {
+	return r.repo.Preload("PharmacyBranch").
+		Preload("Lines.Medicament", withDeleted).
+		First(reservation, "id = ?", reservationId).Error
+}
+
+func (r *reservationRepo) CancelReservation(citizenId, reservationId uuid.UUID, at time.Time) error {
+	return r.repo.Transaction(func(tx Repository) error {
+		reservation := models.StockReservation{}
+		if err := lockReservation(tx, reservationId, &reservation); err != nil {
+			return err
+		}
+		if reservation.CitizenID != citizenId {
+			return gorm.ErrRecordNotFound
+		}
+
+		return closeReservation(tx, &reservation, models.ReservationCancelled, at)
+	})
+}
+
+// FulfillReservation dispenses the reserved lines at the branch the reservation was made at,
+// which releases the stock they hold and closes the reservation. The prescription is locked
+// before the reservation, in the order dispensing it directly locks them.
+func (r *reservationRepo) FulfillReservation(pharmacistId, reservationId uuid.UUID, at time.Time, verify func(prescription *models.Prescription) error) error {
+	return r.repo.Transaction(func(tx Repository) error {
+		reservation := models.StockReservation{}
+		if err := tx.First(&reservation, "id = ?", reservationId).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", reservation.PrescriptionID).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			First(&models.Prescription{}).Error; err != nil {
+			return err
+		}
+		if err := lockReservation(tx, reservationId, &reservation); err != nil {
+			return err
+		}
+
+		pharmacist := models.Pharmacist{}
+		if err := tx.First(&pharmacist, "id = ?", pharmacistId).Error; err != nil {
+			return err
+		}
+		if pharmacist.PharmacyBranchID != reservation.PharmacyBranchID {
+			return ErrReservationOtherBranch
+		}
+		if reservation.Status != models.ReservationActive || !reservation.ExpiresAt.After(at) {
+			return ErrReservationNotActive
+		}
+
+		medicamentIds := make([]uuid.UUID, 0, len(reservation.Lines))
+		for _, line := range reservation.Lines {
+			if !line.Released {
+				medicamentIds = append(medicamentIds, line.MedicamentID)
+			}
+		}
+
+		return fulfillPrescriptionLines(tx, pharmacistId, reservation.PrescriptionID, medicamentIds, verify)
+	})
+}
+
+// ExpireReservations releases the stock of the reservations that ran out and returns how many
+// there were
+func (r *reservationRepo) ExpireReservations(at time.Time) (int, error) {
+	expired := new([]models.StockReservation)
+	if err := r.repo.Where("status = ? AND expires_at <= ?", models.ReservationActive, at).
+		Find(expired).Error; err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, candidate := range *expired {
+		err := r.repo.Transaction(func(tx Repository) error {
+			reservation := models.StockReservation{}
+			if err := lockReservation(tx, candidate.ID, &reservation); err != nil {
+				return err
+			}
+
+			return closeReservation(tx, &reservation, models.ReservationExpired, at)
+		})
+		if errors.Is(err, ErrReservationNotActive) {
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+
+	return released, nil
+}
+
+func lockReservation(tx Repository, reservationId uuid.UUID, reservation *models.StockReservation) error {
+	return tx.Where("id = ?", reservationId).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Lines").
+		First(reservation).Error
+}
+
+// closeReservation ends an active reservation and gives the stock it still holds back to the
+// branch
+func closeReservation(tx Repository, reservation *models.StockReservation, status models.ReservationStatus, at time.Time) error {
+	if reservation.Status != models.ReservationActive {
+		return ErrReservationNotActive
+	}
+
+	for i := range reservation.Lines {
+		if reservation.Lines[i].Released {
+			continue
+		}
+		if err := releaseReservationLine(tx, reservation, &reservation.Lines[i]); err != nil {
+			return err
+		}
+	}
+
+	reservation.Status = status
+	reservation.ClosedAt = &at
+
+	return tx.Model(&models.StockReservation{}).
+		Where("id = ?", reservation.ID).
+		Updates(map[string]interface{}{
+			"status":    status,
+			"closed_at": at,
+		}).Error
+}
+
+// releaseReservationLine gives the stock held by one line of a reservation back to the branch
+func releaseReservationLine(tx Repository, reservation *models.StockReservation, line *models.StockReservationLine) error {
+	if err := tx.Model(&models.PharmacyBranchStorage{}).
+		Where("pharmacy_branch_id = ? AND medicament_id = ? AND reserved >= ?", reservation.PharmacyBranchID, line.MedicamentID, line.Quantity).
+		Update("reserved", gorm.Expr("reserved - ?", line.Quantity)).Error; err != nil {
+		return err
+	}
+
+	line.Released = true
+
+	return tx.Model(&models.StockReservationLine{}).
+		Where("reservation_id = ? AND medicament_id = ?", reservation.ID, line.MedicamentID).
+		Update("released", true).Error
+}
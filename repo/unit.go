@@ -0,0 +1,53 @@
+package repo
+
+import "medico/models"
+
+// Work hands out repos that write through one transaction. Whatever is written through them
+// is committed together or not at all.
+type Work interface {
+	DoctorModerator() DoctorModeratorRepo
+	PharmaModerator() PharmaModeratorRepo
+	CitizenModerator() CitizenModeratorRepo
+	// Audit appends entry to the audit log as part of the work
+	Audit(entry *models.AuditEntry) error
+}
+
+// UnitOfWork groups writes to several entities, possibly of several repos, into a single
+// transaction
+type UnitOfWork interface {
+	Do(work func(w Work) error) error
+}
+
+type unitOfWork struct {
+	repo Repository
+}
+
+func NewUnitOfWork() UnitOfWork {
+	return &unitOfWork{repo: SharedRepository()}
+}
+
+func (u *unitOfWork) Do(work func(w Work) error) error {
+	return u.repo.Transaction(func(tx Repository) error {
+		return work(&transactionWork{tx: tx})
+	})
+}
+
+type transactionWork struct {
+	tx Repository
+}
+
+func (w *transactionWork) DoctorModerator() DoctorModeratorRepo {
+	return &doctorModeratorRepo{repo: w.tx}
+}
+
+func (w *transactionWork) PharmaModerator() PharmaModeratorRepo {
+	return &pharmaModeratorRepo{repo: w.tx}
+}
+
+func (w *transactionWork) CitizenModerator() CitizenModeratorRepo {
+	return &citizenModeratorRepo{repo: w.tx}
+}
+
+func (w *transactionWork) Audit(entry *models.AuditEntry) error {
+	return appendAudit(w.tx, entry)
+}
@@ -11,12 +11,22 @@ import (
 	"medico/controllers"
 	"medico/models"
 	"medico/repo"
+	"medico/service"
 	"strings"
 )
 
 func SetupRoutes(app *fiber.App) {
 	apiRoute := app.Group("/api")
 
+	// the request id ends up in the audit log next to what the request changed. It is always
+	// generated here, an id sent by the client could be chosen to mislead whoever reads the log.
+	apiRoute.Use(func(ctx *fiber.Ctx) error {
+		requestId := uuid.NewString()
+		ctx.Locals("requestid", requestId)
+		ctx.Set(fiber.HeaderXRequestID, requestId)
+		return ctx.Next()
+	})
+
 	setupCORS(apiRoute)
 	//setupCSRF(apiRoute)
 
@@ -37,6 +47,7 @@ func SetupRoutes(app *fiber.App) {
 
 	pharmacyRoute := apiRoute.Group("/pharmacy")
 
+	setupPharmacyRegistrationRoute(pharmacyRoute)
 	setupPharmacyOwnerRoute(pharmacyRoute)
 	setupPharmacistsRoute(pharmacyRoute)
 }
@@ -54,6 +65,7 @@ func setupCORS(router fiber.Router) {
 		fiber.MethodPut,
 		fiber.MethodGet,
 		fiber.MethodDelete,
+		fiber.MethodPatch,
 		fiber.MethodOptions,
 	}
 
@@ -106,6 +118,16 @@ func setupAdminRoutes(router fiber.Router) {
 	adminRoute.Get("/moderator/get", admin.GetModerators)
 	adminRoute.Post("/moderator/create", admin.AddModerator)
 	adminRoute.Delete("/moderator/delete", admin.DeleteModerator)
+	adminRoute.Put("/moderator/restore", admin.RestoreModerator)
+	adminRoute.Patch("/moderator/update", admin.UpdateModerator)
+	adminRoute.Get("/moderator/history", admin.GetModeratorHistory)
+	adminRoute.Delete("/moderator/purge", admin.PurgeModerator)
+	adminRoute.Delete("/doctor/purge", admin.PurgeDoctor)
+	adminRoute.Delete("/citizen/purge", admin.PurgeCitizen)
+	adminRoute.Delete("/pharmacy/purge", admin.PurgePharmacy)
+	adminRoute.Delete("/medicament/purge", admin.PurgeMedicament)
+	adminRoute.Get("/audit/get", admin.GetAuditEntries)
+	adminRoute.Get("/audit/verify", admin.VerifyAudit)
 	adminRoute.Post("/register", func(ctx *fiber.Ctx) error {
 		type RegisterForm struct {
 			Email    string `json:"email"`
@@ -118,9 +140,7 @@ func setupAdminRoutes(router fiber.Router) {
 		if err != nil {
 			return err
 		}
-		databaseConfig := config.LoadDatabaseConfig()
-
-		db := repo.CreateNewRepository(databaseConfig)
+		db := repo.SharedRepository()
 
 		password, err := bcrypt.GenerateFromPassword([]byte(m.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -155,6 +175,31 @@ func setupDoctorModeratorRoutes(moderatorRoute fiber.Router) {
 	doctorModeratorRoute.Get("/get", doctorModerator.GetDoctors)
 	doctorModeratorRoute.Post("/create", doctorModerator.AddDoctor)
 	doctorModeratorRoute.Delete("/delete", doctorModerator.DeleteDoctor)
+	doctorModeratorRoute.Put("/restore", doctorModerator.RestoreDoctor)
+	doctorModeratorRoute.Patch("/update", doctorModerator.UpdateDoctor)
+	doctorModeratorRoute.Get("/history", doctorModerator.GetDoctorHistory)
+	doctorModeratorRoute.Post("/registry/import", doctorModerator.ImportRegistry)
+	doctorModeratorRoute.Post("/registry/recheck", doctorModerator.RecheckLicences)
+
+	doctorModeratorRoute.Get("/hospital/get", doctorModerator.GetHospitals)
+	doctorModeratorRoute.Post("/hospital/create", doctorModerator.AddHospital)
+	doctorModeratorRoute.Put("/hospital/update", doctorModerator.UpdateHospital)
+	doctorModeratorRoute.Delete("/hospital/delete", doctorModerator.DeleteHospital)
+
+	doctorModeratorRoute.Get("/affiliation/get", doctorModerator.GetAffiliations)
+	doctorModeratorRoute.Post("/affiliation/create", doctorModerator.AddAffiliation)
+	doctorModeratorRoute.Put("/affiliation/end", doctorModerator.EndAffiliation)
+	doctorModeratorRoute.Delete("/affiliation/delete", doctorModerator.DeleteAffiliation)
+
+	doctorModeratorRoute.Get("/specialty/get", doctorModerator.GetSpecialties)
+	doctorModeratorRoute.Post("/specialty/create", doctorModerator.AddSpecialty)
+	doctorModeratorRoute.Delete("/specialty/delete", doctorModerator.DeleteSpecialty)
+	doctorModeratorRoute.Post("/specialty/assign", doctorModerator.AssignSpecialty)
+	doctorModeratorRoute.Post("/specialty/unassign", doctorModerator.UnassignSpecialty)
+
+	doctorModeratorRoute.Get("/key/get", doctorModerator.GetSigningKeys)
+	doctorModeratorRoute.Post("/key/rotate", doctorModerator.RotateSigningKey)
+	doctorModeratorRoute.Put("/key/revoke", doctorModerator.RevokeSigningKey)
 }
 
 func setupPharmaModeratorRoutes(moderatorRoute fiber.Router) {
@@ -166,6 +211,11 @@ func setupPharmaModeratorRoutes(moderatorRoute fiber.Router) {
 	pharmaModeratorRoute.Get("/get", pharmaModerator.GetPharmacies)
 	pharmaModeratorRoute.Post("/create", pharmaModerator.AddPharmacy)
 	pharmaModeratorRoute.Delete("/delete", pharmaModerator.DeletePharmacy)
+	pharmaModeratorRoute.Put("/restore", pharmaModerator.RestorePharmacy)
+	pharmaModeratorRoute.Patch("/update", pharmaModerator.UpdatePharmacy)
+	pharmaModeratorRoute.Get("/history", pharmaModerator.GetPharmacyHistory)
+	pharmaModeratorRoute.Get("/registration/get", pharmaModerator.GetRegistrations)
+	pharmaModeratorRoute.Put("/registration/review", pharmaModerator.ReviewRegistration)
 }
 
 func setupMedicamentModeratorRoutes(moderatorRoute fiber.Router) {
@@ -177,6 +227,11 @@ func setupMedicamentModeratorRoutes(moderatorRoute fiber.Router) {
 	medicamentModeratorRoute.Get("/get", medicamentModerator.GetMedicaments)
 	medicamentModeratorRoute.Post("/create", medicamentModerator.AddMedicament)
 	medicamentModeratorRoute.Delete("/delete", medicamentModerator.DeleteMedicament)
+	medicamentModeratorRoute.Put("/restore", medicamentModerator.RestoreMedicament)
+	medicamentModeratorRoute.Patch("/update", medicamentModerator.UpdateMedicament)
+	medicamentModeratorRoute.Get("/history", medicamentModerator.GetMedicamentHistory)
+	medicamentModeratorRoute.Get("/specialty/get", medicamentModerator.GetSpecialties)
+	medicamentModeratorRoute.Put("/restrictions", medicamentModerator.SetRestrictions)
 }
 
 func setupCitizenModeratorRoutes(moderatorRoute fiber.Router) {
@@ -188,6 +243,9 @@ func setupCitizenModeratorRoutes(moderatorRoute fiber.Router) {
 	citizenModeratorRoute.Get("/get", citizenModerator.GetCitizens)
 	citizenModeratorRoute.Post("/create", citizenModerator.AddCitizen)
 	citizenModeratorRoute.Delete("/delete", citizenModerator.DeleteCitizen)
+	citizenModeratorRoute.Put("/restore", citizenModerator.RestoreCitizen)
+	citizenModeratorRoute.Patch("/update", citizenModerator.UpdateCitizen)
+	citizenModeratorRoute.Get("/history", citizenModerator.GetCitizenHistory)
 }
 
 func setupDoctorRoutes(route fiber.Router) {
@@ -202,7 +260,15 @@ func setupDoctorRoutes(route fiber.Router) {
 	doctorRoute.Get("/citizens/ucn", doctor.GetListOfCitizensViaCommonUCN)
 	doctorRoute.Get("/citizen/prescription", doctor.GetCitizenPrescriptions)
 	doctorRoute.Post("/citizen/prescription", doctor.CreateCitizenPrescription)
+	doctorRoute.Put("/citizen/prescription/refills/cancel", doctor.CancelPrescriptionRefills)
+	doctorRoute.Put("/citizen/prescription/revoke", doctor.RevokeCitizenPrescription)
+	doctorRoute.Post("/citizen/prescription/amend", doctor.AmendCitizenPrescription)
+	doctorRoute.Get("/citizen/prescription/history", doctor.GetPrescriptionHistory)
+	doctorRoute.Get("/citizen/prescriptions/:id/pdf", doctor.GetPrescriptionPdf)
 	doctorRoute.Get("/medicaments/commonName", doctor.GetMedicamentByCommonName)
+	doctorRoute.Get("/hospitals", doctor.GetAffiliations)
+
+	setupFhirRoutes(doctorRoute, service.FhirDoctor)
 }
 
 func setupCitizenRoute(router fiber.Router) {
@@ -215,7 +281,29 @@ func setupCitizenRoute(router fiber.Router) {
 	citizenRoute.Get("/medicalInfo", citizen.GetMedicalInfo)
 	citizenRoute.Get("/personalDoctor", citizen.GetPersonalDoctor)
 	citizenRoute.Get("/prescriptions", citizen.Prescription)
+	citizenRoute.Get("/prescriptions/:id/pdf", citizen.PrescriptionPdf)
+	citizenRoute.Get("/prescription/history", citizen.PrescriptionHistory)
+	citizenRoute.Get("/prescription/verification", citizen.PrescriptionVerification)
+	citizenRoute.Get("/prescription/qr", citizen.PrescriptionQr)
 	citizenRoute.Get("/availablePharmacies", citizen.AvailablePharmacies)
+	citizenRoute.Get("/medicaments/availability", citizen.MedicamentAvailability)
+	citizenRoute.Post("/reservation/new", citizen.NewReservation)
+	citizenRoute.Get("/reservations", citizen.Reservations)
+	citizenRoute.Put("/reservation/cancel", citizen.CancelReservation)
+	citizenRoute.Get("/hospitals", citizen.Hospitals)
+	citizenRoute.Get("/hospital/doctors", citizen.DoctorsByHospital)
+
+	setupFhirRoutes(citizenRoute, service.FhirCitizen)
+}
+
+// setupPharmacyRegistrationRoute mounts the registration of pharmacy chains, which needs no session
+func setupPharmacyRegistrationRoute(router fiber.Router) {
+	registration := controllers.NewPharmacyRegistrationController()
+
+	registrationRoute := router.Group("/registration")
+	registrationRoute.Post("/submit", registration.Submit)
+	registrationRoute.Get("/status", registration.Status)
+	registrationRoute.Put("/resubmit", registration.Resubmit)
 }
 
 func setupPharmacyOwnerRoute(router fiber.Router) {
@@ -229,6 +317,23 @@ func setupPharmacyOwnerRoute(router fiber.Router) {
 	pharmacyRoute.Get("/pharmacists", pharmacy.GetAllPharmacists)
 	pharmacyRoute.Get("/branches/commonName", pharmacy.GetBranchesByCommonName)
 	pharmacyRoute.Post("/branch/new", pharmacy.NewPharmacyBranch)
+	pharmacyRoute.Get("/branch/get", pharmacy.GetBranch)
+	pharmacyRoute.Put("/branch/update", pharmacy.UpdateBranch)
+	pharmacyRoute.Put("/branch/hours", pharmacy.SetBranchOpeningHours)
+	pharmacyRoute.Post("/branch/holiday/new", pharmacy.NewBranchHoliday)
+	pharmacyRoute.Delete("/branch/holiday/delete", pharmacy.DeleteBranchHoliday)
+	pharmacyRoute.Put("/branch/close", pharmacy.CloseBranch)
+	pharmacyRoute.Put("/branch/reopen", pharmacy.ReopenBranch)
+	pharmacyRoute.Delete("/branch/decommission", pharmacy.DecommissionBranch)
+	pharmacyRoute.Get("/branch/stock/history", pharmacy.GetStockHistory)
+	pharmacyRoute.Get("/branch/stock/reconcile", pharmacy.ReconcileStock)
+	pharmacyRoute.Post("/branch/stock/transfer", pharmacy.TransferStock)
+	pharmacyRoute.Get("/branch/stock/expiring", pharmacy.GetExpiringStock)
+	pharmacyRoute.Put("/branch/stock/level", pharmacy.SetStockLevel)
+	pharmacyRoute.Delete("/branch/stock/level", pharmacy.DeleteStockLevel)
+	pharmacyRoute.Get("/branch/stock/levels", pharmacy.GetStockLevels)
+	pharmacyRoute.Get("/branch/stock/low", pharmacy.GetLowStock)
+	pharmacyRoute.Get("/branch/stock/purchaseOrders", pharmacy.ExportPurchaseOrders)
 	pharmacyRoute.Post("/pharmacist/new", pharmacy.NewPharmacist)
 }
 
@@ -241,7 +346,37 @@ func setupPharmacistsRoute(router fiber.Router) {
 	pharmacistRoute.Post("/logout", pharmacist.Logout)
 	pharmacistRoute.Get("/medicaments/commonName", pharmacist.GetMedicamentsByCommonName)
 	pharmacistRoute.Get("/prescription/get", pharmacist.GetCitizenPrescription)
+	pharmacistRoute.Get("/prescription/resolve", pharmacist.ResolvePrescription)
 	pharmacistRoute.Post("/prescription/fulfill", pharmacist.FulfillPrescription)
 	pharmacistRoute.Post("/prescription/fulfillMedicament", pharmacist.FulfillMedicamentFromPrescription)
+	pharmacistRoute.Get("/prescription/history", pharmacist.GetPrescriptionHistory)
 	pharmacistRoute.Post("/branch/addMedicament", pharmacist.AddMedicamentToBranchStorage)
+	pharmacistRoute.Post("/branch/stock/adjust", pharmacist.AdjustStock)
+	pharmacistRoute.Post("/branch/stock/writeOff", pharmacist.WriteOffStock)
+	pharmacistRoute.Get("/branch/stock/history", pharmacist.GetStockHistory)
+	pharmacistRoute.Get("/reservations", pharmacist.GetReservations)
+	pharmacistRoute.Post("/reservation/fulfill", pharmacist.FulfillReservation)
+
+	setupFhirRoutes(pharmacistRoute, service.FhirPharmacist)
+}
+
+// setupFhirRoutes mounts the FHIR facade behind the session check of the role's routes
+func setupFhirRoutes(router fiber.Router, role service.FhirRole) {
+	fhir := controllers.NewFhirController(role)
+
+	fhirRoute := router.Group("/fhir")
+	fhirRoute.Get("/Patient", fhir.SearchPatients)
+	fhirRoute.Get("/Patient/:id", fhir.ReadPatient)
+	fhirRoute.Get("/Practitioner", fhir.SearchPractitioners)
+	fhirRoute.Get("/Practitioner/:id", fhir.ReadPractitioner)
+	fhirRoute.Get("/Medication", fhir.SearchMedications)
+	fhirRoute.Get("/Medication/:id", fhir.ReadMedication)
+	fhirRoute.Get("/MedicationRequest", fhir.SearchMedicationRequests)
+	fhirRoute.Get("/MedicationRequest/:id", fhir.ReadMedicationRequest)
+	if role == service.FhirDoctor {
+		fhirRoute.Post("/", fhir.CreateMedicationRequests)
+		fhirRoute.Post("/MedicationRequest", fhir.CreateMedicationRequests)
+	}
+	fhirRoute.Get("/MedicationDispense", fhir.SearchMedicationDispenses)
+	fhirRoute.Get("/MedicationDispense/:id", fhir.ReadMedicationDispense)
 }
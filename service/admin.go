@@ -16,9 +16,18 @@ type AdminService interface {
 	CreateAuthenticationSession(adminId uuid.UUID) (uuid.UUID, time.Duration, error)
 	GetAuthenticationSession(sessionId uuid.UUID) (uuid.UUID, error)
 	DeleteAuthenticationSession(sessionId uuid.UUID) error
-	CreateModerator(createModerator *dto.RequestAdminCreateModerator) error
-	DeleteModerator(moderatorId uuid.UUID) error
-	GetModerators(dtoModerators *[]dto.ResponseAdminGetModerator) error
+	CreateModerator(actor *Actor, createModerator *dto.RequestAdminCreateModerator) error
+	DeleteModerator(actor *Actor, moderatorId uuid.UUID) error
+	RestoreModerator(actor *Actor, moderatorId *dto.QueryAdminRestoreModerator) error
+	GetModerators(query *dto.QueryAdminGetModerators, dtoModerators *dto.ResponseList[dto.ResponseAdminGetModerator]) error
+	UpdateModerator(actor *Actor, updateModerator *dto.RequestAdminUpdateModerator, updated *dto.ResponseUpdated) error
+	GetModeratorChanges(moderatorId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error
+
+	PurgeDoctor(actor *Actor, doctorId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error
+	PurgeCitizen(actor *Actor, citizenId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error
+	PurgePharmacy(actor *Actor, pharmacyId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error
+	PurgeMedicament(actor *Actor, medicamentId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error
+	PurgeModerator(actor *Actor, moderatorId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error
 }
 
 type adminService struct {
@@ -57,7 +66,7 @@ func (s *adminService) DeleteAuthenticationSession(sessionId uuid.UUID) error {
 	return s.authSession.DeleteAuthSession(sessionId)
 }
 
-func (s *adminService) CreateModerator(createModerator *dto.RequestAdminCreateModerator) error {
+func (s *adminService) CreateModerator(actor *Actor, createModerator *dto.RequestAdminCreateModerator) error {
 	password, err := bcrypt.GenerateFromPassword([]byte(createModerator.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -76,36 +85,166 @@ func (s *adminService) CreateModerator(createModerator *dto.RequestAdminCreateMo
 		},
 	}
 
-	if err := s.repo.CreateModerator(&newModeratorAuth); err != nil {
+	audit := actor.audit(models.AuditCreate, models.AuditedModerator, newModeratorAuth.ID, setValues(map[string]interface{}{
+		"first_name":  createModerator.FirstName,
+		"second_name": createModerator.SecondName,
+		"last_name":   createModerator.LastName,
+		"email":       createModerator.Email,
+		"type":        createModerator.Type,
+	}))
+
+	if err := s.repo.CreateModerator(&newModeratorAuth, audit); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (s *adminService) DeleteModerator(moderatorId uuid.UUID) error {
-	return s.repo.DeleteModerator(moderatorId)
+func (s *adminService) DeleteModerator(actor *Actor, moderatorId uuid.UUID) error {
+	return s.repo.DeleteModerator(moderatorId, actor.audit(models.AuditDelete, models.AuditedModerator, moderatorId, deletedDiff))
+}
+
+func (s *adminService) RestoreModerator(actor *Actor, moderatorId *dto.QueryAdminRestoreModerator) error {
+	return s.repo.RestoreModerator(moderatorId.ModeratorId, actor.audit(models.AuditRestore, models.AuditedModerator, moderatorId.ModeratorId, restoredDiff))
 }
 
-func (s *adminService) GetModerators(dtoModerators *[]dto.ResponseAdminGetModerator) error {
+func (s *adminService) GetModerators(query *dto.QueryAdminGetModerators, dtoModerators *dto.ResponseList[dto.ResponseAdminGetModerator]) error {
 	var moderators []models.Moderator
+	var total int64
+
+	filter := repo.ModeratorListFilter{
+		Name:    query.Name,
+		Email:   query.Email,
+		Type:    common.ModeratorType(query.Type),
+		Deleted: query.Deleted,
+	}
+	spec := listSpec(&query.QueryList)
 
-	if err := s.repo.FindAllModerators(&moderators); err != nil {
+	if err := s.repo.FindAllModerators(&filter, spec, &moderators, &total); err != nil {
 		return err
 	}
 
-	*dtoModerators = make([]dto.ResponseAdminGetModerator, len(moderators))
+	*dtoModerators = listPage[dto.ResponseAdminGetModerator](spec, total, len(moderators))
 
 	for i, mod := range moderators {
-		(*dtoModerators)[i] = dto.ResponseAdminGetModerator{
+		dtoModerators.Items[i] = dto.ResponseAdminGetModerator{
 			ID:         mod.ID,
 			FirstName:  mod.FirstName,
 			SecondName: mod.SecondName,
 			LastName:   mod.LastName,
 			Email:      mod.Email,
 			Type:       mod.Type,
+			Version:    mod.Version,
 		}
 	}
 
 	return nil
 }
+
+func (s *adminService) UpdateModerator(actor *Actor, updateModerator *dto.RequestAdminUpdateModerator, updated *dto.ResponseUpdated) error {
+	moderator := models.Moderator{}
+
+	if err := s.repo.FindModeratorById(updateModerator.ModeratorId, &moderator); err != nil {
+		return err
+	}
+
+	if moderator.Version != updateModerator.Version {
+		return repo.ErrVersionConflict
+	}
+
+	changes := newChangeSet()
+	setField(changes, "first_name", moderator.FirstName, updateModerator.FirstName)
+	setField(changes, "second_name", moderator.SecondName, updateModerator.SecondName)
+	setField(changes, "last_name", moderator.LastName, updateModerator.LastName)
+	setField(changes, "email", moderator.Email, updateModerator.Email)
+
+	if updateModerator.Type != nil {
+		moderatorType := common.ModeratorType(*updateModerator.Type)
+		setField(changes, "type", moderator.Type, &moderatorType)
+	}
+
+	updated.Version = moderator.Version
+
+	if changes.empty() {
+		return nil
+	}
+
+	change := changes.record(models.ChangedModerator, moderator.ID, moderator.Version, actor.ID)
+
+	if err := s.repo.UpdateModerator(moderator.ID, moderator.Version, changes.updates, change,
+		actor.audit(models.AuditUpdate, models.AuditedModerator, moderator.ID, changes.diff())); err != nil {
+		return err
+	}
+
+	updated.Version = change.Version
+
+	return nil
+}
+
+func (s *adminService) GetModeratorChanges(moderatorId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error {
+	var changes []models.EntityChange
+
+	if err := s.repo.FindModeratorChanges(moderatorId.Id, &changes); err != nil {
+		return err
+	}
+
+	*dtoChanges = changesToDto(changes)
+
+	return nil
+}
+
+func (s *adminService) PurgeDoctor(actor *Actor, doctorId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error {
+	var references []repo.ReferenceCount
+
+	err := s.repo.PurgeDoctor(doctorId.Id, &references, actor.audit(models.AuditPurge, models.AuditedDoctor, doctorId.Id, auditDiff{}))
+	*dtoReferences = referencesToDto(references)
+
+	return err
+}
+
+func (s *adminService) PurgeCitizen(actor *Actor, citizenId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error {
+	var references []repo.ReferenceCount
+
+	err := s.repo.PurgeCitizen(citizenId.Id, &references, actor.audit(models.AuditPurge, models.AuditedCitizen, citizenId.Id, auditDiff{}))
+	*dtoReferences = referencesToDto(references)
+
+	return err
+}
+
+func (s *adminService) PurgePharmacy(actor *Actor, pharmacyId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error {
+	var references []repo.ReferenceCount
+
+	err := s.repo.PurgePharmacy(pharmacyId.Id, &references, actor.audit(models.AuditPurge, models.AuditedPharmacy, pharmacyId.Id, auditDiff{}))
+	*dtoReferences = referencesToDto(references)
+
+	return err
+}
+
+func (s *adminService) PurgeMedicament(actor *Actor, medicamentId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error {
+	var references []repo.ReferenceCount
+
+	err := s.repo.PurgeMedicament(medicamentId.Id, &references, actor.audit(models.AuditPurge, models.AuditedMedicament, medicamentId.Id, auditDiff{}))
+	*dtoReferences = referencesToDto(references)
+
+	return err
+}
+
+func (s *adminService) PurgeModerator(actor *Actor, moderatorId *dto.QueryAdminPurge, dtoReferences *[]dto.ResponseAdminReference) error {
+	var references []repo.ReferenceCount
+
+	err := s.repo.PurgeModerator(moderatorId.Id, &references, actor.audit(models.AuditPurge, models.AuditedModerator, moderatorId.Id, auditDiff{}))
+	*dtoReferences = referencesToDto(references)
+
+	return err
+}
+
+func referencesToDto(references []repo.ReferenceCount) []dto.ResponseAdminReference {
+	dtoReferences := make([]dto.ResponseAdminReference, len(references))
+	for i, reference := range references {
+		dtoReferences[i] = dto.ResponseAdminReference{
+			Table: reference.Table,
+			Count: reference.Count,
+		}
+	}
+	return dtoReferences
+}
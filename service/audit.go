@@ -0,0 +1,194 @@
+package service
+
+import (
+	"encoding/json"
+	"github.com/google/uuid"
+	"medico/dto"
+	"medico/models"
+	"medico/repo"
+)
+
+// Actor is who performs an audited action and the request it came with
+type Actor struct {
+	ID        uuid.UUID
+	Role      string
+	IP        string
+	RequestID string
+}
+
+const (
+	ActorAdmin               = "admin"
+	ActorDoctorModerator     = "moderator:doctor"
+	ActorPharmacyModerator   = "moderator:pharmacy"
+	ActorMedicamentModerator = "moderator:medicament"
+	ActorCitizenModerator    = "moderator:citizen"
+	ActorSystem              = "system"
+)
+
+// systemActor performs what the application schedules itself
+var systemActor = &Actor{Role: ActorSystem}
+
+type auditChange struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// auditDiff maps every field an action changed to its values before and after
+type auditDiff map[string]auditChange
+
+// setValues lists the values an action set, for records that keep no earlier values
+func setValues(fields map[string]interface{}) auditDiff {
+	diff := make(auditDiff, len(fields))
+	for field, value := range fields {
+		diff[field] = auditChange{After: changeValue(value)}
+	}
+	return diff
+}
+
+var (
+	deletedDiff  = auditDiff{"deleted": {Before: "false", After: "true"}}
+	restoredDiff = auditDiff{"deleted": {Before: "true", After: "false"}}
+)
+
+// audit builds the entry that records the action of the actor
+func (a *Actor) audit(action models.AuditAction, entityType models.AuditEntity, entityId uuid.UUID, diff auditDiff) *models.AuditEntry {
+	// the diff only holds strings, so it always marshals
+	encoded, _ := json.Marshal(diff)
+
+	return &models.AuditEntry{
+		ID:         uuid.New(),
+		ActorID:    a.ID,
+		ActorRole:  a.Role,
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityId,
+		Diff:       string(encoded),
+		IP:         a.IP,
+		RequestID:  a.RequestID,
+	}
+}
+
+const (
+	auditEntryMissing = "audit entry is missing"
+	auditChainBroken  = "audit entry does not follow the entry before it"
+	auditEntryAltered = "audit entry was changed after it was written"
+	// auditChainTruncated is reported when the log does not end at the entry the chain head points at
+	auditChainTruncated = "audit log does not end at the newest entry"
+)
+
+// auditVerifyBatch is how many entries are loaded at a time while verifying the chain
+const auditVerifyBatch = 1000
+
+type AuditService interface {
+	FindEntries(query *dto.QueryAdminGetAuditEntries, dtoEntries *dto.ResponseList[dto.ResponseAdminAuditEntry]) error
+	VerifyChain(result *dto.ResponseAdminAuditVerification) error
+}
+
+type auditService struct {
+	repo repo.AuditRepo
+}
+
+func NewAuditService() AuditService {
+	return &auditService{repo: repo.NewAuditRepo()}
+}
+
+func (s *auditService) FindEntries(query *dto.QueryAdminGetAuditEntries, dtoEntries *dto.ResponseList[dto.ResponseAdminAuditEntry]) error {
+	var entries []models.AuditEntry
+	var total int64
+
+	filter := repo.AuditListFilter{
+		ActorID:    query.ActorId,
+		ActorRole:  query.ActorRole,
+		Action:     models.AuditAction(query.Action),
+		EntityType: models.AuditEntity(query.EntityType),
+		EntityID:   query.EntityId,
+		From:       query.From,
+		To:         query.To,
+	}
+	spec := listSpec(&query.QueryList)
+
+	if err := s.repo.FindAuditEntries(&filter, spec, &entries, &total); err != nil {
+		return err
+	}
+
+	*dtoEntries = listPage[dto.ResponseAdminAuditEntry](spec, total, len(entries))
+
+	for i, entry := range entries {
+		dtoEntries.Items[i] = dto.ResponseAdminAuditEntry{
+			ID:         entry.ID,
+			Sequence:   entry.Sequence,
+			ActorId:    entry.ActorID,
+			ActorRole:  entry.ActorRole,
+			Action:     string(entry.Action),
+			EntityType: string(entry.EntityType),
+			EntityId:   entry.EntityID,
+			Diff:       json.RawMessage(entry.Diff),
+			IP:         entry.IP,
+			RequestId:  entry.RequestID,
+			CreatedAt:  entry.CreatedAt,
+			Hash:       entry.Hash,
+		}
+	}
+
+	return nil
+}
+
+// VerifyChain walks the audit log from the first entry and checks that every entry follows
+// the one before it and still has the hash it was written with. The last entry has to be the
+// one the chain head points at, otherwise entries were cut off the end.
+func (s *auditService) VerifyChain(result *dto.ResponseAdminAuditVerification) error {
+	head := models.AuditChainHead{}
+
+	if err := s.repo.FindAuditChainHead(&head); err != nil {
+		return err
+	}
+
+	*result = dto.ResponseAdminAuditVerification{Valid: true}
+	var sequence uint64
+	var hash string
+
+	for {
+		var entries []models.AuditEntry
+
+		if err := s.repo.FindAuditChain(sequence, auditVerifyBatch, &entries); err != nil {
+			return err
+		}
+
+		for i := range entries {
+			entry := &entries[i]
+
+			switch {
+			case entry.Sequence != sequence+1:
+				chainBroken(result, sequence+1, auditEntryMissing)
+			case entry.PrevHash != hash:
+				chainBroken(result, entry.Sequence, auditChainBroken)
+			case repo.AuditEntryHash(entry) != entry.Hash:
+				chainBroken(result, entry.Sequence, auditEntryAltered)
+			}
+
+			if !result.Valid {
+				return nil
+			}
+
+			sequence = entry.Sequence
+			hash = entry.Hash
+			result.Checked++
+		}
+
+		if len(entries) < auditVerifyBatch {
+			break
+		}
+	}
+
+	if sequence != head.Sequence || hash != head.Hash {
+		chainBroken(result, sequence+1, auditChainTruncated)
+	}
+
+	return nil
+}
+
+func chainBroken(result *dto.ResponseAdminAuditVerification, sequence uint64, reason string) {
+	result.Valid = false
+	result.BrokenAt = &sequence
+	result.Reason = reason
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"github.com/google/uuid"
+	"medico/dto"
+	"medico/models"
+	"time"
+)
+
+// minutesPerDay ends the hours of a branch that is open around the clock
+const minutesPerDay = 24 * 60
+
+// branchOpenAt tells whether a branch serves customers at the time. Hours that close before
+// they open run past midnight, so the hours of the day before can still keep it open.
+func branchOpenAt(branch *models.PharmacyBranch, at time.Time) bool {
+	switch branch.Status {
+	case models.BranchDecommissioned:
+		return false
+	case models.BranchTemporarilyClosed:
+		if branch.ClosedUntil == nil || at.Before(*branch.ClosedUntil) {
+			return false
+		}
+	}
+
+	minute := uint16(at.Hour()*60 + at.Minute())
+
+	if opens, closes, open := branchHoursOn(branch, at); open && opens <= minute && (minute < closes || closes < opens) {
+		return true
+	}
+
+	opens, closes, open := branchHoursOn(branch, at.AddDate(0, 0, -1))
+	return open && closes < opens && minute < closes
+}
+
+// branchHoursOn returns the hours a branch keeps on the date of day. A holiday set for the
+// date replaces the weekly hours of that day and a branch without weekly hours is open all
+// day. open is false when the branch does not open that day.
+func branchHoursOn(branch *models.PharmacyBranch, day time.Time) (opens, closes uint16, open bool) {
+	year, month, date := day.Date()
+
+	for _, holiday := range branch.Holidays {
+		holidayYear, holidayMonth, holidayDate := holiday.Date.Date()
+		if holidayYear == year && holidayMonth == month && holidayDate == date {
+			return holiday.Opens, holiday.Closes, !holiday.Closed
+		}
+	}
+
+	if len(branch.OpeningHours) == 0 {
+		return 0, minutesPerDay, true
+	}
+
+	for _, hours := range branch.OpeningHours {
+		if time.Weekday(hours.Weekday) == day.Weekday() {
+			return hours.Opens, hours.Closes, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// openingHoursToModel converts hours that already passed validation
+func openingHoursToModel(branchId uuid.UUID, hours []dto.RequestBranchOpeningHours) []models.PharmacyBranchOpeningHours {
+	openingHours := make([]models.PharmacyBranchOpeningHours, len(hours))
+
+	for i, day := range hours {
+		opens, _ := dto.ParseClock(day.Opens)
+		closes, _ := dto.ParseClock(day.Closes)
+
+		openingHours[i] = models.PharmacyBranchOpeningHours{
+			PharmacyBranchID: branchId,
+			Weekday:          models.WeekDay(day.Weekday),
+			Opens:            opens,
+			Closes:           closes,
+		}
+	}
+
+	return openingHours
+}
+
+func openingHoursToDto(hours []models.PharmacyBranchOpeningHours) []dto.ResponseBranchOpeningHours {
+	dtoHours := make([]dto.ResponseBranchOpeningHours, len(hours))
+
+	for i, day := range hours {
+		dtoHours[i] = dto.ResponseBranchOpeningHours{
+			Weekday: int(day.Weekday),
+			Opens:   dto.FormatClock(day.Opens),
+			Closes:  dto.FormatClock(day.Closes),
+		}
+	}
+
+	return dtoHours
+}
+
+func holidaysToDto(holidays []models.PharmacyBranchHoliday) []dto.ResponseBranchHoliday {
+	dtoHolidays := make([]dto.ResponseBranchHoliday, len(holidays))
+
+	for i, holiday := range holidays {
+		dtoHolidays[i] = dto.ResponseBranchHoliday{
+			Id:     holiday.ID,
+			Date:   holiday.Date,
+			Closed: holiday.Closed,
+			Note:   holiday.Note,
+		}
+
+		if !holiday.Closed {
+			dtoHolidays[i].Opens = dto.FormatClock(holiday.Opens)
+			dtoHolidays[i].Closes = dto.FormatClock(holiday.Closes)
+		}
+	}
+
+	return dtoHolidays
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"medico/models"
+	"testing"
+	"time"
+)
+
+func TestBranchOpenAt(t *testing.T) {
+	// 2026-03-02 is a Monday
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 2, hour, minute, 0, 0, time.UTC)
+	}
+	reopens := monday(12, 0)
+	weekdays := []models.PharmacyBranchOpeningHours{
+		{Weekday: models.WeekDay(time.Monday), Opens: 8 * 60, Closes: 20 * 60},
+	}
+	overnight := []models.PharmacyBranchOpeningHours{
+		{Weekday: models.WeekDay(time.Sunday), Opens: 20 * 60, Closes: 2 * 60},
+		{Weekday: models.WeekDay(time.Monday), Opens: 22 * 60, Closes: 6 * 60},
+	}
+
+	tests := []struct {
+		name   string
+		branch models.PharmacyBranch
+		at     time.Time
+		open   bool
+	}{
+		{
+			name:   "no hours configured",
+			branch: models.PharmacyBranch{Status: models.BranchOpen},
+			at:     monday(3, 0),
+			open:   true,
+		},
+		{
+			name:   "within the hours",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: weekdays},
+			at:     monday(8, 0),
+			open:   true,
+		},
+		{
+			name:   "at closing time",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: weekdays},
+			at:     monday(20, 0),
+			open:   false,
+		},
+		{
+			name:   "day without hours",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: weekdays},
+			at:     monday(10, 0).AddDate(0, 0, 1),
+			open:   false,
+		},
+		{
+			name:   "overnight before midnight",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: overnight},
+			at:     monday(23, 30),
+			open:   true,
+		},
+		{
+			name:   "overnight after midnight",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: overnight},
+			at:     monday(1, 30),
+			open:   true,
+		},
+		{
+			name:   "after overnight hours end",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: overnight},
+			at:     monday(2, 0),
+			open:   false,
+		},
+		{
+			name:   "overnight into a day without hours",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: overnight},
+			at:     monday(5, 0).AddDate(0, 0, 1),
+			open:   true,
+		},
+		{
+			name: "closed holiday",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: weekdays, Holidays: []models.PharmacyBranchHoliday{
+				{Date: monday(0, 0), Closed: true},
+			}},
+			at:   monday(10, 0),
+			open: false,
+		},
+		{
+			name: "holiday hours",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, OpeningHours: weekdays, Holidays: []models.PharmacyBranchHoliday{
+				{Date: monday(0, 0), Opens: 6 * 60, Closes: 7 * 60},
+			}},
+			at:   monday(6, 30),
+			open: true,
+		},
+		{
+			name: "holiday without weekly hours",
+			branch: models.PharmacyBranch{Status: models.BranchOpen, Holidays: []models.PharmacyBranchHoliday{
+				{Date: monday(0, 0), Closed: true},
+			}},
+			at:   monday(10, 0),
+			open: false,
+		},
+		{
+			name:   "temporarily closed",
+			branch: models.PharmacyBranch{Status: models.BranchTemporarilyClosed, ClosedUntil: &reopens},
+			at:     monday(11, 0),
+			open:   false,
+		},
+		{
+			name:   "reopened",
+			branch: models.PharmacyBranch{Status: models.BranchTemporarilyClosed, ClosedUntil: &reopens},
+			at:     monday(12, 0),
+			open:   true,
+		},
+		{
+			name:   "decommissioned",
+			branch: models.PharmacyBranch{Status: models.BranchDecommissioned},
+			at:     monday(10, 0),
+			open:   false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if open := branchOpenAt(&test.branch, test.at); open != test.open {
+				t.Errorf("branchOpenAt() = %v, want %v", open, test.open)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"medico/dto"
+	"medico/models"
+	"time"
+)
+
+// changeSet collects the columns a partial update changes together with the old and new
+// values that end up in the change history.
+type changeSet struct {
+	updates map[string]interface{}
+	fields  []models.EntityChangeField
+}
+
+func newChangeSet() *changeSet {
+	return &changeSet{updates: map[string]interface{}{}}
+}
+
+// setField records column as changed when value is set and differs from current
+func setField[T comparable](c *changeSet, column string, current T, value *T) {
+	if value == nil || *value == current {
+		return
+	}
+
+	c.set(column, current, *value)
+}
+
+func (c *changeSet) set(column string, oldValue, newValue interface{}) {
+	c.updates[column] = newValue
+	c.fields = append(c.fields, models.EntityChangeField{
+		ID:       uuid.New(),
+		Field:    column,
+		OldValue: changeValue(oldValue),
+		NewValue: changeValue(newValue),
+	})
+}
+
+func (c *changeSet) changed(column string) bool {
+	_, ok := c.updates[column]
+	return ok
+}
+
+func (c *changeSet) empty() bool {
+	return len(c.updates) == 0
+}
+
+// record builds the history entry of the update that moves the entity past version
+func (c *changeSet) record(entityType models.ChangedEntity, entityId uuid.UUID, version uint, changedBy uuid.UUID) *models.EntityChange {
+	return &models.EntityChange{
+		ID:         uuid.New(),
+		EntityType: entityType,
+		EntityID:   entityId,
+		Version:    version + 1,
+		ChangedBy:  changedBy,
+		ChangedAt:  time.Now(),
+		Fields:     c.fields,
+	}
+}
+
+// diff is the audit form of the changed fields
+func (c *changeSet) diff() auditDiff {
+	diff := make(auditDiff, len(c.fields))
+	for _, field := range c.fields {
+		diff[field.Field] = auditChange{Before: field.OldValue, After: field.NewValue}
+	}
+	return diff
+}
+
+// valueOr returns the value a partial update sets, or current when it leaves the field alone
+func valueOr[T any](value *T, current T) T {
+	if value == nil {
+		return current
+	}
+	return *value
+}
+
+func changeValue(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.DateOnly)
+	}
+	return fmt.Sprint(value)
+}
+
+func changesToDto(changes []models.EntityChange) []dto.ResponseChange {
+	dtoChanges := make([]dto.ResponseChange, len(changes))
+
+	for i, change := range changes {
+		fields := make([]dto.ResponseChangeField, len(change.Fields))
+		for j, field := range change.Fields {
+			fields[j] = dto.ResponseChangeField{
+				Field:    field.Field,
+				OldValue: field.OldValue,
+				NewValue: field.NewValue,
+			}
+		}
+
+		dtoChanges[i] = dto.ResponseChange{
+			Version:   change.Version,
+			ChangedBy: change.ChangedBy,
+			ChangedAt: change.ChangedAt,
+			Fields:    fields,
+		}
+	}
+
+	return dtoChanges
+}
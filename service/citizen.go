@@ -2,11 +2,14 @@ package service
 
 import (
 	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
 	"golang.org/x/crypto/bcrypt"
+	"medico/config"
 	"medico/dto"
 	"medico/models"
 	"medico/repo"
 	"medico/session"
+	"sort"
 	"time"
 )
 
@@ -18,19 +21,35 @@ type CitizenService interface {
 
 	GetMedicalInfo(citizenId uuid.UUID, medicalInfo *dto.ResponseCitizenMedicalInfo) error
 	GetPersonalDoctor(citizenId uuid.UUID, doctor *dto.ResponseCitizenPersonalDoctor) error
-	FindAllAvailablePharmacies(prescriptionId *dto.QueryCitizenAvailablePharmacyGet, availablePharmacies *[]dto.ResponseCitizenAvailablePharmacy) error
+	FindAllAvailablePharmacies(citizenId uuid.UUID, query *dto.QueryCitizenAvailablePharmacyGet, availablePharmacies *[]dto.ResponseCitizenAvailablePharmacy) error
+	FindMedicamentAvailability(query *dto.QueryCitizenMedicamentAvailability, availability *[]dto.ResponseCitizenMedicamentAvailability) error
+	ReserveStock(citizenId uuid.UUID, request *dto.RequestCitizenNewReservation, reservationDto *dto.ResponseReservation) error
+	ListReservations(citizenId uuid.UUID, reservationsDto *[]dto.ResponseReservation) error
+	CancelReservation(citizenId uuid.UUID, request *dto.RequestCitizenCancelReservation) error
 	ListPrescriptions(citizenId uuid.UUID, prescriptionsDto *[]dto.ResponseCitizenPrescription) error
+	GetPrescriptionVerification(citizenId uuid.UUID, query *dto.QueryCitizenPrescriptionVerification, verificationDto *dto.ResponseCitizenPrescriptionVerification) error
+	GetPrescriptionQr(citizenId uuid.UUID, query *dto.QueryCitizenPrescriptionVerification) ([]byte, error)
+	GetPrescriptionPdf(citizenId, prescriptionId uuid.UUID) ([]byte, error)
+	GetPrescriptionHistory(citizenId uuid.UUID, query *dto.QueryCitizenGetPrescriptionHistory, historyDto *[]dto.ResponsePrescriptionVersion) error
+	FindHospitals(query *dto.QueryCitizenGetHospitals, hospitalsDto *[]dto.ResponseHospital) error
+	FindDoctorsByHospital(query *dto.QueryCitizenGetDoctorsByHospital, doctorsDto *[]dto.ResponseCitizenHospitalDoctor) error
 }
 
 type citizenService struct {
-	authSession session.AuthSession
-	citizenRepo repo.CitizenRepo
+	authSession        session.AuthSession
+	citizenRepo        repo.CitizenRepo
+	reservationRepo    repo.ReservationRepo
+	prescriptionConfig *config.PrescriptionConfig
+	stockConfig        *config.StockConfig
 }
 
 func NewCitizenService() CitizenService {
 	return &citizenService{
-		authSession: session.NewAuthSession("citizen"),
-		citizenRepo: repo.NewCitizenRepo(),
+		authSession:        session.NewAuthSession("citizen"),
+		citizenRepo:        repo.NewCitizenRepo(),
+		reservationRepo:    repo.NewReservationRepo(),
+		prescriptionConfig: config.LoadPrescriptionConfig(),
+		stockConfig:        config.LoadStockConfig(),
 	}
 }
 
@@ -97,25 +116,236 @@ func (c *citizenService) GetPersonalDoctor(citizenId uuid.UUID, doctorDto *dto.R
 	return nil
 }
 
-func (c *citizenService) FindAllAvailablePharmacies(prescriptionId *dto.QueryCitizenAvailablePharmacyGet, availablePharmacies *[]dto.ResponseCitizenAvailablePharmacy) error {
-	branches := new([]models.PharmacyBranch)
+// FindAllAvailablePharmacies lists the open pharmacies within the radius around the citizen,
+// nearest first, with how much of the prescription each can dispense
+func (c *citizenService) FindAllAvailablePharmacies(citizenId uuid.UUID, query *dto.QueryCitizenAvailablePharmacyGet, availablePharmacies *[]dto.ResponseCitizenAvailablePharmacy) error {
+	prescription := models.Prescription{}
+
+	if err := c.findOwnPrescription(citizenId, query.PrescriptionId, &prescription); err != nil {
+		return err
+	}
+
+	nearby := new([]nearbyPharmacy)
 
-	if err := c.citizenRepo.FindAvailablePharmacies(prescriptionId.PrescriptionId, branches); err != nil {
+	if err := c.findOpenPharmaciesNear(query.Latitude, query.Longitude, query.Radius, nearby); err != nil {
 		return err
 	}
-	*availablePharmacies = make([]dto.ResponseCitizenAvailablePharmacy, len(*branches))
 
-	for i, branch := range *branches {
+	*availablePharmacies = make([]dto.ResponseCitizenAvailablePharmacy, len(*nearby))
+	branchIds := make([]uuid.UUID, len(*nearby))
+
+	for i, pharmacy := range *nearby {
 		(*availablePharmacies)[i] = dto.ResponseCitizenAvailablePharmacy{
-			Name:      branch.Name,
-			Latitude:  branch.Latitude,
-			Longitude: branch.Longitude,
+			Id:        pharmacy.Branch.ID,
+			Name:      pharmacy.Branch.Name,
+			Address:   pharmacy.Branch.Address,
+			Latitude:  pharmacy.Branch.Latitude,
+			Longitude: pharmacy.Branch.Longitude,
+			Distance:  pharmacy.Distance,
+		}
+		branchIds[i] = pharmacy.Branch.ID
+	}
+
+	var openLines int64
+	coverage := new([]repo.BranchStockCoverage)
+
+	if err := c.citizenRepo.FindPrescriptionStockCoverage(prescription.ID, branchIds, time.Now(), &openLines, coverage); err != nil {
+		return err
+	}
+
+	coveredLines := make(map[uuid.UUID]int, len(*coverage))
+	for _, branch := range *coverage {
+		coveredLines[branch.PharmacyBranchID] = int(branch.CoveredLines)
+	}
+
+	for i := range *availablePharmacies {
+		pharmacy := &(*availablePharmacies)[i]
+		pharmacy.CoveredLines = coveredLines[pharmacy.Id]
+		pharmacy.TotalLines = int(openLines)
+
+		switch {
+		case pharmacy.CoveredLines == 0:
+			pharmacy.Coverage = dto.CoverageNone
+		case pharmacy.CoveredLines < pharmacy.TotalLines:
+			pharmacy.Coverage = dto.CoverageSome
+		default:
+			pharmacy.Coverage = dto.CoverageAll
+		}
+	}
+
+	return nil
+}
+
+// FindMedicamentAvailability lists the over the counter medicaments matching the search with
+// how much of each the open pharmacies around the citizen have, nearest first
+func (c *citizenService) FindMedicamentAvailability(query *dto.QueryCitizenMedicamentAvailability, availability *[]dto.ResponseCitizenMedicamentAvailability) error {
+	medicaments := new([]models.Medicament)
+
+	if err := c.citizenRepo.FindOverTheCounterMedicaments(query.Search, medicamentSearchLimit, medicaments); err != nil {
+		return err
+	}
+
+	nearby := new([]nearbyPharmacy)
+
+	if err := c.findOpenPharmaciesNear(query.Latitude, query.Longitude, query.Radius, nearby); err != nil {
+		return err
+	}
+
+	branchIds := make([]uuid.UUID, len(*nearby))
+	for i, pharmacy := range *nearby {
+		branchIds[i] = pharmacy.Branch.ID
+	}
+
+	medicamentIds := make([]uuid.UUID, len(*medicaments))
+	for i, medicament := range *medicaments {
+		medicamentIds[i] = medicament.ID
+	}
+
+	storage := new([]models.PharmacyBranchStorage)
+
+	if err := c.citizenRepo.FindBranchStock(branchIds, medicamentIds, time.Now(), storage); err != nil {
+		return err
+	}
+
+	type stockKey struct{ branchId, medicamentId uuid.UUID }
+	quantities := make(map[stockKey]uint, len(*storage))
+	for _, item := range *storage {
+		if item.Quantity > item.Reserved {
+			quantities[stockKey{item.PharmacyBranchID, item.MedicamentID}] += item.Quantity - item.Reserved
+		}
+	}
+
+	*availability = make([]dto.ResponseCitizenMedicamentAvailability, len(*medicaments))
+
+	for i, medicament := range *medicaments {
+		pharmacies := make([]dto.ResponseMedicamentPharmacyStock, len(*nearby))
+
+		for j, pharmacy := range *nearby {
+			pharmacies[j] = dto.ResponseMedicamentPharmacyStock{
+				Id:        pharmacy.Branch.ID,
+				Name:      pharmacy.Branch.Name,
+				Address:   pharmacy.Branch.Address,
+				Latitude:  pharmacy.Branch.Latitude,
+				Longitude: pharmacy.Branch.Longitude,
+				Distance:  pharmacy.Distance,
+				Stock:     c.stockLevel(quantities[stockKey{pharmacy.Branch.ID, medicament.ID}]),
+			}
+		}
+
+		(*availability)[i] = dto.ResponseCitizenMedicamentAvailability{
+			Id:                medicament.ID,
+			OfficialName:      medicament.OfficialName,
+			BulgarianName:     medicament.BulgarianName,
+			ATC:               medicament.ATC,
+			ActiveIngredients: medicament.ActiveIngredients,
+			Pharmacies:        pharmacies,
 		}
 	}
 
 	return nil
 }
 
+// ReserveStock holds the stock of the citizen's prescription at the branch for the configured
+// time, after which it is released for others
+func (c *citizenService) ReserveStock(citizenId uuid.UUID, request *dto.RequestCitizenNewReservation, reservationDto *dto.ResponseReservation) error {
+	prescription := models.Prescription{}
+
+	if err := c.findOwnPrescription(citizenId, request.PrescriptionId, &prescription); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reservation := models.StockReservation{
+		ID:               uuid.New(),
+		PrescriptionID:   prescription.ID,
+		CitizenID:        citizenId,
+		PharmacyBranchID: request.BranchId,
+		Status:           models.ReservationActive,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(c.stockConfig.ReservationHold),
+	}
+
+	if err := c.reservationRepo.CreateReservation(&reservation, request.MedicamentIds); err != nil {
+		return err
+	}
+
+	if err := c.reservationRepo.FindReservationById(reservation.ID, &reservation); err != nil {
+		return err
+	}
+
+	reservationToDto(&reservation, now, reservationDto)
+
+	return nil
+}
+
+func (c *citizenService) ListReservations(citizenId uuid.UUID, reservationsDto *[]dto.ResponseReservation) error {
+	reservations := new([]models.StockReservation)
+
+	if err := c.reservationRepo.FindReservationsByCitizenId(citizenId, reservations); err != nil {
+		return err
+	}
+
+	reservationsToDto(*reservations, reservationsDto)
+
+	return nil
+}
+
+func (c *citizenService) CancelReservation(citizenId uuid.UUID, request *dto.RequestCitizenCancelReservation) error {
+	return c.reservationRepo.CancelReservation(citizenId, request.ReservationId, time.Now())
+}
+
+// stockLevel buckets a quantity so citizens see whether a pharmacy has a medicament but not
+// how much of it
+func (c *citizenService) stockLevel(quantity uint) string {
+	switch {
+	case quantity == 0:
+		return dto.StockOut
+	case quantity <= c.stockConfig.LowStockThreshold:
+		return dto.StockLow
+	default:
+		return dto.StockAvailable
+	}
+}
+
+// nearbyPharmacy is a branch found around the citizen with its distance from them in kilometres
+type nearbyPharmacy struct {
+	Branch   models.PharmacyBranch
+	Distance float64
+}
+
+// findOpenPharmaciesNear finds the branches open now within radius kilometres of the point,
+// nearest first. A radius of zero searches the default radius.
+func (c *citizenService) findOpenPharmaciesNear(latitude, longitude, radius float32, pharmacies *[]nearbyPharmacy) error {
+	radiusKm := float64(radius)
+	if radiusKm == 0 {
+		radiusKm = defaultSearchRadiusKm
+	}
+
+	branches := new([]models.PharmacyBranch)
+	now := time.Now()
+
+	if err := c.citizenRepo.FindPharmaciesInArea(areaAround(float64(latitude), float64(longitude), radiusKm), now, branches); err != nil {
+		return err
+	}
+
+	*pharmacies = make([]nearbyPharmacy, 0, len(*branches))
+
+	for _, branch := range *branches {
+		distance := distanceKm(float64(latitude), float64(longitude), float64(branch.Latitude), float64(branch.Longitude))
+		if distance > radiusKm || !branchOpenAt(&branch, now) {
+			continue
+		}
+
+		*pharmacies = append(*pharmacies, nearbyPharmacy{Branch: branch, Distance: distance})
+	}
+
+	sort.SliceStable(*pharmacies, func(i, j int) bool {
+		return (*pharmacies)[i].Distance < (*pharmacies)[j].Distance
+	})
+
+	return nil
+}
+
 func (c *citizenService) ListPrescriptions(citizenId uuid.UUID, prescriptionsDto *[]dto.ResponseCitizenPrescription) error {
 	prescriptions := new([]models.Prescription)
 
@@ -130,7 +360,11 @@ func (c *citizenService) ListPrescriptions(citizenId uuid.UUID, prescriptionsDto
 			ID:        prescription.ID,
 			Name:      prescription.Name,
 			State:     string(prescription.State),
+			Version:   prescription.Version,
+			Code:      prescription.Code,
 			StartDate: prescription.StartDate,
+			Hospital:  hospitalToDto(prescription.Hospital),
+			Refills:   refillsToDto(&prescription),
 			Doctor: struct {
 				FirstName string `json:"firstName"`
 				LastName  string `json:"lastName"`
@@ -140,22 +374,131 @@ func (c *citizenService) ListPrescriptions(citizenId uuid.UUID, prescriptionsDto
 				LastName:  prescription.Doctor.LastName,
 				UIN:       prescription.Doctor.UIN,
 			},
-			Medicaments: make([]struct {
-				Name     string `json:"officialName"`
-				Quantity uint   `json:"quantity"`
-			}, len(prescription.Medicaments)),
+			Medicaments: make([]dto.ResponseCitizenPrescriptionMedicament, len(prescription.Medicaments)),
 		}
 
 		for i2, medicament := range prescription.Medicaments {
-			(*prescriptionsDto)[i].Medicaments[i2] = struct {
-				Name     string `json:"officialName"`
-				Quantity uint   `json:"quantity"`
-			}{
+			(*prescriptionsDto)[i].Medicaments[i2] = dto.ResponseCitizenPrescriptionMedicament{
 				Name:     medicament.Medicament.OfficialName,
 				Quantity: medicament.Quantity,
+				Dosage:   dosageToDto(&medicament),
 			}
 		}
 	}
 
 	return nil
 }
+
+func (c *citizenService) GetPrescriptionVerification(citizenId uuid.UUID, query *dto.QueryCitizenPrescriptionVerification, verificationDto *dto.ResponseCitizenPrescriptionVerification) error {
+	prescription := models.Prescription{}
+
+	if err := c.findOwnPrescription(citizenId, query.PrescriptionId, &prescription); err != nil {
+		return err
+	}
+
+	*verificationDto = dto.ResponseCitizenPrescriptionVerification{
+		Code:      prescription.Code,
+		QrPayload: signQrPayload(c.prescriptionConfig.VerificationSecret, prescription.ID, prescription.Code),
+	}
+
+	return nil
+}
+
+// GetPrescriptionQr renders the signed QR payload of the prescription as a PNG image
+func (c *citizenService) GetPrescriptionQr(citizenId uuid.UUID, query *dto.QueryCitizenPrescriptionVerification) ([]byte, error) {
+	prescription := models.Prescription{}
+
+	if err := c.findOwnPrescription(citizenId, query.PrescriptionId, &prescription); err != nil {
+		return nil, err
+	}
+
+	payload := signQrPayload(c.prescriptionConfig.VerificationSecret, prescription.ID, prescription.Code)
+
+	return qrcode.Encode(payload, qrcode.Medium, c.prescriptionConfig.QrSize)
+}
+
+func (c *citizenService) GetPrescriptionPdf(citizenId, prescriptionId uuid.UUID) ([]byte, error) {
+	prescription := models.Prescription{}
+	citizen := models.Citizen{}
+
+	if err := c.citizenRepo.FindPrescriptionForPrint(prescriptionId, &prescription, &citizen); err != nil {
+		return nil, err
+	}
+
+	if prescription.CitizenID != citizenId {
+		return nil, ErrPrescriptionNotOwned
+	}
+
+	payload := signQrPayload(c.prescriptionConfig.VerificationSecret, prescription.ID, prescription.Code)
+
+	return renderPrescriptionPdf(&prescription, &citizen, payload, c.prescriptionConfig.QrSize)
+}
+
+func (c *citizenService) findOwnPrescription(citizenId, prescriptionId uuid.UUID, prescription *models.Prescription) error {
+	if err := c.citizenRepo.FindPrescriptionById(prescriptionId, prescription); err != nil {
+		return err
+	}
+
+	if prescription.CitizenID != citizenId {
+		return ErrPrescriptionNotOwned
+	}
+
+	return nil
+}
+
+func (c *citizenService) GetPrescriptionHistory(citizenId uuid.UUID, query *dto.QueryCitizenGetPrescriptionHistory, historyDto *[]dto.ResponsePrescriptionVersion) error {
+	prescription := models.Prescription{}
+
+	if err := c.findOwnPrescription(citizenId, query.PrescriptionId, &prescription); err != nil {
+		return err
+	}
+
+	history := new([]models.Prescription)
+
+	if err := c.citizenRepo.FindPrescriptionHistory(query.PrescriptionId, history); err != nil {
+		return err
+	}
+
+	prescriptionHistoryToDto(*history, historyDto)
+
+	return nil
+}
+
+func (c *citizenService) FindHospitals(query *dto.QueryCitizenGetHospitals, hospitalsDto *[]dto.ResponseHospital) error {
+	hospitals := new([]models.Hospital)
+
+	if err := c.citizenRepo.FindHospitalsByCommonName(query.Name, hospitals); err != nil {
+		return err
+	}
+
+	*hospitalsDto = make([]dto.ResponseHospital, len(*hospitals))
+
+	for i := range *hospitals {
+		(*hospitalsDto)[i] = *hospitalToDto(&(*hospitals)[i])
+	}
+
+	return nil
+}
+
+func (c *citizenService) FindDoctorsByHospital(query *dto.QueryCitizenGetDoctorsByHospital, doctorsDto *[]dto.ResponseCitizenHospitalDoctor) error {
+	affiliations := new([]models.DoctorAffiliation)
+
+	if err := c.citizenRepo.FindDoctorAffiliationsByHospital(query.HospitalId, query.Name, time.Now(), affiliations); err != nil {
+		return err
+	}
+
+	*doctorsDto = make([]dto.ResponseCitizenHospitalDoctor, len(*affiliations))
+
+	for i, affiliation := range *affiliations {
+		(*doctorsDto)[i] = dto.ResponseCitizenHospitalDoctor{
+			ID:        affiliation.Doctor.ID,
+			FirstName: affiliation.Doctor.FirstName,
+			LastName:  affiliation.Doctor.LastName,
+			UIN:       affiliation.Doctor.UIN,
+			Role:      string(affiliation.Role),
+			Hospital:  *hospitalToDto(&affiliation.Hospital),
+		}
+	}
+
+	return nil
+}
@@ -1,12 +1,17 @@
 package service
 
 import (
+	"errors"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"medico/common"
+	"medico/config"
 	"medico/dto"
 	"medico/models"
 	"medico/repo"
 	"medico/session"
+	"strings"
 	"time"
 )
 
@@ -20,19 +25,27 @@ type DoctorService interface {
 	GetCitizenInfo(doctorId uuid.UUID, citizenUcn string, citizenDto *dto.ResponseDoctorCitizenInfo) error
 	GetCitizensViaCommonUCN(ucn string, citizensDto *[]dto.ResponseListOfCitizensViaCommonUCN) error
 	GetCitizensPrescriptions(doctorId, citizenId uuid.UUID, citizenPrescriptionDto *[]dto.ResponseDoctorGetCitizenPrescription) error
-	CreatePrescription(doctorId uuid.UUID, newPrescriptionDto *dto.RequestDoctorCreatePrescription) error
+	CreatePrescription(doctorId uuid.UUID, newPrescriptionDto *dto.RequestDoctorCreatePrescription, blockedDto *[]dto.ResponseDoctorBlockedMedicament, createdDto *dto.ResponseDoctorCreatedPrescription) error
+	CancelRefills(doctorId uuid.UUID, cancelDto *dto.RequestDoctorCancelRefills) error
+	RevokePrescription(doctorId uuid.UUID, revokeDto *dto.RequestDoctorRevokePrescription) error
+	AmendPrescription(doctorId uuid.UUID, amendDto *dto.RequestDoctorAmendPrescription, blockedDto *[]dto.ResponseDoctorBlockedMedicament) error
+	GetPrescriptionHistory(query *dto.QueryDoctorGetPrescriptionHistory, historyDto *[]dto.ResponsePrescriptionVersion) error
+	GetPrescriptionPdf(doctorId, prescriptionId uuid.UUID) ([]byte, error)
 	GetMedicamentByCommonName(commonName *dto.QueryDoctorGetMedicamentByCommonName, medicaments *[]dto.ResponseDoctorGetMedicamentPrescription) error
+	GetAffiliations(doctorId uuid.UUID, affiliationsDto *[]dto.ResponseDoctorAffiliation) error
 }
 
 type doctorService struct {
-	authSession session.AuthSession
-	repo        repo.DoctorRepo
+	authSession        session.AuthSession
+	repo               repo.DoctorRepo
+	prescriptionConfig *config.PrescriptionConfig
 }
 
 func NewDoctorService() DoctorService {
 	return &doctorService{
-		authSession: session.NewAuthSession("doctor"),
-		repo:        repo.NewDoctorRepo()}
+		authSession:        session.NewAuthSession("doctor"),
+		repo:               repo.NewDoctorRepo(),
+		prescriptionConfig: config.LoadPrescriptionConfig()}
 }
 
 func (d *doctorService) AuthenticateByEmailAndPassword(email string, password string, doctorAuth *models.DoctorAuth) error {
@@ -90,22 +103,20 @@ func (d *doctorService) GetCitizensPrescriptions(doctorId, citizenId uuid.UUID,
 			Id:          prescription.ID,
 			Name:        prescription.Name,
 			State:       string(prescription.State),
+			Version:     prescription.Version,
+			Hospital:    hospitalToDto(prescription.Hospital),
+			Refills:     refillsToDto(&prescription),
 			CreatedDate: prescription.CreationDate,
 			StartDate:   prescription.StartDate,
 			EndDate:     prescription.EndDate,
 		}
 
-		(*citizenPrescriptionDto)[i].Medicaments = []struct {
-			OfficialName string `json:"officialName"`
-			Quantity     uint   `json:"quantity"`
-		}(make([]struct {
-			OfficialName string
-			Quantity     uint
-		}, len(prescription.Medicaments)))
+		(*citizenPrescriptionDto)[i].Medicaments = make([]dto.ResponseDoctorCitizenPrescriptionMedicament, len(prescription.Medicaments))
 
 		for k, medicament := range prescription.Medicaments {
 			(*citizenPrescriptionDto)[i].Medicaments[k].OfficialName = medicament.Medicament.OfficialName
 			(*citizenPrescriptionDto)[i].Medicaments[k].Quantity = medicament.Quantity
+			(*citizenPrescriptionDto)[i].Medicaments[k].Dosage = dosageToDto(&medicament)
 		}
 	}
 
@@ -133,30 +144,236 @@ func (d *doctorService) GetCitizensViaCommonUCN(ucn string, citizensDto *[]dto.R
 	return nil
 }
 
-func (d *doctorService) CreatePrescription(doctorId uuid.UUID, newPrescriptionDto *dto.RequestDoctorCreatePrescription) error {
+func (d *doctorService) CreatePrescription(doctorId uuid.UUID, newPrescriptionDto *dto.RequestDoctorCreatePrescription, blockedDto *[]dto.ResponseDoctorBlockedMedicament, createdDto *dto.ResponseDoctorCreatedPrescription) error {
+	newPrescription := models.Prescription{}
+
+	if err := d.buildPrescription(doctorId, newPrescriptionDto, blockedDto, &newPrescription); err != nil {
+		return err
+	}
+
+	newPrescription.CitizenID = newPrescriptionDto.CitizenId
+	newPrescription.RootID = newPrescription.ID
+	newPrescription.Version = 1
+
+	err := storeWithUniqueCode(&newPrescription, func() error {
+		if err := d.signPrescription(&newPrescription); err != nil {
+			return err
+		}
+
+		return d.repo.CreatePrescription(&newPrescription)
+	})
+	if err != nil {
+		return err
+	}
+
+	*createdDto = dto.ResponseDoctorCreatedPrescription{
+		Id:   newPrescription.ID,
+		Code: newPrescription.Code,
+	}
+
+	return nil
+}
+
+func (d *doctorService) RevokePrescription(doctorId uuid.UUID, revokeDto *dto.RequestDoctorRevokePrescription) error {
+	if err := d.verifyIssuingDoctor(doctorId, revokeDto.PrescriptionId, &models.Prescription{}); err != nil {
+		return err
+	}
+
+	return d.repo.RevokePrescription(revokeDto.PrescriptionId, revokeDto.Reason)
+}
+
+func (d *doctorService) AmendPrescription(doctorId uuid.UUID, amendDto *dto.RequestDoctorAmendPrescription, blockedDto *[]dto.ResponseDoctorBlockedMedicament) error {
+	previous := models.Prescription{}
+
+	if err := d.verifyIssuingDoctor(doctorId, amendDto.PrescriptionId, &previous); err != nil {
+		return err
+	}
+
+	amended := models.Prescription{}
+
+	if err := d.buildPrescription(doctorId, &amendDto.RequestDoctorCreatePrescription, blockedDto, &amended); err != nil {
+		return err
+	}
+
+	amended.CitizenID = previous.CitizenID
+	amended.RootID = previous.RootID
+	amended.Version = previous.Version + 1
+	amended.PreviousVersionID = &previous.ID
+	amended.AmendmentReason = amendDto.Reason
+
+	return storeWithUniqueCode(&amended, func() error {
+		if err := d.signPrescription(&amended); err != nil {
+			return err
+		}
+
+		return d.repo.AmendPrescription(previous.ID, &amended)
+	})
+}
+
+func (d *doctorService) GetPrescriptionHistory(query *dto.QueryDoctorGetPrescriptionHistory, historyDto *[]dto.ResponsePrescriptionVersion) error {
+	history := new([]models.Prescription)
+
+	if err := d.repo.FindPrescriptionHistory(query.PrescriptionId, history); err != nil {
+		return err
+	}
+
+	prescriptionHistoryToDto(*history, historyDto)
+
+	return nil
+}
+
+// GetPrescriptionPdf renders a prescription for printing, only for the doctor who issued it
+func (d *doctorService) GetPrescriptionPdf(doctorId, prescriptionId uuid.UUID) ([]byte, error) {
+	prescription := models.Prescription{}
+	citizen := models.Citizen{}
+
+	if err := d.verifyIssuingDoctor(doctorId, prescriptionId, &prescription); err != nil {
+		return nil, err
+	}
+
+	if err := d.repo.FindPrescriptionForPrint(prescription.ID, &prescription, &citizen); err != nil {
+		return nil, err
+	}
+
+	payload := signQrPayload(d.prescriptionConfig.VerificationSecret, prescription.ID, prescription.Code)
+
+	return renderPrescriptionPdf(&prescription, &citizen, payload, d.prescriptionConfig.QrSize)
+}
+
+func (d *doctorService) verifyIssuingDoctor(doctorId, prescriptionId uuid.UUID, prescription *models.Prescription) error {
+	if err := d.repo.FindPrescriptionById(prescriptionId, prescription); err != nil {
+		return err
+	}
+
+	if prescription.DoctorID != doctorId {
+		return ErrNotIssuingDoctor
+	}
+
+	return nil
+}
+
+// signPrescription signs the prescription with the active key of its doctor
+func (d *doctorService) signPrescription(prescription *models.Prescription) error {
+	key := models.DoctorSigningKey{}
+
+	if err := d.repo.FindActiveSigningKey(prescription.DoctorID, &key); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSigningKeyMissing
+		}
+		return err
+	}
+
+	return signPrescription(d.prescriptionConfig.SigningMasterKey, &key, prescription)
+}
+
+// buildPrescription checks that the doctor may issue the prescription and maps it onto a new
+// model. The citizen and version fields are left to the caller.
+func (d *doctorService) buildPrescription(doctorId uuid.UUID, newPrescriptionDto *dto.RequestDoctorCreatePrescription, blockedDto *[]dto.ResponseDoctorBlockedMedicament, prescription *models.Prescription) error {
+	doctor := models.Doctor{}
+
+	if err := d.repo.FindDoctorById(doctorId, &doctor); err != nil {
+		return err
+	}
+
+	if doctor.PrescribingBlocked {
+		return ErrPrescribingBlocked
+	}
+
+	if newPrescriptionDto.HospitalId != nil {
+		if err := d.verifyAffiliation(doctorId, *newPrescriptionDto.HospitalId); err != nil {
+			return err
+		}
+	}
+
+	if err := d.findRestrictedMedicaments(&doctor, newPrescriptionDto, blockedDto); err != nil {
+		return err
+	}
+
+	if len(*blockedDto) > 0 {
+		return ErrMedicamentRestricted
+	}
+
 	medicaments := make([]models.PrescriptionMedicament, len(newPrescriptionDto.Medicaments))
+	prescribed := make(map[uuid.UUID]bool, len(newPrescriptionDto.Medicaments))
 
 	for i, medicament := range newPrescriptionDto.Medicaments {
+		if prescribed[medicament.Id] {
+			return ErrMedicamentDuplicated
+		}
+		prescribed[medicament.Id] = true
+
 		medicaments[i] = models.PrescriptionMedicament{
+			LineID:       uuid.New(),
 			MedicamentID: medicament.Id,
 			Quantity:     medicament.Quantity,
 			Fulfilled:    false,
 		}
+
+		if dosage := medicament.Dosage; dosage != nil {
+			medicaments[i].DoseAmount = dosage.Amount
+			medicaments[i].DoseUnit = common.DoseUnit(dosage.Unit)
+			medicaments[i].TimesPerDay = dosage.TimesPerDay
+			medicaments[i].TimesOfDay = strings.Join(dosage.TimesOfDay, ",")
+			medicaments[i].DurationDays = dosage.DurationDays
+			medicaments[i].Route = common.AdministrationRoute(dosage.Route)
+			medicaments[i].Notes = dosage.Notes
+		}
 	}
 
-	newPrescription := models.Prescription{
+	code, err := generateVerificationCode()
+	if err != nil {
+		return err
+	}
+
+	// the signed form keeps whole seconds, which every database round trip preserves
+	now := time.Now().Truncate(time.Second)
+	startDate := now
+	if newPrescriptionDto.StartDate != nil && newPrescriptionDto.StartDate.After(now) {
+		startDate = newPrescriptionDto.StartDate.Truncate(time.Second)
+	}
+
+	*prescription = models.Prescription{
 		ID:           uuid.New(),
+		Code:         code,
 		DoctorID:     doctorId,
-		CitizenID:    newPrescriptionDto.CitizenId,
+		HospitalID:   newPrescriptionDto.HospitalId,
 		Medicaments:  medicaments,
 		State:        "active",
 		Name:         newPrescriptionDto.Name,
-		CreationDate: time.Now(),
-		StartDate:    time.Now(),
-		EndDate:      newPrescriptionDto.EndDate,
+		CreationDate: now,
+		StartDate:    startDate,
+		EndDate:      newPrescriptionDto.EndDate.Truncate(time.Second),
+
+		Refills:            newPrescriptionDto.Refills,
+		RefillIntervalDays: newPrescriptionDto.RefillIntervalDays,
+		WindowStartDate:    startDate,
+	}
+
+	if newPrescriptionDto.SubmissionId != "" {
+		prescription.SubmissionID = &newPrescriptionDto.SubmissionId
 	}
 
-	return d.repo.CreatePrescription(&newPrescription)
+	return nil
+}
+
+func (d *doctorService) CancelRefills(doctorId uuid.UUID, cancelDto *dto.RequestDoctorCancelRefills) error {
+	prescription := models.Prescription{}
+
+	if err := d.repo.FindPrescriptionById(cancelDto.PrescriptionId, &prescription); err != nil {
+		return err
+	}
+
+	if prescription.DoctorID != doctorId {
+		return ErrNotIssuingDoctor
+	}
+
+	if prescription.State != models.Active {
+		return repo.ErrPrescriptionNotActive
+	}
+
+	windowPending := prescription.WindowStartDate.After(time.Now())
+
+	return d.repo.CancelRefills(prescription.ID, windowPending)
 }
 
 func (d *doctorService) GetMedicamentByCommonName(commonName *dto.QueryDoctorGetMedicamentByCommonName, medicamentsDto *[]dto.ResponseDoctorGetMedicamentPrescription) error {
@@ -177,3 +394,91 @@ func (d *doctorService) GetMedicamentByCommonName(commonName *dto.QueryDoctorGet
 
 	return nil
 }
+
+func (d *doctorService) verifyAffiliation(doctorId, hospitalId uuid.UUID) error {
+	var affiliations []models.DoctorAffiliation
+
+	if err := d.repo.FindActiveAffiliations(doctorId, time.Now(), &affiliations); err != nil {
+		return err
+	}
+
+	for _, affiliation := range affiliations {
+		if affiliation.HospitalID == hospitalId {
+			return nil
+		}
+	}
+
+	return ErrDoctorNotAffiliated
+}
+
+func (d *doctorService) GetAffiliations(doctorId uuid.UUID, affiliationsDto *[]dto.ResponseDoctorAffiliation) error {
+	var affiliations []models.DoctorAffiliation
+
+	if err := d.repo.FindActiveAffiliations(doctorId, time.Now(), &affiliations); err != nil {
+		return err
+	}
+
+	*affiliationsDto = make([]dto.ResponseDoctorAffiliation, len(affiliations))
+
+	for i, affiliation := range affiliations {
+		(*affiliationsDto)[i] = dto.ResponseDoctorAffiliation{
+			ID:        affiliation.ID,
+			Hospital:  *hospitalToDto(&affiliation.Hospital),
+			Role:      string(affiliation.Role),
+			StartDate: affiliation.StartDate,
+			EndDate:   affiliation.EndDate,
+		}
+	}
+
+	return nil
+}
+
+// findRestrictedMedicaments collects the prescribed medicaments that are restricted to
+// specialties the doctor does not have.
+func (d *doctorService) findRestrictedMedicaments(doctor *models.Doctor, newPrescriptionDto *dto.RequestDoctorCreatePrescription, blockedDto *[]dto.ResponseDoctorBlockedMedicament) error {
+	medicamentIds := make([]uuid.UUID, len(newPrescriptionDto.Medicaments))
+	for i, medicament := range newPrescriptionDto.Medicaments {
+		medicamentIds[i] = medicament.Id
+	}
+
+	*blockedDto = make([]dto.ResponseDoctorBlockedMedicament, 0)
+
+	if len(medicamentIds) == 0 {
+		return nil
+	}
+
+	var medicaments []models.Medicament
+
+	if err := d.repo.FindMedicamentsWithRestrictions(medicamentIds, &medicaments); err != nil {
+		return err
+	}
+
+	doctorSpecialties := make(map[uuid.UUID]bool, len(doctor.Specialties))
+	for _, specialty := range doctor.Specialties {
+		doctorSpecialties[specialty.ID] = true
+	}
+
+	for _, medicament := range medicaments {
+		if len(medicament.RestrictedToSpecialties) == 0 {
+			continue
+		}
+
+		allowed := false
+		for _, specialty := range medicament.RestrictedToSpecialties {
+			if doctorSpecialties[specialty.ID] {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			*blockedDto = append(*blockedDto, dto.ResponseDoctorBlockedMedicament{
+				Id:                 medicament.ID,
+				OfficialName:       medicament.OfficialName,
+				AllowedSpecialties: specialtiesToDto(medicament.RestrictedToSpecialties),
+			})
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"medico/common"
+	"medico/dto"
+	"medico/models"
+	"strconv"
+	"strings"
+)
+
+var doseUnitNames = map[common.DoseUnit][2]string{
+	common.Tablet:      {"таблетка", "таблетки"},
+	common.Capsule:     {"капсула", "капсули"},
+	common.Millilitre:  {"мл", "мл"},
+	common.Milligram:   {"мг", "мг"},
+	common.Drop:        {"капка", "капки"},
+	common.Puff:        {"впръскване", "впръсквания"},
+	common.Sachet:      {"саше", "сашета"},
+	common.Application: {"апликация", "апликации"},
+	common.DosageUnit:  {"единица", "единици"},
+}
+
+var administrationRouteNames = map[common.AdministrationRoute]string{
+	common.OralRoute:          "през устата",
+	common.SublingualRoute:    "под езика",
+	common.TopicalRoute:       "върху кожата",
+	common.InhalationRoute:    "чрез инхалация",
+	common.NasalRoute:         "в носа",
+	common.OphthalmicRoute:    "в очите",
+	common.OticRoute:          "в ушите",
+	common.RectalRoute:        "ректално",
+	common.VaginalRoute:       "вагинално",
+	common.SubcutaneousRoute:  "подкожно",
+	common.IntramuscularRoute: "интрамускулно",
+	common.IntravenousRoute:   "интравенозно",
+}
+
+var timeOfDayNames = map[common.TimeOfDay]string{
+	common.Morning: "сутрин",
+	common.Noon:    "на обяд",
+	common.Evening: "вечер",
+	common.Bedtime: "преди лягане",
+}
+
+func splitTimesOfDay(timesOfDay string) []string {
+	if timesOfDay == "" {
+		return []string{}
+	}
+	return strings.Split(timesOfDay, ",")
+}
+
+func dosageToDto(medicament *models.PrescriptionMedicament) dto.ResponsePrescriptionDosage {
+	return dto.ResponsePrescriptionDosage{
+		Amount:       medicament.DoseAmount,
+		Unit:         string(medicament.DoseUnit),
+		TimesPerDay:  medicament.TimesPerDay,
+		TimesOfDay:   splitTimesOfDay(medicament.TimesOfDay),
+		DurationDays: medicament.DurationDays,
+		Route:        string(medicament.Route),
+		Notes:        medicament.Notes,
+		Sig:          formatSig(medicament),
+	}
+}
+
+// formatSig renders the dosage of a prescription line as a human-readable instruction in
+// Bulgarian, e.g. "Приема се по 1 таблетка 2 пъти дневно (сутрин, вечер) през устата в
+// продължение на 7 дни."
+func formatSig(medicament *models.PrescriptionMedicament) string {
+	if medicament.DoseAmount <= 0 {
+		return ""
+	}
+
+	var sig strings.Builder
+
+	amount := strings.Replace(strconv.FormatFloat(float64(medicament.DoseAmount), 'f', -1, 32), ".", ",", 1)
+	unitNames := doseUnitNames[medicament.DoseUnit]
+	unit := unitNames[1]
+	if medicament.DoseAmount == 1 {
+		unit = unitNames[0]
+	}
+
+	sig.WriteString(fmt.Sprintf("Приема се по %s %s", amount, unit))
+
+	switch medicament.TimesPerDay {
+	case 0:
+	case 1:
+		sig.WriteString(" веднъж дневно")
+	default:
+		sig.WriteString(fmt.Sprintf(" %d пъти дневно", medicament.TimesPerDay))
+	}
+
+	if timesOfDay := splitTimesOfDay(medicament.TimesOfDay); len(timesOfDay) > 0 {
+		names := make([]string, len(timesOfDay))
+		for i, timeOfDay := range timesOfDay {
+			names[i] = timeOfDayNames[common.TimeOfDay(timeOfDay)]
+		}
+		sig.WriteString(fmt.Sprintf(" (%s)", strings.Join(names, ", ")))
+	}
+
+	if route, ok := administrationRouteNames[medicament.Route]; ok {
+		sig.WriteString(" " + route)
+	}
+
+	switch medicament.DurationDays {
+	case 0:
+	case 1:
+		sig.WriteString(" в продължение на 1 ден")
+	default:
+		sig.WriteString(fmt.Sprintf(" в продължение на %d дни", medicament.DurationDays))
+	}
+
+	sig.WriteString(".")
+
+	if notes := strings.TrimSpace(medicament.Notes); notes != "" {
+		sig.WriteString(" " + notes)
+	}
+
+	return sig.String()
+}
@@ -0,0 +1,91 @@
+package service
+
+import "errors"
+
+const (
+	UinNotRegistered   = "uin is not present in the physician registry"
+	UinNameMismatch    = "doctor names do not match the physician registry"
+	UinLicenceInactive = "doctor licence is not active in the physician registry"
+	RegistryInvalidCsv = "physician registry csv is invalid"
+	RegistryEmpty      = "physician registry is empty, import it before rechecking licences"
+)
+
+const (
+	PrescribingBlocked         = "doctor is blocked from prescribing"
+	DoctorNotAffiliated        = "doctor is not affiliated with the hospital"
+	AffiliationEndsBeforeStart = "affiliation cannot end before it starts"
+	MedicamentRestricted       = "some medicaments may only be prescribed by other specialties"
+	MedicamentDuplicated       = "a medicament may be listed only once in a prescription"
+	NotIssuingDoctor           = "only the issuing doctor may change the prescription"
+	PrescriptionNotOwned       = "prescription belongs to another citizen"
+)
+
+const (
+	VerificationCodeInvalid = "prescription verification code is invalid"
+	QrPayloadInvalid        = "prescription qr code is invalid or was tampered with"
+	VerificationMissing     = "either a verification code or a qr payload is required"
+	PrescriptionRevoked     = "prescription was revoked by the issuing doctor"
+	PrescriptionSuperseded  = "prescription was replaced by an amended version"
+)
+
+var (
+	ErrUinNotRegistered   = errors.New(UinNotRegistered)
+	ErrUinNameMismatch    = errors.New(UinNameMismatch)
+	ErrUinLicenceInactive = errors.New(UinLicenceInactive)
+	ErrRegistryInvalidCsv = errors.New(RegistryInvalidCsv)
+	ErrRegistryEmpty      = errors.New(RegistryEmpty)
+)
+
+var (
+	ErrPrescribingBlocked         = errors.New(PrescribingBlocked)
+	ErrDoctorNotAffiliated        = errors.New(DoctorNotAffiliated)
+	ErrAffiliationEndsBeforeStart = errors.New(AffiliationEndsBeforeStart)
+	ErrMedicamentRestricted       = errors.New(MedicamentRestricted)
+	ErrMedicamentDuplicated       = errors.New(MedicamentDuplicated)
+	ErrNotIssuingDoctor           = errors.New(NotIssuingDoctor)
+	ErrPrescriptionNotOwned       = errors.New(PrescriptionNotOwned)
+)
+
+var (
+	ErrVerificationCodeInvalid = errors.New(VerificationCodeInvalid)
+	ErrQrPayloadInvalid        = errors.New(QrPayloadInvalid)
+	ErrVerificationMissing     = errors.New(VerificationMissing)
+	ErrPrescriptionRevoked     = errors.New(PrescriptionRevoked)
+	ErrPrescriptionSuperseded  = errors.New(PrescriptionSuperseded)
+)
+
+const (
+	SigningKeyMissing       = "doctor has no active signing key"
+	SigningKeyCorrupted     = "signing key cannot be opened with the configured master key"
+	SigningMasterKeyInvalid = "signing master key must be 32 base64 encoded bytes"
+	SigningKeyRevoked       = "prescription was signed with a revoked key"
+	PrescriptionUnsigned    = "prescription is not signed"
+	SignatureInvalid        = "prescription signature is invalid"
+)
+
+var (
+	ErrSigningKeyMissing       = errors.New(SigningKeyMissing)
+	ErrSigningKeyCorrupted     = errors.New(SigningKeyCorrupted)
+	ErrSigningMasterKeyInvalid = errors.New(SigningMasterKeyInvalid)
+	ErrSigningKeyRevoked       = errors.New(SigningKeyRevoked)
+	ErrPrescriptionUnsigned    = errors.New(PrescriptionUnsigned)
+	ErrSignatureInvalid        = errors.New(SignatureInvalid)
+)
+
+const (
+	FhirInvalidParameter = "invalid fhir search parameter"
+	FhirAccessDenied     = "fhir request is outside of what the user may access"
+)
+
+var (
+	ErrFhirInvalidParameter = errors.New(FhirInvalidParameter)
+	ErrFhirAccessDenied     = errors.New(FhirAccessDenied)
+)
+
+const (
+	RegistrationPasswordMismatch = "password does not match the one the registration was submitted with"
+)
+
+var (
+	ErrRegistrationPasswordMismatch = errors.New(RegistrationPasswordMismatch)
+)
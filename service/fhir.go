@@ -0,0 +1,989 @@
+package service
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"math"
+	"medico/common"
+	"medico/dto"
+	"medico/models"
+	"medico/repo"
+	"strings"
+	"time"
+)
+
+type FhirRole string
+
+const (
+	FhirDoctor     FhirRole = "doctor"
+	FhirCitizen    FhirRole = "citizen"
+	FhirPharmacist FhirRole = "pharmacist"
+)
+
+// fhirSubmissionIdentifierLength is as long as the identifier of a submission may be stored
+const fhirSubmissionIdentifierLength = 255
+
+// FhirAccess is the authenticated user a FHIR search runs for. Citizens only see their own
+// records, pharmacists see dispensable prescriptions and their branch's dispenses, and doctors
+// see everything, like the role APIs do.
+type FhirAccess struct {
+	Role FhirRole
+	ID   uuid.UUID
+}
+
+type FhirService interface {
+	SearchPatients(access FhirAccess, query *dto.QueryFhirPatientSearch, resources *[]dto.FhirResource, total *int64) error
+	SearchPractitioners(access FhirAccess, query *dto.QueryFhirPractitionerSearch, resources *[]dto.FhirResource, total *int64) error
+	SearchMedications(access FhirAccess, query *dto.QueryFhirMedicationSearch, resources *[]dto.FhirResource, total *int64) error
+	SearchMedicationRequests(access FhirAccess, query *dto.QueryFhirMedicationRequestSearch, resources *[]dto.FhirResource, total *int64) error
+	SearchMedicationDispenses(access FhirAccess, query *dto.QueryFhirMedicationDispenseSearch, resources *[]dto.FhirResource, total *int64) error
+	CreateMedicationRequests(access FhirAccess, submission *dto.RequestFhirSubmission, created *[]dto.FhirResource, existing *bool) error
+}
+
+type fhirService struct {
+	repo   repo.FhirRepo
+	doctor DoctorService
+}
+
+func NewFhirService() FhirService {
+	return &fhirService{
+		repo:   repo.NewFhirRepo(),
+		doctor: NewDoctorService(),
+	}
+}
+
+func (f *fhirService) SearchPatients(access FhirAccess, query *dto.QueryFhirPatientSearch, resources *[]dto.FhirResource, total *int64) error {
+	filter := repo.FhirCitizenFilter{
+		UCN:  parseFhirToken(query.Identifier),
+		Name: query.Name,
+	}
+
+	var err error
+	if filter.ID, err = parseFhirId("_id", query.Id); err != nil {
+		return err
+	}
+
+	if query.BirthDate != "" {
+		birthDate, err := parseFhirDate("birthdate", query.BirthDate)
+		if err != nil {
+			return err
+		}
+		filter.BirthDate = &birthDate.Date
+	}
+
+	switch query.Gender {
+	case "", string(models.Male), string(models.Female):
+		filter.Sex = query.Gender
+	default:
+		return fmt.Errorf("%w: gender", ErrFhirInvalidParameter)
+	}
+
+	switch access.Role {
+	case FhirCitizen:
+		if filter.ID != nil && *filter.ID != access.ID {
+			return ErrFhirAccessDenied
+		}
+		filter.ID = &access.ID
+	case FhirPharmacist:
+		if filter.ID == nil && filter.UCN == "" {
+			return fmt.Errorf("%w: pharmacists must search patients by identifier", ErrFhirAccessDenied)
+		}
+	}
+
+	var citizens []models.Citizen
+	if err := f.repo.FindCitizens(&filter, fhirPage(&query.QueryFhirPaging), &citizens, total); err != nil {
+		return err
+	}
+
+	*resources = make([]dto.FhirResource, len(citizens))
+	for i := range citizens {
+		(*resources)[i] = patientToFhir(&citizens[i])
+	}
+
+	return nil
+}
+
+func (f *fhirService) SearchPractitioners(_ FhirAccess, query *dto.QueryFhirPractitionerSearch, resources *[]dto.FhirResource, total *int64) error {
+	filter := repo.FhirDoctorFilter{
+		UIN:  parseFhirToken(query.Identifier),
+		Name: query.Name,
+	}
+
+	var err error
+	if filter.ID, err = parseFhirId("_id", query.Id); err != nil {
+		return err
+	}
+
+	var doctors []models.Doctor
+	if err := f.repo.FindDoctors(&filter, fhirPage(&query.QueryFhirPaging), &doctors, total); err != nil {
+		return err
+	}
+
+	*resources = make([]dto.FhirResource, len(doctors))
+	for i := range doctors {
+		(*resources)[i] = practitionerToFhir(&doctors[i])
+	}
+
+	return nil
+}
+
+func (f *fhirService) SearchMedications(_ FhirAccess, query *dto.QueryFhirMedicationSearch, resources *[]dto.FhirResource, total *int64) error {
+	filter := repo.FhirMedicamentFilter{
+		ATC: parseFhirToken(query.Code),
+	}
+
+	var err error
+	if filter.ID, err = parseFhirId("_id", query.Id); err != nil {
+		return err
+	}
+
+	var medicaments []models.Medicament
+	if err := f.repo.FindMedicaments(&filter, fhirPage(&query.QueryFhirPaging), &medicaments, total); err != nil {
+		return err
+	}
+
+	*resources = make([]dto.FhirResource, len(medicaments))
+	for i := range medicaments {
+		(*resources)[i] = medicationToFhir(&medicaments[i])
+	}
+
+	return nil
+}
+
+func (f *fhirService) SearchMedicationRequests(access FhirAccess, query *dto.QueryFhirMedicationRequestSearch, resources *[]dto.FhirResource, total *int64) error {
+	filter := repo.FhirPrescriptionLineFilter{}
+
+	var err error
+	if filter.LineID, err = parseFhirId("_id", query.Id); err != nil {
+		return err
+	}
+	if filter.CitizenID, err = parseFhirReference("patient", "Patient", query.Patient); err != nil {
+		return err
+	}
+	if filter.DoctorID, err = parseFhirReference("requester", "Practitioner", query.Requester); err != nil {
+		return err
+	}
+	if filter.MedicamentID, err = parseFhirReference("medication", "Medication", query.Medication); err != nil {
+		return err
+	}
+	if query.AuthoredOn != "" {
+		if filter.AuthoredOn, err = parseFhirDate("authoredon", query.AuthoredOn); err != nil {
+			return err
+		}
+	}
+	if query.Status != "" {
+		for _, status := range strings.Split(query.Status, ",") {
+			state, ok := fhirRequestStates[status]
+			if !ok {
+				return fmt.Errorf("%w: status", ErrFhirInvalidParameter)
+			}
+			filter.States = append(filter.States, state)
+		}
+	}
+
+	switch access.Role {
+	case FhirCitizen:
+		if filter.CitizenID != nil && *filter.CitizenID != access.ID {
+			return ErrFhirAccessDenied
+		}
+		filter.CitizenID = &access.ID
+	case FhirPharmacist:
+		if filter.LineID == nil && filter.CitizenID == nil {
+			return fmt.Errorf("%w: pharmacists must search prescriptions by patient or identifier", ErrFhirAccessDenied)
+		}
+		filter.States = []models.PrescriptionState{models.Active}
+		filter.Dispensable = true
+		filter.Signed = true
+	}
+
+	var lines []models.PrescriptionMedicament
+	if err := f.repo.FindPrescriptionLines(&filter, fhirPage(&query.QueryFhirPaging), &lines, total); err != nil {
+		return err
+	}
+
+	// unsigned prescriptions are already left out by the query, the few whose signature does
+	// not verify are reported in place of their lines, so every counted line has an entry
+	*resources = make([]dto.FhirResource, len(lines))
+	for i := range lines {
+		if access.Role == FhirPharmacist {
+			if err := verifyPrescriptionSignature(lines[i].Prescription); err != nil {
+				(*resources)[i] = refusedLineToFhir(&lines[i], err)
+				continue
+			}
+		}
+
+		(*resources)[i] = medicationRequestToFhir(&lines[i])
+	}
+
+	return nil
+}
+
+func (f *fhirService) SearchMedicationDispenses(access FhirAccess, query *dto.QueryFhirMedicationDispenseSearch, resources *[]dto.FhirResource, total *int64) error {
+	filter := repo.FhirFulfillmentFilter{}
+
+	var err error
+	if filter.ID, err = parseFhirId("_id", query.Id); err != nil {
+		return err
+	}
+	if filter.CitizenID, err = parseFhirReference("patient", "Patient", query.Patient); err != nil {
+		return err
+	}
+	if filter.MedicamentID, err = parseFhirReference("medication", "Medication", query.Medication); err != nil {
+		return err
+	}
+	if filter.LineID, err = parseFhirReference("prescription", "MedicationRequest", query.Prescription); err != nil {
+		return err
+	}
+
+	switch access.Role {
+	case FhirCitizen:
+		if filter.CitizenID != nil && *filter.CitizenID != access.ID {
+			return ErrFhirAccessDenied
+		}
+		filter.CitizenID = &access.ID
+	case FhirPharmacist:
+		branchId := uuid.UUID{}
+		if err := f.repo.FindPharmacistBranchId(access.ID, &branchId); err != nil {
+			return err
+		}
+		filter.PharmacyBranchID = &branchId
+	}
+
+	var fulfillments []models.PrescriptionFulfillment
+	if err := f.repo.FindFulfillments(&filter, fhirPage(&query.QueryFhirPaging), &fulfillments, total); err != nil {
+		return err
+	}
+
+	*resources = make([]dto.FhirResource, len(fulfillments))
+	for i := range fulfillments {
+		(*resources)[i] = medicationDispenseToFhir(&fulfillments[i])
+	}
+
+	return nil
+}
+
+func fhirPage(paging *dto.QueryFhirPaging) repo.FhirPage {
+	paging.Normalize()
+
+	return repo.FhirPage{
+		Offset: paging.Offset,
+		Limit:  paging.Count,
+	}
+}
+
+// parseFhirToken drops the system of a system|code token
+func parseFhirToken(token string) string {
+	if i := strings.LastIndex(token, "|"); i >= 0 {
+		return token[i+1:]
+	}
+
+	return token
+}
+
+func parseFhirId(parameter, id string) (*uuid.UUID, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFhirInvalidParameter, parameter)
+	}
+
+	return &parsed, nil
+}
+
+// parseFhirReference accepts either a bare id or a Type/id reference
+func parseFhirReference(parameter, resourceType, reference string) (*uuid.UUID, error) {
+	if typed, ok := strings.CutPrefix(reference, resourceType+"/"); ok {
+		reference = typed
+	}
+
+	return parseFhirId(parameter, reference)
+}
+
+// parseFhirDate parses a day with an optional comparison prefix such as ge2025-01-31
+func parseFhirDate(parameter, value string) (*repo.FhirDateFilter, error) {
+	filter := repo.FhirDateFilter{Prefix: "eq"}
+
+	if len(value) > 2 {
+		switch value[:2] {
+		case "eq", "ne", "lt", "le", "gt", "ge":
+			filter.Prefix, value = value[:2], value[2:]
+		}
+	}
+
+	date, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFhirInvalidParameter, parameter)
+	}
+
+	filter.Date = date
+	return &filter, nil
+}
+
+var fhirRequestStatuses = map[models.PrescriptionState]string{
+	models.Active:     "active",
+	models.Fulfilled:  "completed",
+	models.Revoked:    "cancelled",
+	models.Superseded: "stopped",
+	models.Invalid:    "entered-in-error",
+}
+
+var fhirRequestStates = map[string]models.PrescriptionState{
+	"active":           models.Active,
+	"completed":        models.Fulfilled,
+	"cancelled":        models.Revoked,
+	"stopped":          models.Superseded,
+	"entered-in-error": models.Invalid,
+}
+
+var fhirTimingEvents = map[common.TimeOfDay]string{
+	common.Morning: "MORN",
+	common.Noon:    "NOON",
+	common.Evening: "EVE",
+	common.Bedtime: "HS",
+}
+
+var fhirTimesOfDay = map[string]common.TimeOfDay{
+	"MORN": common.Morning,
+	"NOON": common.Noon,
+	"EVE":  common.Evening,
+	"HS":   common.Bedtime,
+}
+
+func patientToFhir(citizen *models.Citizen) *dto.FhirPatient {
+	patient := dto.FhirPatient{
+		ResourceType: "Patient",
+		Id:           citizen.ID.String(),
+		Identifier:   []dto.FhirIdentifier{{System: dto.FhirUcnSystem, Value: citizen.UCN}},
+		Name:         []dto.FhirHumanName{fhirHumanName(citizen.FirstName, citizen.SecondName, citizen.LastName)},
+		Gender:       string(citizen.Sex),
+	}
+
+	if !citizen.Birthday.IsZero() {
+		patient.BirthDate = citizen.Birthday.Format(time.DateOnly)
+	}
+	if citizen.Email != "" {
+		patient.Telecom = append(patient.Telecom, dto.FhirContactPoint{System: "email", Value: citizen.Email})
+	}
+	if citizen.PhoneNumber != "" {
+		patient.Telecom = append(patient.Telecom, dto.FhirContactPoint{System: "phone", Value: citizen.PhoneNumber})
+	}
+
+	return &patient
+}
+
+func practitionerToFhir(doctor *models.Doctor) *dto.FhirPractitioner {
+	practitioner := dto.FhirPractitioner{
+		ResourceType: "Practitioner",
+		Id:           doctor.ID.String(),
+		Identifier:   []dto.FhirIdentifier{{System: dto.FhirUinSystem, Value: doctor.UIN}},
+		Active:       !doctor.PrescribingBlocked,
+		Name:         []dto.FhirHumanName{fhirHumanName(doctor.FirstName, doctor.SecondName, doctor.LastName)},
+	}
+
+	if doctor.Email != "" {
+		practitioner.Telecom = []dto.FhirContactPoint{{System: "email", Value: doctor.Email}}
+	}
+
+	for _, specialty := range doctor.Specialties {
+		practitioner.Qualification = append(practitioner.Qualification, dto.FhirPractitionerQualification{
+			Code: dto.FhirCodeableConcept{
+				Coding: []dto.FhirCoding{{Code: specialty.Code, Display: specialty.Name}},
+				Text:   specialty.Name,
+			},
+		})
+	}
+
+	return &practitioner
+}
+
+func medicationToFhir(medicament *models.Medicament) *dto.FhirMedication {
+	return &dto.FhirMedication{
+		ResourceType: "Medication",
+		Id:           medicament.ID.String(),
+		Code: dto.FhirCodeableConcept{
+			Coding: []dto.FhirCoding{{System: dto.FhirAtcSystem, Code: medicament.ATC, Display: medicament.OfficialName}},
+			Text:   medicament.OfficialName,
+		},
+		Status: "active",
+	}
+}
+
+// medicationRequestToFhir maps a prescription line. The line's prescription must be loaded
+// with its doctor.
+func medicationRequestToFhir(line *models.PrescriptionMedicament) *dto.FhirMedicationRequest {
+	prescription := line.Prescription
+	dosage := dosageToDto(line)
+	authoredOn := prescription.CreationDate
+	validityStart := prescription.StartDate
+	validityEnd := prescription.EndDate
+
+	timing := dto.FhirTiming{
+		Repeat: dto.FhirTimingRepeat{
+			Frequency:  line.TimesPerDay,
+			Period:     1,
+			PeriodUnit: "d",
+		},
+	}
+	if line.DurationDays > 0 {
+		timing.Repeat.BoundsDuration = &dto.FhirDuration{Value: float64(line.DurationDays), Unit: "d", Code: "d"}
+	}
+	for _, timeOfDay := range dosage.TimesOfDay {
+		timing.Repeat.When = append(timing.Repeat.When, fhirTimingEvents[common.TimeOfDay(timeOfDay)])
+	}
+
+	request := dto.FhirMedicationRequest{
+		ResourceType:    "MedicationRequest",
+		Id:              line.LineID.String(),
+		Meta:            &dto.FhirMeta{VersionId: fmt.Sprint(prescription.Version)},
+		GroupIdentifier: &dto.FhirIdentifier{System: dto.FhirPrescriptionSystem, Value: prescription.Code},
+		Status:          fhirRequestStatuses[prescription.State],
+		Intent:          "order",
+		MedicationReference: &dto.FhirReference{
+			Reference: "Medication/" + line.MedicamentID.String(),
+			Display:   line.Medicament.OfficialName,
+		},
+		Subject:    dto.FhirReference{Reference: "Patient/" + prescription.CitizenID.String()},
+		AuthoredOn: &authoredOn,
+		Requester: &dto.FhirReference{
+			Reference: "Practitioner/" + prescription.DoctorID.String(),
+			Display:   fullName(prescription.Doctor.FirstName, prescription.Doctor.LastName),
+		},
+		DosageInstruction: []dto.FhirDosage{{
+			Text:               dosage.Sig,
+			PatientInstruction: line.Notes,
+			Timing:             &timing,
+			Route:              &dto.FhirCodeableConcept{Text: string(line.Route)},
+			DoseAndRate:        []dto.FhirDoseAndRate{{DoseQuantity: dto.FhirQuantity{Value: float64(line.DoseAmount), Unit: string(line.DoseUnit)}}},
+		}},
+		DispenseRequest: &dto.FhirDispenseRequest{
+			ValidityPeriod:         &dto.FhirPeriod{Start: &validityStart, End: &validityEnd},
+			NumberOfRepeatsAllowed: prescription.Refills,
+			Quantity:               &dto.FhirQuantity{Value: float64(line.Quantity)},
+		},
+	}
+
+	if prescription.Refills > 0 {
+		request.DispenseRequest.DispenseInterval = &dto.FhirDuration{Value: float64(prescription.RefillIntervalDays), Unit: "d", Code: "d"}
+	}
+
+	return &request
+}
+
+func medicationDispenseToFhir(fulfillment *models.PrescriptionFulfillment) *dto.FhirMedicationDispense {
+	dispense := dto.FhirMedicationDispense{
+		ResourceType: "MedicationDispense",
+		Id:           fulfillment.ID.String(),
+		Status:       "completed",
+		MedicationReference: dto.FhirReference{
+			Reference: "Medication/" + fulfillment.MedicamentID.String(),
+			Display:   fulfillment.Medicament.OfficialName,
+		},
+		AuthorizingPrescription: []dto.FhirReference{{Reference: "MedicationRequest/" + fulfillment.LineID.String()}},
+		Quantity:                dto.FhirQuantity{Value: float64(fulfillment.Quantity)},
+		WhenHandedOver:          fulfillment.FulfilledAt,
+		Location:                &dto.FhirReference{Display: fulfillment.PharmacyBranch.Name},
+	}
+
+	if fulfillment.Prescription != nil {
+		dispense.Subject = dto.FhirReference{Reference: "Patient/" + fulfillment.Prescription.CitizenID.String()}
+	}
+
+	return &dispense
+}
+
+func fhirHumanName(firstName, secondName, lastName string) dto.FhirHumanName {
+	name := dto.FhirHumanName{
+		Use:    "official",
+		Family: lastName,
+		Text:   fullName(firstName, secondName, lastName),
+	}
+
+	for _, given := range []string{firstName, secondName} {
+		if given != "" {
+			name.Given = append(name.Given, given)
+		}
+	}
+
+	return name
+}
+
+// refusedLineToFhir explains why a prescription line is withheld from a search
+func refusedLineToFhir(line *models.PrescriptionMedicament, err error) *dto.FhirOperationOutcome {
+	return &dto.FhirOperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue: []dto.FhirOperationOutcomeIssue{{
+			Severity:    "error",
+			Code:        "security",
+			Diagnostics: fmt.Sprintf("MedicationRequest/%s is withheld: %v", line.LineID, err),
+		}},
+	}
+}
+
+// CreateMedicationRequests creates a prescription with a line for each submitted MedicationRequest.
+// It goes through the doctor service like a prescription made in medico, so the same
+// restrictions apply and the prescription is signed with the doctor's key. A submission with
+// an identifier is only created once, submitting it again finds the prescription created
+// the first time and reports it as existing.
+func (f *fhirService) CreateMedicationRequests(access FhirAccess, submission *dto.RequestFhirSubmission, created *[]dto.FhirResource, existing *bool) error {
+	if access.Role != FhirDoctor {
+		return ErrFhirAccessDenied
+	}
+
+	requests := submission.Requests
+
+	if submission.Identifier != "" {
+		if len(submission.Identifier) > fhirSubmissionIdentifierLength {
+			return dto.FhirIssue("identifier", "identifier must be at most %d characters", fhirSubmissionIdentifierLength)
+		}
+
+		if err := f.findSubmittedRequests(access.ID, submission, created); err != nil {
+			return err
+		}
+		if *existing = len(*created) > 0; *existing {
+			return nil
+		}
+	}
+
+	prescriptionDto := dto.RequestDoctorCreatePrescription{SubmissionId: submission.Identifier}
+
+	if err := f.medicationRequestsToDto(access.ID, requests, &prescriptionDto); err != nil {
+		return err
+	}
+
+	if err := prescriptionDto.Validate(); err != nil {
+		return &dto.FhirIssueError{Expression: requests[0].Path, Err: err}
+	}
+
+	blockedDto := make([]dto.ResponseDoctorBlockedMedicament, 0)
+	createdDto := dto.ResponseDoctorCreatedPrescription{}
+
+	err := f.doctor.CreatePrescription(access.ID, &prescriptionDto, &blockedDto, &createdDto)
+	switch {
+	case errors.Is(err, ErrMedicamentRestricted):
+		return restrictedMedicationRequests(requests, &prescriptionDto, blockedDto)
+	case errors.Is(err, gorm.ErrDuplicatedKey) && submission.Identifier != "":
+		// the same submission may have been created concurrently
+		if findErr := f.findSubmittedRequests(access.ID, submission, created); findErr != nil {
+			return findErr
+		}
+		if *existing = len(*created) > 0; !*existing {
+			return err
+		}
+		return nil
+	case err != nil:
+		return err
+	}
+
+	filter := repo.FhirPrescriptionLineFilter{PrescriptionID: &createdDto.Id}
+
+	return f.findCreatedRequests(&filter, len(requests), created)
+}
+
+// findSubmittedRequests finds the lines of the prescription created from an earlier submission
+// with the same identifier
+func (f *fhirService) findSubmittedRequests(doctorId uuid.UUID, submission *dto.RequestFhirSubmission, created *[]dto.FhirResource) error {
+	filter := repo.FhirPrescriptionLineFilter{DoctorID: &doctorId, SubmissionID: &submission.Identifier}
+
+	return f.findCreatedRequests(&filter, dto.FhirMaxCount, created)
+}
+
+func (f *fhirService) findCreatedRequests(filter *repo.FhirPrescriptionLineFilter, limit int, created *[]dto.FhirResource) error {
+	var lines []models.PrescriptionMedicament
+	var total int64
+
+	if err := f.repo.FindPrescriptionLines(filter, repo.FhirPage{Limit: limit}, &lines, &total); err != nil {
+		return err
+	}
+
+	*created = make([]dto.FhirResource, len(lines))
+	for i := range lines {
+		(*created)[i] = medicationRequestToFhir(&lines[i])
+	}
+
+	return nil
+}
+
+// medicationRequestsToDto maps the submitted requests to a prescription. The requests must
+// agree on everything that medico keeps per prescription rather than per line.
+func (f *fhirService) medicationRequestsToDto(doctorId uuid.UUID, requests []dto.RequestFhirMedicationRequest, prescriptionDto *dto.RequestDoctorCreatePrescription) error {
+	var errs []error
+	medicaments := make(map[uuid.UUID]bool, len(requests))
+
+	for i := range requests {
+		path, request := requests[i].Path, &requests[i].Resource
+
+		if request.Status != "active" {
+			errs = append(errs, dto.FhirIssue(path+".status", "only active requests can be created"))
+		}
+		if request.Intent != "order" {
+			errs = append(errs, dto.FhirIssue(path+".intent", "only orders can be created"))
+		}
+
+		err := f.verifyRequester(doctorId, request.Requester)
+		switch {
+		case isFhirIssue(err):
+			errs = append(errs, &dto.FhirIssueError{Expression: path + ".requester", Err: err})
+		case err != nil:
+			return err
+		}
+
+		citizenId, err := f.resolvePatient(&request.Subject)
+		switch {
+		case isFhirIssue(err):
+			errs = append(errs, &dto.FhirIssueError{Expression: path + ".subject", Err: err})
+		case err != nil:
+			return err
+		case i == 0:
+			prescriptionDto.CitizenId = citizenId
+		case citizenId != prescriptionDto.CitizenId:
+			errs = append(errs, dto.FhirIssue(path+".subject", "every request must be for the same patient"))
+		}
+
+		groupIdentifier := fhirGroupIdentifier(request)
+		if i == 0 {
+			prescriptionDto.Name = fhirPrescriptionName(groupIdentifier)
+		} else if groupIdentifier != fhirGroupIdentifier(&requests[0].Resource) {
+			errs = append(errs, dto.FhirIssue(path+".groupIdentifier", "every request must belong to the same group"))
+		}
+
+		line := dto.RequestDoctorPrescriptionMedicament{}
+
+		line.Id, err = f.resolveMedication(request)
+		switch {
+		case isFhirIssue(err):
+			errs = append(errs, &dto.FhirIssueError{Expression: path + ".medication", Err: err})
+		case err != nil:
+			return err
+		case medicaments[line.Id]:
+			errs = append(errs, dto.FhirIssue(path+".medication", "medication is requested more than once"))
+		}
+		medicaments[line.Id] = true
+
+		errs = append(errs, fhirDispenseRequestToDto(path, i == 0, request.DispenseRequest, prescriptionDto, &line)...)
+		line.Dosage = &dto.RequestPrescriptionDosage{}
+		errs = append(errs, fhirDosageToDto(path, request.DosageInstruction, line.Dosage)...)
+
+		prescriptionDto.Medicaments = append(prescriptionDto.Medicaments, line)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *fhirService) verifyRequester(doctorId uuid.UUID, requester *dto.FhirReference) error {
+	if requester == nil {
+		return nil
+	}
+
+	if requester.Reference != "" {
+		if id, ok := fhirReferenceId("Practitioner", requester.Reference); !ok || id != doctorId {
+			return fmt.Errorf("%w: requester is not the authenticated doctor", ErrFhirAccessDenied)
+		}
+		return nil
+	}
+
+	if requester.Identifier == nil || requester.Identifier.System != dto.FhirUinSystem {
+		return fmt.Errorf("%w: requester must reference a Practitioner or carry a %s identifier", dto.ErrFhirResourceInvalid, dto.FhirUinSystem)
+	}
+
+	var doctors []models.Doctor
+	var total int64
+
+	if err := f.repo.FindDoctors(&repo.FhirDoctorFilter{ID: &doctorId}, repo.FhirPage{Limit: 1}, &doctors, &total); err != nil {
+		return err
+	}
+
+	if total == 0 || doctors[0].UIN != requester.Identifier.Value {
+		return fmt.Errorf("%w: requester is not the authenticated doctor", ErrFhirAccessDenied)
+	}
+
+	return nil
+}
+
+// resolvePatient finds the citizen a subject refers to, either by id or by UCN
+func (f *fhirService) resolvePatient(subject *dto.FhirReference) (uuid.UUID, error) {
+	filter := repo.FhirCitizenFilter{}
+
+	switch {
+	case subject.Reference != "":
+		id, ok := fhirReferenceId("Patient", subject.Reference)
+		if !ok {
+			return uuid.Nil, fmt.Errorf("%w: subject must reference a Patient", dto.ErrFhirResourceInvalid)
+		}
+		filter.ID = &id
+	case subject.Identifier != nil && subject.Identifier.System == dto.FhirUcnSystem:
+		filter.UCN = subject.Identifier.Value
+	default:
+		return uuid.Nil, fmt.Errorf("%w: subject must reference a Patient or carry a %s identifier", dto.ErrFhirResourceInvalid, dto.FhirUcnSystem)
+	}
+
+	var citizens []models.Citizen
+	var total int64
+
+	if err := f.repo.FindCitizens(&filter, repo.FhirPage{Limit: 1}, &citizens, &total); err != nil {
+		return uuid.Nil, err
+	}
+
+	if total == 0 {
+		return uuid.Nil, fmt.Errorf("%w: patient is not known", dto.ErrFhirResourceInvalid)
+	}
+
+	return citizens[0].ID, nil
+}
+
+// resolveMedication finds the medicament of a request, either by reference or by its ATC code
+func (f *fhirService) resolveMedication(request *dto.FhirMedicationRequest) (uuid.UUID, error) {
+	filter := repo.FhirMedicamentFilter{}
+
+	switch {
+	case request.MedicationReference != nil:
+		id, ok := fhirReferenceId("Medication", request.MedicationReference.Reference)
+		if !ok {
+			return uuid.Nil, fmt.Errorf("%w: medicationReference must reference a Medication", dto.ErrFhirResourceInvalid)
+		}
+		filter.ID = &id
+	case request.MedicationCodeableConcept != nil:
+		for _, coding := range request.MedicationCodeableConcept.Coding {
+			if coding.System == dto.FhirAtcSystem {
+				filter.ATC = coding.Code
+			}
+		}
+		if filter.ATC == "" {
+			return uuid.Nil, fmt.Errorf("%w: medicationCodeableConcept must carry an ATC coding", dto.ErrFhirResourceInvalid)
+		}
+	default:
+		return uuid.Nil, fmt.Errorf("%w: medication is required", dto.ErrFhirResourceInvalid)
+	}
+
+	var medicaments []models.Medicament
+	var total int64
+
+	if err := f.repo.FindMedicaments(&filter, repo.FhirPage{Limit: 1}, &medicaments, &total); err != nil {
+		return uuid.Nil, err
+	}
+
+	switch {
+	case total == 0:
+		return uuid.Nil, fmt.Errorf("%w: medication is not known", dto.ErrFhirResourceInvalid)
+	case total > 1:
+		return uuid.Nil, fmt.Errorf("%w: ATC code %s matches %d medications, reference one of them", dto.ErrFhirResourceInvalid, filter.ATC, total)
+	}
+
+	return medicaments[0].ID, nil
+}
+
+// fhirDispenseRequestToDto takes the validity and repeats of the prescription from the first
+// request and checks that the others agree with it
+func fhirDispenseRequestToDto(path string, first bool, dispenseRequest *dto.FhirDispenseRequest, prescriptionDto *dto.RequestDoctorCreatePrescription, line *dto.RequestDoctorPrescriptionMedicament) []error {
+	path += ".dispenseRequest"
+
+	if dispenseRequest == nil {
+		return []error{dto.FhirIssue(path, "dispense request is required")}
+	}
+
+	var errs []error
+
+	if dispenseRequest.Quantity == nil {
+		errs = append(errs, dto.FhirIssue(path+".quantity", "quantity is required"))
+	} else if quantity, ok := fhirWholeNumber(dispenseRequest.Quantity.Value); !ok || quantity == 0 {
+		errs = append(errs, dto.FhirIssue(path+".quantity", "quantity must be a whole number of packages"))
+	} else {
+		line.Quantity = quantity
+	}
+
+	var startDate *time.Time
+	var endDate time.Time
+	if dispenseRequest.ValidityPeriod == nil || dispenseRequest.ValidityPeriod.End == nil {
+		errs = append(errs, dto.FhirIssue(path+".validityPeriod.end", "end of the validity period is required"))
+	} else {
+		startDate = dispenseRequest.ValidityPeriod.Start
+		endDate = *dispenseRequest.ValidityPeriod.End
+	}
+
+	var interval uint
+	if dispenseRequest.DispenseInterval != nil {
+		var err error
+		if interval, err = fhirDays(dispenseRequest.DispenseInterval); err != nil {
+			errs = append(errs, &dto.FhirIssueError{Expression: path + ".dispenseInterval", Err: err})
+		}
+	}
+
+	if first {
+		prescriptionDto.StartDate = startDate
+		prescriptionDto.EndDate = endDate
+		prescriptionDto.Refills = dispenseRequest.NumberOfRepeatsAllowed
+		prescriptionDto.RefillIntervalDays = interval
+		return errs
+	}
+
+	if !fhirSameTime(startDate, prescriptionDto.StartDate) || !endDate.Equal(prescriptionDto.EndDate) {
+		errs = append(errs, dto.FhirIssue(path+".validityPeriod", "every request must have the same validity period"))
+	}
+	if dispenseRequest.NumberOfRepeatsAllowed != prescriptionDto.Refills || interval != prescriptionDto.RefillIntervalDays {
+		errs = append(errs, dto.FhirIssue(path, "every request must allow the same repeats"))
+	}
+
+	return errs
+}
+
+func fhirDosageToDto(path string, dosages []dto.FhirDosage, dosageDto *dto.RequestPrescriptionDosage) []error {
+	path += ".dosageInstruction"
+
+	if len(dosages) != 1 {
+		return []error{dto.FhirIssue(path, "exactly one dosage instruction is required")}
+	}
+
+	dosage := &dosages[0]
+	path += "[0]"
+
+	var errs []error
+
+	dosageDto.Notes = dosage.PatientInstruction
+
+	if len(dosage.DoseAndRate) != 1 {
+		errs = append(errs, dto.FhirIssue(path+".doseAndRate", "exactly one dose is required"))
+	} else {
+		dose := dosage.DoseAndRate[0].DoseQuantity
+		dosageDto.Amount = float32(dose.Value)
+		dosageDto.Unit = cmp.Or(dose.Code, dose.Unit)
+	}
+
+	if dosage.Route == nil {
+		errs = append(errs, dto.FhirIssue(path+".route", "route is required"))
+	} else {
+		dosageDto.Route = dosage.Route.Text
+		for _, coding := range dosage.Route.Coding {
+			dosageDto.Route = coding.Code
+		}
+	}
+
+	if dosage.Timing == nil {
+		return append(errs, dto.FhirIssue(path+".timing", "timing is required"))
+	}
+
+	repeat := &dosage.Timing.Repeat
+
+	if repeat.Period != 1 || repeat.PeriodUnit != "d" {
+		errs = append(errs, dto.FhirIssue(path+".timing.repeat", "timing must repeat daily"))
+	}
+	dosageDto.TimesPerDay = repeat.Frequency
+
+	for _, when := range repeat.When {
+		timeOfDay, ok := fhirTimesOfDay[when]
+		if !ok {
+			errs = append(errs, dto.FhirIssue(path+".timing.repeat.when", "%s is not a supported time of day", when))
+			continue
+		}
+		dosageDto.TimesOfDay = append(dosageDto.TimesOfDay, string(timeOfDay))
+	}
+
+	if repeat.BoundsDuration == nil {
+		errs = append(errs, dto.FhirIssue(path+".timing.repeat.boundsDuration", "duration of the treatment is required"))
+	} else if days, err := fhirDays(repeat.BoundsDuration); err != nil {
+		errs = append(errs, &dto.FhirIssueError{Expression: path + ".timing.repeat.boundsDuration", Err: err})
+	} else if days > math.MaxUint16 {
+		errs = append(errs, &dto.FhirIssueError{Expression: path + ".timing.repeat.boundsDuration", Err: dto.ErrDoseDuration})
+	} else {
+		dosageDto.DurationDays = uint16(days)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if err := dosageDto.Validate(); err != nil {
+		return []error{&dto.FhirIssueError{Expression: path, Err: err}}
+	}
+
+	return nil
+}
+
+// restrictedMedicationRequests points the restriction error at the requests of the blocked medicaments
+func restrictedMedicationRequests(requests []dto.RequestFhirMedicationRequest, prescriptionDto *dto.RequestDoctorCreatePrescription, blockedDto []dto.ResponseDoctorBlockedMedicament) error {
+	var errs []error
+
+	for _, blocked := range blockedDto {
+		specialties := make([]string, len(blocked.AllowedSpecialties))
+		for i, specialty := range blocked.AllowedSpecialties {
+			specialties[i] = specialty.Name
+		}
+
+		for i, line := range prescriptionDto.Medicaments {
+			if line.Id == blocked.Id {
+				errs = append(errs, &dto.FhirIssueError{
+					Expression: requests[i].Path + ".medication",
+					Err:        fmt.Errorf("%w: %s may only be prescribed by %s", ErrMedicamentRestricted, blocked.OfficialName, strings.Join(specialties, ", ")),
+				})
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isFhirIssue(err error) bool {
+	return errors.Is(err, dto.ErrFhirResourceInvalid) || errors.Is(err, ErrFhirAccessDenied)
+}
+
+func fhirGroupIdentifier(request *dto.FhirMedicationRequest) string {
+	if request.GroupIdentifier == nil {
+		return ""
+	}
+
+	return request.GroupIdentifier.Value
+}
+
+// fhirPrescriptionName names an imported prescription after the group identifier the EHR gave it
+func fhirPrescriptionName(groupIdentifier string) string {
+	if groupIdentifier == "" {
+		return "FHIR import"
+	}
+
+	name := []rune("FHIR " + groupIdentifier)
+	return string(name[:min(len(name), 32)])
+}
+
+func fhirReferenceId(resourceType, reference string) (uuid.UUID, bool) {
+	id, ok := strings.CutPrefix(reference, resourceType+"/")
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	parsed, err := uuid.Parse(id)
+	return parsed, err == nil
+}
+
+func fhirSameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return a.Equal(*b)
+}
+
+func fhirWholeNumber(value float64) (uint, bool) {
+	if value < 0 || value != math.Trunc(value) || value > math.MaxUint32 {
+		return 0, false
+	}
+
+	return uint(value), true
+}
+
+// fhirDays reads a duration given in days
+func fhirDays(duration *dto.FhirDuration) (uint, error) {
+	if cmp.Or(duration.Code, duration.Unit) != "d" {
+		return 0, fmt.Errorf("%w: duration must be given in days", dto.ErrFhirResourceInvalid)
+	}
+
+	days, ok := fhirWholeNumber(duration.Value)
+	if !ok {
+		return 0, fmt.Errorf("%w: duration must be a whole number of days", dto.ErrFhirResourceInvalid)
+	}
+
+	return days, nil
+}
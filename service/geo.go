@@ -0,0 +1,62 @@
+package service
+
+import (
+	"math"
+	"medico/repo"
+)
+
+const earthRadiusKm = 6371.0
+
+// defaultSearchRadiusKm is how far around the citizen pharmacies are searched when no radius
+// is asked for
+const defaultSearchRadiusKm = 10.0
+
+// medicamentSearchLimit caps how many medicaments an availability search answers with
+const medicamentSearchLimit = 10
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// distanceKm is the great-circle distance between two points by the haversine formula
+func distanceKm(fromLatitude, fromLongitude, toLatitude, toLongitude float64) float64 {
+	latitudeDelta := radians(toLatitude - fromLatitude)
+	longitudeDelta := radians(toLongitude - fromLongitude)
+
+	a := math.Sin(latitudeDelta/2)*math.Sin(latitudeDelta/2) +
+		math.Cos(radians(fromLatitude))*math.Cos(radians(toLatitude))*
+			math.Sin(longitudeDelta/2)*math.Sin(longitudeDelta/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// areaAround is the smallest bounding box that holds the circle of radiusKm around the point.
+// Near a pole the circle covers every longitude.
+func areaAround(latitude, longitude, radiusKm float64) repo.GeoArea {
+	latitudeDelta := radiusKm / earthRadiusKm * 180 / math.Pi
+	area := repo.GeoArea{
+		MinLatitude:  latitude - latitudeDelta,
+		MaxLatitude:  latitude + latitudeDelta,
+		MinLongitude: -180,
+		MaxLongitude: 180,
+	}
+
+	if area.MinLatitude <= -90 || area.MaxLatitude >= 90 {
+		area.MinLatitude = math.Max(area.MinLatitude, -90)
+		area.MaxLatitude = math.Min(area.MaxLatitude, 90)
+		return area
+	}
+
+	longitudeDelta := math.Asin(math.Sin(radians(latitudeDelta))/math.Cos(radians(latitude))) * 180 / math.Pi
+	area.MinLongitude = longitude - longitudeDelta
+	area.MaxLongitude = longitude + longitudeDelta
+
+	if area.MinLongitude < -180 {
+		area.MinLongitude += 360
+	}
+	if area.MaxLongitude > 180 {
+		area.MaxLongitude -= 360
+	}
+
+	return area
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"math"
+	"medico/repo"
+	"testing"
+)
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name                        string
+		fromLatitude, fromLongitude float64
+		toLatitude, toLongitude     float64
+		distance                    float64
+	}{
+		{name: "same point", fromLatitude: 42.6977, fromLongitude: 23.3219, toLatitude: 42.6977, toLongitude: 23.3219, distance: 0},
+		{name: "sofia to plovdiv", fromLatitude: 42.6977, fromLongitude: 23.3219, toLatitude: 42.1354, toLongitude: 24.7453, distance: 132.5},
+		{name: "one degree along the equator", fromLatitude: 0, fromLongitude: 0, toLatitude: 0, toLongitude: 1, distance: 111.2},
+		{name: "across the antimeridian", fromLatitude: 0, fromLongitude: 179.5, toLatitude: 0, toLongitude: -179.5, distance: 111.2},
+		{name: "antipodes", fromLatitude: 0, fromLongitude: 0, toLatitude: 0, toLongitude: 180, distance: math.Pi * earthRadiusKm},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			distance := distanceKm(test.fromLatitude, test.fromLongitude, test.toLatitude, test.toLongitude)
+
+			if math.Abs(distance-test.distance) > 0.1 {
+				t.Errorf("distanceKm() = %.2f, want %.2f", distance, test.distance)
+			}
+		})
+	}
+}
+
+func TestAreaAround(t *testing.T) {
+	tests := []struct {
+		name                string
+		latitude, longitude float64
+		radiusKm            float64
+		area                repo.GeoArea
+	}{
+		{
+			name:     "equator",
+			latitude: 0, longitude: 0, radiusKm: 111.19,
+			area: repo.GeoArea{MinLatitude: -1, MaxLatitude: 1, MinLongitude: -1, MaxLongitude: 1},
+		},
+		{
+			name:     "wider in longitude away from the equator",
+			latitude: 60, longitude: 10, radiusKm: 111.19,
+			area: repo.GeoArea{MinLatitude: 59, MaxLatitude: 61, MinLongitude: 8, MaxLongitude: 12},
+		},
+		{
+			name:     "across the antimeridian",
+			latitude: 0, longitude: 179.5, radiusKm: 111.19,
+			area: repo.GeoArea{MinLatitude: -1, MaxLatitude: 1, MinLongitude: 178.5, MaxLongitude: -179.5},
+		},
+		{
+			name:     "around a pole",
+			latitude: 89.5, longitude: 10, radiusKm: 111.19,
+			area: repo.GeoArea{MinLatitude: 88.5, MaxLatitude: 90, MinLongitude: -180, MaxLongitude: 180},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			area := areaAround(test.latitude, test.longitude, test.radiusKm)
+
+			for _, bound := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"min latitude", area.MinLatitude, test.area.MinLatitude},
+				{"max latitude", area.MaxLatitude, test.area.MaxLatitude},
+				{"min longitude", area.MinLongitude, test.area.MinLongitude},
+				{"max longitude", area.MaxLongitude, test.area.MaxLongitude},
+			} {
+				if math.Abs(bound.got-bound.want) > 0.01 {
+					t.Errorf("areaAround() %s = %.4f, want %.4f", bound.name, bound.got, bound.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"medico/dto"
+	"medico/models"
+)
+
+func hospitalToDto(hospital *models.Hospital) *dto.ResponseHospital {
+	if hospital == nil {
+		return nil
+	}
+
+	return &dto.ResponseHospital{
+		ID:          hospital.ID,
+		Type:        string(hospital.Type),
+		Name:        string(hospital.Name),
+		Address:     string(hospital.Address),
+		City:        hospital.City,
+		PhoneNumber: hospital.PhoneNumber,
+	}
+}
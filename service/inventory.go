@@ -0,0 +1,186 @@
+package service
+
+import (
+	"encoding/csv"
+	"github.com/google/uuid"
+	"io"
+	"math"
+	"medico/common"
+	"medico/dto"
+	"medico/models"
+	"medico/repo"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stockMovement starts a movement of the medicament at the branch made by the actor now
+func stockMovement(branchId, medicamentId uuid.UUID, movementType common.StockMovementType, delta int64, role models.StockActorRole, actorId uuid.UUID) models.StockMovement {
+	return models.StockMovement{
+		ID:               uuid.New(),
+		PharmacyBranchID: branchId,
+		MedicamentID:     medicamentId,
+		Type:             movementType,
+		Delta:            delta,
+		ActorRole:        role,
+		ActorID:          actorId,
+		OccurredAt:       time.Now(),
+	}
+}
+
+// findStockHistory finds a page of the movements of the branch matching the query
+func findStockHistory(inventoryRepo repo.InventoryRepo, branchId uuid.UUID, query *dto.QueryStockHistory, movementsDto *dto.ResponseList[dto.ResponseStockMovement]) error {
+	var movements []models.StockMovement
+	var total int64
+
+	filter := repo.StockMovementFilter{
+		PharmacyBranchID: branchId,
+		MedicamentID:     query.MedicamentId,
+		Type:             common.StockMovementType(query.Type),
+		From:             query.From,
+		To:               query.To,
+	}
+	spec := listSpec(&query.QueryList)
+
+	if err := inventoryRepo.FindMovements(&filter, spec, &movements, &total); err != nil {
+		return err
+	}
+
+	*movementsDto = listPage[dto.ResponseStockMovement](spec, total, len(movements))
+
+	for i, movement := range movements {
+		movementsDto.Items[i] = dto.ResponseStockMovement{
+			Id:            movement.ID,
+			BranchId:      movement.PharmacyBranchID,
+			MedicamentId:  movement.MedicamentID,
+			OfficialName:  movement.Medicament.OfficialName,
+			Type:          string(movement.Type),
+			Delta:         movement.Delta,
+			QuantityAfter: movement.QuantityAfter,
+			BatchNumber:   movement.BatchNumber,
+			ExpiresOn:     movement.ExpiresOn,
+			ActorRole:     string(movement.ActorRole),
+			ActorId:       movement.ActorID,
+			Reason:        movement.Reason,
+			Reference:     movement.Reference,
+			OccurredAt:    movement.OccurredAt,
+		}
+	}
+
+	return nil
+}
+
+// reconcileStock compares the stock of the branch with what its movements add up to. Stock
+// without any movement, e.g. from before the ledger was kept, shows up as a discrepancy too.
+func reconcileStock(inventoryRepo repo.InventoryRepo, branchId uuid.UUID, reconciliation *dto.ResponseStockReconciliation) error {
+	storage := new([]models.PharmacyBranchStorage)
+	balances := new([]repo.LedgerBalance)
+
+	if err := inventoryRepo.FindBranchStorage(branchId, storage); err != nil {
+		return err
+	}
+
+	if err := inventoryRepo.FindLedgerBalances(branchId, balances); err != nil {
+		return err
+	}
+
+	ledger := make(map[uuid.UUID]int64, len(*balances))
+	for _, balance := range *balances {
+		ledger[balance.MedicamentID] = balance.Quantity
+	}
+
+	*reconciliation = dto.ResponseStockReconciliation{
+		BranchId:      branchId,
+		Discrepancies: []dto.ResponseStockDiscrepancy{},
+	}
+
+	for _, item := range *storage {
+		balance := ledger[item.MedicamentID]
+		delete(ledger, item.MedicamentID)
+
+		if balance == int64(item.Quantity) {
+			continue
+		}
+
+		reconciliation.Discrepancies = append(reconciliation.Discrepancies, dto.ResponseStockDiscrepancy{
+			MedicamentId:   item.MedicamentID,
+			OfficialName:   item.Medicament.OfficialName,
+			Quantity:       item.Quantity,
+			LedgerQuantity: balance,
+		})
+	}
+
+	// movements of a medicament the branch has no stock row for
+	for medicamentId, balance := range ledger {
+		if balance == 0 {
+			continue
+		}
+
+		reconciliation.Discrepancies = append(reconciliation.Discrepancies, dto.ResponseStockDiscrepancy{
+			MedicamentId:   medicamentId,
+			LedgerQuantity: balance,
+		})
+	}
+
+	reconciliation.Consistent = len(reconciliation.Discrepancies) == 0
+
+	return nil
+}
+
+// reorderQuantity suggests how much to order for the branch to hold the target level and at
+// least enough to cover coverDays of dispensing at the recent rate
+func reorderQuantity(level *repo.StockLevelStatus, dailyDispensed float64, coverDays uint) uint {
+	wanted := max(float64(level.Target), math.Ceil(dailyDispensed*float64(coverDays)))
+	available := float64(level.Quantity) - float64(level.Reserved)
+
+	if available >= wanted {
+		return 0
+	}
+
+	return uint(wanted - available)
+}
+
+// writePurchaseOrders writes the stock levels to be reordered as CSV, one order line per row
+func writePurchaseOrders(levels []dto.ResponseStockLevel, out io.Writer) error {
+	writer := csv.NewWriter(out)
+
+	if err := writer.Write([]string{
+		"branch_id", "branch_name", "medicament_id", "official_name",
+		"quantity", "minimum", "target", "daily_dispensed", "order_quantity",
+	}); err != nil {
+		return err
+	}
+
+	for _, level := range levels {
+		if level.ReorderQuantity == 0 {
+			continue
+		}
+
+		if err := writer.Write([]string{
+			level.BranchId.String(),
+			csvText(level.BranchName),
+			level.MedicamentId.String(),
+			csvText(level.OfficialName),
+			strconv.FormatUint(uint64(level.Quantity), 10),
+			strconv.FormatUint(uint64(level.Minimum), 10),
+			strconv.FormatUint(uint64(level.Target), 10),
+			strconv.FormatFloat(level.DailyDispensed, 'f', 2, 64),
+			strconv.FormatUint(uint64(level.ReorderQuantity), 10),
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvText keeps a free text cell from being read as a formula by spreadsheet applications.
+// Besides the formula signs, a leading tab or carriage return can start one.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"medico/repo"
+	"testing"
+)
+
+func TestReorderQuantity(t *testing.T) {
+	tests := []struct {
+		name           string
+		level          repo.StockLevelStatus
+		dailyDispensed float64
+		coverDays      uint
+		order          uint
+	}{
+		{
+			name:  "up to the target",
+			level: repo.StockLevelStatus{Minimum: 10, Target: 50, Quantity: 8},
+			order: 42,
+		},
+		{
+			name:  "reserved stock is not available",
+			level: repo.StockLevelStatus{Minimum: 10, Target: 50, Quantity: 20, Reserved: 15},
+			order: 45,
+		},
+		{
+			name:  "more reserved than held",
+			level: repo.StockLevelStatus{Minimum: 10, Target: 50, Quantity: 5, Reserved: 15},
+			order: 60,
+		},
+		{
+			name:           "dispensing rate above the target",
+			level:          repo.StockLevelStatus{Minimum: 10, Target: 50, Quantity: 10},
+			dailyDispensed: 4,
+			coverDays:      30,
+			order:          110,
+		},
+		{
+			name:           "dispensing rate below the target",
+			level:          repo.StockLevelStatus{Minimum: 10, Target: 50, Quantity: 10},
+			dailyDispensed: 1,
+			coverDays:      30,
+			order:          40,
+		},
+		{
+			name:  "enough stock",
+			level: repo.StockLevelStatus{Minimum: 10, Target: 50, Quantity: 60},
+			order: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if order := reorderQuantity(&test.level, test.dailyDispensed, test.coverDays); order != test.order {
+				t.Errorf("reorderQuantity() = %d, want %d", order, test.order)
+			}
+		})
+	}
+}
+
+func TestCsvText(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		text  string
+	}{
+		{name: "plain", value: "Aspirin 500 mg", text: "Aspirin 500 mg"},
+		{name: "empty", value: "", text: ""},
+		{name: "formula", value: "=HYPERLINK(\"x\")", text: "'=HYPERLINK(\"x\")"},
+		{name: "plus", value: "+1", text: "'+1"},
+		{name: "minus", value: "-1", text: "'-1"},
+		{name: "at", value: "@SUM(A1)", text: "'@SUM(A1)"},
+		{name: "tab", value: "\t=1", text: "'\t=1"},
+		{name: "carriage return", value: "\r=1", text: "'\r=1"},
+		{name: "sign inside", value: "Vitamin C + Zinc", text: "Vitamin C + Zinc"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if text := csvText(test.value); text != test.text {
+				t.Errorf("csvText(%q) = %q, want %q", test.value, text, test.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"medico/dto"
+	"medico/repo"
+	"strings"
+)
+
+// listSpec turns the paging and sorting parameters of a list request into a repository spec
+func listSpec(query *dto.QueryList) *repo.ListSpec {
+	query.Normalize()
+
+	spec := repo.ListSpec{
+		Page: query.Page,
+		Size: query.Size,
+	}
+
+	for _, field := range strings.Split(query.Sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		spec.Sort = append(spec.Sort, repo.SortKey{
+			Field:      strings.TrimPrefix(field, "-"),
+			Descending: strings.HasPrefix(field, "-"),
+		})
+	}
+
+	return &spec
+}
+
+// listPage is an empty page of count items for the rows a spec loaded
+func listPage[T any](spec *repo.ListSpec, total int64, count int) dto.ResponseList[T] {
+	return dto.ResponseList[T]{
+		Items: make([]T, count),
+		Page:  spec.Page,
+		Size:  spec.Size,
+		Total: total,
+	}
+}
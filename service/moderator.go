@@ -1,9 +1,17 @@
 package service
 
 import (
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"io"
+	"log"
 	"medico/common"
+	"medico/config"
 	"medico/dto"
 	"medico/models"
 	"medico/repo"
@@ -65,20 +73,50 @@ type DoctorModeratorService interface {
 
 	GetAuthenticationSession(sessionID uuid.UUID) (uuid.UUID, error)
 
-	CreateDoctor(createDoctor *dto.RequestModeratorCreateDoctor) error
-	DeleteDoctor(doctorId *dto.QueryModeratorDeleteDoctor) error
-	FindAllDoctors(dtoDoctors *[]dto.ResponseModeratorGetDoctors) error
+	CreateDoctor(actor *Actor, createDoctor *dto.RequestModeratorCreateDoctor) error
+	DeleteDoctor(actor *Actor, doctorId *dto.QueryModeratorDeleteDoctor) error
+	RestoreDoctor(actor *Actor, doctorId *dto.QueryModeratorRestoreDoctor) error
+	FindAllDoctors(query *dto.QueryModeratorGetDoctors, dtoDoctors *dto.ResponseList[dto.ResponseModeratorGetDoctors]) error
+	UpdateDoctor(actor *Actor, updateDoctor *dto.RequestModeratorUpdateDoctor, updated *dto.ResponseUpdated) error
+	FindDoctorChanges(doctorId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error
+
+	ImportPhysicianRegistry(actor *Actor, registry io.Reader, result *dto.ResponseModeratorImportRegistry) error
+	RecheckDoctorLicences(actor *Actor, query *dto.QueryList, dtoDoctors *dto.ResponseList[dto.ResponseModeratorGetDoctors]) error
+
+	CreateHospital(actor *Actor, createHospital *dto.RequestModeratorCreateHospital) error
+	UpdateHospital(actor *Actor, updateHospital *dto.RequestModeratorUpdateHospital) error
+	DeleteHospital(actor *Actor, hospitalId *dto.QueryModeratorDeleteHospital) error
+	FindAllHospitals(dtoHospitals *[]dto.ResponseHospital) error
+
+	CreateAffiliation(actor *Actor, createAffiliation *dto.RequestModeratorCreateAffiliation) error
+	EndAffiliation(actor *Actor, endAffiliation *dto.RequestModeratorEndAffiliation) error
+	DeleteAffiliation(actor *Actor, affiliationId *dto.QueryModeratorDeleteAffiliation) error
+	FindAffiliations(doctorId *dto.QueryModeratorGetAffiliations, dtoAffiliations *[]dto.ResponseModeratorGetAffiliation) error
+
+	CreateSpecialty(actor *Actor, createSpecialty *dto.RequestModeratorCreateSpecialty) error
+	DeleteSpecialty(actor *Actor, specialtyId *dto.QueryModeratorDeleteSpecialty) error
+	FindAllSpecialties(dtoSpecialties *[]dto.ResponseSpecialty) error
+	AssignSpecialty(actor *Actor, doctorSpecialty *dto.RequestModeratorDoctorSpecialty) error
+	UnassignSpecialty(actor *Actor, doctorSpecialty *dto.RequestModeratorDoctorSpecialty) error
+
+	RotateSigningKey(actor *Actor, rotateKey *dto.RequestModeratorRotateSigningKey) error
+	RevokeSigningKey(actor *Actor, revokeKey *dto.RequestModeratorRevokeSigningKey) error
+	FindSigningKeys(doctorId *dto.QueryModeratorGetSigningKeys, dtoKeys *[]dto.ResponseModeratorSigningKey) error
 }
 
 type doctorModeratorService struct {
-	authSession session.AuthSession
-	repo        repo.DoctorModeratorRepo
+	authSession        session.AuthSession
+	repo               repo.DoctorModeratorRepo
+	uow                repo.UnitOfWork
+	prescriptionConfig *config.PrescriptionConfig
 }
 
 func NewDoctorModeratorService() DoctorModeratorService {
 	return &doctorModeratorService{
-		authSession: session.NewAuthSession("moderator:doctor"),
-		repo:        repo.NewDoctorModeratorRepo(),
+		authSession:        session.NewAuthSession("moderator:doctor"),
+		repo:               repo.NewDoctorModeratorRepo(),
+		uow:                repo.NewUnitOfWork(),
+		prescriptionConfig: config.LoadPrescriptionConfig(),
 	}
 }
 
@@ -91,59 +129,537 @@ func (m *doctorModeratorService) GetAuthenticationSession(sessionID uuid.UUID) (
 
 }
 
-func (m *doctorModeratorService) CreateDoctor(createDoctor *dto.RequestModeratorCreateDoctor) error {
+func (m *doctorModeratorService) CreateDoctor(actor *Actor, createDoctor *dto.RequestModeratorCreateDoctor) error {
+	if err := m.verifyPhysicianRegistry(createDoctor); err != nil {
+		return err
+	}
+
 	password, err := bcrypt.GenerateFromPassword([]byte(createDoctor.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 
+	doctorId := uuid.New()
+	signingKey := models.DoctorSigningKey{}
+
+	if err := generateSigningKey(m.prescriptionConfig.SigningMasterKey, doctorId, &signingKey); err != nil {
+		return err
+	}
+
 	newDoctorAuth := models.DoctorAuth{
-		ID:       uuid.New(),
+		ID:       doctorId,
 		Email:    createDoctor.Email,
 		Password: string(password),
 		Doctor: models.Doctor{
-			FirstName:  createDoctor.FirstName,
-			SecondName: createDoctor.SecondName,
-			LastName:   createDoctor.LastName,
-			UIN:        createDoctor.UIN,
-			Email:      createDoctor.Email,
+			FirstName:        createDoctor.FirstName,
+			SecondName:       createDoctor.SecondName,
+			LastName:         createDoctor.LastName,
+			UIN:              createDoctor.UIN,
+			Email:            createDoctor.Email,
+			LicenceCheckedAt: time.Now(),
 		},
 	}
 
-	if err := m.repo.CreateDoctor(&newDoctorAuth); err != nil {
+	audit := actor.audit(models.AuditCreate, models.AuditedDoctor, doctorId, setValues(map[string]interface{}{
+		"first_name":  createDoctor.FirstName,
+		"second_name": createDoctor.SecondName,
+		"last_name":   createDoctor.LastName,
+		"uin":         createDoctor.UIN,
+		"email":       createDoctor.Email,
+	}))
+
+	return m.uow.Do(func(w repo.Work) error {
+		if err := w.DoctorModerator().CreateDoctor(&newDoctorAuth); err != nil {
+			return err
+		}
+
+		if err := w.DoctorModerator().CreateSigningKey(&signingKey); err != nil {
+			return err
+		}
+
+		return w.Audit(audit)
+	})
+}
+
+func (m *doctorModeratorService) DeleteDoctor(actor *Actor, doctorId *dto.QueryModeratorDeleteDoctor) error {
+	return m.repo.DeleteDoctor(doctorId.DoctorId, actor.audit(models.AuditDelete, models.AuditedDoctor, doctorId.DoctorId, deletedDiff))
+}
+
+func (m *doctorModeratorService) RestoreDoctor(actor *Actor, doctorId *dto.QueryModeratorRestoreDoctor) error {
+	return m.repo.RestoreDoctor(doctorId.DoctorId, actor.audit(models.AuditRestore, models.AuditedDoctor, doctorId.DoctorId, restoredDiff))
+}
+
+func (m *doctorModeratorService) FindAllDoctors(query *dto.QueryModeratorGetDoctors, dtoDoctors *dto.ResponseList[dto.ResponseModeratorGetDoctors]) error {
+	var doctors []models.Doctor
+	var total int64
+
+	filter := repo.DoctorListFilter{
+		Name:               query.Name,
+		UIN:                query.UIN,
+		Email:              query.Email,
+		SpecialtyCode:      query.Specialty,
+		PrescribingBlocked: query.PrescribingBlocked,
+		Deleted:            query.Deleted,
+	}
+	spec := listSpec(&query.QueryList)
+
+	if err := m.repo.FindAllDoctors(&filter, spec, &doctors, &total); err != nil {
 		return err
 	}
 
+	*dtoDoctors = listPage[dto.ResponseModeratorGetDoctors](spec, total, len(doctors))
+
+	for i, doc := range doctors {
+		dtoDoctors.Items[i] = dto.ResponseModeratorGetDoctors{
+			ID:                 doc.ID,
+			FirstName:          doc.FirstName,
+			SecondName:         doc.SecondName,
+			LastName:           doc.LastName,
+			Email:              doc.Email,
+			UIN:                doc.UIN,
+			PrescribingBlocked: doc.PrescribingBlocked,
+			Specialties:        specialtiesToDto(doc.Specialties),
+			Version:            doc.Version,
+		}
+	}
+
 	return nil
 }
 
-func (m *doctorModeratorService) DeleteDoctor(doctorId *dto.QueryModeratorDeleteDoctor) error {
-	return m.repo.DeleteDoctor(doctorId.DoctorId)
+// UpdateDoctor applies the fields set in updateDoctor when the doctor is still at the version
+// they were made against. Changed names or UIN are checked against the physician registry again.
+func (m *doctorModeratorService) UpdateDoctor(actor *Actor, updateDoctor *dto.RequestModeratorUpdateDoctor, updated *dto.ResponseUpdated) error {
+	doctor := models.Doctor{}
+
+	if err := m.repo.FindDoctorById(updateDoctor.DoctorId, &doctor); err != nil {
+		return err
+	}
+
+	if doctor.Version != updateDoctor.Version {
+		return repo.ErrVersionConflict
+	}
+
+	changes := newChangeSet()
+	setField(changes, "first_name", doctor.FirstName, updateDoctor.FirstName)
+	setField(changes, "second_name", doctor.SecondName, updateDoctor.SecondName)
+	setField(changes, "last_name", doctor.LastName, updateDoctor.LastName)
+	setField(changes, "uin", doctor.UIN, updateDoctor.UIN)
+	setField(changes, "email", doctor.Email, updateDoctor.Email)
+
+	updated.Version = doctor.Version
+
+	if changes.empty() {
+		return nil
+	}
+
+	if changes.changed("first_name") || changes.changed("second_name") || changes.changed("last_name") || changes.changed("uin") {
+		registered := dto.RequestModeratorCreateDoctor{
+			FirstName:  valueOr(updateDoctor.FirstName, doctor.FirstName),
+			SecondName: valueOr(updateDoctor.SecondName, doctor.SecondName),
+			LastName:   valueOr(updateDoctor.LastName, doctor.LastName),
+			UIN:        valueOr(updateDoctor.UIN, doctor.UIN),
+		}
+
+		if err := m.verifyPhysicianRegistry(&registered); err != nil {
+			return err
+		}
+	}
+
+	change := changes.record(models.ChangedDoctor, doctor.ID, doctor.Version, actor.ID)
+
+	if err := m.repo.UpdateDoctor(doctor.ID, doctor.Version, changes.updates, change,
+		actor.audit(models.AuditUpdate, models.AuditedDoctor, doctor.ID, changes.diff())); err != nil {
+		return err
+	}
+
+	updated.Version = change.Version
+
+	return nil
 }
 
-func (m *doctorModeratorService) FindAllDoctors(dtoDoctors *[]dto.ResponseModeratorGetDoctors) error {
-	var doctors []models.Doctor
+func (m *doctorModeratorService) FindDoctorChanges(doctorId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error {
+	var changes []models.EntityChange
 
-	if err := m.repo.FindAllDoctors(&doctors); err != nil {
+	if err := m.repo.FindDoctorChanges(doctorId.Id, &changes); err != nil {
 		return err
 	}
 
-	*dtoDoctors = make([]dto.ResponseModeratorGetDoctors, len(doctors))
+	*dtoChanges = changesToDto(changes)
 
-	for i, doc := range doctors {
-		(*dtoDoctors)[i] = dto.ResponseModeratorGetDoctors{
-			ID:         doc.ID,
-			FirstName:  doc.FirstName,
-			SecondName: doc.SecondName,
-			LastName:   doc.LastName,
-			Email:      doc.Email,
-			UIN:        doc.UIN,
+	return nil
+}
+
+func (m *doctorModeratorService) verifyPhysicianRegistry(createDoctor *dto.RequestModeratorCreateDoctor) error {
+	entry := models.PhysicianRegistryEntry{}
+
+	if err := m.repo.FindPhysicianRegistryEntry(createDoctor.UIN, &entry); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUinNotRegistered
+		}
+		return err
+	}
+
+	if !strings.EqualFold(strings.TrimSpace(entry.FirstName), strings.TrimSpace(createDoctor.FirstName)) ||
+		!strings.EqualFold(strings.TrimSpace(entry.LastName), strings.TrimSpace(createDoctor.LastName)) ||
+		(entry.SecondName != "" && !strings.EqualFold(strings.TrimSpace(entry.SecondName), strings.TrimSpace(createDoctor.SecondName))) {
+		return ErrUinNameMismatch
+	}
+
+	if entry.Status != models.LicenceActive {
+		return ErrUinLicenceInactive
+	}
+
+	return nil
+}
+
+// ImportPhysicianRegistry replaces the local physician registry with a CSV snapshot of the
+// medical-association register. The snapshot must have a header with the columns
+// uin, first_name, second_name, last_name and status.
+func (m *doctorModeratorService) ImportPhysicianRegistry(actor *Actor, registry io.Reader, result *dto.ResponseModeratorImportRegistry) error {
+	entries, err := parsePhysicianRegistry(registry, time.Now())
+	if err != nil {
+		return err
+	}
+
+	audit := actor.audit(models.AuditImport, models.AuditedPhysicianRegistry, uuid.Nil, setValues(map[string]interface{}{
+		"entries": len(entries),
+	}))
+
+	if err := m.repo.ReplacePhysicianRegistry(&entries, audit); err != nil {
+		return err
+	}
+
+	result.Imported = len(entries)
+
+	return nil
+}
+
+// parsePhysicianRegistry reads the entries of a registry snapshot. Every UIN may be listed
+// only once and a snapshot without entries is refused, since it would block every doctor.
+func parsePhysicianRegistry(registry io.Reader, importedAt time.Time) ([]models.PhysicianRegistryEntry, error) {
+	reader := csv.NewReader(registry)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.Join(ErrRegistryInvalidCsv, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	for _, column := range []string{"uin", "first_name", "second_name", "last_name", "status"} {
+		if _, ok := columns[column]; !ok {
+			return nil, ErrRegistryInvalidCsv
+		}
+	}
+
+	entries := make([]models.PhysicianRegistryEntry, 0)
+	listed := make(map[string]bool)
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Join(ErrRegistryInvalidCsv, err)
+		}
+
+		status := models.LicenceStatus(strings.ToLower(strings.TrimSpace(record[columns["status"]])))
+		if status != models.LicenceActive && status != models.LicenceSuspended && status != models.LicenceRevoked {
+			return nil, ErrRegistryInvalidCsv
+		}
+
+		uin := strings.TrimSpace(record[columns["uin"]])
+		if listed[uin] {
+			return nil, fmt.Errorf("%w: uin %s is listed more than once", ErrRegistryInvalidCsv, uin)
+		}
+		listed[uin] = true
+
+		entries = append(entries, models.PhysicianRegistryEntry{
+			UIN:        uin,
+			FirstName:  strings.TrimSpace(record[columns["first_name"]]),
+			SecondName: strings.TrimSpace(record[columns["second_name"]]),
+			LastName:   strings.TrimSpace(record[columns["last_name"]]),
+			Status:     status,
+			ImportedAt: importedAt,
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: registry has no entries", ErrRegistryInvalidCsv)
+	}
+
+	return entries, nil
+}
+
+// RecheckDoctorLicences flags every doctor whose licence is no longer active in the
+// physician registry and returns a page of the doctors that are blocked from prescribing.
+func (m *doctorModeratorService) RecheckDoctorLicences(actor *Actor, query *dto.QueryList, dtoDoctors *dto.ResponseList[dto.ResponseModeratorGetDoctors]) error {
+	if err := recheckDoctorLicences(m.repo, actor, time.Now()); err != nil {
+		return err
+	}
+
+	blocked := true
+
+	return m.FindAllDoctors(&dto.QueryModeratorGetDoctors{QueryList: *query, PrescribingBlocked: &blocked}, dtoDoctors)
+}
+
+func (m *doctorModeratorService) CreateHospital(actor *Actor, createHospital *dto.RequestModeratorCreateHospital) error {
+	newHospital := models.Hospital{
+		ID:          uuid.New(),
+		Type:        common.HospitalType(createHospital.Type),
+		Name:        models.Text(createHospital.Name),
+		Address:     models.Text(createHospital.Address),
+		City:        createHospital.City,
+		PhoneNumber: createHospital.PhoneNumber,
+	}
+
+	return m.repo.CreateHospital(&newHospital, actor.audit(models.AuditCreate, models.AuditedHospital, newHospital.ID, hospitalValues(&newHospital)))
+}
+
+func (m *doctorModeratorService) UpdateHospital(actor *Actor, updateHospital *dto.RequestModeratorUpdateHospital) error {
+	hospital := models.Hospital{
+		ID:          updateHospital.ID,
+		Type:        common.HospitalType(updateHospital.Type),
+		Name:        models.Text(updateHospital.Name),
+		Address:     models.Text(updateHospital.Address),
+		City:        updateHospital.City,
+		PhoneNumber: updateHospital.PhoneNumber,
+	}
+
+	return m.repo.UpdateHospital(&hospital, actor.audit(models.AuditUpdate, models.AuditedHospital, hospital.ID, hospitalValues(&hospital)))
+}
+
+func (m *doctorModeratorService) DeleteHospital(actor *Actor, hospitalId *dto.QueryModeratorDeleteHospital) error {
+	return m.repo.DeleteHospital(hospitalId.HospitalId, actor.audit(models.AuditDelete, models.AuditedHospital, hospitalId.HospitalId, deletedDiff))
+}
+
+func (m *doctorModeratorService) FindAllHospitals(dtoHospitals *[]dto.ResponseHospital) error {
+	var hospitals []models.Hospital
+
+	if err := m.repo.FindAllHospitals(&hospitals); err != nil {
+		return err
+	}
+
+	*dtoHospitals = make([]dto.ResponseHospital, len(hospitals))
+
+	for i := range hospitals {
+		(*dtoHospitals)[i] = *hospitalToDto(&hospitals[i])
+	}
+
+	return nil
+}
+
+// hospitalValues lists the fields of a hospital for the audit log
+func hospitalValues(hospital *models.Hospital) auditDiff {
+	return setValues(map[string]interface{}{
+		"type":         hospital.Type,
+		"name":         hospital.Name,
+		"address":      hospital.Address,
+		"city":         hospital.City,
+		"phone_number": hospital.PhoneNumber,
+	})
+}
+
+func (m *doctorModeratorService) CreateAffiliation(actor *Actor, createAffiliation *dto.RequestModeratorCreateAffiliation) error {
+	newAffiliation := models.DoctorAffiliation{
+		ID:         uuid.New(),
+		DoctorID:   createAffiliation.DoctorId,
+		HospitalID: createAffiliation.HospitalId,
+		Role:       common.AffiliationRole(createAffiliation.Role),
+		StartDate:  createAffiliation.StartDate,
+		EndDate:    createAffiliation.EndDate,
+	}
+
+	values := map[string]interface{}{
+		"doctor_id":   newAffiliation.DoctorID,
+		"hospital_id": newAffiliation.HospitalID,
+		"role":        newAffiliation.Role,
+		"start_date":  newAffiliation.StartDate,
+	}
+	if newAffiliation.EndDate != nil {
+		values["end_date"] = *newAffiliation.EndDate
+	}
+
+	return m.repo.CreateAffiliation(&newAffiliation, actor.audit(models.AuditCreate, models.AuditedAffiliation, newAffiliation.ID, setValues(values)))
+}
+
+func (m *doctorModeratorService) EndAffiliation(actor *Actor, endAffiliation *dto.RequestModeratorEndAffiliation) error {
+	affiliation := models.DoctorAffiliation{}
+
+	if err := m.repo.FindAffiliationById(endAffiliation.AffiliationId, &affiliation); err != nil {
+		return err
+	}
+
+	if endAffiliation.EndDate.Before(affiliation.StartDate) {
+		return ErrAffiliationEndsBeforeStart
+	}
+
+	return m.repo.EndAffiliation(affiliation.ID, endAffiliation.EndDate,
+		actor.audit(models.AuditEnd, models.AuditedAffiliation, affiliation.ID, setValues(map[string]interface{}{
+			"end_date": endAffiliation.EndDate,
+		})))
+}
+
+func (m *doctorModeratorService) DeleteAffiliation(actor *Actor, affiliationId *dto.QueryModeratorDeleteAffiliation) error {
+	return m.repo.DeleteAffiliation(affiliationId.AffiliationId, actor.audit(models.AuditDelete, models.AuditedAffiliation, affiliationId.AffiliationId, deletedDiff))
+}
+
+func (m *doctorModeratorService) FindAffiliations(doctorId *dto.QueryModeratorGetAffiliations, dtoAffiliations *[]dto.ResponseModeratorGetAffiliation) error {
+	var affiliations []models.DoctorAffiliation
+
+	if err := m.repo.FindAffiliationsByDoctorId(doctorId.DoctorId, &affiliations); err != nil {
+		return err
+	}
+
+	*dtoAffiliations = make([]dto.ResponseModeratorGetAffiliation, len(affiliations))
+
+	for i, affiliation := range affiliations {
+		(*dtoAffiliations)[i] = dto.ResponseModeratorGetAffiliation{
+			ID:        affiliation.ID,
+			DoctorId:  affiliation.DoctorID,
+			Hospital:  *hospitalToDto(&affiliation.Hospital),
+			Role:      string(affiliation.Role),
+			StartDate: affiliation.StartDate,
+			EndDate:   affiliation.EndDate,
+		}
+	}
+
+	return nil
+}
+
+func (m *doctorModeratorService) CreateSpecialty(actor *Actor, createSpecialty *dto.RequestModeratorCreateSpecialty) error {
+	newSpecialty := models.Specialty{
+		ID:   uuid.New(),
+		Code: strings.ToUpper(createSpecialty.Code),
+		Name: createSpecialty.Name,
+	}
+
+	return m.repo.CreateSpecialty(&newSpecialty, actor.audit(models.AuditCreate, models.AuditedSpecialty, newSpecialty.ID, setValues(map[string]interface{}{
+		"code": newSpecialty.Code,
+		"name": newSpecialty.Name,
+	})))
+}
+
+func (m *doctorModeratorService) DeleteSpecialty(actor *Actor, specialtyId *dto.QueryModeratorDeleteSpecialty) error {
+	return m.repo.DeleteSpecialty(specialtyId.SpecialtyId, actor.audit(models.AuditDelete, models.AuditedSpecialty, specialtyId.SpecialtyId, deletedDiff))
+}
+
+func (m *doctorModeratorService) FindAllSpecialties(dtoSpecialties *[]dto.ResponseSpecialty) error {
+	var specialties []models.Specialty
+
+	if err := m.repo.FindAllSpecialties(&specialties); err != nil {
+		return err
+	}
+
+	*dtoSpecialties = specialtiesToDto(specialties)
+
+	return nil
+}
+
+func (m *doctorModeratorService) AssignSpecialty(actor *Actor, doctorSpecialty *dto.RequestModeratorDoctorSpecialty) error {
+	return m.repo.AddDoctorSpecialty(doctorSpecialty.DoctorId, doctorSpecialty.SpecialtyId,
+		actor.audit(models.AuditAssign, models.AuditedDoctor, doctorSpecialty.DoctorId, auditDiff{
+			"specialty_id": {After: doctorSpecialty.SpecialtyId.String()},
+		}))
+}
+
+func (m *doctorModeratorService) UnassignSpecialty(actor *Actor, doctorSpecialty *dto.RequestModeratorDoctorSpecialty) error {
+	return m.repo.RemoveDoctorSpecialty(doctorSpecialty.DoctorId, doctorSpecialty.SpecialtyId,
+		actor.audit(models.AuditUnassign, models.AuditedDoctor, doctorSpecialty.DoctorId, auditDiff{
+			"specialty_id": {Before: doctorSpecialty.SpecialtyId.String()},
+		}))
+}
+
+func (m *doctorModeratorService) RotateSigningKey(actor *Actor, rotateKey *dto.RequestModeratorRotateSigningKey) error {
+	signingKey := models.DoctorSigningKey{}
+
+	if err := generateSigningKey(m.prescriptionConfig.SigningMasterKey, rotateKey.DoctorId, &signingKey); err != nil {
+		return err
+	}
+
+	return m.repo.RotateSigningKey(&signingKey, actor.audit(models.AuditRotate, models.AuditedSigningKey, signingKey.ID, setValues(map[string]interface{}{
+		"doctor_id": signingKey.DoctorID,
+	})))
+}
+
+// RevokeSigningKey marks a compromised key. Prescriptions it signed are refused at the
+// pharmacy, and when it was the active key the doctor cannot prescribe until it is rotated.
+func (m *doctorModeratorService) RevokeSigningKey(actor *Actor, revokeKey *dto.RequestModeratorRevokeSigningKey) error {
+	return m.repo.RevokeSigningKey(revokeKey.KeyId, revokeKey.Reason,
+		actor.audit(models.AuditRevoke, models.AuditedSigningKey, revokeKey.KeyId, setValues(map[string]interface{}{
+			"revocation_reason": revokeKey.Reason,
+		})))
+}
+
+func (m *doctorModeratorService) FindSigningKeys(doctorId *dto.QueryModeratorGetSigningKeys, dtoKeys *[]dto.ResponseModeratorSigningKey) error {
+	var keys []models.DoctorSigningKey
+
+	if err := m.repo.FindSigningKeysByDoctorId(doctorId.DoctorId, &keys); err != nil {
+		return err
+	}
+
+	*dtoKeys = make([]dto.ResponseModeratorSigningKey, len(keys))
+
+	for i, key := range keys {
+		(*dtoKeys)[i] = dto.ResponseModeratorSigningKey{
+			ID:               key.ID,
+			DoctorId:         key.DoctorID,
+			PublicKey:        base64.StdEncoding.EncodeToString(key.PublicKey),
+			Status:           string(key.Status),
+			CreatedAt:        key.CreatedAt,
+			RetiredAt:        key.RetiredAt,
+			RevokedAt:        key.RevokedAt,
+			RevocationReason: key.RevocationReason,
 		}
 	}
 
 	return nil
 }
 
+// recheckDoctorLicences refuses to check the licences against an empty registry, which would
+// block every doctor
+func recheckDoctorLicences(doctorModeratorRepo repo.DoctorModeratorRepo, actor *Actor, checkedAt time.Time) error {
+	var registered int64
+
+	if err := doctorModeratorRepo.CountPhysicianRegistryEntries(&registered); err != nil {
+		return err
+	}
+
+	if registered == 0 {
+		return ErrRegistryEmpty
+	}
+
+	audit := actor.audit(models.AuditRecheck, models.AuditedPhysicianRegistry, uuid.Nil, auditDiff{})
+
+	return doctorModeratorRepo.RecheckDoctorLicences(checkedAt, audit)
+}
+
+// ScheduleLicenceRecheck re-checks the licences of all doctors against the physician
+// registry on every tick of the given interval. Without a positive interval nothing is
+// scheduled.
+func ScheduleLicenceRecheck(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("licence recheck interval %s is not positive, licences are not rechecked", interval)
+		return
+	}
+
+	doctorModeratorRepo := repo.NewDoctorModeratorRepo()
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			if err := recheckDoctorLicences(doctorModeratorRepo, systemActor, time.Now()); err != nil {
+				log.Println("licence recheck failed:", err)
+			}
+		}
+	}()
+}
+
 // PHARMA
 
 type PharmaModeratorService interface {
@@ -151,20 +667,30 @@ type PharmaModeratorService interface {
 
 	GetAuthenticationSession(sessionID uuid.UUID) (uuid.UUID, error)
 
-	CreatePharmacyAndOwner(createPharmacy *dto.RequestModeratorCreatePharmacy) error
-	DeletePharmacy(pharmacyId *dto.QueryModeratorDeletePharmacy) error
-	FindAllPharmacies(dtoPharmacies *[]dto.ResponseModeratorGetPharmacies) error
+	CreatePharmacyAndOwner(actor *Actor, createPharmacy *dto.RequestModeratorCreatePharmacy) error
+	DeletePharmacy(actor *Actor, pharmacyId *dto.QueryModeratorDeletePharmacy) error
+	RestorePharmacy(actor *Actor, pharmacyId *dto.QueryModeratorRestorePharmacy) error
+	FindAllPharmacies(query *dto.QueryModeratorGetPharmacies, dtoPharmacies *dto.ResponseList[dto.ResponseModeratorGetPharmacies]) error
+	UpdatePharmacy(actor *Actor, updatePharmacy *dto.RequestModeratorUpdatePharmacy, updated *dto.ResponseUpdated) error
+	FindPharmacyChanges(pharmacyId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error
+
+	FindAllRegistrations(query *dto.QueryModeratorGetRegistrations, dtoRegistrations *dto.ResponseList[dto.ResponseModeratorGetRegistration]) error
+	ReviewRegistration(actor *Actor, review *dto.RequestModeratorReviewRegistration) error
 }
 
 type pharmaModeratorService struct {
 	authSession session.AuthSession
 	repo        repo.PharmaModeratorRepo
+	uow         repo.UnitOfWork
+	notifier    Notifier
 }
 
 func NewPharmaModeratorService() PharmaModeratorService {
 	return &pharmaModeratorService{
 		authSession: session.NewAuthSession("moderator:pharmacy"),
 		repo:        repo.NewPharmaModeratorRepo(),
+		uow:         repo.NewUnitOfWork(),
+		notifier:    NewNotifier(),
 	}
 }
 
@@ -177,7 +703,7 @@ func (m *pharmaModeratorService) GetAuthenticationSession(sessionID uuid.UUID) (
 
 }
 
-func (m *pharmaModeratorService) CreatePharmacyAndOwner(createPharmacy *dto.RequestModeratorCreatePharmacy) error {
+func (m *pharmaModeratorService) CreatePharmacyAndOwner(actor *Actor, createPharmacy *dto.RequestModeratorCreatePharmacy) error {
 	password, err := bcrypt.GenerateFromPassword([]byte(createPharmacy.OwnerPassword), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -198,41 +724,231 @@ func (m *pharmaModeratorService) CreatePharmacyAndOwner(createPharmacy *dto.Requ
 		OwnerID: newPharmacyOwnerAuth.ID,
 	}
 
-	if err := m.repo.CreatePharmacyOwner(&newPharmacyOwnerAuth); err != nil {
-		return err
-	}
+	audit := actor.audit(models.AuditCreate, models.AuditedPharmacy, newPharmacy.ID, setValues(map[string]interface{}{
+		"name":        newPharmacy.Name,
+		"owner_id":    newPharmacy.OwnerID,
+		"owner_name":  createPharmacy.OwnerName,
+		"owner_email": createPharmacy.OwnerEmail,
+	}))
 
-	if err := m.repo.CreatePharmacy(&newPharmacy); err != nil {
-		return err
-	}
+	return m.uow.Do(func(w repo.Work) error {
+		if err := w.PharmaModerator().CreatePharmacyOwner(&newPharmacyOwnerAuth); err != nil {
+			return err
+		}
 
-	return nil
+		if err := w.PharmaModerator().CreatePharmacy(&newPharmacy); err != nil {
+			return err
+		}
+
+		return w.Audit(audit)
+	})
+}
+
+func (m *pharmaModeratorService) DeletePharmacy(actor *Actor, pharmacyId *dto.QueryModeratorDeletePharmacy) error {
+	return m.repo.DeletePharmacy(pharmacyId.PharmacyId, actor.audit(models.AuditDelete, models.AuditedPharmacy, pharmacyId.PharmacyId, deletedDiff))
 }
 
-func (m *pharmaModeratorService) DeletePharmacy(pharmacyId *dto.QueryModeratorDeletePharmacy) error {
-	return m.repo.DeletePharmacy(pharmacyId.PharmacyId)
+func (m *pharmaModeratorService) RestorePharmacy(actor *Actor, pharmacyId *dto.QueryModeratorRestorePharmacy) error {
+	return m.repo.RestorePharmacy(pharmacyId.PharmacyId, actor.audit(models.AuditRestore, models.AuditedPharmacy, pharmacyId.PharmacyId, restoredDiff))
 }
 
-func (m *pharmaModeratorService) FindAllPharmacies(dtoPharmacies *[]dto.ResponseModeratorGetPharmacies) error {
+func (m *pharmaModeratorService) FindAllPharmacies(query *dto.QueryModeratorGetPharmacies, dtoPharmacies *dto.ResponseList[dto.ResponseModeratorGetPharmacies]) error {
 	var pharmacies []models.PharmacyBrand
+	var total int64
 
-	if err := m.repo.FindAllPharmacies(&pharmacies); err != nil {
+	filter := repo.PharmacyListFilter{
+		Name:      query.Name,
+		OwnerName: query.Owner,
+		Deleted:   query.Deleted,
+	}
+	spec := listSpec(&query.QueryList)
+
+	if err := m.repo.FindAllPharmacies(&filter, spec, &pharmacies, &total); err != nil {
 		return err
 	}
 
-	*dtoPharmacies = make([]dto.ResponseModeratorGetPharmacies, len(pharmacies))
+	*dtoPharmacies = listPage[dto.ResponseModeratorGetPharmacies](spec, total, len(pharmacies))
 
 	for i, pharmacy := range pharmacies {
-		(*dtoPharmacies)[i] = dto.ResponseModeratorGetPharmacies{
+		dtoPharmacies.Items[i] = dto.ResponseModeratorGetPharmacies{
 			ID:        pharmacy.ID,
 			Name:      pharmacy.Name,
 			OwnerName: pharmacy.Owner.Name,
+			Version:   pharmacy.Version,
+		}
+	}
+
+	return nil
+}
+
+func (m *pharmaModeratorService) UpdatePharmacy(actor *Actor, updatePharmacy *dto.RequestModeratorUpdatePharmacy, updated *dto.ResponseUpdated) error {
+	pharmacy := models.PharmacyBrand{}
+
+	if err := m.repo.FindPharmacyById(updatePharmacy.PharmacyId, &pharmacy); err != nil {
+		return err
+	}
+
+	if pharmacy.Version != updatePharmacy.Version {
+		return repo.ErrVersionConflict
+	}
+
+	changes := newChangeSet()
+	setField(changes, "name", pharmacy.Name, updatePharmacy.Name)
+	setField(changes, "website", pharmacy.Website, updatePharmacy.Website)
+	setField(changes, "headquarters_address", pharmacy.HeadquartersAddress, updatePharmacy.HeadquartersAddress)
+
+	updated.Version = pharmacy.Version
+
+	if changes.empty() {
+		return nil
+	}
+
+	change := changes.record(models.ChangedPharmacy, pharmacy.ID, pharmacy.Version, actor.ID)
+
+	if err := m.repo.UpdatePharmacy(pharmacy.ID, pharmacy.Version, changes.updates, change,
+		actor.audit(models.AuditUpdate, models.AuditedPharmacy, pharmacy.ID, changes.diff())); err != nil {
+		return err
+	}
+
+	updated.Version = change.Version
+
+	return nil
+}
+
+func (m *pharmaModeratorService) FindPharmacyChanges(pharmacyId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error {
+	var changes []models.EntityChange
+
+	if err := m.repo.FindPharmacyChanges(pharmacyId.Id, &changes); err != nil {
+		return err
+	}
+
+	*dtoChanges = changesToDto(changes)
+
+	return nil
+}
+
+func (m *pharmaModeratorService) FindAllRegistrations(query *dto.QueryModeratorGetRegistrations, dtoRegistrations *dto.ResponseList[dto.ResponseModeratorGetRegistration]) error {
+	var registrations []models.PharmacyRegistration
+	var total int64
+
+	filter := repo.RegistrationListFilter{
+		Status:      models.RegistrationStatus(query.Status),
+		CompanyName: query.Company,
+	}
+	spec := listSpec(&query.QueryList)
+
+	if err := m.repo.FindAllRegistrations(&filter, spec, &registrations, &total); err != nil {
+		return err
+	}
+
+	*dtoRegistrations = listPage[dto.ResponseModeratorGetRegistration](spec, total, len(registrations))
+
+	for i, registration := range registrations {
+		dtoRegistrations.Items[i] = dto.ResponseModeratorGetRegistration{
+			Id:                  registration.ID,
+			CompanyName:         registration.CompanyName,
+			CompanyNumber:       registration.CompanyNumber,
+			Website:             registration.Website,
+			LicenceNumber:       registration.LicenceNumber,
+			HeadquartersAddress: registration.HeadquartersAddress,
+			OwnerName:           registration.OwnerName,
+			OwnerEmail:          registration.OwnerEmail,
+			OwnerPhone:          registration.OwnerPhone,
+			Status:              string(registration.Status),
+			SubmittedAt:         registration.SubmittedAt,
+			PharmacyId:          registration.PharmacyBrandID,
+			Reviews:             reviewsToDto(registration.Reviews),
+		}
+	}
+
+	return nil
+}
+
+// ReviewRegistration decides a pending registration. Approving it creates the owner account
+// with the password the applicant chose and the pharmacy with the company data. The applicant
+// is told the outcome either way.
+func (m *pharmaModeratorService) ReviewRegistration(actor *Actor, reviewRegistration *dto.RequestModeratorReviewRegistration) error {
+	registration := models.PharmacyRegistration{}
+
+	if err := m.repo.FindRegistrationById(reviewRegistration.RegistrationId, &registration); err != nil {
+		return err
+	}
+
+	review := models.PharmacyRegistrationReview{
+		ID:             uuid.New(),
+		RegistrationID: registration.ID,
+		ModeratorID:    actor.ID,
+		Decision:       common.RegistrationDecision(reviewRegistration.Decision),
+		Comment:        reviewRegistration.Comment,
+		ReviewedAt:     time.Now(),
+	}
+
+	switch review.Decision {
+	case common.ApproveRegistration:
+		owner := models.PharmacyOwnerAuth{
+			ID:       uuid.New(),
+			Email:    registration.OwnerEmail,
+			Password: registration.OwnerPassword,
+			PharmacyOwner: models.PharmacyOwner{
+				Name: registration.OwnerName,
+			},
 		}
+
+		pharmacy := models.PharmacyBrand{
+			ID:                  uuid.New(),
+			Name:                registration.CompanyName,
+			Website:             registration.Website,
+			OwnerID:             owner.ID,
+			HeadquartersAddress: registration.HeadquartersAddress,
+			LicenceNumber:       registration.LicenceNumber,
+		}
+
+		audit := actor.audit(models.AuditReview, models.AuditedRegistration, registration.ID, auditDiff{
+			"status":      {Before: string(registration.Status), After: string(models.RegistrationApproved)},
+			"pharmacy_id": {After: pharmacy.ID.String()},
+			"owner_id":    {After: owner.ID.String()},
+		})
+
+		if err := m.repo.ApproveRegistration(&review, &owner, &pharmacy, audit); err != nil {
+			return err
+		}
+
+		notifyApplicant(m.notifier, &registration, "Pharmacy registration approved", fmt.Sprintf(
+			"The registration of %s was approved. You can now sign in as the pharmacy owner with %s.",
+			registration.CompanyName, registration.OwnerEmail))
+
+	case common.RejectRegistration:
+		if err := m.decideRegistration(actor, &registration, &review, models.RegistrationRejected); err != nil {
+			return err
+		}
+
+		notifyApplicant(m.notifier, &registration, "Pharmacy registration rejected", fmt.Sprintf(
+			"The registration of %s was rejected.\n\n%s",
+			registration.CompanyName, review.Comment))
+
+	case common.RequestRegistrationChanges:
+		if err := m.decideRegistration(actor, &registration, &review, models.RegistrationChangesRequested); err != nil {
+			return err
+		}
+
+		notifyApplicant(m.notifier, &registration, "Pharmacy registration needs changes", fmt.Sprintf(
+			"The registration of %s needs changes before it can be approved.\n\n%s\n\nSubmit the corrected registration with your reference %s.",
+			registration.CompanyName, review.Comment, registration.ID))
 	}
 
 	return nil
 }
 
+// decideRegistration stores a review that does not provision anything
+func (m *pharmaModeratorService) decideRegistration(actor *Actor, registration *models.PharmacyRegistration, review *models.PharmacyRegistrationReview, status models.RegistrationStatus) error {
+	audit := actor.audit(models.AuditReview, models.AuditedRegistration, registration.ID, auditDiff{
+		"status":  {Before: string(registration.Status), After: string(status)},
+		"comment": {After: review.Comment},
+	})
+
+	return m.repo.ReviewRegistration(review, status, audit)
+}
+
 // MEDICAMENT
 
 type MedicamentModeratorService interface {
@@ -240,9 +956,15 @@ type MedicamentModeratorService interface {
 
 	GetAuthenticationSession(sessionID uuid.UUID) (uuid.UUID, error)
 
-	CreateMedicament(createMedicament *dto.RequestModeratorCreateMedicament) error
-	DeleteMedicament(medicamentId *dto.QueryModeratorDeleteMedicament) error
-	FindAllMedicaments(dtoMedicaments *[]dto.ResponseModeratorGetMedicaments) error
+	CreateMedicament(actor *Actor, createMedicament *dto.RequestModeratorCreateMedicament) error
+	DeleteMedicament(actor *Actor, medicamentId *dto.QueryModeratorDeleteMedicament) error
+	RestoreMedicament(actor *Actor, medicamentId *dto.QueryModeratorRestoreMedicament) error
+	FindAllMedicaments(query *dto.QueryModeratorGetMedicaments, dtoMedicaments *dto.ResponseList[dto.ResponseModeratorGetMedicaments]) error
+	UpdateMedicament(actor *Actor, updateMedicament *dto.RequestModeratorUpdateMedicament, updated *dto.ResponseUpdated) error
+	FindMedicamentChanges(medicamentId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error
+
+	FindAllSpecialties(dtoSpecialties *[]dto.ResponseSpecialty) error
+	SetMedicamentRestrictions(actor *Actor, restrictions *dto.RequestModeratorMedicamentRestrictions) error
 }
 
 type medicamentModeratorService struct {
@@ -265,7 +987,7 @@ func (m *medicamentModeratorService) GetAuthenticationSession(sessionID uuid.UUI
 	return m.authSession.GetAuthSession(sessionID)
 }
 
-func (m *medicamentModeratorService) CreateMedicament(createMedicament *dto.RequestModeratorCreateMedicament) error {
+func (m *medicamentModeratorService) CreateMedicament(actor *Actor, createMedicament *dto.RequestModeratorCreateMedicament) error {
 	newMedicament := models.Medicament{
 		ID:           uuid.New(),
 		OfficialName: createMedicament.OfficialName,
@@ -278,32 +1000,125 @@ func (m *medicamentModeratorService) CreateMedicament(createMedicament *dto.Requ
 
 	newMedicament.ActiveIngredients = strings.Join(temp, ",")
 
-	return m.repo.CreateMedicament(&newMedicament)
+	return m.repo.CreateMedicament(&newMedicament, actor.audit(models.AuditCreate, models.AuditedMedicament, newMedicament.ID, setValues(map[string]interface{}{
+		"official_name":      newMedicament.OfficialName,
+		"atc":                newMedicament.ATC,
+		"active_ingredients": newMedicament.ActiveIngredients,
+	})))
+}
+func (m *medicamentModeratorService) DeleteMedicament(actor *Actor, medicamentId *dto.QueryModeratorDeleteMedicament) error {
+	return m.repo.DeleteMedicament(medicamentId.MedicamentId, actor.audit(models.AuditDelete, models.AuditedMedicament, medicamentId.MedicamentId, deletedDiff))
 }
-func (m *medicamentModeratorService) DeleteMedicament(medicamentId *dto.QueryModeratorDeleteMedicament) error {
-	return m.repo.DeleteMedicament(medicamentId.MedicamentId)
+
+func (m *medicamentModeratorService) RestoreMedicament(actor *Actor, medicamentId *dto.QueryModeratorRestoreMedicament) error {
+	return m.repo.RestoreMedicament(medicamentId.MedicamentId, actor.audit(models.AuditRestore, models.AuditedMedicament, medicamentId.MedicamentId, restoredDiff))
 }
-func (m *medicamentModeratorService) FindAllMedicaments(dtoMedicaments *[]dto.ResponseModeratorGetMedicaments) error {
+func (m *medicamentModeratorService) FindAllMedicaments(query *dto.QueryModeratorGetMedicaments, dtoMedicaments *dto.ResponseList[dto.ResponseModeratorGetMedicaments]) error {
 	var medicaments []models.Medicament
+	var total int64
+
+	filter := repo.MedicamentListFilter{
+		Name:       query.Name,
+		ATC:        query.ATC,
+		Restricted: query.Restricted,
+		Deleted:    query.Deleted,
+	}
+	spec := listSpec(&query.QueryList)
 
-	if err := m.repo.FindAllMedicaments(&medicaments); err != nil {
+	if err := m.repo.FindAllMedicaments(&filter, spec, &medicaments, &total); err != nil {
 		return err
 	}
 
-	*dtoMedicaments = make([]dto.ResponseModeratorGetMedicaments, len(medicaments))
+	*dtoMedicaments = listPage[dto.ResponseModeratorGetMedicaments](spec, total, len(medicaments))
 
 	for i, medicament := range medicaments {
-		(*dtoMedicaments)[i] = dto.ResponseModeratorGetMedicaments{
-			ID:                medicament.ID,
-			OfficialName:      medicament.OfficialName,
-			ATC:               medicament.ATC,
-			ActiveIngredients: strings.Split(medicament.ActiveIngredients, ","),
+		dtoMedicaments.Items[i] = dto.ResponseModeratorGetMedicaments{
+			ID:                      medicament.ID,
+			OfficialName:            medicament.OfficialName,
+			ATC:                     medicament.ATC,
+			ActiveIngredients:       strings.Split(medicament.ActiveIngredients, ","),
+			RestrictedToSpecialties: specialtiesToDto(medicament.RestrictedToSpecialties),
+			Version:                 medicament.Version,
 		}
 	}
 
 	return nil
 }
 
+func (m *medicamentModeratorService) UpdateMedicament(actor *Actor, updateMedicament *dto.RequestModeratorUpdateMedicament, updated *dto.ResponseUpdated) error {
+	medicament := models.Medicament{}
+
+	if err := m.repo.FindMedicamentById(updateMedicament.MedicamentId, &medicament); err != nil {
+		return err
+	}
+
+	if medicament.Version != updateMedicament.Version {
+		return repo.ErrVersionConflict
+	}
+
+	changes := newChangeSet()
+	setField(changes, "official_name", medicament.OfficialName, updateMedicament.OfficialName)
+	setField(changes, "atc", medicament.ATC, updateMedicament.ATC)
+
+	if updateMedicament.ActiveIngredients != nil {
+		ingredients := strings.Join(*updateMedicament.ActiveIngredients, ",")
+		setField(changes, "active_ingredients", medicament.ActiveIngredients, &ingredients)
+	}
+
+	updated.Version = medicament.Version
+
+	if changes.empty() {
+		return nil
+	}
+
+	change := changes.record(models.ChangedMedicament, medicament.ID, medicament.Version, actor.ID)
+
+	if err := m.repo.UpdateMedicament(medicament.ID, medicament.Version, changes.updates, change,
+		actor.audit(models.AuditUpdate, models.AuditedMedicament, medicament.ID, changes.diff())); err != nil {
+		return err
+	}
+
+	updated.Version = change.Version
+
+	return nil
+}
+
+func (m *medicamentModeratorService) FindMedicamentChanges(medicamentId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error {
+	var changes []models.EntityChange
+
+	if err := m.repo.FindMedicamentChanges(medicamentId.Id, &changes); err != nil {
+		return err
+	}
+
+	*dtoChanges = changesToDto(changes)
+
+	return nil
+}
+
+func (m *medicamentModeratorService) FindAllSpecialties(dtoSpecialties *[]dto.ResponseSpecialty) error {
+	var specialties []models.Specialty
+
+	if err := m.repo.FindAllSpecialties(&specialties); err != nil {
+		return err
+	}
+
+	*dtoSpecialties = specialtiesToDto(specialties)
+
+	return nil
+}
+
+func (m *medicamentModeratorService) SetMedicamentRestrictions(actor *Actor, restrictions *dto.RequestModeratorMedicamentRestrictions) error {
+	specialtyIds := make([]string, len(restrictions.SpecialtyIds))
+	for i, specialtyId := range restrictions.SpecialtyIds {
+		specialtyIds[i] = specialtyId.String()
+	}
+
+	return m.repo.ReplaceMedicamentRestrictions(restrictions.MedicamentId, restrictions.SpecialtyIds,
+		actor.audit(models.AuditUpdate, models.AuditedMedicament, restrictions.MedicamentId, setValues(map[string]interface{}{
+			"restricted_to_specialties": strings.Join(specialtyIds, ","),
+		})))
+}
+
 // CITIZEN
 
 type CitizenModeratorService interface {
@@ -311,20 +1126,25 @@ type CitizenModeratorService interface {
 
 	GetAuthenticationSession(sessionID uuid.UUID) (uuid.UUID, error)
 
-	CreateCitizen(createCitizen *dto.RequestModeratorCreateCitizen) error
-	DeleteCitizen(citizenId *dto.QueryModeratorDeleteCitizen) error
-	FindAllCitizens(dtoCitizens *[]dto.ResponseModeratorGetCitizens) error
+	CreateCitizen(actor *Actor, createCitizen *dto.RequestModeratorCreateCitizen) error
+	DeleteCitizen(actor *Actor, citizenId *dto.QueryModeratorDeleteCitizen) error
+	RestoreCitizen(actor *Actor, citizenId *dto.QueryModeratorRestoreCitizen) error
+	FindAllCitizens(query *dto.QueryModeratorGetCitizens, dtoCitizens *dto.ResponseList[dto.ResponseModeratorGetCitizens]) error
+	UpdateCitizen(actor *Actor, updateCitizen *dto.RequestModeratorUpdateCitizen, updated *dto.ResponseUpdated) error
+	FindCitizenChanges(citizenId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error
 }
 
 type citizenModeratorService struct {
 	authSession session.AuthSession
 	repo        repo.CitizenModeratorRepo
+	uow         repo.UnitOfWork
 }
 
 func NewCitizenModeratorService() CitizenModeratorService {
 	return &citizenModeratorService{
 		authSession: session.NewAuthSession("moderator:citizen"),
 		repo:        repo.NewCitizenModeratorRepo(),
+		uow:         repo.NewUnitOfWork(),
 	}
 }
 
@@ -337,7 +1157,17 @@ func (m *citizenModeratorService) GetAuthenticationSession(sessionID uuid.UUID)
 
 }
 
-func (m *citizenModeratorService) CreateCitizen(createCitizen *dto.RequestModeratorCreateCitizen) error {
+func (m *citizenModeratorService) CreateCitizen(actor *Actor, createCitizen *dto.RequestModeratorCreateCitizen) error {
+	birthday, female, err := dto.ParseUcn(createCitizen.UCN)
+	if err != nil {
+		return err
+	}
+
+	sex := models.Male
+	if female {
+		sex = models.Female
+	}
+
 	password, err := bcrypt.GenerateFromPassword([]byte(createCitizen.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -351,39 +1181,135 @@ func (m *citizenModeratorService) CreateCitizen(createCitizen *dto.RequestModera
 			FirstName:  createCitizen.FirstName,
 			SecondName: createCitizen.SecondName,
 			LastName:   createCitizen.LastName,
+			Birthday:   birthday,
+			Sex:        sex,
 			UCN:        createCitizen.UCN,
 			Email:      createCitizen.Email,
 			//PersonalDoctorID: createCitizen.PersonalDoctorId,
 		},
 	}
 
-	if err := m.repo.CreateCitizen(&newCitizenAuth); err != nil {
-		return err
-	}
+	audit := actor.audit(models.AuditCreate, models.AuditedCitizen, newCitizenAuth.ID, setValues(map[string]interface{}{
+		"first_name":  createCitizen.FirstName,
+		"second_name": createCitizen.SecondName,
+		"last_name":   createCitizen.LastName,
+		"birthday":    birthday,
+		"sex":         sex,
+		"ucn":         createCitizen.UCN,
+		"email":       createCitizen.Email,
+	}))
+
+	return m.uow.Do(func(w repo.Work) error {
+		if err := w.CitizenModerator().CreateCitizen(&newCitizenAuth); err != nil {
+			return err
+		}
 
-	return nil
+		return w.Audit(audit)
+	})
+}
+func (m *citizenModeratorService) DeleteCitizen(actor *Actor, citizenId *dto.QueryModeratorDeleteCitizen) error {
+	return m.repo.DeleteCitizen(citizenId.CitizenId, actor.audit(models.AuditDelete, models.AuditedCitizen, citizenId.CitizenId, deletedDiff))
 }
-func (m *citizenModeratorService) DeleteCitizen(citizenId *dto.QueryModeratorDeleteCitizen) error {
-	return m.repo.DeleteCitizen(citizenId.CitizenId)
+
+func (m *citizenModeratorService) RestoreCitizen(actor *Actor, citizenId *dto.QueryModeratorRestoreCitizen) error {
+	return m.repo.RestoreCitizen(citizenId.CitizenId, actor.audit(models.AuditRestore, models.AuditedCitizen, citizenId.CitizenId, restoredDiff))
 }
-func (m *citizenModeratorService) FindAllCitizens(dtoCitizens *[]dto.ResponseModeratorGetCitizens) error {
+func (m *citizenModeratorService) FindAllCitizens(query *dto.QueryModeratorGetCitizens, dtoCitizens *dto.ResponseList[dto.ResponseModeratorGetCitizens]) error {
 	var citizens []models.Citizen
+	var total int64
 
-	if err := m.repo.FindAllCitizens(&citizens); err != nil {
+	filter := repo.CitizenListFilter{
+		Name:    query.Name,
+		UCN:     query.UCN,
+		Email:   query.Email,
+		Deleted: query.Deleted,
+	}
+	spec := listSpec(&query.QueryList)
+
+	if err := m.repo.FindAllCitizens(&filter, spec, &citizens, &total); err != nil {
 		return err
 	}
 
-	*dtoCitizens = make([]dto.ResponseModeratorGetCitizens, len(citizens))
+	*dtoCitizens = listPage[dto.ResponseModeratorGetCitizens](spec, total, len(citizens))
 
 	for i, citizen := range citizens {
-		(*dtoCitizens)[i] = dto.ResponseModeratorGetCitizens{
+		dtoCitizens.Items[i] = dto.ResponseModeratorGetCitizens{
 			ID:         citizen.ID,
 			FirstName:  citizen.FirstName,
 			SecondName: citizen.SecondName,
 			LastName:   citizen.LastName,
 			UCN:        citizen.UCN,
+			Version:    citizen.Version,
+		}
+	}
+
+	return nil
+}
+
+// UpdateCitizen applies the fields set in updateCitizen when the citizen is still at the version
+// they were made against. A changed UCN also changes the birthday and sex it encodes.
+func (m *citizenModeratorService) UpdateCitizen(actor *Actor, updateCitizen *dto.RequestModeratorUpdateCitizen, updated *dto.ResponseUpdated) error {
+	citizen := models.Citizen{}
+
+	if err := m.repo.FindCitizenById(updateCitizen.CitizenId, &citizen); err != nil {
+		return err
+	}
+
+	if citizen.Version != updateCitizen.Version {
+		return repo.ErrVersionConflict
+	}
+
+	changes := newChangeSet()
+	setField(changes, "first_name", citizen.FirstName, updateCitizen.FirstName)
+	setField(changes, "second_name", citizen.SecondName, updateCitizen.SecondName)
+	setField(changes, "last_name", citizen.LastName, updateCitizen.LastName)
+	setField(changes, "ucn", citizen.UCN, updateCitizen.UCN)
+	setField(changes, "email", citizen.Email, updateCitizen.Email)
+	setField(changes, "phone_number", citizen.PhoneNumber, updateCitizen.PhoneNumber)
+
+	if changes.changed("ucn") {
+		birthday, female, err := dto.ParseUcn(*updateCitizen.UCN)
+		if err != nil {
+			return err
+		}
+
+		sex := models.Male
+		if female {
+			sex = models.Female
+		}
+
+		if !birthday.Equal(citizen.Birthday) {
+			changes.set("birthday", citizen.Birthday, birthday)
 		}
+		setField(changes, "sex", citizen.Sex, &sex)
+	}
+
+	updated.Version = citizen.Version
+
+	if changes.empty() {
+		return nil
 	}
 
+	change := changes.record(models.ChangedCitizen, citizen.ID, citizen.Version, actor.ID)
+
+	if err := m.repo.UpdateCitizen(citizen.ID, citizen.Version, changes.updates, change,
+		actor.audit(models.AuditUpdate, models.AuditedCitizen, citizen.ID, changes.diff())); err != nil {
+		return err
+	}
+
+	updated.Version = change.Version
+
+	return nil
+}
+
+func (m *citizenModeratorService) FindCitizenChanges(citizenId *dto.QueryChangeHistory, dtoChanges *[]dto.ResponseChange) error {
+	var changes []models.EntityChange
+
+	if err := m.repo.FindCitizenChanges(citizenId.Id, &changes); err != nil {
+		return err
+	}
+
+	*dtoChanges = changesToDto(changes)
+
 	return nil
 }
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"medico/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePhysicianRegistry(t *testing.T) {
+	importedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		registry string
+		entries  []models.PhysicianRegistryEntry
+		err      error
+	}{
+		{
+			name: "columns in any order",
+			registry: "status, last_name, first_name, second_name, uin\n" +
+				"active, Petrov, Ivan, Georgiev, 1234567890\n" +
+				"SUSPENDED, Ivanova, Maria, , 2345678901\n",
+			entries: []models.PhysicianRegistryEntry{
+				{UIN: "1234567890", FirstName: "Ivan", SecondName: "Georgiev", LastName: "Petrov", Status: models.LicenceActive, ImportedAt: importedAt},
+				{UIN: "2345678901", FirstName: "Maria", LastName: "Ivanova", Status: models.LicenceSuspended, ImportedAt: importedAt},
+			},
+		},
+		{
+			name:     "missing column",
+			registry: "uin,first_name,last_name,status\n1234567890,Ivan,Petrov,active\n",
+			err:      ErrRegistryInvalidCsv,
+		},
+		{
+			name:     "unknown status",
+			registry: "uin,first_name,second_name,last_name,status\n1234567890,Ivan,,Petrov,retired\n",
+			err:      ErrRegistryInvalidCsv,
+		},
+		{
+			name: "duplicate uin",
+			registry: "uin,first_name,second_name,last_name,status\n" +
+				"1234567890,Ivan,,Petrov,active\n" +
+				" 1234567890,Ivan,,Petrov,revoked\n",
+			err: ErrRegistryInvalidCsv,
+		},
+		{
+			name:     "no entries",
+			registry: "uin,first_name,second_name,last_name,status\n",
+			err:      ErrRegistryInvalidCsv,
+		},
+		{
+			name:     "empty file",
+			registry: "",
+			err:      ErrRegistryInvalidCsv,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := parsePhysicianRegistry(strings.NewReader(test.registry), importedAt)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("parsePhysicianRegistry() error = %v, want %v", err, test.err)
+			}
+			if len(entries) != len(test.entries) {
+				t.Fatalf("parsePhysicianRegistry() = %d entries, want %d", len(entries), len(test.entries))
+			}
+			for i := range entries {
+				if entries[i] != test.entries[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, entries[i], test.entries[i])
+				}
+			}
+		})
+	}
+}
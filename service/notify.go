@@ -0,0 +1,46 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"medico/config"
+	"net/smtp"
+	"strings"
+)
+
+// Notifier sends a plain text message to an email address
+type Notifier interface {
+	Notify(to, subject, body string) error
+}
+
+type mailNotifier struct {
+	config *config.MailConfig
+}
+
+func NewNotifier() Notifier {
+	return &mailNotifier{config: config.LoadMailConfig()}
+}
+
+func (n *mailNotifier) Notify(to, subject, body string) error {
+	if n.config.Host == "" {
+		log.Printf("mail to %s: %s", to, subject)
+		return nil
+	}
+
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + n.config.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	address := fmt.Sprintf("%s:%d", n.config.Host, n.config.Port)
+	return smtp.SendMail(address, auth, n.config.From, []string{to}, []byte(message))
+}
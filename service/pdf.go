@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jung-kurt/gofpdf"
+	"github.com/skip2/go-qrcode"
+	"medico/assets"
+	"medico/models"
+	"strings"
+)
+
+const (
+	pdfFontFamily = "DejaVuSans"
+	pdfDateFormat = "02.01.2006"
+	pdfQrImage    = "qr"
+	pdfQrSide     = 40.0
+)
+
+// pdfStateStamps are printed across prescriptions that can no longer be dispensed, which are
+// printed without their QR code
+var pdfStateStamps = map[models.PrescriptionState]string{
+	models.Fulfilled:  "ИЗПЪЛНЕНА",
+	models.Revoked:    "АНУЛИРАНА",
+	models.Superseded: "ЗАМЕНЕНА С НОВА ВЕРСИЯ",
+}
+
+// renderPrescriptionPdf builds a printable copy of the prescription with its verification
+// code and QR payload. The QR code is left out and the state stamped instead once the
+// prescription is no longer active. Everything is rendered in-process with embedded fonts.
+func renderPrescriptionPdf(prescription *models.Prescription, citizen *models.Citizen, qrPayload string, qrSize int) ([]byte, error) {
+	regularFont, err := assets.Fonts.ReadFile("fonts/DejaVuSans.ttf")
+	if err != nil {
+		return nil, err
+	}
+
+	boldFont, err := assets.Fonts.ReadFile("fonts/DejaVuSans-Bold.ttf")
+	if err != nil {
+		return nil, err
+	}
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(prescription.Name, true)
+	pdf.AddUTF8FontFromBytes(pdfFontFamily, "", regularFont)
+	pdf.AddUTF8FontFromBytes(pdfFontFamily, "B", boldFont)
+	pdf.AddPage()
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, top, right, _ := pdf.GetMargins()
+	contentWidth := pageWidth - left - right
+	headerWidth := contentWidth
+
+	if prescription.State == models.Active {
+		qrPng, err := qrcode.Encode(qrPayload, qrcode.Medium, qrSize)
+		if err != nil {
+			return nil, err
+		}
+
+		pdf.RegisterImageOptionsReader(pdfQrImage, gofpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(qrPng))
+		pdf.ImageOptions(pdfQrImage, pageWidth-right-pdfQrSide, top, pdfQrSide, pdfQrSide, false, gofpdf.ImageOptions{}, 0, "")
+		headerWidth -= pdfQrSide
+	}
+
+	pdf.SetFont(pdfFontFamily, "B", 16)
+	pdf.CellFormat(headerWidth, 10, "Електронна рецепта", "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFontFamily, "", 12)
+	pdf.CellFormat(headerWidth, 7, prescription.Name, "", 1, "L", false, 0, "")
+	pdf.CellFormat(headerWidth, 7, "Код за проверка: "+prescription.Code, "", 1, "L", false, 0, "")
+	pdf.CellFormat(headerWidth, 7, fmt.Sprintf("Версия: %d", prescription.Version), "", 1, "L", false, 0, "")
+
+	if stamp, ok := pdfStateStamps[prescription.State]; ok {
+		pdf.Ln(2)
+		pdf.SetFont(pdfFontFamily, "B", 14)
+		pdf.SetTextColor(200, 0, 0)
+		pdf.CellFormat(contentWidth, 10, stamp, "1", 1, "C", false, 0, "")
+		pdf.SetTextColor(0, 0, 0)
+	} else {
+		pdf.SetY(top + pdfQrSide + 5)
+	}
+
+	pdfSection(pdf, "Лекар")
+	pdfLine(pdf, "Име", fullName(prescription.Doctor.FirstName, prescription.Doctor.SecondName, prescription.Doctor.LastName))
+	pdfLine(pdf, "УИН", prescription.Doctor.UIN)
+	if prescription.Hospital != nil {
+		pdfLine(pdf, "Лечебно заведение", fmt.Sprintf("%s, %s", prescription.Hospital.Name, prescription.Hospital.City))
+	}
+
+	pdfSection(pdf, "Пациент")
+	pdfLine(pdf, "Име", fullName(citizen.FirstName, citizen.SecondName, citizen.LastName))
+	pdfLine(pdf, "ЕГН", citizen.UCN)
+	pdfLine(pdf, "Дата на раждане", citizen.Birthday.Format(pdfDateFormat))
+
+	pdfSection(pdf, "Срокове")
+	pdfLine(pdf, "Издадена на", prescription.StartDate.Format(pdfDateFormat))
+	pdfLine(pdf, "Валидна до", prescription.EndDate.Format(pdfDateFormat))
+	if prescription.Refills > 0 {
+		pdfLine(pdf, "Повторни отпускания", fmt.Sprintf("%d през %d дни", prescription.Refills, prescription.RefillIntervalDays))
+	}
+
+	pdfSection(pdf, "Лекарства")
+	for i, medicament := range prescription.Medicaments {
+		pdf.SetFont(pdfFontFamily, "B", 11)
+		pdf.MultiCell(contentWidth, 6, fmt.Sprintf("%d. %s — %d оп.", i+1, medicament.Medicament.OfficialName, medicament.Quantity), "", "L", false)
+		pdf.SetFont(pdfFontFamily, "", 11)
+		pdf.MultiCell(contentWidth, 6, dosageToDto(&medicament).Sig, "", "L", false)
+		pdf.Ln(2)
+	}
+
+	if err := pdf.Error(); err != nil {
+		return nil, err
+	}
+
+	out := bytes.Buffer{}
+	if err := pdf.Output(&out); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+func pdfSection(pdf *gofpdf.Fpdf, title string) {
+	pdf.Ln(3)
+	pdf.SetFont(pdfFontFamily, "B", 13)
+	pdf.CellFormat(0, 8, title, "B", 1, "L", false, 0, "")
+	pdf.Ln(1)
+}
+
+func pdfLine(pdf *gofpdf.Fpdf, label, value string) {
+	pdf.SetFont(pdfFontFamily, "", 11)
+	pdf.CellFormat(50, 6, label+":", "", 0, "L", false, 0, "")
+	pdf.MultiCell(0, 6, value, "", "L", false)
+}
+
+func fullName(names ...string) string {
+	return strings.Join(strings.Fields(strings.Join(names, " ")), " ")
+}
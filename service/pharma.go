@@ -1,8 +1,13 @@
 package service
 
 import (
+	"errors"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"io"
+	"medico/common"
+	"medico/config"
 	"medico/dto"
 	"medico/models"
 	"medico/repo"
@@ -22,17 +27,41 @@ type PharmacyOwnerService interface {
 
 	NewPharmacyBranch(pharmacyOwnerId uuid.UUID, branch *dto.RequestPharmacyOwnerNewBranch) error
 	NewPharmacist(pharmacyOwnerId uuid.UUID, pharmacist *dto.RequestPharmacyOwnerNewPharmacist) error
+
+	GetBranch(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerGetBranch, branchDto *dto.ResponsePharmacyOwnerBranch) error
+	UpdateBranch(pharmacyOwnerId uuid.UUID, update *dto.RequestPharmacyOwnerUpdateBranch) error
+	SetBranchOpeningHours(pharmacyOwnerId uuid.UUID, hours *dto.RequestPharmacyOwnerBranchHours) error
+	NewBranchHoliday(pharmacyOwnerId uuid.UUID, holiday *dto.RequestPharmacyOwnerNewBranchHoliday) error
+	DeleteBranchHoliday(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerDeleteBranchHoliday) error
+	CloseBranch(pharmacyOwnerId uuid.UUID, closure *dto.RequestPharmacyOwnerCloseBranch) error
+	ReopenBranch(pharmacyOwnerId uuid.UUID, reopen *dto.RequestPharmacyOwnerReopenBranch) error
+	DecommissionBranch(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerDecommissionBranch) error
+
+	TransferStock(pharmacyOwnerId uuid.UUID, transfer *dto.RequestPharmacyOwnerStockTransfer) error
+	GetStockHistory(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockHistory, movementsDto *dto.ResponseList[dto.ResponseStockMovement]) error
+	ReconcileStock(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockReconciliation, reconciliation *dto.ResponseStockReconciliation) error
+	GetExpiringStock(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerExpiringStock, stockDto *[]dto.ResponseExpiringStock) error
+
+	SetStockLevel(pharmacyOwnerId uuid.UUID, level *dto.RequestPharmacyOwnerStockLevel) error
+	DeleteStockLevel(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerDeleteStockLevel) error
+	GetStockLevels(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockLevels, levelsDto *[]dto.ResponseStockLevel) error
+	GetLowStock(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockLevels, levelsDto *[]dto.ResponseStockLevel) error
+	ExportPurchaseOrders(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockLevels, out io.Writer) error
 }
 
 type pharmacyOwnerService struct {
-	authSession session.AuthSession
-	repo        repo.PharmacyOwnerRepo
+	authSession   session.AuthSession
+	repo          repo.PharmacyOwnerRepo
+	inventoryRepo repo.InventoryRepo
+	stockConfig   *config.StockConfig
 }
 
 func NewPharmacyOwnerService() PharmacyOwnerService {
 	return &pharmacyOwnerService{
-		authSession: session.NewAuthSession("pharmacy:owner"),
-		repo:        repo.NewPharmacyOwnerRepo(),
+		authSession:   session.NewAuthSession("pharmacy:owner"),
+		repo:          repo.NewPharmacyOwnerRepo(),
+		inventoryRepo: repo.NewInventoryRepo(),
+		stockConfig:   config.LoadStockConfig(),
 	}
 }
 
@@ -71,8 +100,9 @@ func (p *pharmacyOwnerService) GetAllBranches(pharmacyOwnerId uuid.UUID, branche
 
 	for i, pharmacyBranch := range *pharmacyBranches {
 		(*branches)[i] = dto.ResponsePharmacyOwnerBranches{
-			ID:   pharmacyBranch.ID,
-			Name: pharmacyBranch.Name,
+			ID:     pharmacyBranch.ID,
+			Name:   pharmacyBranch.Name,
+			Status: string(pharmacyBranch.Status),
 		}
 	}
 
@@ -126,12 +156,16 @@ func (p *pharmacyOwnerService) NewPharmacyBranch(pharmacyOwnerId uuid.UUID, bran
 		return err
 	}
 
+	branchId := uuid.New()
 	newBranch := models.PharmacyBranch{
-		ID:              uuid.New(),
+		ID:              branchId,
 		Name:            branch.Name,
+		Address:         branch.Address,
 		PharmacyBrandID: pharmacyBrand.ID,
 		Latitude:        branch.Latitude,
 		Longitude:       branch.Longitude,
+		Status:          models.BranchOpen,
+		OpeningHours:    openingHoursToModel(branchId, branch.OpeningHours),
 	}
 
 	if err := p.repo.CreatePharmacyBranch(&newBranch); err != nil {
@@ -142,6 +176,10 @@ func (p *pharmacyOwnerService) NewPharmacyBranch(pharmacyOwnerId uuid.UUID, bran
 }
 
 func (p *pharmacyOwnerService) NewPharmacist(pharmacyOwnerId uuid.UUID, pharmacist *dto.RequestPharmacyOwnerNewPharmacist) error {
+	if err := p.findOperatingBranch(pharmacyOwnerId, pharmacist.WorkingBranch, &models.PharmacyBranch{}); err != nil {
+		return err
+	}
+
 	password, err := bcrypt.GenerateFromPassword([]byte(pharmacist.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
@@ -165,6 +203,345 @@ func (p *pharmacyOwnerService) NewPharmacist(pharmacyOwnerId uuid.UUID, pharmaci
 	return nil
 }
 
+// findOperatingBranch loads a branch of the owner that is not decommissioned
+func (p *pharmacyOwnerService) findOperatingBranch(pharmacyOwnerId, branchId uuid.UUID, branch *models.PharmacyBranch) error {
+	if err := p.repo.FindPharmacyBranchByOwnerId(pharmacyOwnerId, branchId, branch); err != nil {
+		return err
+	}
+
+	if branch.Status == models.BranchDecommissioned {
+		return repo.ErrBranchDecommissioned
+	}
+
+	return nil
+}
+
+func (p *pharmacyOwnerService) GetBranch(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerGetBranch, branchDto *dto.ResponsePharmacyOwnerBranch) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.repo.FindPharmacyBranchByOwnerId(pharmacyOwnerId, query.BranchId, &branch); err != nil {
+		return err
+	}
+
+	*branchDto = dto.ResponsePharmacyOwnerBranch{
+		ID:               branch.ID,
+		Name:             branch.Name,
+		Address:          branch.Address,
+		Latitude:         branch.Latitude,
+		Longitude:        branch.Longitude,
+		Status:           string(branch.Status),
+		ClosedUntil:      branch.ClosedUntil,
+		ClosedReason:     branch.ClosedReason,
+		DecommissionedAt: branch.DecommissionedAt,
+		OpeningHours:     openingHoursToDto(branch.OpeningHours),
+		Holidays:         holidaysToDto(branch.Holidays),
+	}
+
+	return nil
+}
+
+func (p *pharmacyOwnerService) UpdateBranch(pharmacyOwnerId uuid.UUID, update *dto.RequestPharmacyOwnerUpdateBranch) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, update.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return p.repo.UpdatePharmacyBranch(branch.ID, map[string]interface{}{
+		"name":      update.Name,
+		"address":   update.Address,
+		"latitude":  update.Latitude,
+		"longitude": update.Longitude,
+	})
+}
+
+func (p *pharmacyOwnerService) SetBranchOpeningHours(pharmacyOwnerId uuid.UUID, hours *dto.RequestPharmacyOwnerBranchHours) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, hours.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return p.repo.ReplaceBranchOpeningHours(branch.ID, openingHoursToModel(branch.ID, hours.OpeningHours))
+}
+
+func (p *pharmacyOwnerService) NewBranchHoliday(pharmacyOwnerId uuid.UUID, holiday *dto.RequestPharmacyOwnerNewBranchHoliday) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, holiday.BranchId, &branch); err != nil {
+		return err
+	}
+
+	year, month, day := holiday.Date.Date()
+	newHoliday := models.PharmacyBranchHoliday{
+		ID:               uuid.New(),
+		PharmacyBranchID: branch.ID,
+		Date:             time.Date(year, month, day, 0, 0, 0, 0, time.Local),
+		Closed:           holiday.Closed,
+		Note:             holiday.Note,
+	}
+
+	if !holiday.Closed {
+		newHoliday.Opens, _ = dto.ParseClock(holiday.Opens)
+		newHoliday.Closes, _ = dto.ParseClock(holiday.Closes)
+	}
+
+	return p.repo.SetBranchHoliday(&newHoliday)
+}
+
+func (p *pharmacyOwnerService) DeleteBranchHoliday(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerDeleteBranchHoliday) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, query.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return p.repo.DeleteBranchHoliday(branch.ID, query.HolidayId)
+}
+
+func (p *pharmacyOwnerService) CloseBranch(pharmacyOwnerId uuid.UUID, closure *dto.RequestPharmacyOwnerCloseBranch) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, closure.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return p.repo.CloseBranch(branch.ID, closure.Until, closure.Reason)
+}
+
+func (p *pharmacyOwnerService) ReopenBranch(pharmacyOwnerId uuid.UUID, reopen *dto.RequestPharmacyOwnerReopenBranch) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, reopen.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return p.repo.ReopenBranch(branch.ID)
+}
+
+// DecommissionBranch closes a branch for good. The branch is kept for the prescriptions
+// dispensed there, while its stock and pharmacists go to the branch the owner names.
+func (p *pharmacyOwnerService) DecommissionBranch(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerDecommissionBranch) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, query.BranchId, &branch); err != nil {
+		return err
+	}
+
+	if query.TransferTo != nil {
+		if *query.TransferTo == branch.ID {
+			return repo.ErrTransferBranchInvalid
+		}
+
+		if err := p.findOperatingBranch(pharmacyOwnerId, *query.TransferTo, &models.PharmacyBranch{}); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, repo.ErrBranchDecommissioned) {
+				return repo.ErrTransferBranchInvalid
+			}
+			return err
+		}
+	}
+
+	return p.repo.DecommissionBranch(pharmacyOwnerId, branch.ID, query.TransferTo, time.Now())
+}
+
+// TransferStock moves stock between two branches of the owner
+func (p *pharmacyOwnerService) TransferStock(pharmacyOwnerId uuid.UUID, transfer *dto.RequestPharmacyOwnerStockTransfer) error {
+	if transfer.FromBranchId == transfer.ToBranchId {
+		return repo.ErrTransferBranchInvalid
+	}
+
+	from := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, transfer.FromBranchId, &from); err != nil {
+		return err
+	}
+
+	to := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, transfer.ToBranchId, &to); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, repo.ErrBranchDecommissioned) {
+			return repo.ErrTransferBranchInvalid
+		}
+		return err
+	}
+
+	return p.inventoryRepo.TransferStock(from.ID, to.ID, transfer.MedicamentId, transfer.BatchNumber, transfer.Quantity,
+		pharmacyOwnerId, transfer.Reason, time.Now())
+}
+
+// GetStockHistory lists the stock movements of one of the owner's branches, decommissioned
+// ones included
+func (p *pharmacyOwnerService) GetStockHistory(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockHistory, movementsDto *dto.ResponseList[dto.ResponseStockMovement]) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.repo.FindPharmacyBranchByOwnerId(pharmacyOwnerId, query.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return findStockHistory(p.inventoryRepo, branch.ID, &query.QueryStockHistory, movementsDto)
+}
+
+// ReconcileStock reports the medicaments of a branch whose stock does not match its ledger
+func (p *pharmacyOwnerService) ReconcileStock(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockReconciliation, reconciliation *dto.ResponseStockReconciliation) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.repo.FindPharmacyBranchByOwnerId(pharmacyOwnerId, query.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return reconcileStock(p.inventoryRepo, branch.ID, reconciliation)
+}
+
+// GetExpiringStock lists the batches of a branch that expired or expire within the window
+func (p *pharmacyOwnerService) GetExpiringStock(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerExpiringStock, stockDto *[]dto.ResponseExpiringStock) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.repo.FindPharmacyBranchByOwnerId(pharmacyOwnerId, query.BranchId, &branch); err != nil {
+		return err
+	}
+
+	days := p.stockConfig.ExpiryWarningDays
+	if query.Days != nil {
+		days = *query.Days
+	}
+
+	now := time.Now()
+	batches := new([]models.StockBatch)
+
+	if err := p.inventoryRepo.FindExpiringBatches(branch.ID, now.AddDate(0, 0, int(days)), batches); err != nil {
+		return err
+	}
+
+	*stockDto = make([]dto.ResponseExpiringStock, len(*batches))
+
+	today := now.Format(time.DateOnly)
+	for i, batch := range *batches {
+		(*stockDto)[i] = dto.ResponseExpiringStock{
+			MedicamentId: batch.MedicamentID,
+			OfficialName: batch.Medicament.OfficialName,
+			BatchNumber:  batch.BatchNumber,
+			ExpiresOn:    batch.ExpiresOn,
+			Quantity:     batch.Quantity,
+			Expired:      batch.ExpiresOn.Format(time.DateOnly) < today,
+		}
+	}
+
+	return nil
+}
+
+func (p *pharmacyOwnerService) SetStockLevel(pharmacyOwnerId uuid.UUID, level *dto.RequestPharmacyOwnerStockLevel) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.findOperatingBranch(pharmacyOwnerId, level.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return p.inventoryRepo.SetStockLevel(&models.StockLevel{
+		PharmacyBranchID: branch.ID,
+		MedicamentID:     level.MedicamentId,
+		Minimum:          level.Minimum,
+		Target:           level.Target,
+	})
+}
+
+func (p *pharmacyOwnerService) DeleteStockLevel(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerDeleteStockLevel) error {
+	branch := models.PharmacyBranch{}
+
+	if err := p.repo.FindPharmacyBranchByOwnerId(pharmacyOwnerId, query.BranchId, &branch); err != nil {
+		return err
+	}
+
+	return p.inventoryRepo.DeleteStockLevel(branch.ID, query.MedicamentId)
+}
+
+func (p *pharmacyOwnerService) GetStockLevels(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockLevels, levelsDto *[]dto.ResponseStockLevel) error {
+	return p.findStockLevels(pharmacyOwnerId, query, false, levelsDto)
+}
+
+// GetLowStock lists the medicaments below their minimum level with how much to reorder
+func (p *pharmacyOwnerService) GetLowStock(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockLevels, levelsDto *[]dto.ResponseStockLevel) error {
+	return p.findStockLevels(pharmacyOwnerId, query, true, levelsDto)
+}
+
+// ExportPurchaseOrders writes the reorders of the medicaments below their minimum level as CSV
+func (p *pharmacyOwnerService) ExportPurchaseOrders(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockLevels, out io.Writer) error {
+	levels := new([]dto.ResponseStockLevel)
+
+	if err := p.findStockLevels(pharmacyOwnerId, query, true, levels); err != nil {
+		return err
+	}
+
+	return writePurchaseOrders(*levels, out)
+}
+
+// findStockLevels finds the stock levels of the queried branches of the owner, or only the
+// ones below their minimum, and suggests reorders from the dispensing of the recent days
+func (p *pharmacyOwnerService) findStockLevels(pharmacyOwnerId uuid.UUID, query *dto.QueryPharmacyOwnerStockLevels, belowMinimum bool, levelsDto *[]dto.ResponseStockLevel) error {
+	branches := new([]models.PharmacyBranch)
+
+	if query.BranchId != nil {
+		branch := models.PharmacyBranch{}
+		if err := p.repo.FindPharmacyBranchByOwnerId(pharmacyOwnerId, *query.BranchId, &branch); err != nil {
+			return err
+		}
+		*branches = append(*branches, branch)
+	} else if err := p.repo.FindPharmacyBranchesByOwnerId(pharmacyOwnerId, branches); err != nil {
+		return err
+	}
+
+	names := make(map[uuid.UUID]string, len(*branches))
+	branchIds := make([]uuid.UUID, 0, len(*branches))
+
+	for _, branch := range *branches {
+		if branch.Status == models.BranchDecommissioned && query.BranchId == nil {
+			continue
+		}
+		names[branch.ID] = branch.Name
+		branchIds = append(branchIds, branch.ID)
+	}
+
+	levels := new([]repo.StockLevelStatus)
+
+	if err := p.inventoryRepo.FindStockLevels(branchIds, belowMinimum, time.Now(), levels); err != nil {
+		return err
+	}
+
+	velocityDays := max(p.stockConfig.ReorderVelocityDays, 1)
+	dispensed := new([]repo.DispensedQuantity)
+
+	if err := p.inventoryRepo.FindDispensedQuantities(branchIds, time.Now().AddDate(0, 0, -int(velocityDays)), dispensed); err != nil {
+		return err
+	}
+
+	type item struct{ branchId, medicamentId uuid.UUID }
+	dailyDispensed := make(map[item]float64, len(*dispensed))
+
+	for _, quantity := range *dispensed {
+		dailyDispensed[item{quantity.PharmacyBranchID, quantity.MedicamentID}] = float64(quantity.Quantity) / float64(velocityDays)
+	}
+
+	*levelsDto = make([]dto.ResponseStockLevel, len(*levels))
+
+	for i, level := range *levels {
+		daily := dailyDispensed[item{level.PharmacyBranchID, level.MedicamentID}]
+
+		(*levelsDto)[i] = dto.ResponseStockLevel{
+			BranchId:        level.PharmacyBranchID,
+			BranchName:      names[level.PharmacyBranchID],
+			MedicamentId:    level.MedicamentID,
+			OfficialName:    level.OfficialName,
+			Minimum:         level.Minimum,
+			Target:          level.Target,
+			Quantity:        level.Quantity,
+			Reserved:        level.Reserved,
+			DailyDispensed:  daily,
+			ReorderQuantity: reorderQuantity(&level, daily, p.stockConfig.ReorderCoverDays),
+		}
+	}
+
+	return nil
+}
+
 type PharmacistService interface {
 	AuthenticateByEmailAndPassword(email string, password string, pharmacistAuth *models.PharmacistAuth) error
 	CreateAuthenticationSession(pharmacyOwnerId uuid.UUID) (uuid.UUID, time.Duration, error)
@@ -172,22 +549,36 @@ type PharmacistService interface {
 	DeleteAuthenticationSession(sessionID uuid.UUID) error
 
 	GetCitizensActivePrescriptions(citizenUcn *dto.QueryPharmacistCitizenPrescriptionGet, prescriptions *[]dto.ResponsePharmacistCitizenPrescription) error
+	ResolvePrescription(query *dto.QueryPharmacistResolvePrescription, prescriptionDto *dto.ResponsePharmacistCitizenPrescription) error
 	FulfillWholePrescription(pharmacistId uuid.UUID, data *dto.RequestPharmacistCitizenFulfillWholePrescription) error
-	FulfillMedicamentFromPrescription(data *dto.RequestPharmacistCitizenFulfillMedicamentFromPrescription) error
+	FulfillMedicamentFromPrescription(pharmacistId uuid.UUID, data *dto.RequestPharmacistCitizenFulfillMedicamentFromPrescription) error
+	GetPrescriptionHistory(query *dto.QueryPharmacistGetPrescriptionHistory, historyDto *[]dto.ResponsePrescriptionVersion) error
+
+	GetReservations(pharmacistId uuid.UUID, reservationsDto *[]dto.ResponseReservation) error
+	FulfillReservation(pharmacistId uuid.UUID, data *dto.RequestPharmacistFulfillReservation) error
 
 	AddMedicamentToBranchStorage(pharmacistId uuid.UUID, data *dto.RequestPharmacistBranchAddMedicament) error
+	AdjustStock(pharmacistId uuid.UUID, data *dto.RequestPharmacistStockAdjustment) error
+	WriteOffStock(pharmacistId uuid.UUID, data *dto.RequestPharmacistStockWriteOff) error
+	GetStockHistory(pharmacistId uuid.UUID, query *dto.QueryStockHistory, movementsDto *dto.ResponseList[dto.ResponseStockMovement]) error
 	GetMedicamentByCommonName(commonName *dto.QueryDoctorGetMedicamentByCommonName, medicamentsDto *[]dto.ResponseDoctorGetMedicamentPrescription) error
 }
 
 type pharmacistService struct {
-	authSession session.AuthSession
-	repo        repo.PharmacistRepo
+	authSession        session.AuthSession
+	repo               repo.PharmacistRepo
+	reservationRepo    repo.ReservationRepo
+	inventoryRepo      repo.InventoryRepo
+	prescriptionConfig *config.PrescriptionConfig
 }
 
 func NewPharmacistService() PharmacistService {
 	return &pharmacistService{
-		authSession: session.NewAuthSession("pharmacy:pharmacist"),
-		repo:        repo.NewPharmacistRepo(),
+		authSession:        session.NewAuthSession("pharmacy:pharmacist"),
+		repo:               repo.NewPharmacistRepo(),
+		reservationRepo:    repo.NewReservationRepo(),
+		inventoryRepo:      repo.NewInventoryRepo(),
+		prescriptionConfig: config.LoadPrescriptionConfig(),
 	}
 }
 
@@ -224,42 +615,99 @@ func (p pharmacistService) GetCitizensActivePrescriptions(citizenUcn *dto.QueryP
 
 	*prescriptionsDto = make([]dto.ResponsePharmacistCitizenPrescription, len(*prescriptions))
 
-	for i, prescription := range *prescriptions {
-		(*prescriptionsDto)[i] = dto.ResponsePharmacistCitizenPrescription{
-			ID:           prescription.ID,
-			Name:         prescription.Name,
-			CreationDate: prescription.CreationDate,
-			StartDate:    prescription.StartDate,
-			EndDate:      prescription.EndDate,
-			Medicaments: make([]struct {
-				Id           uuid.UUID `json:"id"`
-				OfficialName string    `json:"officialName"`
-				Quantity     uint      `json:"quantity"`
-				Fulfilled    bool      `json:"fulfilled"`
-			}, len(prescription.Medicaments)),
-		}
+	for i := range *prescriptions {
+		pharmacistPrescriptionToDto(&(*prescriptions)[i], &(*prescriptionsDto)[i])
+	}
 
-		for k, medicament := range prescription.Medicaments {
-			(*prescriptionsDto)[i].Medicaments[k] = struct {
-				Id           uuid.UUID `json:"id"`
-				OfficialName string    `json:"officialName"`
-				Quantity     uint      `json:"quantity"`
-				Fulfilled    bool      `json:"fulfilled"`
-			}{
-				Id:           medicament.MedicamentID,
-				OfficialName: medicament.Medicament.OfficialName,
-				Quantity:     medicament.Quantity,
-				Fulfilled:    medicament.Fulfilled,
-			}
+	return nil
+}
+
+// ResolvePrescription finds the single prescription behind a verification code or a signed
+// QR payload.
+func (p pharmacistService) ResolvePrescription(query *dto.QueryPharmacistResolvePrescription, prescriptionDto *dto.ResponsePharmacistCitizenPrescription) error {
+	var prescriptionId uuid.UUID
+	code := query.Code
+
+	if query.Qr != "" {
+		qrPrescriptionId, qrCode, err := verifyQrPayload(p.prescriptionConfig.VerificationSecret, query.Qr)
+		if err != nil {
+			return err
 		}
+		prescriptionId, code = qrPrescriptionId, qrCode
+	}
+
+	if code == "" {
+		return ErrVerificationMissing
+	}
+
+	code, err := normalizeVerificationCode(code)
+	if err != nil {
+		return err
+	}
+
+	prescription := models.Prescription{}
+
+	if err := p.repo.FindPrescriptionByCode(code, &prescription); err != nil {
+		return err
+	}
+
+	if prescriptionId != uuid.Nil && prescription.ID != prescriptionId {
+		return ErrQrPayloadInvalid
 	}
 
+	switch {
+	case prescription.State == models.Revoked:
+		return ErrPrescriptionRevoked
+	case prescription.State == models.Superseded:
+		return ErrPrescriptionSuperseded
+	case prescription.State != models.Active, prescription.WindowStartDate.After(time.Now()):
+		return repo.ErrPrescriptionNotDispensable
+	}
+
+	if err := verifyPrescriptionSignature(&prescription); err != nil {
+		return err
+	}
+
+	pharmacistPrescriptionToDto(&prescription, prescriptionDto)
+
 	return nil
 }
 
+// pharmacistPrescriptionToDto maps a prescription with its signing key preloaded. Tampered
+// prescriptions are kept and flagged, so the pharmacist sees them instead of missing them.
+func pharmacistPrescriptionToDto(prescription *models.Prescription, prescriptionDto *dto.ResponsePharmacistCitizenPrescription) {
+	*prescriptionDto = dto.ResponsePharmacistCitizenPrescription{
+		ID:           prescription.ID,
+		Name:         prescription.Name,
+		CreationDate: prescription.CreationDate,
+		StartDate:    prescription.StartDate,
+		EndDate:      prescription.EndDate,
+		Hospital:     hospitalToDto(prescription.Hospital),
+		Refill:       prescription.RefillsUsed,
+		Version:      prescription.Version,
+		Medicaments:  make([]dto.ResponsePharmacistPrescriptionMedicament, len(prescription.Medicaments)),
+	}
+
+	for k, medicament := range prescription.Medicaments {
+		prescriptionDto.Medicaments[k] = dto.ResponsePharmacistPrescriptionMedicament{
+			Id:           medicament.MedicamentID,
+			OfficialName: medicament.Medicament.OfficialName,
+			Quantity:     medicament.Quantity,
+			Fulfilled:    medicament.Fulfilled,
+			Dosage:       dosageToDto(&medicament),
+		}
+	}
+
+	if err := verifyPrescriptionSignature(prescription); err != nil {
+		prescriptionDto.SignatureError = err.Error()
+	} else {
+		prescriptionDto.SignatureValid = true
+	}
+}
+
 func (p pharmacistService) FulfillWholePrescription(pharmacistId uuid.UUID, data *dto.RequestPharmacistCitizenFulfillWholePrescription) error {
 	for _, prescription := range data.Prescriptions {
-		err := p.repo.FulfillWholePrescription(pharmacistId, prescription.Id)
+		err := p.repo.FulfillWholePrescription(pharmacistId, prescription.Id, verifyPrescriptionSignature)
 		if err != nil {
 			return err
 		}
@@ -268,10 +716,10 @@ func (p pharmacistService) FulfillWholePrescription(pharmacistId uuid.UUID, data
 	return nil
 }
 
-func (p pharmacistService) FulfillMedicamentFromPrescription(data *dto.RequestPharmacistCitizenFulfillMedicamentFromPrescription) error {
+func (p pharmacistService) FulfillMedicamentFromPrescription(pharmacistId uuid.UUID, data *dto.RequestPharmacistCitizenFulfillMedicamentFromPrescription) error {
 	for _, prescription := range data.Prescriptions {
 		for _, medicament := range prescription.Medicaments {
-			err := p.repo.FulfillMedicamentFromPrescription(medicament.Id)
+			err := p.repo.FulfillMedicamentFromPrescription(pharmacistId, prescription.Id, medicament.Id, verifyPrescriptionSignature)
 			if err != nil {
 				return err
 			}
@@ -281,15 +729,101 @@ func (p pharmacistService) FulfillMedicamentFromPrescription(data *dto.RequestPh
 	return nil
 }
 
-func (p pharmacistService) AddMedicamentToBranchStorage(pharmacistId uuid.UUID, data *dto.RequestPharmacistBranchAddMedicament) error {
-	for _, medicament := range data.Medicaments {
-		err := p.repo.AddMedicamentToBranchStorageViaPharmacistId(pharmacistId, medicament.MedicamentId, medicament.Quantity)
-		if err != nil {
-			return err
-		}
+func (p pharmacistService) GetPrescriptionHistory(query *dto.QueryPharmacistGetPrescriptionHistory, historyDto *[]dto.ResponsePrescriptionVersion) error {
+	history := new([]models.Prescription)
+
+	if err := p.repo.FindPrescriptionHistory(query.PrescriptionId, history); err != nil {
+		return err
+	}
+
+	prescriptionHistoryToDto(*history, historyDto)
+
+	return nil
+}
+
+// GetReservations lists the reservations waiting to be picked up at the pharmacist's branch
+func (p pharmacistService) GetReservations(pharmacistId uuid.UUID, reservationsDto *[]dto.ResponseReservation) error {
+	reservations := new([]models.StockReservation)
+
+	if err := p.reservationRepo.FindActiveReservationsByPharmacistId(pharmacistId, time.Now(), reservations); err != nil {
+		return err
 	}
+
+	reservationsToDto(*reservations, reservationsDto)
+
 	return nil
 }
+
+// FulfillReservation dispenses what the citizen reserved from the stock held for them
+func (p pharmacistService) FulfillReservation(pharmacistId uuid.UUID, data *dto.RequestPharmacistFulfillReservation) error {
+	return p.reservationRepo.FulfillReservation(pharmacistId, data.ReservationId, time.Now(), verifyPrescriptionSignature)
+}
+
+// AddMedicamentToBranchStorage receives a delivery into the pharmacist's branch
+func (p pharmacistService) AddMedicamentToBranchStorage(pharmacistId uuid.UUID, data *dto.RequestPharmacistBranchAddMedicament) error {
+	pharmacist := models.Pharmacist{}
+
+	if err := p.repo.FindPharmacistById(pharmacistId, &pharmacist); err != nil {
+		return err
+	}
+
+	movements := make([]models.StockMovement, len(data.Medicaments))
+
+	for i, medicament := range data.Medicaments {
+		expiresOn := medicament.ExpiresOn
+		movements[i] = stockMovement(pharmacist.PharmacyBranchID, medicament.MedicamentId, common.StockReceipt,
+			int64(medicament.Quantity), models.StockActorPharmacist, pharmacistId)
+		movements[i].BatchNumber = medicament.BatchNumber
+		movements[i].ExpiresOn = &expiresOn
+		movements[i].Reference = data.Reference
+	}
+
+	return p.inventoryRepo.RecordMovements(movements)
+}
+
+// AdjustStock corrects the stock of the pharmacist's branch to what was counted
+func (p pharmacistService) AdjustStock(pharmacistId uuid.UUID, data *dto.RequestPharmacistStockAdjustment) error {
+	pharmacist := models.Pharmacist{}
+
+	if err := p.repo.FindPharmacistById(pharmacistId, &pharmacist); err != nil {
+		return err
+	}
+
+	movement := stockMovement(pharmacist.PharmacyBranchID, data.MedicamentId, common.StockAdjustment,
+		data.Delta, models.StockActorPharmacist, pharmacistId)
+	movement.BatchNumber = data.BatchNumber
+	movement.ExpiresOn = data.ExpiresOn
+	movement.Reason = data.Reason
+
+	return p.inventoryRepo.RecordMovements([]models.StockMovement{movement})
+}
+
+func (p pharmacistService) WriteOffStock(pharmacistId uuid.UUID, data *dto.RequestPharmacistStockWriteOff) error {
+	pharmacist := models.Pharmacist{}
+
+	if err := p.repo.FindPharmacistById(pharmacistId, &pharmacist); err != nil {
+		return err
+	}
+
+	movement := stockMovement(pharmacist.PharmacyBranchID, data.MedicamentId, common.StockWriteOff,
+		-int64(data.Quantity), models.StockActorPharmacist, pharmacistId)
+	movement.BatchNumber = data.BatchNumber
+	movement.Reason = data.Reason
+
+	return p.inventoryRepo.RecordMovements([]models.StockMovement{movement})
+}
+
+// GetStockHistory lists the stock movements of the pharmacist's branch
+func (p pharmacistService) GetStockHistory(pharmacistId uuid.UUID, query *dto.QueryStockHistory, movementsDto *dto.ResponseList[dto.ResponseStockMovement]) error {
+	pharmacist := models.Pharmacist{}
+
+	if err := p.repo.FindPharmacistById(pharmacistId, &pharmacist); err != nil {
+		return err
+	}
+
+	return findStockHistory(p.inventoryRepo, pharmacist.PharmacyBranchID, query, movementsDto)
+}
+
 func (p pharmacistService) GetMedicamentByCommonName(commonName *dto.QueryDoctorGetMedicamentByCommonName, medicamentsDto *[]dto.ResponseDoctorGetMedicamentPrescription) error {
 	medicaments := new([]models.Medicament)
 	err := p.repo.FindMedicamentByCommonName(commonName.CommonName, medicaments)
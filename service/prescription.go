@@ -0,0 +1,40 @@
+package service
+
+import (
+	"medico/dto"
+	"medico/models"
+)
+
+func prescriptionHistoryToDto(history []models.Prescription, historyDto *[]dto.ResponsePrescriptionVersion) {
+	*historyDto = make([]dto.ResponsePrescriptionVersion, len(history))
+
+	for i, prescription := range history {
+		(*historyDto)[i] = dto.ResponsePrescriptionVersion{
+			Id:                prescription.ID,
+			Version:           prescription.Version,
+			PreviousVersionId: prescription.PreviousVersionID,
+			Name:              prescription.Name,
+			State:             string(prescription.State),
+			Hospital:          hospitalToDto(prescription.Hospital),
+			Medicaments:       make([]dto.ResponsePrescriptionVersionMedicament, len(prescription.Medicaments)),
+			CreationDate:      prescription.CreationDate,
+			EndDate:           prescription.EndDate,
+			AmendmentReason:   prescription.AmendmentReason,
+			RevokedAt:         prescription.RevokedAt,
+			RevocationReason:  prescription.RevocationReason,
+		}
+
+		(*historyDto)[i].Doctor.FirstName = prescription.Doctor.FirstName
+		(*historyDto)[i].Doctor.LastName = prescription.Doctor.LastName
+		(*historyDto)[i].Doctor.UIN = prescription.Doctor.UIN
+
+		for k, medicament := range prescription.Medicaments {
+			(*historyDto)[i].Medicaments[k] = dto.ResponsePrescriptionVersionMedicament{
+				Id:           medicament.MedicamentID,
+				OfficialName: medicament.Medicament.OfficialName,
+				Quantity:     medicament.Quantity,
+				Dosage:       dosageToDto(&medicament),
+			}
+		}
+	}
+}
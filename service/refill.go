@@ -0,0 +1,25 @@
+package service
+
+import (
+	"medico/dto"
+	"medico/models"
+)
+
+func refillsToDto(prescription *models.Prescription) dto.ResponsePrescriptionRefills {
+	refills := dto.ResponsePrescriptionRefills{
+		Total:        prescription.Refills,
+		IntervalDays: prescription.RefillIntervalDays,
+		Cancelled:    prescription.RefillsCancelled,
+	}
+
+	if !prescription.RefillsCancelled && prescription.Refills > prescription.RefillsUsed {
+		refills.Remaining = prescription.Refills - prescription.RefillsUsed
+	}
+
+	if prescription.State == models.Active {
+		nextDispenseDate := prescription.WindowStartDate
+		refills.NextDispenseDate = &nextDispenseDate
+	}
+
+	return refills
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"medico/dto"
+	"medico/models"
+	"medico/repo"
+	"sort"
+	"time"
+)
+
+type PharmacyRegistrationService interface {
+	SubmitRegistration(register *dto.RequestPharmacyRegistration, submitted *dto.ResponsePharmacyRegistrationSubmitted) error
+	FindRegistrationStatus(registrationId *dto.QueryPharmacyRegistrationStatus, status *dto.ResponsePharmacyRegistrationStatus) error
+	ResubmitRegistration(resubmit *dto.RequestPharmacyRegistrationResubmit) error
+}
+
+type pharmacyRegistrationService struct {
+	repo     repo.PharmacyRegistrationRepo
+	notifier Notifier
+}
+
+func NewPharmacyRegistrationService() PharmacyRegistrationService {
+	return &pharmacyRegistrationService{
+		repo:     repo.NewPharmacyRegistrationRepo(),
+		notifier: NewNotifier(),
+	}
+}
+
+func (s *pharmacyRegistrationService) SubmitRegistration(register *dto.RequestPharmacyRegistration, submitted *dto.ResponsePharmacyRegistrationSubmitted) error {
+	password, err := bcrypt.GenerateFromPassword([]byte(register.OwnerPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	registration := models.PharmacyRegistration{
+		ID:                  uuid.New(),
+		CompanyName:         register.CompanyName,
+		CompanyNumber:       register.CompanyNumber,
+		Website:             register.Website,
+		LicenceNumber:       register.LicenceNumber,
+		HeadquartersAddress: register.HeadquartersAddress,
+		OwnerName:           register.OwnerName,
+		OwnerEmail:          register.OwnerEmail,
+		OwnerPhone:          register.OwnerPhone,
+		OwnerPassword:       string(password),
+		Status:              models.RegistrationPending,
+		SubmittedAt:         now,
+		UpdatedAt:           now,
+	}
+
+	if err := s.repo.CreateRegistration(&registration); err != nil {
+		return err
+	}
+
+	submitted.Id = registration.ID
+
+	notifyApplicant(s.notifier, &registration, "Pharmacy registration received", fmt.Sprintf(
+		"We received the registration of %s and a moderator will review it.\n\nYour reference is %s. Use it to follow the review.",
+		registration.CompanyName, registration.ID))
+
+	return nil
+}
+
+func (s *pharmacyRegistrationService) FindRegistrationStatus(registrationId *dto.QueryPharmacyRegistrationStatus, status *dto.ResponsePharmacyRegistrationStatus) error {
+	registration := models.PharmacyRegistration{}
+
+	if err := s.repo.FindRegistrationById(registrationId.Id, &registration); err != nil {
+		return err
+	}
+
+	*status = dto.ResponsePharmacyRegistrationStatus{
+		Id:          registration.ID,
+		CompanyName: registration.CompanyName,
+		Status:      string(registration.Status),
+		SubmittedAt: registration.SubmittedAt,
+		Reviews:     reviewsToDto(registration.Reviews),
+	}
+
+	return nil
+}
+
+// ResubmitRegistration replaces the data of a registration a moderator returned for changes
+// and queues it for review again. Only whoever knows the password the registration was
+// submitted with may resubmit it.
+func (s *pharmacyRegistrationService) ResubmitRegistration(resubmit *dto.RequestPharmacyRegistrationResubmit) error {
+	registration := models.PharmacyRegistration{}
+
+	if err := s.repo.FindRegistrationById(resubmit.Id, &registration); err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(registration.OwnerPassword), []byte(resubmit.OwnerPassword)); err != nil {
+		return ErrRegistrationPasswordMismatch
+	}
+
+	if registration.Status != models.RegistrationChangesRequested {
+		return repo.ErrRegistrationNotReturned
+	}
+
+	updates := map[string]interface{}{
+		"company_name":         resubmit.CompanyName,
+		"company_number":       resubmit.CompanyNumber,
+		"website":              resubmit.Website,
+		"licence_number":       resubmit.LicenceNumber,
+		"headquarters_address": resubmit.HeadquartersAddress,
+		"owner_name":           resubmit.OwnerName,
+		"owner_phone":          resubmit.OwnerPhone,
+		"updated_at":           time.Now(),
+	}
+
+	return s.repo.ResubmitRegistration(registration.ID, updates)
+}
+
+// notifyApplicant tells the owner of a registration what happened to it. The change is
+// already stored by then, so a message that cannot be sent is only logged.
+func notifyApplicant(notifier Notifier, registration *models.PharmacyRegistration, subject, body string) {
+	if err := notifier.Notify(registration.OwnerEmail, subject, body); err != nil {
+		log.Printf("notifying the applicant of registration %s failed: %v", registration.ID, err)
+	}
+}
+
+func reviewsToDto(reviews []models.PharmacyRegistrationReview) []dto.ResponseRegistrationReview {
+	sort.Slice(reviews, func(i, j int) bool {
+		return reviews[i].ReviewedAt.Before(reviews[j].ReviewedAt)
+	})
+
+	dtoReviews := make([]dto.ResponseRegistrationReview, len(reviews))
+
+	for i, review := range reviews {
+		dtoReviews[i] = dto.ResponseRegistrationReview{
+			Decision:   string(review.Decision),
+			Comment:    review.Comment,
+			ReviewedAt: review.ReviewedAt,
+		}
+	}
+
+	return dtoReviews
+}
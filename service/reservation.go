@@ -0,0 +1,73 @@
+package service
+
+import (
+	"log"
+	"medico/dto"
+	"medico/models"
+	"medico/repo"
+	"time"
+)
+
+// ScheduleReservationExpiry gives the stock held by expired reservations back to the branches
+// on every tick of the given interval. Without a positive interval nothing is scheduled.
+func ScheduleReservationExpiry(interval time.Duration) {
+	if interval <= 0 {
+		log.Printf("reservation sweep interval %s is not positive, expired reservations keep their stock", interval)
+		return
+	}
+
+	reservationRepo := repo.NewReservationRepo()
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		for range ticker.C {
+			if _, err := reservationRepo.ExpireReservations(time.Now()); err != nil {
+				log.Println("reservation expiry failed:", err)
+			}
+		}
+	}()
+}
+
+// reservationStatus is the status a citizen or pharmacist sees. A reservation past its expiry
+// is expired even before its stock is released.
+func reservationStatus(reservation *models.StockReservation, at time.Time) models.ReservationStatus {
+	if reservation.Status == models.ReservationActive && !reservation.ExpiresAt.After(at) {
+		return models.ReservationExpired
+	}
+	return reservation.Status
+}
+
+func reservationsToDto(reservations []models.StockReservation, reservationsDto *[]dto.ResponseReservation) {
+	now := time.Now()
+	*reservationsDto = make([]dto.ResponseReservation, len(reservations))
+
+	for i, reservation := range reservations {
+		reservationToDto(&reservation, now, &(*reservationsDto)[i])
+	}
+}
+
+func reservationToDto(reservation *models.StockReservation, at time.Time, reservationDto *dto.ResponseReservation) {
+	lines := make([]dto.ResponseReservationLine, len(reservation.Lines))
+
+	for i, line := range reservation.Lines {
+		lines[i] = dto.ResponseReservationLine{
+			MedicamentId: line.MedicamentID,
+			OfficialName: line.Medicament.OfficialName,
+			Quantity:     line.Quantity,
+			Released:     line.Released,
+		}
+	}
+
+	*reservationDto = dto.ResponseReservation{
+		Id:             reservation.ID,
+		PrescriptionId: reservation.PrescriptionID,
+		BranchId:       reservation.PharmacyBranchID,
+		BranchName:     reservation.PharmacyBranch.Name,
+		BranchAddress:  reservation.PharmacyBranch.Address,
+		Status:         string(reservationStatus(reservation, at)),
+		CreatedAt:      reservation.CreatedAt,
+		ExpiresAt:      reservation.ExpiresAt,
+		ClosedAt:       reservation.ClosedAt,
+		Lines:          lines,
+	}
+}
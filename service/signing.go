@@ -0,0 +1,213 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/google/uuid"
+	"medico/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// canonicalPrescription is the signed form of a prescription. It holds only what the doctor
+// decided, so dispensing and refill bookkeeping do not invalidate the signature. Fields are
+// serialized in declaration order and lines are sorted by medicament.
+type canonicalPrescription struct {
+	ID                 uuid.UUID                   `json:"id"`
+	RootID             uuid.UUID                   `json:"rootId"`
+	Version            uint                        `json:"version"`
+	DoctorID           uuid.UUID                   `json:"doctorId"`
+	CitizenID          uuid.UUID                   `json:"citizenId"`
+	HospitalID         *uuid.UUID                  `json:"hospitalId"`
+	Name               string                      `json:"name"`
+	Code               string                      `json:"code"`
+	CreationDate       string                      `json:"creationDate"`
+	StartDate          string                      `json:"startDate"`
+	EndDate            string                      `json:"endDate"`
+	Refills            uint                        `json:"refills"`
+	RefillIntervalDays uint                        `json:"refillIntervalDays"`
+	Medicaments        []canonicalPrescriptionLine `json:"medicaments"`
+}
+
+type canonicalPrescriptionLine struct {
+	MedicamentID uuid.UUID `json:"medicamentId"`
+	Quantity     uint      `json:"quantity"`
+	DoseAmount   float32   `json:"doseAmount"`
+	DoseUnit     string    `json:"doseUnit"`
+	TimesPerDay  uint8     `json:"timesPerDay"`
+	TimesOfDay   string    `json:"timesOfDay"`
+	DurationDays uint16    `json:"durationDays"`
+	Route        string    `json:"route"`
+	Notes        string    `json:"notes"`
+}
+
+const canonicalTimeFormat = "2006-01-02T15:04:05Z"
+
+// canonicalizePrescription returns the bytes that are signed for the prescription
+func canonicalizePrescription(prescription *models.Prescription) ([]byte, error) {
+	canonical := canonicalPrescription{
+		ID:                 prescription.ID,
+		RootID:             prescription.RootID,
+		Version:            prescription.Version,
+		DoctorID:           prescription.DoctorID,
+		CitizenID:          prescription.CitizenID,
+		HospitalID:         prescription.HospitalID,
+		Name:               prescription.Name,
+		Code:               prescription.Code,
+		CreationDate:       prescription.CreationDate.UTC().Format(canonicalTimeFormat),
+		StartDate:          prescription.StartDate.UTC().Format(canonicalTimeFormat),
+		EndDate:            prescription.EndDate.UTC().Format(canonicalTimeFormat),
+		Refills:            prescription.Refills,
+		RefillIntervalDays: prescription.RefillIntervalDays,
+		Medicaments:        make([]canonicalPrescriptionLine, len(prescription.Medicaments)),
+	}
+
+	for i, medicament := range prescription.Medicaments {
+		canonical.Medicaments[i] = canonicalPrescriptionLine{
+			MedicamentID: medicament.MedicamentID,
+			Quantity:     medicament.Quantity,
+			DoseAmount:   medicament.DoseAmount,
+			DoseUnit:     string(medicament.DoseUnit),
+			TimesPerDay:  medicament.TimesPerDay,
+			TimesOfDay:   medicament.TimesOfDay,
+			DurationDays: medicament.DurationDays,
+			Route:        string(medicament.Route),
+			Notes:        medicament.Notes,
+		}
+	}
+
+	slices.SortFunc(canonical.Medicaments, func(a, b canonicalPrescriptionLine) int {
+		return strings.Compare(a.MedicamentID.String(), b.MedicamentID.String())
+	})
+
+	return json.Marshal(canonical)
+}
+
+// generateSigningKey creates a new active key pair for the doctor with the private key sealed
+// under the master key
+func generateSigningKey(masterKey string, doctorId uuid.UUID, key *models.DoctorSigningKey) error {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	keyId := uuid.New()
+
+	sealed, err := sealSigningKey(masterKey, keyId, privateKey.Seed())
+	if err != nil {
+		return err
+	}
+
+	*key = models.DoctorSigningKey{
+		ID:         keyId,
+		DoctorID:   doctorId,
+		PublicKey:  publicKey,
+		PrivateKey: sealed,
+		Status:     models.SigningKeyActive,
+		CreatedAt:  time.Now(),
+	}
+
+	return nil
+}
+
+// signPrescription signs the canonical form of the prescription with the doctor's active key
+func signPrescription(masterKey string, key *models.DoctorSigningKey, prescription *models.Prescription) error {
+	if key.Status != models.SigningKeyActive || key.DoctorID != prescription.DoctorID {
+		return ErrSigningKeyMissing
+	}
+
+	seed, err := openSigningKey(masterKey, key)
+	if err != nil {
+		return err
+	}
+
+	canonical, err := canonicalizePrescription(prescription)
+	if err != nil {
+		return err
+	}
+
+	prescription.SigningKeyID = &key.ID
+	prescription.Signature = ed25519.Sign(ed25519.NewKeyFromSeed(seed), canonical)
+
+	return nil
+}
+
+// verifyPrescriptionSignature checks the prescription against the key it names. The key must
+// be loaded with the prescription.
+func verifyPrescriptionSignature(prescription *models.Prescription) error {
+	if prescription.SigningKey == nil || len(prescription.Signature) == 0 {
+		return ErrPrescriptionUnsigned
+	}
+
+	if prescription.SigningKey.Status == models.SigningKeyRevoked {
+		return ErrSigningKeyRevoked
+	}
+
+	if prescription.SigningKey.DoctorID != prescription.DoctorID || len(prescription.SigningKey.PublicKey) != ed25519.PublicKeySize {
+		return ErrSignatureInvalid
+	}
+
+	canonical, err := canonicalizePrescription(prescription)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(prescription.SigningKey.PublicKey, canonical, prescription.Signature) {
+		return ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+func sealSigningKey(masterKey string, keyId uuid.UUID, seed []byte) ([]byte, error) {
+	aead, err := signingKeyCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, seed, keyId[:]), nil
+}
+
+func openSigningKey(masterKey string, key *models.DoctorSigningKey) ([]byte, error) {
+	aead, err := signingKeyCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key.PrivateKey) < aead.NonceSize() {
+		return nil, ErrSigningKeyCorrupted
+	}
+
+	nonce, sealed := key.PrivateKey[:aead.NonceSize()], key.PrivateKey[aead.NonceSize():]
+
+	seed, err := aead.Open(nil, nonce, sealed, key.ID[:])
+	if err != nil {
+		return nil, ErrSigningKeyCorrupted
+	}
+
+	return seed, nil
+}
+
+func signingKeyCipher(masterKey string) (cipher.AEAD, error) {
+	rawKey, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil || len(rawKey) != 32 {
+		return nil, ErrSigningMasterKeyInvalid
+	}
+
+	block, err := aes.NewCipher(rawKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
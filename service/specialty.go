@@ -0,0 +1,20 @@
+package service
+
+import (
+	"medico/dto"
+	"medico/models"
+)
+
+func specialtiesToDto(specialties []models.Specialty) []dto.ResponseSpecialty {
+	specialtiesDto := make([]dto.ResponseSpecialty, len(specialties))
+
+	for i, specialty := range specialties {
+		specialtiesDto[i] = dto.ResponseSpecialty{
+			ID:   specialty.ID,
+			Code: specialty.Code,
+			Name: specialty.Name,
+		}
+	}
+
+	return specialtiesDto
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"medico/models"
+	"strings"
+)
+
+// verificationCodeAlphabet leaves out characters that are easy to confuse when read aloud
+// or typed, such as 0 and O or 1 and I.
+const verificationCodeAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+const (
+	verificationCodeLength = 8
+	qrPayloadPrefix        = "MEDICO"
+	qrPayloadVersion       = "1"
+)
+
+// verificationCodeAttempts bounds how often a prescription is stored again with a fresh code
+// after its code collided with the code of another prescription
+const verificationCodeAttempts = 5
+
+// generateVerificationCode returns a random code formatted as XXXX-XXXX
+func generateVerificationCode() (string, error) {
+	random := make([]byte, verificationCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	code := make([]byte, verificationCodeLength)
+	for i, b := range random {
+		code[i] = verificationCodeAlphabet[int(b)%len(verificationCodeAlphabet)]
+	}
+
+	return formatVerificationCode(string(code)), nil
+}
+
+// storeWithUniqueCode runs store and, while it fails on a duplicate key, gives the prescription
+// a fresh verification code and runs it again.
+func storeWithUniqueCode(prescription *models.Prescription, store func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := store()
+		if !errors.Is(err, gorm.ErrDuplicatedKey) || attempt == verificationCodeAttempts {
+			return err
+		}
+
+		if prescription.Code, err = generateVerificationCode(); err != nil {
+			return err
+		}
+	}
+}
+
+// normalizeVerificationCode accepts a code typed in any case, with or without separators
+func normalizeVerificationCode(code string) (string, error) {
+	code = strings.ToUpper(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+
+	if len(code) != verificationCodeLength {
+		return "", ErrVerificationCodeInvalid
+	}
+
+	for _, c := range code {
+		if !strings.ContainsRune(verificationCodeAlphabet, c) {
+			return "", ErrVerificationCodeInvalid
+		}
+	}
+
+	return formatVerificationCode(code), nil
+}
+
+func formatVerificationCode(code string) string {
+	return code[:verificationCodeLength/2] + "-" + code[verificationCodeLength/2:]
+}
+
+// signQrPayload builds the QR content MEDICO:1:<prescription id>:<code>:<signature>
+func signQrPayload(secret string, prescriptionId uuid.UUID, code string) string {
+	message := qrPayloadVersion + ":" + prescriptionId.String() + ":" + code
+
+	return qrPayloadPrefix + ":" + message + ":" + qrPayloadSignature(secret, message)
+}
+
+// verifyQrPayload checks the signature of a QR payload and returns the prescription it points to
+func verifyQrPayload(secret string, payload string) (uuid.UUID, string, error) {
+	parts := strings.Split(payload, ":")
+	if len(parts) != 5 || parts[0] != qrPayloadPrefix || parts[1] != qrPayloadVersion {
+		return uuid.Nil, "", ErrQrPayloadInvalid
+	}
+
+	message := strings.Join(parts[1:4], ":")
+	if !hmac.Equal([]byte(parts[4]), []byte(qrPayloadSignature(secret, message))) {
+		return uuid.Nil, "", ErrQrPayloadInvalid
+	}
+
+	prescriptionId, err := uuid.Parse(parts[2])
+	if err != nil {
+		return uuid.Nil, "", ErrQrPayloadInvalid
+	}
+
+	return prescriptionId, parts[3], nil
+}
+
+func qrPayloadSignature(secret string, message string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}